@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"os"
 
 	"github.com/SUSE/telemetry/pkg/client"
 	"github.com/SUSE/telemetry/pkg/config"
@@ -12,11 +14,18 @@ import (
 
 // options is a struct of the options
 type options struct {
-	config  string
-	items   bool
-	bundles bool
-	reports bool
-	debug   bool
+	config      string
+	items       bool
+	bundles     bool
+	reports     bool
+	quarantined bool
+	managed     bool
+	evictions   bool
+	requeue     string
+	export      string
+	remove      bool
+	importPath  string
+	debug       bool
 }
 
 var opts options
@@ -67,6 +76,64 @@ func main() {
 		panic(err)
 	}
 
+	if opts.export != "" {
+		manifest, err := tc.ExportReports(opts.export, opts.remove)
+		if err != nil {
+			slog.Error(
+				"Failed to export reports from client datastore",
+				slog.String("archive", opts.export),
+				slog.String("error", err.Error()),
+			)
+			panic(err)
+		}
+
+		fmt.Printf("Exported %d Telemetry reports to %q.\n", len(manifest.Reports), opts.export)
+		for i, entry := range manifest.Reports {
+			fmt.Printf("Reports[%d]: %q\n", i, entry.ReportId)
+		}
+		return
+	}
+
+	if opts.importPath != "" {
+		// imported reports are submitted with this client's credentials
+		if err := tc.Register(); err != nil {
+			slog.Error(
+				"Failed to register TelemetryClient",
+				slog.String("error", err.Error()),
+			)
+			panic(err)
+		}
+
+		// reports that were rejected don't prevent the others being imported
+		manifest, err := tc.ImportReports(opts.importPath)
+		if err != nil && !errors.Is(err, client.ErrReportRejected) {
+			slog.Error(
+				"Failed to import reports",
+				slog.String("archive", opts.importPath),
+				slog.String("error", err.Error()),
+			)
+			panic(err)
+		}
+
+		fmt.Printf(
+			"Imported %d Telemetry reports from client %q.\n",
+			len(manifest.Reports),
+			manifest.ClientId,
+		)
+		for i, entry := range manifest.Reports {
+			fmt.Printf("Reports[%d]: %q\n", i, entry.ReportId)
+		}
+		if err != nil {
+			slog.Error(
+				"Some imported reports were rejected",
+				slog.String("archive", opts.importPath),
+				slog.String("error", err.Error()),
+			)
+			os.Exit(1)
+		}
+		return
+	}
+
 	processor := tc.Processor()
 
 	// this will be toggled to true if items, bundles or reports were found
@@ -135,6 +202,136 @@ func main() {
 		}
 	}
 
+	if opts.quarantined {
+		reportRows, err := processor.GetQuarantinedReportRows()
+		if err != nil {
+			slog.Error(
+				"Failed to retrieve quarantined reports from client datastore",
+				slog.String("error", err.Error()),
+			)
+			panic(err)
+		}
+
+		reportCount := len(reportRows)
+		if reportCount > 0 {
+			fmt.Printf("%d Quarantined telemetry reports found.\n", len(reportRows))
+			for i, reportRow := range reportRows {
+				stateRow, err := processor.GetReportState(reportRow)
+				if err != nil {
+					slog.Error(
+						"Failed to retrieve report state from client datastore",
+						slog.String("reportId", reportRow.ReportId),
+						slog.String("error", err.Error()),
+					)
+					panic(err)
+				}
+				fmt.Printf(
+					"Quarantined[%d]: %q attempts=%d updated=%s reason=%q\n",
+					i,
+					reportRow.ReportId,
+					stateRow.Attempts,
+					stateRow.UpdatedAt,
+					stateRow.Reason,
+				)
+			}
+
+			foundEntries = true
+		}
+	}
+
+	if opts.managed {
+		managedRows, err := processor.GetManagedClientRows()
+		if err != nil {
+			slog.Error(
+				"Failed to retrieve managed clients from client datastore",
+				slog.String("error", err.Error()),
+			)
+			panic(err)
+		}
+
+		managedCount := len(managedRows)
+		if managedCount > 0 {
+			fmt.Printf("%d Managed clients found.\n", len(managedRows))
+			for i, managedRow := range managedRows {
+				fmt.Printf(
+					"Managed[%d]: %q clientId=%q registered=%s\n",
+					i,
+					managedRow.SystemId,
+					managedRow.ClientId,
+					managedRow.RegisteredAt,
+				)
+			}
+
+			foundEntries = true
+		}
+	}
+
+	if opts.evictions {
+		evictionRows, err := processor.GetEvictionRows()
+		if err != nil {
+			slog.Error(
+				"Failed to retrieve evictions from client datastore",
+				slog.String("error", err.Error()),
+			)
+			panic(err)
+		}
+
+		evictionCount := len(evictionRows)
+		if evictionCount > 0 {
+			fmt.Printf("%d Telemetry evictions found.\n", len(evictionRows))
+			for i, evictionRow := range evictionRows {
+				fmt.Printf(
+					"Evicted[%d]: %q class=%s reason=%s items=%d bytes=%d oldest=%s newest=%s evicted=%s\n",
+					i,
+					evictionRow.ItemType,
+					evictionRow.ItemClass.String(),
+					evictionRow.Reason,
+					evictionRow.ItemCount,
+					evictionRow.ItemBytes,
+					evictionRow.OldestTimestamp,
+					evictionRow.NewestTimestamp,
+					evictionRow.EvictedAt,
+				)
+			}
+
+			foundEntries = true
+		}
+	}
+
+	if opts.requeue != "" {
+		reportRows, err := processor.GetQuarantinedReportRows()
+		if err != nil {
+			slog.Error(
+				"Failed to retrieve quarantined reports from client datastore",
+				slog.String("error", err.Error()),
+			)
+			panic(err)
+		}
+
+		requeued := 0
+		for _, reportRow := range reportRows {
+			if opts.requeue != "all" && opts.requeue != reportRow.ReportId {
+				continue
+			}
+
+			if err := processor.RequeueReport(reportRow); err != nil {
+				slog.Error(
+					"Failed to re-queue quarantined report",
+					slog.String("reportId", reportRow.ReportId),
+					slog.String("error", err.Error()),
+				)
+				panic(err)
+			}
+			fmt.Printf("Re-queued report %q\n", reportRow.ReportId)
+			requeued++
+		}
+
+		if requeued == 0 {
+			fmt.Printf("No quarantined reports matching %q found\n", opts.requeue)
+		}
+		return
+	}
+
 	if !foundEntries {
 		fmt.Println("No items, bundles or reports found in client datastore")
 	}
@@ -146,11 +343,31 @@ func init() {
 	flag.BoolVar(&opts.items, "items", false, "Report details on telemetry data items datastore")
 	flag.BoolVar(&opts.bundles, "bundles", false, "Report details on telemetry bundles datastore")
 	flag.BoolVar(&opts.reports, "reports", false, "Report details on telemetry reports datastore")
+	flag.BoolVar(&opts.quarantined, "quarantined", false, "Report details on quarantined telemetry reports")
+	flag.BoolVar(&opts.managed, "managed", false, "Report details on managed clients that telemetry is synthesized for")
+	flag.BoolVar(&opts.evictions, "evictions", false, "Report details on staged telemetry evicted to enforce the staging limits")
+	flag.StringVar(&opts.requeue, "requeue", "", "Re-queue the specified quarantined report id, or all quarantined reports if \"all\"")
+	flag.StringVar(&opts.export, "export", "", "Export pending telemetry reports to the specified archive")
+	flag.BoolVar(&opts.remove, "remove", false, "Remove the exported telemetry reports from the datastore, when used with '-export'")
+	flag.StringVar(&opts.importPath, "import", "", "Verify and submit the telemetry reports in the specified archive")
 	flag.Parse()
 
-	if !(opts.items || opts.bundles || opts.reports) {
+	if opts.export != "" && opts.importPath != "" {
+		fmt.Fprintln(os.Stderr, "Error: Only one of '-export' and '-import' can be specified.")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if opts.remove && opts.export == "" {
+		fmt.Fprintln(os.Stderr, "Error: '-remove' can only be specified with '-export'.")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if !(opts.items || opts.bundles || opts.reports || opts.quarantined || opts.managed || opts.evictions || opts.requeue != "") {
 		opts.items = true
 		opts.bundles = true
 		opts.reports = true
+		opts.quarantined = true
 	}
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -24,6 +25,7 @@ type options struct {
 	nosubmit     bool
 	tags         types.Tags
 	telemetry    types.TelemetryType
+	class        types.TelemetryClass
 	jsonFiles    []string
 	debug        bool
 }
@@ -112,7 +114,11 @@ func main() {
 			panic(err)
 		}
 
-		err = tc.Generate(opts.telemetry, types.NewTelemetryBlob(jsonContent), opts.tags)
+		err = tc.GenerateWithClass(opts.telemetry, opts.class, types.NewTelemetryBlob(jsonContent), opts.tags)
+		if errors.Is(err, client.ErrTelemetryClassNotAllowed) || errors.Is(err, client.ErrTelemetryTypeNotAllowed) {
+			fmt.Fprintf(os.Stderr, "Error: Telemetry from %q not added: %s.\n", filepath.Base(jsonFile), err.Error())
+			os.Exit(1)
+		}
 		if err != nil {
 			slog.Error(
 				"Error generating telemetry data item",
@@ -123,9 +129,10 @@ func main() {
 		}
 
 		fmt.Printf(
-			"Added telemetry data from %q as type %q with tags %s to local datastore\n",
+			"Added telemetry data from %q as type %q, class %s, with tags %s to local datastore\n",
 			filepath.Base(jsonFile),
 			opts.telemetry,
+			opts.class.String(),
 			opts.tags,
 		)
 	}
@@ -172,6 +179,7 @@ func main() {
 }
 
 func init() {
+	var class string
 	flag.StringVar(&opts.config, "config", config.DEF_CFG_PATH, "Path to config file to read")
 	flag.BoolVar(&opts.debug, "debug", false, "Whether to enable debug level logging.")
 	flag.BoolVar(&opts.dryrun, "dryrun", false, "Process provided JSON files but do add them to the telemetry staging area.")
@@ -182,8 +190,16 @@ func init() {
 	flag.BoolVar(&opts.nosubmit, "nosubmit", false, "Do not submit any Telemetry reports")
 	flag.Var(&opts.tags, "tag", "Optional tags to be associated with the submitted telemetry data")
 	flag.Var(&opts.telemetry, "telemetry", "The type of the telemetry being submitted")
+	flag.StringVar(&class, "class", "MANDATORY", "The class of the telemetry being submitted, one of MANDATORY, OPT-OUT or OPT-IN")
 	flag.Parse()
 
+	var err error
+	if opts.class, err = types.TelemetryClassFromString(class); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Invalid value specified for '-class': %s.\n", err.Error())
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	if (opts.telemetry) == "" {
 		fmt.Fprintln(os.Stderr, "Error: No value specified for '-telemetry'.")
 		flag.Usage()
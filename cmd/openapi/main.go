@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SUSE/telemetry/pkg/logging"
+	"github.com/SUSE/telemetry/pkg/openapi"
+)
+
+// options is a struct of the options
+type options struct {
+	output  string
+	format  string
+	servers []string
+	debug   bool
+}
+
+var opts options
+
+func main() {
+	if err := logging.SetupBasicLogging(opts.debug); err != nil {
+		panic(err)
+	}
+
+	slog.Debug("OpenAPI", slog.Any("options", opts))
+
+	doc, err := openapi.Generate()
+	if err != nil {
+		slog.Error(
+			"Failed to generate OpenAPI document",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+
+	for _, server := range opts.servers {
+		doc.AddServer(server, "")
+	}
+
+	// default the format based upon the output file extension
+	format := opts.format
+	if format == "" {
+		format = "yaml"
+		if filepath.Ext(opts.output) == ".json" {
+			format = "json"
+		}
+	}
+
+	var data []byte
+	switch strings.ToLower(format) {
+	case "json":
+		data, err = doc.JSON()
+	case "yaml", "yml":
+		data, err = doc.YAML()
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		slog.Error(
+			"Failed to encode OpenAPI document",
+			slog.String("format", format),
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+
+	if opts.output == "" || opts.output == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(opts.output, data, 0644)
+	}
+	if err != nil {
+		slog.Error(
+			"Failed to write OpenAPI document",
+			slog.String("output", opts.output),
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	flag.StringVar(&opts.output, "output", "-", "Path of the file to write the OpenAPI document to, or - for stdout.")
+	flag.StringVar(&opts.format, "format", "", "Format of the OpenAPI document, json or yaml, defaulting based upon the output file extension.")
+	flag.Func("server", "Server URL, e.g. a telemetry_base_url, to include in the OpenAPI document; may be repeated.", func(value string) error {
+		opts.servers = append(opts.servers, value)
+		return nil
+	})
+	flag.BoolVar(&opts.debug, "debug", false, "Whether to enable debug level logging.")
+	flag.Parse()
+}
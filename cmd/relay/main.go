@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/SUSE/telemetry/pkg/logging"
+	"github.com/SUSE/telemetry/pkg/relay"
+)
+
+// options is a struct of the options
+type options struct {
+	config string
+	listen string
+	debug  bool
+}
+
+var opts options
+
+func main() {
+	if err := logging.SetupBasicLogging(opts.debug); err != nil {
+		panic(err)
+	}
+
+	slog.Debug("Relay", slog.Any("options", opts))
+
+	cfg, err := config.NewConfig(opts.config)
+	if err != nil {
+		slog.Error(
+			"Failed to load config",
+			slog.String("config", opts.config),
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// setup logging based upon config settings
+	lm := logging.NewLogManager()
+	if err := lm.Config(&cfg.Logging); err != nil {
+		panic(err)
+	}
+
+	// override config log level to debug if option specified
+	if opts.debug {
+		lm.SetLevel("DEBUG")
+		slog.Debug("Debug mode enabled")
+	}
+
+	if err := lm.Setup(); err != nil {
+		panic(err)
+	}
+
+	// override config listen address if option specified
+	if opts.listen != "" {
+		cfg.Relay.Listen = opts.listen
+	}
+
+	r, err := relay.NewRelay(cfg)
+	if err != nil {
+		slog.Error(
+			"Failed to instantiate Relay",
+			slog.String("config", opts.config),
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// reload the consent settings from the config file on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if err := r.Client().ReloadConsentContext(ctx); err != nil {
+					slog.Warn(
+						"Failed to reload consent settings",
+						slog.String("config", opts.config),
+						slog.String("error", err.Error()),
+					)
+				}
+			}
+		}
+	}()
+
+	if err := r.Run(ctx); err != nil {
+		slog.Error(
+			"Relay failed",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	flag.StringVar(&opts.config, "config", config.DEF_CFG_PATH, "Path to config file to read")
+	flag.StringVar(&opts.listen, "listen", "", "Address to listen on for client requests, overriding the config setting.")
+	flag.BoolVar(&opts.debug, "debug", false, "Whether to enable debug level logging.")
+	flag.Parse()
+}
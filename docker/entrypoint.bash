@@ -33,7 +33,8 @@ Notes:
   * If no <tool> is specified then this help message is shown.
   * Any certs that are found in the directory specified by the
     TELEMETRY_CERTS_DIR env var will be added to the system
-    certs store.
+    certs store, and are also trusted via the generated config's
+    transport ca_dirs setting.
   * An appropriate config file, specified by the TELEMETRY_CONFIG
     env var, will be generated using the TELEMETRY_* env vars,
     and automatically specified via a --config <config> option to
@@ -114,6 +115,13 @@ case "${ds_params}" in
 	;;
 esac
 
+# trust any certs provided in the certs directory
+if [[ -d "${certs_dir}" ]]; then
+	ca_dirs="\"${certs_dir}\""
+else
+	ca_dirs=""
+fi
+
 # verify that the datastore directory exists if needed
 if [[ -n "${ds_dir}" ]] && [[ ! -d "${ds_dir}" ]]; then
     echo "Error: '${ds_dir}' directory not found"
@@ -154,12 +162,16 @@ logging:
   level: ${log_level}
   location: stderr
   style: text
+transport:
+  ca_dirs: [${ca_dirs}]
 _EOF_
 	chmod 644 "${config}"
 	chown ${user}:${group} "${config}"
 fi
 
-# install additional certs if provided
+# install additional certs if provided, so that they are trusted even
+# if an existing config, which may not specify them in its transport
+# ca_dirs setting, is being used
 if [[ -d "${certs_dir}" ]]; then
 	certs=( $(ls -1 ${certs_dir}) )
 	if (( ${#certs[@]} )); then
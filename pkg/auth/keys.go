@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Key is a trusted public key that auth token signatures can be verified
+// against, optionally restricted to tokens with a matching key id or
+// signing algorithm.
+type Key struct {
+	Id        string // key id, matched against the token's kid header
+	Algorithm string // signing algorithm, matched against the token's alg header
+	PublicKey crypto.PublicKey
+}
+
+// LoadPEMKeys loads the public keys from a PEM encoded file, which may
+// contain PKIX or PKCS1 public keys, or certificates.
+func LoadPEMKeys(path string) (keys []Key, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PEM file %q: %w", path, err)
+	}
+
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		var publicKey crypto.PublicKey
+		switch block.Type {
+		case "PUBLIC KEY":
+			publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				publicKey = cert.PublicKey
+			}
+		default:
+			// ignore other blocks, such as private keys
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s in PEM file %q: %w", block.Type, path, err)
+		}
+
+		keys = append(keys, Key{PublicKey: publicKey})
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys found in PEM file %q", path)
+	}
+
+	return
+}
+
+// jwk is a JSON Web Key, as defined by RFC 7517, with the parameters for
+// RSA, EC and OKP (Ed25519) public keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+
+	// RSA parameters
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC and OKP parameters
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwks is a JSON Web Key Set, as defined by RFC 7517.
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+func decodeB64(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(value)
+}
+
+func (k *jwk) publicKey() (publicKey crypto.PublicKey, err error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeB64(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := decodeB64(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("unsupported RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+		x, err := decodeB64(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := decodeB64(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		ecKey := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(ecKey.X, ecKey.Y) {
+			return nil, fmt.Errorf("EC point is not on curve %q", k.Crv)
+		}
+		return ecKey, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", k.Crv)
+		}
+		x, err := decodeB64(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// LoadJWKS loads the public keys from a JSON Web Key Set file, skipping
+// any keys that are not intended for signature verification.
+func LoadJWKS(path string) (keys []Key, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file %q: %w", path, err)
+	}
+
+	var keySet jwks
+	if err = json.Unmarshal(data, &keySet); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file %q: %w", path, err)
+	}
+
+	for i, k := range keySet.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		publicKey, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d (kid %q) in JWKS file %q: %w", i, k.Kid, path, err)
+		}
+
+		keys = append(keys, Key{Id: k.Kid, Algorithm: k.Alg, PublicKey: publicKey})
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys found in JWKS file %q", path)
+	}
+
+	return
+}
@@ -0,0 +1,152 @@
+// Package auth provides verification of auth token signatures against
+// trusted public keys, along with checks of the token issuer and audience.
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// returned when no trusted public keys have been configured
+	ErrNoVerificationKeys = errors.New("no token verification keys configured")
+
+	// returned when none of the trusted keys can verify a token
+	ErrNoMatchingKey = errors.New("no matching token verification key")
+)
+
+// signing methods that can be verified using public keys; symmetric
+// methods are never accepted, as that would allow anyone with access to
+// a public key to forge tokens
+var publicKeyMethods = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodRS384.Alg(),
+	jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodPS256.Alg(),
+	jwt.SigningMethodPS384.Alg(),
+	jwt.SigningMethodPS512.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodES384.Alg(),
+	jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+// Verifier verifies auth tokens against a set of trusted public keys.
+type Verifier struct {
+	keys     []Key
+	issuer   string
+	audience string
+}
+
+// NewVerifier creates a verifier using the keys, issuer and audience
+// specified by the token verification config.
+func NewVerifier(cfg *config.TokenVerifyConfig) (v *Verifier, err error) {
+	v = &Verifier{
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+	}
+
+	for _, path := range cfg.PublicKeys {
+		keys, err := LoadPEMKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = append(v.keys, keys...)
+	}
+
+	for _, path := range cfg.JWKSFiles {
+		keys, err := LoadJWKS(path)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = append(v.keys, keys...)
+	}
+
+	if len(v.keys) == 0 {
+		return nil, ErrNoVerificationKeys
+	}
+
+	return
+}
+
+// NewVerifierFromKeys creates a verifier using the specified keys, issuer
+// and audience, with empty issuer and audience values not being checked.
+func NewVerifierFromKeys(keys []Key, issuer, audience string) (v *Verifier, err error) {
+	if len(keys) == 0 {
+		return nil, ErrNoVerificationKeys
+	}
+
+	return &Verifier{keys: keys, issuer: issuer, audience: audience}, nil
+}
+
+// keyMatchesMethod returns true if the key is of the appropriate type for
+// the signing method.
+func keyMatchesMethod(key Key, method jwt.SigningMethod) bool {
+	if key.Algorithm != "" && key.Algorithm != method.Alg() {
+		return false
+	}
+
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.PublicKey.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		_, ok := key.PublicKey.(*ecdsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodEd25519:
+		_, ok := key.PublicKey.(ed25519.PublicKey)
+		return ok
+	}
+
+	return false
+}
+
+// keyFunc selects the candidate keys for verifying the token, limited to
+// keys with a matching key id if the token specifies one.
+func (v *Verifier) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	var keySet jwt.VerificationKeySet
+	for _, key := range v.keys {
+		if kid != "" && key.Id != "" && key.Id != kid {
+			continue
+		}
+		if keyMatchesMethod(key, token.Method) {
+			keySet.Keys = append(keySet.Keys, key.PublicKey)
+		}
+	}
+
+	if len(keySet.Keys) == 0 {
+		return nil, fmt.Errorf("%w: alg %q, kid %q", ErrNoMatchingKey, token.Method.Alg(), kid)
+	}
+
+	return keySet, nil
+}
+
+// Verify parses the token into the claims, verifying that its signature
+// was generated by one of the trusted keys, that it hasn't expired, and
+// that it has the expected issuer and audience, if configured.
+func (v *Verifier) Verify(tokenString string, claims jwt.Claims) (token *jwt.Token, err error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(publicKeyMethods),
+	}
+	if v.issuer != "" {
+		options = append(options, jwt.WithIssuer(v.issuer))
+	}
+	if v.audience != "" {
+		options = append(options, jwt.WithAudience(v.audience))
+	}
+
+	token, err = jwt.ParseWithClaims(tokenString, claims, v.keyFunc, options...)
+	if err != nil {
+		return nil, fmt.Errorf("auth token verification failed: %w", err)
+	}
+
+	return
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	testIssuer   = "telemetry-auth-test"
+	testAudience = "telemetry-auth-test-clients"
+)
+
+type VerifierTestSuite struct {
+	suite.Suite
+
+	tmpDir string
+
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	edKey  ed25519.PrivateKey
+}
+
+func (t *VerifierTestSuite) SetupSuite() {
+	var err error
+
+	t.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	t.Require().NoError(err)
+
+	t.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	t.Require().NoError(err)
+
+	_, t.edKey, err = ed25519.GenerateKey(rand.Reader)
+	t.Require().NoError(err)
+}
+
+func (t *VerifierTestSuite) SetupTest() {
+	t.tmpDir = t.T().TempDir()
+}
+
+// writePEM writes the public key to a PEM file in the test directory
+func (t *VerifierTestSuite) writePEM(name string, publicKey crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	t.Require().NoError(err)
+
+	path := filepath.Join(t.tmpDir, name)
+	t.Require().NoError(os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+	return path
+}
+
+func b64(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+// writeJWKS writes the EC and Ed25519 public keys to a JWKS file in the
+// test directory, along with an encryption key that should be ignored
+func (t *VerifierTestSuite) writeJWKS(name string) string {
+	ecPub := t.ecKey.PublicKey
+	keySet := map[string]any{
+		"keys": []map[string]string{
+			{
+				"kty": "EC",
+				"kid": "ec-key",
+				"use": "sig",
+				"crv": "P-256",
+				"x":   b64(ecPub.X.FillBytes(make([]byte, 32))),
+				"y":   b64(ecPub.Y.FillBytes(make([]byte, 32))),
+			},
+			{
+				"kty": "OKP",
+				"kid": "ed-key",
+				"alg": "EdDSA",
+				"crv": "Ed25519",
+				"x":   b64(t.edKey.Public().(ed25519.PublicKey)),
+			},
+			{
+				"kty": "RSA",
+				"kid": "enc-key",
+				"use": "enc",
+				"n":   b64(t.rsaKey.N.Bytes()),
+				"e":   b64(big.NewInt(int64(t.rsaKey.E)).Bytes()),
+			},
+		},
+	}
+	data, err := json.Marshal(keySet)
+	t.Require().NoError(err)
+
+	path := filepath.Join(t.tmpDir, name)
+	t.Require().NoError(os.WriteFile(path, data, 0600))
+	return path
+}
+
+func (t *VerifierTestSuite) sign(method jwt.SigningMethod, key any, kid string, claims jwt.RegisteredClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	t.Require().NoError(err)
+	return signed
+}
+
+func validClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Issuer:    testIssuer,
+		Audience:  jwt.ClaimStrings{testAudience},
+		Subject:   "1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+}
+
+func (t *VerifierTestSuite) verifier() *Verifier {
+	v, err := NewVerifier(&config.TokenVerifyConfig{
+		PublicKeys: []string{t.writePEM("rsa.pem", t.rsaKey.Public())},
+		JWKSFiles:  []string{t.writeJWKS("keys.jwks")},
+		Issuer:     testIssuer,
+		Audience:   testAudience,
+	})
+	t.Require().NoError(err)
+	return v
+}
+
+func (t *VerifierTestSuite) TestVerifyTrustedKeys() {
+	v := t.verifier()
+
+	tokens := map[string]string{
+		"RS256 from PEM":  t.sign(jwt.SigningMethodRS256, t.rsaKey, "", validClaims()),
+		"PS384 from PEM":  t.sign(jwt.SigningMethodPS384, t.rsaKey, "any-kid", validClaims()),
+		"ES256 from JWKS": t.sign(jwt.SigningMethodES256, t.ecKey, "ec-key", validClaims()),
+		"ES256 no kid":    t.sign(jwt.SigningMethodES256, t.ecKey, "", validClaims()),
+		"EdDSA from JWKS": t.sign(jwt.SigningMethodEdDSA, t.edKey, "ed-key", validClaims()),
+	}
+	for name, token := range tokens {
+		var claims jwt.RegisteredClaims
+		_, err := v.Verify(token, &claims)
+		t.NoError(err, name)
+		t.Equal("1", claims.Subject, name)
+	}
+}
+
+func (t *VerifierTestSuite) TestVerifyRejectsUntrustedTokens() {
+	v := t.verifier()
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	t.Require().NoError(err)
+
+	expired := validClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+	wrongIssuer := validClaims()
+	wrongIssuer.Issuer = "someone-else"
+
+	wrongAudience := validClaims()
+	wrongAudience.Audience = jwt.ClaimStrings{"other-clients"}
+
+	valid := t.sign(jwt.SigningMethodES256, t.ecKey, "ec-key", validClaims())
+	parts := strings.Split(valid, ".")
+	tamperedClaims, err := json.Marshal(map[string]any{"iss": testIssuer, "aud": testAudience, "sub": "2"})
+	t.Require().NoError(err)
+
+	tokens := map[string]string{
+		"untrusted key":   t.sign(jwt.SigningMethodES256, otherKey, "", validClaims()),
+		"wrong kid":       t.sign(jwt.SigningMethodEdDSA, t.edKey, "ec-key", validClaims()),
+		"expired":         t.sign(jwt.SigningMethodRS256, t.rsaKey, "", expired),
+		"wrong issuer":    t.sign(jwt.SigningMethodRS256, t.rsaKey, "", wrongIssuer),
+		"wrong audience":  t.sign(jwt.SigningMethodRS256, t.rsaKey, "", wrongAudience),
+		"symmetric":       t.sign(jwt.SigningMethodHS256, []byte("secret"), "", validClaims()),
+		"tampered claims": parts[0] + "." + b64(tamperedClaims) + "." + parts[2],
+		"unsigned":        t.sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", validClaims()),
+	}
+	for name, token := range tokens {
+		var claims jwt.RegisteredClaims
+		_, err := v.Verify(token, &claims)
+		t.Error(err, name)
+	}
+}
+
+func (t *VerifierTestSuite) TestNewVerifierErrors() {
+	_, err := NewVerifier(&config.TokenVerifyConfig{})
+	t.ErrorIs(err, ErrNoVerificationKeys)
+
+	_, err = NewVerifier(&config.TokenVerifyConfig{PublicKeys: []string{filepath.Join(t.tmpDir, "missing.pem")}})
+	t.Error(err, "missing PEM file should fail")
+
+	notPEM := filepath.Join(t.tmpDir, "not.pem")
+	t.Require().NoError(os.WriteFile(notPEM, []byte("not a PEM file"), 0600))
+	_, err = NewVerifier(&config.TokenVerifyConfig{PublicKeys: []string{notPEM}})
+	t.Error(err, "PEM file without keys should fail")
+
+	badJWKS := filepath.Join(t.tmpDir, "bad.jwks")
+	t.Require().NoError(os.WriteFile(badJWKS, []byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"AA","y":"AA"}]}`), 0600))
+	_, err = NewVerifier(&config.TokenVerifyConfig{JWKSFiles: []string{badJWKS}})
+	t.Error(err, "JWKS file with an invalid key should fail")
+
+	_, err = NewVerifierFromKeys(nil, testIssuer, "")
+	t.ErrorIs(err, ErrNoVerificationKeys)
+}
+
+func TestVerifierTestSuite(t *testing.T) {
+	suite.Run(t, new(VerifierTestSuite))
+}
@@ -0,0 +1,684 @@
+package client
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	telemetrylib "github.com/SUSE/telemetry/pkg/lib"
+	"github.com/SUSE/telemetry/pkg/restapi"
+	"github.com/SUSE/telemetry/pkg/types"
+)
+
+const (
+	// report archive layout
+	REPORT_ARCHIVE_VERSION     = 1
+	REPORT_ARCHIVE_MANIFEST    = `manifest.json`
+	REPORT_ARCHIVE_REPORTS_DIR = `reports`
+
+	// permissions used for report archives
+	REPORT_ARCHIVE_PERM = 0640
+
+	// upper limit on the size of any file in a report archive
+	REPORT_ARCHIVE_MAX_ENTRY_SIZE = 64 << 20
+
+	// upper limit on the total size of the reports that ReadReportArchive
+	// will load into memory
+	REPORT_ARCHIVE_MAX_TOTAL_SIZE = 256 << 20
+)
+
+// ReportArchiveManifest describes the contents of a report archive.
+type ReportArchiveManifest struct {
+	Version   int                  `json:"version"`
+	ClientId  string               `json:"clientId"`
+	CreatedAt string               `json:"createdAt"`
+	Reports   []ReportArchiveEntry `json:"reports"`
+}
+
+// ReportArchiveEntry describes a report stored in a report archive; the
+// checksum is the report's footer checksum, as verified by the report's
+// VerifyChecksum(), while the SHA256 digest covers the report file.
+type ReportArchiveEntry struct {
+	ReportId string `json:"reportId"`
+	File     string `json:"file"`
+	Size     int    `json:"size"`
+	Checksum string `json:"checksum"`
+	Sha256   string `json:"sha256"`
+}
+
+// limits enforced on report archives, which tests can lower
+var (
+	reportArchiveMaxEntrySize int64 = REPORT_ARCHIVE_MAX_ENTRY_SIZE
+	reportArchiveMaxTotalSize int64 = REPORT_ARCHIVE_MAX_TOTAL_SIZE
+)
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// measureReport writes the staged report to a hasher, so that it need not
+// be held in memory, returning a summary of the report, without the data
+// items' content, along with its size and SHA256 digest.
+func (tc *TelemetryClient) measureReport(ctx context.Context, reportRow *telemetrylib.TelemetryReportRow) (summary *telemetrylib.TelemetryReport, size int64, digest string, err error) {
+	hasher := sha256.New()
+	summary, size, err = tc.processor.WriteReportContext(ctx, reportRow, hasher)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	return summary, size, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func (tc *TelemetryClient) ExportReports(archivePath string, remove bool) (manifest *ReportArchiveManifest, err error) {
+	return tc.ExportReportsContext(context.Background(), archivePath, remove)
+}
+
+// ExportReportsContext writes the pending reports to a gzip compressed tar
+// archive at the specified path, along with a manifest describing them.
+// Each report is streamed from the datastore into the archive, so that the
+// reports need not be held in memory. Reports that are larger than
+// REPORT_ARCHIVE_MAX_ENTRY_SIZE are split, as they would be if the server
+// rejected them as too large, and reports that would take the archive
+// over REPORT_ARCHIVE_MAX_TOTAL_SIZE are left for a later export. The
+// exported reports remain staged, and will still be submitted by this
+// client, unless remove is true, in which case they are recorded in the
+// submission history and removed from the datastore, as they will be
+// submitted from wherever the archive is imported.
+func (tc *TelemetryClient) ExportReportsContext(ctx context.Context, archivePath string, remove bool) (manifest *ReportArchiveManifest, err error) {
+	reportRows, err := tc.processor.GetPendingReportRowsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve pending reports: %w", err)
+	}
+
+	manifest = &ReportArchiveManifest{
+		Version:   REPORT_ARCHIVE_VERSION,
+		ClientId:  tc.ClientId(),
+		CreatedAt: types.Now().String(),
+		Reports:   []ReportArchiveEntry{},
+	}
+
+	var exportedRows []*telemetrylib.TelemetryReportRow
+	var exportedReports []*telemetrylib.TelemetryReport
+	var totalSize int64
+	var deferred int
+
+	// export each pending report, including any reports that result from
+	// splitting reports that were too large for the archive
+	for i := 0; i < len(reportRows); i++ {
+		reportRow := reportRows[i]
+
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		summary, size, digest, err := tc.measureReport(ctx, reportRow)
+		if err != nil {
+			// corrupted reports are quarantined rather than exported
+			if errors.Is(err, telemetrylib.ErrChecksumMismatch) {
+				if err := tc.processor.QuarantineReportContext(ctx, reportRow, err.Error()); err != nil {
+					return nil, fmt.Errorf("failed to quarantine report %q: %w", reportRow.ReportId, err)
+				}
+				continue
+			}
+			return nil, fmt.Errorf("failed to generate report %q: %w", reportRow.ReportId, err)
+		}
+
+		// split reports that are too large to be imported
+		if size > reportArchiveMaxEntrySize {
+			splitRows, splitErr := tc.processor.SplitReportContext(ctx, reportRow)
+			if splitErr != nil {
+				// a report that can't be split further can never be
+				// exported
+				if errors.Is(splitErr, telemetrylib.ErrReportNotSplittable) {
+					if err := tc.processor.QuarantineReportContext(ctx, reportRow, splitErr.Error()); err != nil {
+						return nil, fmt.Errorf("failed to quarantine report %q: %w", reportRow.ReportId, err)
+					}
+					continue
+				}
+				return nil, fmt.Errorf("failed to split report %q: %w", reportRow.ReportId, splitErr)
+			}
+
+			slog.Info(
+				"Report too large for report archive, split for export",
+				slog.String("reportId", reportRow.ReportId),
+			)
+			reportRows = append(reportRows, splitRows...)
+			continue
+		}
+
+		// leave reports that don't fit in this archive for a later export
+		if totalSize+size > reportArchiveMaxTotalSize {
+			deferred++
+			continue
+		}
+		totalSize += size
+
+		manifest.Reports = append(manifest.Reports, ReportArchiveEntry{
+			ReportId: reportRow.ReportId,
+			File:     path.Join(REPORT_ARCHIVE_REPORTS_DIR, reportRow.ReportId+".json"),
+			Size:     int(size),
+			Checksum: summary.Footer.Checksum,
+			Sha256:   digest,
+		})
+		exportedRows = append(exportedRows, reportRow)
+		exportedReports = append(exportedReports, summary)
+	}
+
+	err = writeReportArchive(archivePath, manifest, func(i int, w io.Writer) error {
+		_, _, err := tc.processor.WriteReportContext(ctx, exportedRows[i], w)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if remove {
+		// the exported reports will be submitted from wherever the archive
+		// is imported, so record them as submitted to the archive and remove
+		// them from the datastore
+		for i, reportRow := range exportedRows {
+			submission := telemetrylib.NewTelemetrySubmissionRow(
+				exportedReports[i],
+				archivePath,
+				manifest.Reports[i].Size,
+				1,
+				0,
+				types.Now(),
+			)
+			if err := tc.processor.RecordSubmissionContext(ctx, submission); err != nil {
+				slog.Warn(
+					"Failed to record report export",
+					slog.String("reportId", reportRow.ReportId),
+					slog.String("err", err.Error()),
+				)
+			}
+
+			if err = tc.processor.DeleteReportContext(ctx, reportRow); err != nil {
+				return nil, fmt.Errorf("failed to delete exported report %q: %w", reportRow.ReportId, err)
+			}
+		}
+	}
+
+	if deferred > 0 {
+		slog.Warn(
+			"Reports left for a later export, as they would exceed the report archive size limit",
+			slog.Int("reports", deferred),
+			slog.Int64("limit", reportArchiveMaxTotalSize),
+		)
+	}
+
+	slog.Info(
+		"Exported reports",
+		slog.String("archive", archivePath),
+		slog.Int("reports", len(manifest.Reports)),
+	)
+
+	return
+}
+
+// reportArchiveWriter writes the content of the i'th report listed in a
+// report archive manifest
+type reportArchiveWriter func(i int, w io.Writer) error
+
+// writeReportArchive writes the manifest and report contents to a gzip
+// compressed tar archive, via a temporary file that is renamed once the
+// archive is complete, failing if any report's content doesn't match its
+// manifest entry, e.g. because it changed since the manifest was created.
+func writeReportArchive(archivePath string, manifest *ReportArchiveManifest, writeReport reportArchiveWriter) (err error) {
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to JSON marshal report archive manifest: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(archivePath), "."+filepath.Base(archivePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create report archive %q: %w", archivePath, err)
+	}
+	tmpPath := tmpFile.Name()
+	defer func() {
+		if err != nil {
+			tmpFile.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	gzWriter := gzip.NewWriter(tmpFile)
+	tarWriter := tar.NewWriter(gzWriter)
+	modTime := time.Now()
+
+	addFile := func(name string, size int64, write func(w io.Writer) error) error {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    REPORT_ARCHIVE_PERM,
+			Size:    size,
+			ModTime: modTime,
+		}
+		if err := tarWriter.WriteHeader(hdr); err != nil {
+			return err
+		}
+		return write(tarWriter)
+	}
+
+	// the manifest is written first so that it can be inspected, and the
+	// reports verified as they are read, without reading the entire archive
+	err = addFile(REPORT_ARCHIVE_MANIFEST, int64(len(manifestJSON)), func(w io.Writer) error {
+		_, err := w.Write(manifestJSON)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add manifest to report archive: %w", err)
+	}
+
+	for i, entry := range manifest.Reports {
+		err = addFile(entry.File, int64(entry.Size), func(w io.Writer) error {
+			// the tar writer fails if the size doesn't match the header
+			hasher := sha256.New()
+			if err := writeReport(i, io.MultiWriter(w, hasher)); err != nil {
+				return err
+			}
+			if hex.EncodeToString(hasher.Sum(nil)) != entry.Sha256 {
+				return fmt.Errorf("report %q content doesn't match manifest", entry.ReportId)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add report %q to report archive: %w", entry.ReportId, err)
+		}
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finalise report archive: %w", err)
+	}
+
+	if err = gzWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finalise report archive: %w", err)
+	}
+
+	if err = tmpFile.Chmod(REPORT_ARCHIVE_PERM); err != nil {
+		return fmt.Errorf("failed to set permissions on report archive: %w", err)
+	}
+
+	if err = tmpFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync report archive: %w", err)
+	}
+
+	if err = tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close report archive: %w", err)
+	}
+
+	if err = os.Rename(tmpPath, archivePath); err != nil {
+		return fmt.Errorf("failed to rename report archive %q: %w", tmpPath, err)
+	}
+
+	return
+}
+
+// ReadReportArchive reads the report archive at the specified path,
+// verifying that the archive contents match the manifest and that each
+// report is valid with a matching checksum, returning the manifest and
+// the reports in manifest order. As all of the reports are loaded into
+// memory, archives whose manifest lists more than
+// REPORT_ARCHIVE_MAX_TOTAL_SIZE bytes of reports are rejected; use
+// WalkReportArchive to process larger archives.
+func ReadReportArchive(archivePath string) (manifest *ReportArchiveManifest, reports []*telemetrylib.TelemetryReport, err error) {
+	var reportIndex map[string]int
+
+	manifest, err = WalkReportArchive(
+		archivePath,
+		func(manifest *ReportArchiveManifest) error {
+			var totalSize int64
+			reportIndex = make(map[string]int, len(manifest.Reports))
+			for i, entry := range manifest.Reports {
+				totalSize += int64(entry.Size)
+				reportIndex[entry.File] = i
+			}
+			if totalSize > reportArchiveMaxTotalSize {
+				return fmt.Errorf("%w: reports too large", ErrInvalidReportArchive)
+			}
+			reports = make([]*telemetrylib.TelemetryReport, len(manifest.Reports))
+			return nil
+		},
+		func(entry *ReportArchiveEntry, report *telemetrylib.TelemetryReport) error {
+			reports[reportIndex[entry.File]] = report
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return
+}
+
+// WalkReportArchive reads the report archive at the specified path, one
+// entry at a time, verifying that the archive contents match the manifest
+// and that each report is valid with a matching checksum. The manifest,
+// which must be the first entry in the archive, is passed to manifestFn,
+// if specified, and each verified report is then passed to reportFn, in
+// archive order, so that only one report is held in memory at a time. The
+// walk stops at the first error, which is returned, so reports that were
+// passed to reportFn before the archive was found to be invalid must be
+// discarded by the caller, e.g. by walking the archive twice.
+func WalkReportArchive(
+	archivePath string,
+	manifestFn func(manifest *ReportArchiveManifest) error,
+	reportFn func(entry *ReportArchiveEntry, report *telemetrylib.TelemetryReport) error,
+) (manifest *ReportArchiveManifest, err error) {
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report archive %q: %w", archivePath, err)
+	}
+	defer archive.Close()
+
+	gzReader, err := gzip.NewReader(archive)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidReportArchive, err)
+	}
+	defer gzReader.Close()
+
+	tarReader := tar.NewReader(gzReader)
+
+	// readEntry reads the next file in the archive, returning io.EOF once
+	// there are no more files
+	readEntry := func() (name string, content []byte, err error) {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			return "", nil, err
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %w", ErrInvalidReportArchive, err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			return "", nil, fmt.Errorf("%w: unexpected entry %q", ErrInvalidReportArchive, hdr.Name)
+		}
+
+		if hdr.Size > reportArchiveMaxEntrySize {
+			return "", nil, fmt.Errorf("%w: entry %q too large", ErrInvalidReportArchive, hdr.Name)
+		}
+
+		content, err = io.ReadAll(io.LimitReader(tarReader, reportArchiveMaxEntrySize))
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: failed to read entry %q: %w", ErrInvalidReportArchive, hdr.Name, err)
+		}
+
+		return hdr.Name, content, nil
+	}
+
+	// the manifest is written first, describing the reports that follow
+	name, manifestJSON, err := readEntry()
+	if err == io.EOF || (err == nil && name != REPORT_ARCHIVE_MANIFEST) {
+		return nil, fmt.Errorf("%w: missing manifest", ErrInvalidReportArchive)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifest = new(ReportArchiveManifest)
+	if err = json.Unmarshal(manifestJSON, manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %w", ErrInvalidReportArchive, err)
+	}
+
+	if manifest.Version != REPORT_ARCHIVE_VERSION {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidReportArchive, manifest.Version)
+	}
+
+	// every report listed in the manifest must appear exactly once
+	pending := make(map[string]*ReportArchiveEntry, len(manifest.Reports))
+	for i := range manifest.Reports {
+		entry := &manifest.Reports[i]
+		if _, found := pending[entry.File]; found || entry.File == REPORT_ARCHIVE_MANIFEST {
+			return nil, fmt.Errorf("%w: duplicate manifest entry %q", ErrInvalidReportArchive, entry.File)
+		}
+		pending[entry.File] = entry
+	}
+
+	if manifestFn != nil {
+		if err = manifestFn(manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		name, content, err := readEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// every file in the archive must be listed in the manifest
+		entry, found := pending[name]
+		if !found {
+			return nil, fmt.Errorf("%w: entry %q not in manifest", ErrInvalidReportArchive, name)
+		}
+		delete(pending, name)
+
+		report, err := verifyReportArchiveEntry(entry, content)
+		if err != nil {
+			return nil, err
+		}
+
+		if reportFn != nil {
+			if err = reportFn(entry, report); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, entry := range manifest.Reports {
+		if _, found := pending[entry.File]; found {
+			return nil, fmt.Errorf("%w: missing report %q", ErrInvalidReportArchive, entry.ReportId)
+		}
+	}
+
+	return
+}
+
+// verifyReportArchiveEntry verifies that the content matches the manifest
+// entry, returning the report it contains.
+func verifyReportArchiveEntry(entry *ReportArchiveEntry, content []byte) (report *telemetrylib.TelemetryReport, err error) {
+	if len(content) != entry.Size || sha256Hex(content) != entry.Sha256 {
+		return nil, fmt.Errorf("%w: report %q content doesn't match manifest", ErrInvalidReportArchive, entry.ReportId)
+	}
+
+	var trReq restapi.TelemetryReportRequest
+	if err = json.Unmarshal(content, &trReq); err != nil {
+		return nil, fmt.Errorf("%w: invalid report %q: %w", ErrInvalidReportArchive, entry.ReportId, err)
+	}
+	report = &trReq.TelemetryReport
+
+	if report.Header.ReportId != entry.ReportId {
+		return nil, fmt.Errorf(
+			"%w: report %q doesn't match manifest entry %q",
+			ErrInvalidReportArchive,
+			report.Header.ReportId,
+			entry.ReportId,
+		)
+	}
+
+	if entry.Checksum == "" || report.Footer.Checksum != entry.Checksum {
+		return nil, fmt.Errorf("%w: report %q checksum doesn't match manifest", ErrInvalidReportArchive, entry.ReportId)
+	}
+
+	if err = report.VerifyChecksum(); err != nil {
+		return nil, fmt.Errorf("%w: report %q: %w", ErrInvalidReportArchive, entry.ReportId, err)
+	}
+
+	if err = report.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: report %q: %w", ErrInvalidReportArchive, entry.ReportId, err)
+	}
+
+	return
+}
+
+func (tc *TelemetryClient) ImportReports(archivePath string) (manifest *ReportArchiveManifest, err error) {
+	return tc.ImportReportsContext(context.Background(), archivePath)
+}
+
+// ImportReportsContext verifies the report archive at the specified path
+// and then submits the reports it contains using this client's transport
+// and credentials. Submission failures are handled as they are for staged
+// reports: reports that are too large for the server are split, and the
+// parts submitted, while reports that will never be accepted, which can't
+// be quarantined as they aren't staged, are skipped, with an error wrapping
+// ErrReportRejected being returned, along with the manifest, once the rest
+// of the reports have been submitted. Reports that this client has already
+// submitted are skipped, so that an interrupted import can safely be
+// repeated.
+func (tc *TelemetryClient) ImportReportsContext(ctx context.Context, archivePath string) (manifest *ReportArchiveManifest, err error) {
+	// verify the entire archive before submitting anything, without
+	// holding all of the reports in memory
+	if _, err = WalkReportArchive(archivePath, nil, nil); err != nil {
+		return nil, err
+	}
+
+	if err = tc.prepareSubmission(ctx); err != nil {
+		return nil, err
+	}
+
+	var rejections []error
+	manifest, err = WalkReportArchive(
+		archivePath,
+		nil,
+		func(entry *ReportArchiveEntry, report *telemetrylib.TelemetryReport) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			count, err := tc.processor.SubmissionCountContext(ctx, report.Header.ReportId)
+			if err != nil {
+				return fmt.Errorf("failed to check submission history for report %q: %w", report.Header.ReportId, err)
+			}
+			if count > 0 {
+				slog.Info(
+					"Skipping previously submitted report",
+					slog.String("reportId", report.Header.ReportId),
+				)
+				return nil
+			}
+
+			err = tc.submitImportedReport(ctx, entry, report)
+			if errors.Is(err, ErrReportRejected) {
+				slog.Warn(
+					"Imported report rejected",
+					slog.String("reportId", report.Header.ReportId),
+					slog.String("err", err.Error()),
+				)
+				rejections = append(rejections, err)
+				return nil
+			}
+			return err
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info(
+		"Imported reports",
+		slog.String("archive", archivePath),
+		slog.String("clientId", manifest.ClientId),
+		slog.Int("reports", len(manifest.Reports)),
+		slog.Int("rejected", len(rejections)),
+	)
+
+	return manifest, errors.Join(rejections...)
+}
+
+// submitImportedReport submits a report from a report archive, splitting it
+// and submitting the parts if it is too large for the server, and recording
+// the submissions in the submission history. Fails with ErrReportRejected
+// if the report, or any of its parts, will never be accepted.
+func (tc *TelemetryClient) submitImportedReport(ctx context.Context, entry *ReportArchiveEntry, report *telemetrylib.TelemetryReport) (err error) {
+	var rejections []error
+	var lastSubmission *telemetrylib.TelemetrySubmissionRow
+
+	// submit the report, including any parts that result from splitting
+	// reports that were too large for the server
+	reports := []*telemetrylib.TelemetryReport{report}
+	for i := 0; i < len(reports); i++ {
+		part := reports[i]
+
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		submission, err := tc.submitReport(ctx, part)
+		if err != nil {
+			switch submitFailureActionFor(err) {
+			case submitFailureReject:
+				rejections = append(rejections, fmt.Errorf("%w: report %q: %w", ErrReportRejected, part.Header.ReportId, err))
+				continue
+
+			case submitFailureSplit:
+				splitReports, splitErr := part.Split()
+				if splitErr != nil {
+					// a report that can't be split further will never be
+					// accepted by the server
+					if errors.Is(splitErr, telemetrylib.ErrReportNotSplittable) {
+						rejections = append(rejections, fmt.Errorf("%w: report %q: %w: %w", ErrReportRejected, part.Header.ReportId, splitErr, err))
+						continue
+					}
+					return fmt.Errorf("failed to split imported report %q: %w: %w", part.Header.ReportId, splitErr, err)
+				}
+
+				slog.Info(
+					"Imported report too large, split for submission",
+					slog.String("reportId", part.Header.ReportId),
+				)
+				reports = append(reports, splitReports...)
+				continue
+			}
+
+			// the import can be repeated once the server recovers
+			return fmt.Errorf("failed to submit imported report %q: %w", part.Header.ReportId, err)
+		}
+
+		if err := tc.processor.RecordSubmissionContext(ctx, submission); err != nil {
+			slog.Warn(
+				"Failed to record imported report submission",
+				slog.String("reportId", part.Header.ReportId),
+				slog.String("err", err.Error()),
+			)
+		}
+		lastSubmission = submission
+	}
+
+	// the parts of a split report have new report ids, so record the
+	// original report as submitted too, so that it is skipped if the
+	// import is repeated
+	if len(reports) > 1 && lastSubmission != nil {
+		submission := telemetrylib.NewTelemetrySubmissionRow(
+			report,
+			lastSubmission.ServerUrl,
+			entry.Size,
+			lastSubmission.Attempts,
+			lastSubmission.ProcessingId,
+			types.Now(),
+		)
+		submission.ProcessedAt = lastSubmission.ProcessedAt
+		if err := tc.processor.RecordSubmissionContext(ctx, submission); err != nil {
+			slog.Warn(
+				"Failed to record imported report submission",
+				slog.String("reportId", report.Header.ReportId),
+				slog.String("err", err.Error()),
+			)
+		}
+	}
+
+	return errors.Join(rejections...)
+}
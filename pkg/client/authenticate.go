@@ -2,11 +2,13 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/SUSE/telemetry/pkg/restapi"
 )
@@ -14,6 +16,11 @@ import (
 // Authenticate is responsible for (re)authenticating an already registered
 // client with the server to ensure that it's auth token is up to date.
 func (tc *TelemetryClient) Authenticate() (err error) {
+	return tc.AuthenticateContext(context.Background())
+}
+
+// AuthenticateContext is the context aware variant of Authenticate.
+func (tc *TelemetryClient) AuthenticateContext(ctx context.Context) (err error) {
 	// get the registration, failing if it can't be retrieved
 	regId, err := tc.getRegistration()
 	if err != nil {
@@ -45,7 +52,7 @@ func (tc *TelemetryClient) Authenticate() (err error) {
 
 	reqUrl := tc.cfg.TelemetryBaseURL + "/authenticate"
 	reqBuf := bytes.NewBuffer(reqBodyJSON)
-	req, err := http.NewRequest("POST", reqUrl, reqBuf)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqUrl, reqBuf)
 	if err != nil {
 		slog.Error(
 			"failed to create new HTTP request for client authentication",
@@ -56,8 +63,7 @@ func (tc *TelemetryClient) Authenticate() (err error) {
 
 	req.Header.Add("Content-Type", "application/json")
 
-	httpClient := http.DefaultClient
-	resp, err := httpClient.Do(req)
+	resp, err := tc.httpClient.Do(req)
 	if err != nil {
 		slog.Error(
 			"failed to HTTP POST client authentication request",
@@ -104,7 +110,7 @@ func (tc *TelemetryClient) Authenticate() (err error) {
 			tc.creds.DisableRetries()
 
 			// retry client registration
-			return tc.Register()
+			return tc.RegisterContext(ctx)
 		}
 		fallthrough
 
@@ -125,6 +131,11 @@ func (tc *TelemetryClient) Authenticate() (err error) {
 		return
 	}
 
+	// don't save credentials that can't be trusted
+	if err = tc.verifyAuthToken(caResp.AuthToken); err != nil {
+		return
+	}
+
 	// save the extracted creds
 	err = tc.creds.UpdateCreds(&caResp)
 	if err != nil {
@@ -142,3 +153,45 @@ func (tc *TelemetryClient) Authenticate() (err error) {
 
 	return
 }
+
+// RefreshIfNeeded re-authenticates the client if its auth token has expired,
+// or will expire within the configured refresh window, avoiding requests
+// that would be rejected as unauthorized.
+func (tc *TelemetryClient) RefreshIfNeeded() (err error) {
+	return tc.RefreshIfNeededContext(context.Background())
+}
+
+// RefreshIfNeededContext is the context aware variant of RefreshIfNeeded.
+func (tc *TelemetryClient) RefreshIfNeededContext(ctx context.Context) (err error) {
+	// nothing to refresh if the client hasn't been registered
+	if !tc.creds.Valid() {
+		return
+	}
+
+	// an unparseable token will need to be replaced
+	expiration, err := tc.AuthExpiration()
+	if err != nil {
+		slog.Warn(
+			"Unable to determine auth token expiration, refreshing",
+			slog.String("err", err.Error()),
+		)
+		return tc.AuthenticateContext(ctx)
+	}
+
+	// tokens without an expiration never need refreshing
+	if expiration.IsZero() {
+		return
+	}
+
+	remaining := time.Until(expiration)
+	if remaining > tc.cfg.Auth.RefreshWindow {
+		return
+	}
+
+	slog.Info(
+		"Auth token expiring, refreshing",
+		slog.Duration("remaining", remaining),
+	)
+
+	return tc.AuthenticateContext(ctx)
+}
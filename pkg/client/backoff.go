@@ -0,0 +1,198 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/SUSE/telemetry/pkg/utils"
+)
+
+const (
+	BACKOFF_NAME = `backoff`
+	BACKOFF_PERM = 0600
+)
+
+// TelemetryClientBackoff tracks the time before which the server should not
+// be contacted, persisted in the client config dir so that it is honoured
+// across separate client invocations.
+type TelemetryClientBackoff struct {
+	NotBefore time.Time `json:"notBefore"`
+
+	config      *config.Config
+	backoffFile utils.FileManager
+}
+
+func NewTelemetryClientBackoff(cfg *config.Config) (*TelemetryClientBackoff, error) {
+	backoffPath := filepath.Join(cfg.ConfigDir(), BACKOFF_NAME)
+	b := &TelemetryClientBackoff{
+		config: cfg,
+	}
+
+	// create a managed file to manage the backoff file based upon
+	// the location, ownership and permissions of the config file with
+	// backups disabled.
+	fm := utils.NewManagedFile()
+	err := fm.Init(
+		backoffPath,
+		b.config.ConfigUser(),
+		b.config.ConfigGroup(),
+		BACKOFF_PERM,
+	)
+	fm.DisableBackups()
+
+	if err != nil {
+		slog.Debug(
+			"failed to setup backoff file manager",
+			slog.String("path", backoffPath),
+			slog.String("err", err.Error()),
+		)
+		return nil, fmt.Errorf("failed to setup backoff file manager: %w", err)
+	}
+
+	b.backoffFile = fm
+
+	return b, nil
+}
+
+func (b *TelemetryClientBackoff) String() string {
+	return fmt.Sprintf("<p:%q, nb:%q>", b.Path(), b.NotBefore.Format(time.RFC3339))
+}
+
+func (b *TelemetryClientBackoff) Exists() bool {
+	exists, _ := b.backoffFile.Exists()
+	return exists
+}
+
+func (b *TelemetryClientBackoff) Path() string {
+	return b.backoffFile.Path()
+}
+
+// Active returns true if the server should not yet be contacted.
+func (b *TelemetryClientBackoff) Active() bool {
+	return time.Now().Before(b.NotBefore)
+}
+
+// Defer records that the server should not be contacted again until the
+// specified delay has elapsed, unless a later time is already recorded.
+func (b *TelemetryClientBackoff) Defer(delay time.Duration) (err error) {
+	notBefore := time.Now().Add(delay)
+	if !notBefore.After(b.NotBefore) {
+		return
+	}
+
+	b.NotBefore = notBefore
+
+	return b.Save()
+}
+
+func (b *TelemetryClientBackoff) Save() (err error) {
+	err = b.backoffFile.Create()
+	if err != nil {
+		slog.Debug(
+			"failed to create/open backoff",
+			slog.String("path", b.Path()),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+	defer b.backoffFile.Close()
+
+	bytes, err := json.Marshal(b)
+	if err != nil {
+		slog.Error(
+			"failed to json.Marshal() client backoff",
+			slog.String("backoff", b.String()),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	err = b.backoffFile.Update(bytes)
+	if err != nil {
+		slog.Error(
+			"failed to save client backoff file",
+			slog.String("backoff", b.String()),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	slog.Debug(
+		"client backoff saved",
+		slog.String("backoff", b.String()),
+	)
+	return
+}
+
+func (b *TelemetryClientBackoff) Load() (err error) {
+	// nothing to load if the backoff file doesn't exist
+	if !b.Exists() {
+		return
+	}
+
+	err = b.backoffFile.Open(
+		false, // no need to create, should already exist
+	)
+	if err != nil {
+		slog.Error(
+			"failed to open client backoff",
+			slog.String("path", b.Path()),
+		)
+		return
+	}
+	defer b.backoffFile.Close()
+
+	bytes, err := b.backoffFile.Read()
+	if err != nil {
+		slog.Error(
+			"failed to read client backoff file",
+			slog.String("path", b.Path()),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	err = json.Unmarshal(bytes, b)
+	if err != nil {
+		slog.Error(
+			"failed to json.Unmarshal() client backoff file contents",
+			slog.String("path", b.Path()),
+			slog.String("contents", string(bytes)),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	slog.Debug(
+		"client backoff loaded",
+		slog.String("backoff", b.String()),
+	)
+
+	return
+}
+
+// Clear removes any recorded backoff.
+func (b *TelemetryClientBackoff) Clear() (err error) {
+	b.NotBefore = time.Time{}
+
+	// nothing to do if file doesn't exist
+	if !b.Exists() {
+		return
+	}
+
+	err = b.backoffFile.Delete()
+	if err != nil {
+		slog.Error(
+			"failed to delete client backoff",
+			slog.String("path", b.Path()),
+			slog.String("err", err.Error()),
+		)
+		return fmt.Errorf("failed to os.Remove(%q): %w", b.Path(), err)
+	}
+
+	return
+}
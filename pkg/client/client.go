@@ -1,24 +1,36 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/SUSE/telemetry/pkg/auth"
 	"github.com/SUSE/telemetry/pkg/config"
 	telemetrylib "github.com/SUSE/telemetry/pkg/lib"
+	"github.com/SUSE/telemetry/pkg/restapi"
 	"github.com/SUSE/telemetry/pkg/types"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type TelemetryClient struct {
-	cfg       *config.Config
-	reg       *TelemetryClientRegistration
-	creds     *TelemetryClientCredentials
-	processor telemetrylib.TelemetryProcessor
+	cfg        *config.Config
+	reg        *TelemetryClientRegistration
+	creds      *TelemetryClientCredentials
+	backoff    *TelemetryClientBackoff
+	processor  telemetrylib.TelemetryProcessor
+	httpClient *http.Client
+	encoding   string // Content-Encoding used for report submissions
+	transport  ReportTransport
+	verifier   *auth.Verifier // optional auth token verifier
+
+	// guards the config's consent settings, which can be reloaded
+	consentMutex sync.RWMutex
 }
 
 func NewTelemetryClient(cfg *config.Config) (tc *TelemetryClient, err error) {
@@ -68,6 +80,60 @@ func NewTelemetryClient(cfg *config.Config) (tc *TelemetryClient, err error) {
 		}
 	}
 
+	// create the auth token verifier, if trusted keys are configured
+	if cfg.Auth.Verify.Enabled() {
+		tc.verifier, err = auth.NewVerifier(&cfg.Auth.Verify)
+		if err != nil {
+			slog.Debug(
+				"failed to setup auth token verification",
+				slog.String("Verify", cfg.Auth.Verify.String()),
+				slog.String("err", err.Error()),
+			)
+			return nil, fmt.Errorf("failed to setup auth token verification: %w", err)
+		}
+	}
+
+	// create client backoff manager
+	tc.backoff, err = NewTelemetryClientBackoff(cfg)
+	if err != nil {
+		slog.Debug(
+			"failed to create a new client backoff",
+			slog.String("configDir", cfg.ConfigDir()),
+			slog.String("err", err.Error()),
+		)
+		return nil, fmt.Errorf("failed to create a new client backoff: %w", err)
+	}
+
+	// load any backoff previously requested by the server
+	if err = tc.backoff.Load(); err != nil {
+		slog.Warn(
+			"failed to load existing client backoff, ignoring",
+			slog.String("backoff", tc.backoff.Path()),
+			slog.String("err", err.Error()),
+		)
+	}
+
+	// create the HTTP client used for all requests to the server
+	tc.httpClient, err = newHTTPClient(&cfg.Transport)
+	if err != nil {
+		slog.Debug(
+			"failed to setup HTTP transport",
+			slog.String("Transport", cfg.Transport.String()),
+			slog.String("err", err.Error()),
+		)
+		return nil, fmt.Errorf("failed to setup HTTP transport: %w", err)
+	}
+
+	tc.encoding, err = reportContentEncoding(&cfg.Transport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup HTTP transport: %w", err)
+	}
+
+	tc.transport, err = newReportTransport(tc, &cfg.Submission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup report transport: %w", err)
+	}
+
 	tc.processor, err = telemetrylib.NewTelemetryProcessor(&cfg.DataStores)
 	if err != nil {
 		slog.Debug(
@@ -78,6 +144,14 @@ func NewTelemetryClient(cfg *config.Config) (tc *TelemetryClient, err error) {
 		return nil, fmt.Errorf("failed to setup data store manager: %w", err)
 	}
 
+	// purge any staged telemetry that the config no longer consents to
+	if err := tc.ReconcileConsent(); err != nil {
+		slog.Warn(
+			"Failed to purge staged telemetry for which consent was withdrawn",
+			slog.String("error", err.Error()),
+		)
+	}
+
 	return tc, nil
 }
 
@@ -166,10 +240,15 @@ func (tc *TelemetryClient) authParsedToken() (token *jwt.Token, err error) {
 		return
 	}
 
-	// only the server can validate the signing key, so parse unverified
-	token, _, err = jwt.NewParser().ParseUnverified(
-		string(tc.creds.AuthToken), jwt.MapClaims{},
-	)
+	// verify the token if trusted keys are configured, otherwise only the
+	// server can validate the signing key, so parse unverified
+	if tc.verifier != nil {
+		token, err = tc.verifier.Verify(string(tc.creds.AuthToken), jwt.MapClaims{})
+	} else {
+		token, _, err = jwt.NewParser().ParseUnverified(
+			string(tc.creds.AuthToken), jwt.MapClaims{},
+		)
+	}
 
 	if err != nil {
 		slog.Error(
@@ -182,6 +261,24 @@ func (tc *TelemetryClient) authParsedToken() (token *jwt.Token, err error) {
 	return
 }
 
+// verifyAuthToken verifies an auth token received from the server against
+// the configured trusted keys, if any.
+func (tc *TelemetryClient) verifyAuthToken(authToken string) (err error) {
+	if tc.verifier == nil {
+		return
+	}
+
+	_, err = tc.verifier.Verify(authToken, jwt.MapClaims{})
+	if err != nil {
+		slog.Error(
+			"Received auth token failed verification",
+			slog.String("error", err.Error()),
+		)
+	}
+
+	return
+}
+
 func (tc *TelemetryClient) AuthIssuer() (issuer string, err error) {
 	token, err := tc.authParsedToken()
 	if err != nil {
@@ -215,7 +312,10 @@ func (tc *TelemetryClient) AuthExpiration() (expiration time.Time, err error) {
 		return
 	}
 
-	expiration = expTime.Time
+	// a token without an expiration claim has a zero expiration
+	if expTime != nil {
+		expiration = expTime.Time
+	}
 
 	return
 }
@@ -247,10 +347,26 @@ func (tc *TelemetryClient) CredentialsPath() string {
 	return tc.creds.Path()
 }
 
+// ReportTransport returns the transport used to submit reports
+func (tc *TelemetryClient) ReportTransport() ReportTransport {
+	return tc.transport
+}
+
+// SetReportTransport overrides the transport used to submit reports
+func (tc *TelemetryClient) SetReportTransport(transport ReportTransport) {
+	tc.transport = transport
+}
+
 func (tc *TelemetryClient) ClientId() string {
 	return tc.reg.ClientId
 }
 
+// RegistrationId returns the registration id assigned to the client by
+// the server, which is only available once the client is registered
+func (tc *TelemetryClient) RegistrationId() int64 {
+	return tc.creds.RegistrationId
+}
+
 func (tc *TelemetryClient) RegistrationPath() string {
 	return tc.reg.Path()
 }
@@ -263,6 +379,12 @@ func (tc *TelemetryClient) PersistentDatastore() bool {
 	return tc.processor.Persistent()
 }
 
+// SubmitNotBefore returns the time before which the client will not
+// attempt to submit reports to the server.
+func (tc *TelemetryClient) SubmitNotBefore() time.Time {
+	return tc.backoff.NotBefore
+}
+
 func errClientNotAuthorized() error {
 	return errors.New("client not authorized")
 }
@@ -275,22 +397,37 @@ func errAuthenticationRequired() error {
 	return errors.New("client authentication required")
 }
 
-var (
-	ErrClientNotAuthorized    = errClientNotAuthorized()    // general authorization failure
-	ErrRegistrationRequired   = errRegistrationRequired()   // need to (re-)register
-	ErrAuthenticationRequired = errAuthenticationRequired() // need to (re-authenticate)
-)
+func errServerBackoff() error {
+	return errors.New("server requested backoff")
+}
 
-func parseQuotedAssignment(assignment string) (field, value string, found bool) {
-	// split assignment on '='
-	field, value, found = strings.Cut(assignment, "=")
-	if found {
-		// if split was successful string quote and inner wrapping spaces
-		value = strings.TrimSpace(strings.Trim(value, `"'`))
-	}
-	return
+func errInvalidReportArchive() error {
+	return errors.New("invalid report archive")
+}
+
+func errReportRejected() error {
+	return errors.New("report rejected")
 }
 
+func errTelemetryClassNotAllowed() error {
+	return errors.New("telemetry class not allowed")
+}
+
+func errTelemetryTypeNotAllowed() error {
+	return errors.New("telemetry type not allowed")
+}
+
+var (
+	ErrClientNotAuthorized      = errClientNotAuthorized()      // general authorization failure
+	ErrRegistrationRequired     = errRegistrationRequired()     // need to (re-)register
+	ErrAuthenticationRequired   = errAuthenticationRequired()   // need to (re-authenticate)
+	ErrServerBackoff            = errServerBackoff()            // server shouldn't be contacted yet
+	ErrInvalidReportArchive     = errInvalidReportArchive()     // report archive failed verification
+	ErrReportRejected           = errReportRejected()           // report will never be accepted
+	ErrTelemetryClassNotAllowed = errTelemetryClassNotAllowed() // class not enabled by the config
+	ErrTelemetryTypeNotAllowed  = errTelemetryTypeNotAllowed()  // type denied by the config
+)
+
 func unauthorizedError(resp *http.Response) (err error) {
 	// default to general authorization failure
 	err = ErrClientNotAuthorized
@@ -308,104 +445,248 @@ func unauthorizedError(resp *http.Response) (err error) {
 	// joing possible multiple header values with ","
 	wwwAuthenticate := strings.Join(hdrWwwAuthenticate, ",")
 
-	if wwwAuthenticate == "" {
+	// the challenge scope indicates the required recovery action
+	scope, parseErr := restapi.ParseChallenge(wwwAuthenticate)
+	if parseErr != nil {
 		slog.Error(
-			"Unauthorized response WWW-Authenticate header empty",
+			"Unauthorized response WWW-Authenticate header invalid",
 			slog.Int("StatusCode", resp.StatusCode),
 			slog.String("WWW-Authenticate", wwwAuthenticate),
+			slog.String("err", parseErr.Error()),
 		)
 		return
 	}
 
-	// the WWW-Authenticate header should have the following format
-	//   <challenge> realm="<realm>" scope="<scope>"
-	// where:
-	//   <challenge> is "Bearer"
-	//   <realm> is "suse-telemetry-service"
-	//   <scope> is either "authenticate" or "register"
-	fields := strings.Fields(wwwAuthenticate)
+	switch scope {
+	case restapi.AUTH_SCOPE_AUTHENTICATE:
+		slog.Debug("Client (re-)authentication required")
+		err = ErrAuthenticationRequired
+	case restapi.AUTH_SCOPE_REGISTER:
+		slog.Debug("Client (re-)registration required")
+		err = ErrRegistrationRequired
+	}
 
-	// validate the WWW-Authenticate header value
-	if len(fields) < 3 {
-		slog.Error(
-			"Unauthorized response WWW-Authenticate header invalid format",
-			slog.Int("StatusCode", resp.StatusCode),
-			slog.String("WWW-Authenticate", wwwAuthenticate),
+	return
+}
+
+// Generate adds a telemetry data item as mandatory telemetry, which is
+// always submitted while telemetry is enabled; use GenerateWithClass for
+// opt-out or opt-in telemetry.
+func (tc *TelemetryClient) Generate(telemetry types.TelemetryType, content *types.TelemetryBlob, tags types.Tags) error {
+	return tc.GenerateContext(context.Background(), telemetry, content, tags)
+}
+
+// GenerateContext is the context aware variant of Generate.
+func (tc *TelemetryClient) GenerateContext(ctx context.Context, telemetry types.TelemetryType, content *types.TelemetryBlob, tags types.Tags) error {
+	return tc.GenerateWithClassContext(ctx, telemetry, types.MANDATORY_TELEMETRY, content, tags)
+}
+
+// GenerateWithClass adds a telemetry data item, recording the telemetry
+// class it was collected under, rather than treating it as mandatory
+// telemetry, as Generate does.
+func (tc *TelemetryClient) GenerateWithClass(telemetry types.TelemetryType, class types.TelemetryClass, content *types.TelemetryBlob, tags types.Tags) error {
+	return tc.GenerateWithClassContext(context.Background(), telemetry, class, content, tags)
+}
+
+// GenerateWithClassContext is the context aware variant of
+// GenerateWithClass.
+func (tc *TelemetryClient) GenerateWithClassContext(ctx context.Context, telemetry types.TelemetryType, class types.TelemetryClass, content *types.TelemetryBlob, tags types.Tags) error {
+	// Enforce valid versioned JSON object
+	if err := content.Valid(); err != nil {
+		slog.Debug(
+			"Supplied content is not a versioned JSON object",
+			slog.String("error", err.Error()),
 		)
-		return
+		return err
 	}
 
-	// first field specifies the challenge, value validated below
-	challenge := fields[0]
-
-	// second field should be realm="<realm>", value validated below
-	fieldName, realm, found := parseQuotedAssignment(fields[1])
-	if !found || (fieldName != "realm") {
-		slog.Error(
-			"Unauthorized response WWW-Authenticate header missing realm",
-			slog.Int("StatusCode", resp.StatusCode),
-			slog.String("WWW-Authenticate", wwwAuthenticate),
+	// Enforce content size limits
+	if err := content.CheckLimits(); err != nil {
+		slog.Debug(
+			"Supplied JSON blob failed limits check",
+			slog.String("error", err.Error()),
 		)
-		return
+		return err
 	}
 
-	// third field should be scope="<scope>", value validated below
-	fieldName, scope, found := parseQuotedAssignment(fields[2])
-	if !found || (fieldName != "scope") {
-		slog.Error(
-			"Unauthorized response WWW-Authenticate header missing scope",
-			slog.Int("StatusCode", resp.StatusCode),
-			slog.String("WWW-Authenticate", wwwAuthenticate),
+	// Reject telemetry that the config doesn't consent to
+	if err := tc.checkConsent(telemetry, class); err != nil {
+		slog.Debug(
+			"Supplied telemetry not permitted by the config",
+			slog.String("error", err.Error()),
 		)
-		return
+		return err
 	}
 
-	// only Bearer challenge type is accepted
-	if challenge != "Bearer" {
-		slog.Error(
-			"Unauthorized response WWW-Authenticate header invalid challenge",
-			slog.Int("StatusCode", resp.StatusCode),
-			slog.String("WWW-Authenticate", wwwAuthenticate),
-			slog.String("challenge", challenge),
+	// Add telemetry data item to DataItem data store
+	slog.Debug(
+		"Generated Telemetry",
+		slog.String("name", telemetry.String()),
+		slog.String("class", class.String()),
+		slog.String("tags", tags.String()),
+		slog.String("content", content.String()),
+	)
+
+	if err := tc.processor.AddDataWithClassContext(ctx, telemetry, class, content, tags); err != nil {
+		return err
+	}
+
+	tc.enforceStagingLimits(ctx)
+
+	return nil
+}
+
+// EnforceStagingLimits evicts staged telemetry as needed to bring the local
+// staging datastore within the configured staging limits, which is also
+// done whenever telemetry is generated.
+func (tc *TelemetryClient) EnforceStagingLimits() error {
+	return tc.EnforceStagingLimitsContext(context.Background())
+}
+
+// EnforceStagingLimitsContext is the context aware variant of
+// EnforceStagingLimits.
+func (tc *TelemetryClient) EnforceStagingLimitsContext(ctx context.Context) (err error) {
+	_, err = tc.processor.EnforceStagingLimitsContext(ctx, &tc.cfg.Staging)
+	return
+}
+
+// enforceStagingLimits enforces the staging limits after telemetry has
+// been staged, which succeeded even if the limits couldn't be enforced
+func (tc *TelemetryClient) enforceStagingLimits(ctx context.Context) {
+	if err := tc.EnforceStagingLimitsContext(ctx); err != nil {
+		slog.Warn(
+			"Failed to enforce staging limits",
+			slog.String("error", err.Error()),
 		)
-		return
 	}
+}
 
-	// only suse-telemetry-service realm type is accepted
-	switch realm {
-	case "suse-telemetry-service":
-		// valid
-	default:
-		slog.Error(
-			"Unauthorized response WWW-Authenticate header invalid realm",
-			slog.Int("StatusCode", resp.StatusCode),
-			slog.String("WWW-Authenticate", wwwAuthenticate),
-			slog.String("realm", realm),
+// consentConfig returns a copy of the config, with the current consent
+// settings
+func (tc *TelemetryClient) consentConfig() config.Config {
+	tc.consentMutex.RLock()
+	defer tc.consentMutex.RUnlock()
+
+	return *tc.cfg
+}
+
+// checkConsent returns an error if the config's class options don't permit
+// telemetry of the specified type and class to be submitted, as staging it
+// would be pointless, it being purged when consent is next reconciled.
+// Nothing is purged while telemetry is disabled, so nor is it rejected.
+func (tc *TelemetryClient) checkConsent(telemetry types.TelemetryType, class types.TelemetryClass) error {
+	cfg := tc.consentConfig()
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if !cfg.TelemetryClassEnabled(class) {
+		return fmt.Errorf(
+			"%w: %s telemetry is not enabled by the config class options",
+			ErrTelemetryClassNotAllowed,
+			class.String(),
 		)
-		return
 	}
 
-	// only authenticate and register scope types are accepted
-	switch scope {
-	case "authenticate":
-		slog.Debug("Client (re-)authentication required")
-		err = ErrAuthenticationRequired
-	case "register":
-		slog.Debug("Client (re-)registration required")
-		err = ErrRegistrationRequired
-	default:
-		slog.Error(
-			"Unauthorized response WWW-Authenticate header invalid scope",
-			slog.Int("StatusCode", resp.StatusCode),
-			slog.String("WWW-Authenticate", wwwAuthenticate),
-			slog.String("scope", scope),
+	if !cfg.TelemetryTypeEnabled(telemetry) {
+		return fmt.Errorf(
+			"%w: %q telemetry is not allowed by the config class options",
+			ErrTelemetryTypeNotAllowed,
+			telemetry.String(),
 		)
 	}
 
+	return nil
+}
+
+// ReconcileConsent purges any staged telemetry, whether or not it has been
+// bundled or reported, that the config's class options and allow and deny
+// lists no longer permit to be submitted, recording the purge as evictions.
+// This is done when the client is created, when the consent settings are
+// reloaded and before reports are submitted, so that withdrawn consent
+// takes effect even if the config was changed after the telemetry was
+// staged.
+func (tc *TelemetryClient) ReconcileConsent() error {
+	return tc.ReconcileConsentContext(context.Background())
+}
+
+// ReconcileConsentContext is the context aware variant of ReconcileConsent.
+func (tc *TelemetryClient) ReconcileConsentContext(ctx context.Context) (err error) {
+	cfg := tc.consentConfig()
+	_, err = tc.processor.PurgeWithdrawnConsentContext(ctx, &cfg)
 	return
 }
 
-func (tc *TelemetryClient) Generate(telemetry types.TelemetryType, content *types.TelemetryBlob, tags types.Tags) error {
+// ReloadConsent reloads the consent settings, i.e. whether telemetry is
+// enabled and the class options, from the config file, and reconciles the
+// staged telemetry with them, so that a long running client picks up
+// consent changes without being recreated.
+func (tc *TelemetryClient) ReloadConsent() error {
+	return tc.ReloadConsentContext(context.Background())
+}
+
+// ReloadConsentContext is the context aware variant of ReloadConsent.
+func (tc *TelemetryClient) ReloadConsentContext(ctx context.Context) (err error) {
+	cfg, err := config.NewConfig(tc.cfg.ConfigPath())
+	if err != nil {
+		return fmt.Errorf("failed to reload consent settings: %w", err)
+	}
+
+	tc.consentMutex.Lock()
+	tc.cfg.Enabled = cfg.Enabled
+	tc.cfg.ClassOptions = cfg.ClassOptions
+	tc.consentMutex.Unlock()
+
+	slog.Debug(
+		"Reloaded consent settings",
+		slog.Bool("enabled", cfg.Enabled),
+		slog.String("classOptions", cfg.ClassOptions.String()),
+	)
+
+	return tc.ReconcileConsentContext(ctx)
+}
+
+// RegisterManagedClient registers a client system, identified by a
+// management framework specific system id, on whose behalf telemetry will
+// be synthesized, returning its persistently assigned telemetry client id.
+func (tc *TelemetryClient) RegisterManagedClient(systemId string) (clientId string, err error) {
+	return tc.RegisterManagedClientContext(context.Background(), systemId)
+}
+
+// RegisterManagedClientContext is the context aware variant of
+// RegisterManagedClient.
+func (tc *TelemetryClient) RegisterManagedClientContext(ctx context.Context, systemId string) (clientId string, err error) {
+	managedRow, err := tc.processor.RegisterManagedClientContext(ctx, systemId)
+	if err != nil {
+		return
+	}
+
+	return managedRow.ClientId, nil
+}
+
+// GenerateManaged adds a telemetry data item, as mandatory telemetry, on
+// behalf of the managed client system with the specified system id,
+// registering the managed client if needed; use GenerateManagedWithClass
+// for opt-out or opt-in telemetry.
+func (tc *TelemetryClient) GenerateManaged(systemId string, telemetry types.TelemetryType, content *types.TelemetryBlob, tags types.Tags) error {
+	return tc.GenerateManagedContext(context.Background(), systemId, telemetry, content, tags)
+}
+
+// GenerateManagedContext is the context aware variant of GenerateManaged.
+func (tc *TelemetryClient) GenerateManagedContext(ctx context.Context, systemId string, telemetry types.TelemetryType, content *types.TelemetryBlob, tags types.Tags) error {
+	return tc.GenerateManagedWithClassContext(ctx, systemId, telemetry, types.MANDATORY_TELEMETRY, content, tags)
+}
+
+// GenerateManagedWithClass adds a telemetry data item on behalf of the
+// managed client system with the specified system id, recording the
+// telemetry class it was collected under.
+func (tc *TelemetryClient) GenerateManagedWithClass(systemId string, telemetry types.TelemetryType, class types.TelemetryClass, content *types.TelemetryBlob, tags types.Tags) error {
+	return tc.GenerateManagedWithClassContext(context.Background(), systemId, telemetry, class, content, tags)
+}
+
+// GenerateManagedWithClassContext is the context aware variant of
+// GenerateManagedWithClass.
+func (tc *TelemetryClient) GenerateManagedWithClassContext(ctx context.Context, systemId string, telemetry types.TelemetryType, class types.TelemetryClass, content *types.TelemetryBlob, tags types.Tags) error {
 	// Enforce valid versioned JSON object
 	if err := content.Valid(); err != nil {
 		slog.Debug(
@@ -424,60 +705,268 @@ func (tc *TelemetryClient) Generate(telemetry types.TelemetryType, content *type
 		return err
 	}
 
-	// Add telemetry data item to DataItem data store
+	// Reject telemetry that the config doesn't consent to
+	if err := tc.checkConsent(telemetry, class); err != nil {
+		slog.Debug(
+			"Supplied telemetry not permitted by the config",
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+
+	managedRow, err := tc.processor.RegisterManagedClientContext(ctx, systemId)
+	if err != nil {
+		return err
+	}
+
 	slog.Debug(
-		"Generated Telemetry",
+		"Generated Managed Telemetry",
+		slog.String("systemId", systemId),
+		slog.String("clientId", managedRow.ClientId),
 		slog.String("name", telemetry.String()),
+		slog.String("class", class.String()),
 		slog.String("tags", tags.String()),
-		slog.String("content", content.String()),
 	)
 
-	return tc.processor.AddData(telemetry, content, tags)
+	if err = tc.processor.AddManagedDataWithClassContext(ctx, managedRow, telemetry, class, content, tags); err != nil {
+		return err
+	}
+
+	tc.enforceStagingLimits(ctx)
+
+	return nil
+}
+
+// CreateManagedBundles bundles the telemetry data items staged on behalf of
+// each managed client system, which will be aggregated into the reports
+// created by CreateReports.
+func (tc *TelemetryClient) CreateManagedBundles(tags types.Tags) error {
+	return tc.CreateManagedBundlesContext(context.Background(), tags)
+}
+
+// CreateManagedBundlesContext is the context aware variant of
+// CreateManagedBundles.
+func (tc *TelemetryClient) CreateManagedBundlesContext(ctx context.Context, tags types.Tags) (err error) {
+	slog.Debug("Managed Bundles", slog.String("Tags", tags.String()))
+	_, err = tc.processor.GenerateManagedBundlesContext(ctx, tc.ClientId(), tc.cfg.CustomerId, tags)
+
+	return
 }
 
 func (tc *TelemetryClient) CreateBundles(tags types.Tags) error {
+	return tc.CreateBundlesContext(context.Background(), tags)
+}
+
+func (tc *TelemetryClient) CreateBundlesContext(ctx context.Context, tags types.Tags) error {
 	// Bundle existing telemetry data items found in DataItem data store into one or more bundles in the Bundle data store
 	slog.Debug("Bundle", slog.String("Tags", tags.String()))
-	tc.processor.GenerateBundle(tc.ClientId(), tc.cfg.CustomerId, tags)
+	_, err := tc.processor.GenerateBundlesContext(
+		ctx,
+		tc.ClientId(),
+		tc.cfg.CustomerId,
+		tags,
+		&tc.cfg.Bundling,
+	)
 
-	return nil
+	return err
 }
 
 func (tc *TelemetryClient) CreateReports(tags types.Tags) (err error) {
+	return tc.CreateReportsContext(context.Background(), tags)
+}
+
+func (tc *TelemetryClient) CreateReportsContext(ctx context.Context, tags types.Tags) (err error) {
 	// Generate reports from available bundles
 	slog.Debug("CreateReports", slog.String("Tags", tags.String()))
-	tc.processor.GenerateReport(tc.ClientId(), tags)
+	_, err = tc.processor.GenerateReportsContext(
+		ctx,
+		tc.ClientId(),
+		tags,
+		tc.cfg.Submission.MaxRequestSize,
+	)
 
 	return
 }
 
+// actions taken when a report submission fails
+type submitFailureAction int
+
+const (
+	submitFailureAbort      submitFailureAction = iota // stop submitting reports
+	submitFailureReject                                // the report will never be accepted
+	submitFailureSplit                                 // the report is too large, so split it
+	submitFailureRetryLater                            // the server failed, so try again later
+)
+
+// submitFailureActionFor determines how a failed report submission should
+// be handled, so that staged and imported reports are handled alike.
+func submitFailureActionFor(err error) submitFailureAction {
+	var statusErr *StatusError
+	switch {
+	// a corrupted report will never be submittable
+	case errors.Is(err, telemetrylib.ErrChecksumMismatch):
+		return submitFailureReject
+
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusRequestEntityTooLarge:
+		return submitFailureSplit
+
+	// the server rejected the report as invalid so resubmitting it won't
+	// help
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusBadRequest:
+		return submitFailureReject
+
+	// the server responded with an error, rather than being unreachable or
+	// asking for a backoff
+	case errors.As(err, &statusErr) && !errors.Is(err, ErrServerBackoff):
+		return submitFailureRetryLater
+	}
+
+	return submitFailureAbort
+}
+
 func (tc *TelemetryClient) Submit() (err error) {
+	return tc.SubmitContext(context.Background())
+}
+
+// prepareSubmission ensures that the client is ready to submit reports,
+// which, for transports that deliver reports to the server, requires the
+// client to be registered and authenticated, and the server not to have
+// requested a backoff.
+func (tc *TelemetryClient) prepareSubmission(ctx context.Context) (err error) {
+	// only transports that deliver reports to the server need the client
+	// to be registered and authenticated
+	if !tc.transport.Authenticated() {
+		return
+	}
+
 	// fail if the client is not registered
 	err = tc.creds.Load()
 	if err != nil {
 		return
 	}
 
-	// retrieve available reports
-	reportRows, err := tc.processor.GetReportRows()
+	// don't contact the server if it previously requested a backoff
+	if tc.backoff.Active() {
+		slog.Info(
+			"Telemetry submission deferred due to server requested backoff",
+			slog.String("notBefore", tc.backoff.NotBefore.Format(time.RFC3339)),
+		)
+		return fmt.Errorf(
+			"%w: not before %s",
+			ErrServerBackoff,
+			tc.backoff.NotBefore.Format(time.RFC3339),
+		)
+	}
+
+	// refresh the auth token if it has expired or will expire soon
+	if err = tc.RefreshIfNeededContext(ctx); err != nil {
+		return fmt.Errorf("failed to refresh auth token: %w", err)
+	}
+
+	return
+}
+
+func (tc *TelemetryClient) SubmitContext(ctx context.Context) (err error) {
+	// never submit telemetry for which consent has been withdrawn
+	if err = tc.ReconcileConsentContext(ctx); err != nil {
+		return fmt.Errorf("failed to purge staged telemetry for which consent was withdrawn: %w", err)
+	}
+
+	// retrieve available reports, excluding any that are quarantined
+	reportRows, err := tc.processor.GetPendingReportRowsContext(ctx)
 	if err != nil {
 		return
 	}
 
-	// submit each available report
-	for _, reportRow := range reportRows {
+	// only contact the server if there is something to submit
+	if len(reportRows) == 0 {
+		return
+	}
 
-		report, err := tc.processor.ToReport(reportRow)
+	if err = tc.prepareSubmission(ctx); err != nil {
+		return
+	}
+
+	// submit each available report, including any reports that result
+	// from splitting reports that were too large for the server
+	for i := 0; i < len(reportRows); i++ {
+		reportRow := reportRows[i]
+
+		// stop submitting if the context is done
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		submission, err := tc.submitStagedReport(ctx, reportRow)
 		if err != nil {
-			return fmt.Errorf("failed to generate report %q: %w", reportRow.ReportId, err)
+			switch submitFailureActionFor(err) {
+			// a report that will never be accepted, e.g. because it is
+			// corrupted, or the server rejected it as invalid, is
+			// quarantined, moving on to the next report
+			case submitFailureReject:
+				if err := tc.processor.QuarantineReportContext(ctx, reportRow, err.Error()); err != nil {
+					return fmt.Errorf("failed to quarantine report %q: %w", reportRow.ReportId, err)
+				}
+				continue
+
+			// split reports that are too large and submit the parts
+			case submitFailureSplit:
+				splitRows, splitErr := tc.processor.SplitReportContext(ctx, reportRow)
+				if splitErr != nil {
+					// a report that can't be split further will never be
+					// accepted by the server
+					if errors.Is(splitErr, telemetrylib.ErrReportNotSplittable) {
+						if err := tc.processor.QuarantineReportContext(ctx, reportRow, splitErr.Error()); err != nil {
+							return fmt.Errorf("failed to quarantine report %q: %w", reportRow.ReportId, err)
+						}
+						continue
+					}
+					return fmt.Errorf("failed to split report %q: %w: %w", reportRow.ReportId, splitErr, err)
+				}
+
+				slog.Info(
+					"Report too large, split for submission",
+					slog.String("reportId", reportRow.ReportId),
+				)
+				reportRows = append(reportRows, splitRows...)
+				continue
+
+			// record the failed attempt, quarantining the report if it
+			// has failed too many times, in which case move on to the
+			// next report
+			case submitFailureRetryLater:
+				stateRow, stateErr := tc.processor.RecordReportFailureContext(
+					ctx,
+					reportRow,
+					err.Error(),
+					tc.cfg.Submission.MaxAttempts,
+				)
+				if stateErr != nil {
+					slog.Warn(
+						"Failed to record failed report submission",
+						slog.String("reportId", reportRow.ReportId),
+						slog.String("err", stateErr.Error()),
+					)
+				} else if stateRow.Quarantined {
+					continue
+				}
+			}
+
+			return fmt.Errorf("failed to submit report %q: %w", reportRow.ReportId, err)
 		}
 
-		if err := tc.submitReport(report); err != nil {
-			return fmt.Errorf("failed to submit report %q: %w", report.Header.ReportId, err)
+		// record the submission history, which shouldn't prevent the
+		// submitted report from being deleted
+		if err := tc.processor.RecordSubmissionContext(ctx, submission); err != nil {
+			slog.Warn(
+				"Failed to record report submission",
+				slog.String("reportId", reportRow.ReportId),
+				slog.String("err", err.Error()),
+			)
 		}
 
 		// delete the successfully submitted report
-		tc.processor.DeleteReport(reportRow)
+		tc.processor.DeleteReportContext(ctx, reportRow)
 	}
 
 	return nil
@@ -1,18 +1,31 @@
 package client
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/SUSE/telemetry/pkg/config"
+	telemetrylib "github.com/SUSE/telemetry/pkg/lib"
 	"github.com/SUSE/telemetry/pkg/restapi"
+	"github.com/SUSE/telemetry/pkg/telemetrytest"
 	"github.com/SUSE/telemetry/pkg/types"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/suite"
@@ -46,6 +59,9 @@ func (c *ClientTestSuiteJWT) CreateToken() (string, error) {
 type ClientTestSuite struct {
 	suite.Suite
 
+	// datastore driver used to stage telemetry
+	driver string
+
 	tmpDir string
 
 	// JWT token settings
@@ -84,7 +100,7 @@ func (t *ClientTestSuite) createTemp(name string) (file *os.File, err error) {
 	return os.Create(filepath.Join(t.tmpDir, name))
 }
 
-func (t *ClientTestSuite) createTestConfig(server *httptest.Server) (string, error) {
+func (t *ClientTestSuite) createTestConfig(server *httptest.Server, extraCfg ...string) (string, error) {
 	cfgFmt := `---
 telemetry_base_url: %q
 enabled: true
@@ -92,8 +108,8 @@ client_id: d19ecc03-787c-469b-8bf5-71df704f3b16
 customer_id: TEST_CUSTOMER
 tags: []
 datastores:
-  driver: sqlite3
-  params: %s/client/telemetry.db
+  driver: %s
+  params: %s
 class_options:
   opt_out: true
   opt_in: false
@@ -107,13 +123,52 @@ logging:
 	cfgFile, err := t.createTemp("config.yaml")
 	t.Require().NoError(err, "should be able to create a temp config file")
 
-	cfgContent := fmt.Sprintf(cfgFmt, server.URL, t.tmpDir)
+	cfgContent := fmt.Sprintf(cfgFmt, server.URL, t.driver, t.datastoreParams())
+	for _, extra := range extraCfg {
+		cfgContent += "\n" + extra
+	}
 	_, err = cfgFile.WriteString(cfgContent)
 	t.Require().NoError(err, "should be able to write to temp config file")
 
 	return cfgFile.Name(), err
 }
 
+// datastoreParams returns the params of the test client's datastore
+func (t *ClientTestSuite) datastoreParams() string {
+	if t.driver == telemetrylib.DATASTORE_DRIVER_SPOOL {
+		return filepath.Join(t.tmpDir, "client", "spool")
+	}
+
+	return filepath.Join(t.tmpDir, "client", "telemetry.db")
+}
+
+// corruptItemChecksums overwrites the recorded checksum of all of the
+// items staged in the test client's datastore
+func (t *ClientTestSuite) corruptItemChecksums() {
+	if t.driver == telemetrylib.DATASTORE_DRIVER_SPOOL {
+		itemPaths, err := filepath.Glob(filepath.Join(t.datastoreParams(), "items", "*.json"))
+		t.Require().NoError(err, "should be able to find the staged items")
+		t.Require().NotEmpty(itemPaths, "items should have been staged")
+		for _, itemPath := range itemPaths {
+			content, err := os.ReadFile(itemPath)
+			t.Require().NoError(err, "should be able to read staged item")
+			var item map[string]any
+			t.Require().NoError(json.Unmarshal(content, &item))
+			item["ItemChecksum"] = "corrupted"
+			content, err = json.Marshal(item)
+			t.Require().NoError(err)
+			t.Require().NoError(os.WriteFile(itemPath, content, 0600), "should be able to corrupt item checksum")
+		}
+		return
+	}
+
+	db, err := sql.Open("sqlite3", t.datastoreParams())
+	t.Require().NoError(err, "should be able to open the staging datastore")
+	_, err = db.Exec(`UPDATE items SET itemChecksum = 'corrupted'`)
+	t.Require().NoError(err, "should be able to corrupt item checksums")
+	t.Require().NoError(db.Close())
+}
+
 func (t *ClientTestSuite) registerSucessHandler(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var reqBytes, respBytes []byte
@@ -250,8 +305,8 @@ func (t *ClientTestSuite) reportSucessHandler(w http.ResponseWriter, r *http.Req
 		"expected Authorization header to contain client auth token",
 	)
 
-	// extract the JSON payload
-	reqBytes, err = io.ReadAll(r.Body)
+	// extract the JSON payload, decoding it if needed
+	reqBytes, err = restapi.ReadRequestBody(r, 0)
 	t.Require().NoError(err, "/report request should have a payload")
 	t.Require().True(json.Valid(reqBytes))
 
@@ -285,19 +340,35 @@ type telemetryTestServerHandler struct {
 	Func   http.HandlerFunc
 }
 
-func (t *ClientTestSuite) telemetryTestServer(handlers ...telemetryTestServerHandler) (server *httptest.Server) {
-	mux := http.NewServeMux()
+func (t *ClientTestSuite) telemetryTestMux(handlers ...telemetryTestServerHandler) (mux *http.ServeMux) {
+	mux = http.NewServeMux()
 
 	for _, handler := range handlers {
 		pattern := fmt.Sprintf("%s %s", handler.Method, handler.Path)
 		mux.HandleFunc(pattern, handler.Func)
 	}
 
-	server = httptest.NewServer(mux)
-
 	return
 }
 
+func (t *ClientTestSuite) telemetryTestServer(handlers ...telemetryTestServerHandler) (server *httptest.Server) {
+	return httptest.NewServer(t.telemetryTestMux(handlers...))
+}
+
+func (t *ClientTestSuite) telemetryTestTLSServer(handlers ...telemetryTestServerHandler) (server *httptest.Server, caPath string) {
+	server = httptest.NewTLSServer(t.telemetryTestMux(handlers...))
+
+	// save the test server's self-signed cert as a PEM CA file
+	caFile, err := t.createTemp("ca.pem")
+	t.Require().NoError(err, "should be able to create a temp CA file")
+	defer caFile.Close()
+
+	err = pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	t.Require().NoError(err, "should be able to write test server cert to CA file")
+
+	return server, caFile.Name()
+}
+
 func (t *ClientTestSuite) Test_RegisterAuthenticateSubmit() {
 	var err error
 	var cfgPath string
@@ -371,11 +442,1774 @@ func (t *ClientTestSuite) Test_RegisterAuthenticateSubmit() {
 	err = t.client.CreateReports(types.Tags{})
 	t.Require().NoError(err, "report creation should have worked")
 
+	// retrieve the report that will be submitted
+	reportRows, err := t.client.Processor().GetReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+	t.Require().Len(reportRows, 1, "a single report should have been created")
+	report, err := t.client.Processor().ToReport(reportRows[0])
+	t.Require().NoError(err, "should be able to render report")
+
 	// submit the report to the server
 	err = t.client.Submit()
 	t.Require().NoError(err, "report submission should have worked")
+
+	// verify that the submission history records the submitted report
+	count, err := t.client.Processor().SubmissionCount(report.Header.ReportId)
+	t.Require().NoError(err, "should be able to count submissions")
+	t.Require().Equal(1, count, "report submission should have been recorded")
+
+	submissions, err := t.client.Processor().GetSubmissionRows(report.Header.ReportId)
+	t.Require().NoError(err, "should be able to retrieve submission history")
+	t.Require().Len(submissions, 1)
+	t.Require().Equal(report.Header.ReportId, submissions[0].ReportId)
+	t.Require().Equal(report.TelemetryBundles[0].Header.BundleId, submissions[0].BundleIds)
+	t.Require().Equal(report.TelemetryBundles[0].TelemetryDataItems[0].Header.TelemetryId, submissions[0].ItemIds)
+	t.Require().Equal(1, submissions[0].Attempts)
+	t.Require().NotEmpty(submissions[0].ProcessedAt)
+	t.Require().NotEmpty(submissions[0].SubmittedAt)
 }
 
-func TestTelemetryClientTestSuite(t *testing.T) {
-	suite.Run(t, new(ClientTestSuite))
+func (t *ClientTestSuite) Test_RegisterWithTransportCAFile() {
+	var err error
+	var cfgPath string
+
+	// setup TLS test server instance
+	server, caPath := t.telemetryTestTLSServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+	)
+	defer server.Close()
+
+	// without the test server's CA registration should fail
+	cfgPath, err = t.createTestConfig(server)
+	t.Require().NoError(err, "should have created config for test server")
+
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err, "should be able to create test client object from test config object")
+
+	err = t.client.Register()
+	t.Require().Error(err, "client registration should fail without trusting the test server CA")
+
+	// with the test server's CA specified registration should succeed
+	cfgPath, err = t.createTestConfig(server, fmt.Sprintf("transport:\n  ca_files:\n    - %s", caPath))
+	t.Require().NoError(err, "should have created config for test server with CA file")
+
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+	t.Require().Equal([]string{caPath}, t.cfg.Transport.CAFiles)
+
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err, "should be able to create test client object from test config object")
+
+	err = t.client.Register()
+	t.Require().NoError(err, "client registration should succeed when trusting the test server CA")
+}
+
+func (t *ClientTestSuite) Test_InvalidTransportConfig() {
+	var err error
+	var cfgPath string
+
+	server := t.telemetryTestServer()
+	defer server.Close()
+
+	// a client cert without a matching key should be rejected
+	cfgPath, err = t.createTestConfig(server, "transport:\n  client_cert: /nonexistent/client.crt")
+	t.Require().NoError(err, "should have created config for test server")
+
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+
+	_, err = NewTelemetryClient(t.cfg)
+	t.Require().Error(err, "client creation should fail with a client cert but no client key")
+
+	// a CA file that doesn't exist should be rejected
+	cfgPath, err = t.createTestConfig(server, "transport:\n  ca_files:\n    - /nonexistent/ca.pem")
+	t.Require().NoError(err, "should have created config for test server")
+
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+
+	_, err = NewTelemetryClient(t.cfg)
+	t.Require().Error(err, "client creation should fail with a missing CA file")
+
+	// an unsupported compression should be rejected
+	cfgPath, err = t.createTestConfig(server, "transport:\n  compression: lz4")
+	t.Require().NoError(err, "should have created config for test server")
+
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+
+	_, err = NewTelemetryClient(t.cfg)
+	t.Require().Error(err, "client creation should fail with an unsupported compression")
+
+	// an unsupported submission method should be rejected
+	cfgPath, err = t.createTestConfig(server, "submission:\n  method: carrier-pigeon")
+	t.Require().NoError(err, "should have created config for test server")
+
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+
+	_, err = NewTelemetryClient(t.cfg)
+	t.Require().Error(err, "client creation should fail with an unsupported submission method")
+
+	// the spool submission method requires a spool directory
+	cfgPath, err = t.createTestConfig(server, "submission:\n  method: spool\n  spool_dir: \"\"")
+	t.Require().NoError(err, "should have created config for test server")
+
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+
+	_, err = NewTelemetryClient(t.cfg)
+	t.Require().Error(err, "client creation should fail without a spool directory")
+}
+
+func (t *ClientTestSuite) Test_SubmitContextCancelled() {
+	var err error
+	var cfgPath string
+
+	// setup test server instance whose report handler doesn't respond
+	// until the test completes
+	release := make(chan struct{})
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			},
+		},
+	)
+	defer server.Close()
+	defer close(release)
+
+	cfgPath, err = t.createTestConfig(server)
+	t.Require().NoError(err, "should have created config for test server")
+
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err, "should be able to create test client object from test config object")
+
+	err = t.client.RegisterContext(context.Background())
+	t.Require().NoError(err, "client registration should succeed")
+
+	// stage a report for submission
+	err = t.client.Generate(
+		"TELEMETRY-UNIT-TEST",
+		types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+		types.Tags{},
+	)
+	t.Require().NoError(err, "data item generation should have worked")
+	t.Require().NoError(t.client.CreateBundles(types.Tags{}), "bundle creation should have worked")
+	t.Require().NoError(t.client.CreateReports(types.Tags{}), "report creation should have worked")
+
+	// submission should give up promptly once the deadline expires
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = t.client.SubmitContext(ctx)
+	t.Require().Error(err, "report submission should fail when the context expires")
+	t.Require().ErrorIs(err, context.DeadlineExceeded)
+	t.Require().Less(time.Since(start), 5*time.Second, "report submission should not wait for the server")
+
+	// the unsubmitted report should still be available
+	count, err := t.client.Processor().ReportCount()
+	t.Require().NoError(err, "should be able to count reports")
+	t.Require().Equal(1, count, "unsubmitted report should be retained")
+
+	// an already cancelled context should fail without contacting the server
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	err = t.client.SubmitContext(cancelled)
+	t.Require().ErrorIs(err, context.Canceled)
+}
+
+// setupTestClient creates a registered test client targetting the
+// specified server, with a report staged for submission.
+func (t *ClientTestSuite) setupTestClient(server *httptest.Server, extraCfg ...string) {
+	cfgPath, err := t.createTestConfig(server, extraCfg...)
+	t.Require().NoError(err, "should have created config for test server")
+
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err, "should be able to create test client object from test config object")
+
+	err = t.client.Register()
+	t.Require().NoError(err, "client registration should succeed")
+
+	err = t.client.Generate(
+		"TELEMETRY-UNIT-TEST",
+		types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+		types.Tags{},
+	)
+	t.Require().NoError(err, "data item generation should have worked")
+	t.Require().NoError(t.client.CreateBundles(types.Tags{}), "bundle creation should have worked")
+	t.Require().NoError(t.client.CreateReports(types.Tags{}), "report creation should have worked")
+}
+
+func (t *ClientTestSuite) Test_SubmitRetryAfter() {
+	var reportRequests int
+
+	// setup test server instance that is busy for the first report request
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				reportRequests++
+				if reportRequests == 1 {
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				t.reportSucessHandler(w, r)
+			},
+		},
+	)
+	defer server.Close()
+
+	t.setupTestClient(server, "submission:\n  retry_delay: 10ms")
+
+	start := time.Now()
+	err := t.client.Submit()
+	t.Require().NoError(err, "report submission should succeed after retrying")
+	t.Require().Equal(2, reportRequests, "report should have been submitted twice")
+	t.Require().GreaterOrEqual(time.Since(start), time.Second, "retry should have honoured Retry-After")
+	t.Require().False(t.client.backoff.Exists(), "no backoff should be recorded after success")
+
+	// the submission should have been recorded, including the retry
+	submissions, err := t.client.Processor().GetSubmissionRows()
+	t.Require().NoError(err, "should be able to retrieve submission history")
+	t.Require().Len(submissions, 1, "submission should have been recorded")
+	t.Require().Equal(2, submissions[0].Attempts, "submission attempts should have been recorded")
+	t.Require().Equal(t.cfg.TelemetryBaseURL, submissions[0].ServerUrl)
+	t.Require().Equal("TELEMETRY-UNIT-TEST", submissions[0].ItemTypes)
+	t.Require().Positive(submissions[0].Size)
+}
+
+func (t *ClientTestSuite) Test_SubmitServerBackoff() {
+	var reportRequests int
+
+	// setup test server instance that asks clients to go away for an hour
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				reportRequests++
+				w.Header().Set("Retry-After", "3600")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+		},
+	)
+	defer server.Close()
+
+	t.setupTestClient(server)
+
+	err := t.client.Submit()
+	t.Require().ErrorIs(err, ErrServerBackoff, "report submission should be deferred")
+	var statusErr *StatusError
+	t.Require().ErrorAs(err, &statusErr, "underlying status error should be available")
+	t.Require().Equal(http.StatusTooManyRequests, statusErr.StatusCode)
+	t.Require().Equal(1, reportRequests, "report should not be retried within the same run")
+	t.Require().True(t.client.backoff.Exists(), "backoff should have been saved")
+
+	// a new client instance should honour the saved backoff without
+	// contacting the server
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err, "should be able to create another test client object")
+	t.Require().WithinDuration(time.Now().Add(time.Hour), t.client.SubmitNotBefore(), time.Minute)
+
+	err = t.client.Submit()
+	t.Require().ErrorIs(err, ErrServerBackoff, "report submission should still be deferred")
+	t.Require().Equal(1, reportRequests, "server should not have been contacted again")
+
+	count, err := t.client.Processor().ReportCount()
+	t.Require().NoError(err, "should be able to count reports")
+	t.Require().Equal(1, count, "deferred report should be retained")
+}
+
+func (t *ClientTestSuite) Test_SubmitNonRetryableError() {
+	var reportRequests int
+
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				reportRequests++
+				http.Error(w, "forbidden", http.StatusForbidden)
+			},
+		},
+	)
+	defer server.Close()
+
+	t.setupTestClient(server, "submission:\n  retry_delay: 10ms")
+
+	err := t.client.Submit()
+	var statusErr *StatusError
+	t.Require().ErrorAs(err, &statusErr, "report submission should fail with a status error")
+	t.Require().Equal(http.StatusForbidden, statusErr.StatusCode)
+	t.Require().False(statusErr.Retryable())
+	t.Require().Equal(1, reportRequests, "non-retryable failure should not be retried")
+	t.Require().False(t.client.backoff.Exists(), "no backoff should be recorded")
+
+	// the failed attempt should have been recorded against the report
+	reportRows, err := t.client.Processor().GetReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+	t.Require().Len(reportRows, 1, "report should not have been deleted")
+	stateRow, err := t.client.Processor().GetReportState(reportRows[0])
+	t.Require().NoError(err, "should be able to retrieve report state")
+	t.Require().Equal(1, stateRow.Attempts, "failed attempt should have been recorded")
+	t.Require().False(stateRow.Quarantined, "report should not be quarantined yet")
+}
+
+func (t *ClientTestSuite) Test_SubmitQuarantinesRejectedReport() {
+	var reportRequests int
+
+	// setup test server instance that rejects the first report as invalid
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				reportRequests++
+				if reportRequests == 1 {
+					http.Error(w, "bad report", http.StatusBadRequest)
+					return
+				}
+				t.reportSucessHandler(w, r)
+			},
+		},
+	)
+	defer server.Close()
+
+	// setupTestClient stages a single report, so stage a second one
+	t.setupTestClient(server, "submission:\n  retry_delay: 10ms")
+
+	err := t.client.Generate(
+		"TELEMETRY-UNIT-TEST",
+		types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+		types.Tags{},
+	)
+	t.Require().NoError(err, "data item generation should have worked")
+	t.Require().NoError(t.client.CreateBundles(types.Tags{}), "bundle creation should have worked")
+	t.Require().NoError(t.client.CreateReports(types.Tags{}), "report creation should have worked")
+
+	reportRows, err := t.client.Processor().GetReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+	t.Require().Len(reportRows, 2, "two reports should have been staged")
+
+	// the rejected report shouldn't prevent the next one being submitted
+	err = t.client.Submit()
+	t.Require().NoError(err, "report submission should continue past rejected report")
+	t.Require().Equal(2, reportRequests, "both reports should have been submitted")
+
+	quarantinedRows, err := t.client.Processor().GetQuarantinedReportRows()
+	t.Require().NoError(err, "should be able to retrieve quarantined reports")
+	t.Require().Len(quarantinedRows, 1, "rejected report should have been quarantined")
+	t.Require().Equal(reportRows[0].ReportId, quarantinedRows[0].ReportId)
+
+	stateRow, err := t.client.Processor().GetReportState(quarantinedRows[0])
+	t.Require().NoError(err, "should be able to retrieve report state")
+	t.Require().Contains(stateRow.Reason, "bad report", "quarantine reason should include server response")
+
+	count, err := t.client.Processor().SubmissionCount(reportRows[1].ReportId)
+	t.Require().NoError(err, "should be able to count submissions")
+	t.Require().Equal(1, count, "second report should have been submitted")
+
+	// quarantined reports aren't submitted again
+	err = t.client.Submit()
+	t.Require().NoError(err, "report submission should have worked")
+	t.Require().Equal(2, reportRequests, "quarantined report should not be submitted")
+
+	// until they are re-queued
+	t.Require().NoError(t.client.Processor().RequeueReport(quarantinedRows[0]))
+	err = t.client.Submit()
+	t.Require().NoError(err, "re-queued report submission should have worked")
+	t.Require().Equal(3, reportRequests, "re-queued report should have been submitted")
+
+	count, err = t.client.Processor().ReportCount()
+	t.Require().NoError(err, "should be able to count reports")
+	t.Require().Equal(0, count, "all reports should have been submitted")
+}
+
+func (t *ClientTestSuite) Test_SubmitQuarantinesAfterMaxAttempts() {
+	var reportRequests int
+
+	// setup test server instance that always fails
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				reportRequests++
+				http.Error(w, "internal error", http.StatusInternalServerError)
+			},
+		},
+	)
+	defer server.Close()
+
+	t.setupTestClient(server, "submission:\n  retries: 0\n  max_attempts: 2")
+
+	// first failed attempt is reported
+	err := t.client.Submit()
+	var statusErr *StatusError
+	t.Require().ErrorAs(err, &statusErr, "report submission should fail with a status error")
+	t.Require().Equal(http.StatusInternalServerError, statusErr.StatusCode)
+
+	quarantinedRows, err := t.client.Processor().GetQuarantinedReportRows()
+	t.Require().NoError(err, "should be able to retrieve quarantined reports")
+	t.Require().Empty(quarantinedRows, "report should not be quarantined after first failure")
+
+	// second failed attempt quarantines the report
+	err = t.client.Submit()
+	t.Require().NoError(err, "report submission should move past quarantined report")
+	t.Require().Equal(2, reportRequests)
+
+	quarantinedRows, err = t.client.Processor().GetQuarantinedReportRows()
+	t.Require().NoError(err, "should be able to retrieve quarantined reports")
+	t.Require().Len(quarantinedRows, 1, "report should be quarantined after max attempts")
+
+	stateRow, err := t.client.Processor().GetReportState(quarantinedRows[0])
+	t.Require().NoError(err, "should be able to retrieve report state")
+	t.Require().Equal(2, stateRow.Attempts)
+
+	// quarantined report isn't submitted again
+	t.Require().NoError(t.client.Submit(), "report submission should have worked")
+	t.Require().Equal(2, reportRequests, "quarantined report should not be submitted")
+}
+
+func (t *ClientTestSuite) Test_SubmitCompressed() {
+	for _, compression := range []string{"gzip", "zstd"} {
+		var contentEncoding string
+
+		server := t.telemetryTestServer(
+			telemetryTestServerHandler{
+				Method: "POST",
+				Path:   "/register",
+				Func:   t.registerSucessHandler,
+			},
+			telemetryTestServerHandler{
+				Method: "POST",
+				Path:   "/report",
+				Func: func(w http.ResponseWriter, r *http.Request) {
+					contentEncoding = r.Header.Get("Content-Encoding")
+					t.reportSucessHandler(w, r)
+				},
+			},
+		)
+
+		t.setupTestClient(server, "transport:\n  compression: "+compression)
+
+		err := t.client.Submit()
+		t.Require().NoError(err, "%s compressed report submission should have worked", compression)
+		t.Require().Equal(compression, contentEncoding, "report should have been %s compressed", compression)
+
+		server.Close()
+	}
+}
+
+func (t *ClientTestSuite) Test_SubmitCompressedFallback() {
+	var contentEncodings []string
+
+	// setup test server instance that doesn't support compressed reports
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				contentEncodings = append(contentEncodings, r.Header.Get("Content-Encoding"))
+				if r.Header.Get("Content-Encoding") != "" {
+					w.WriteHeader(http.StatusUnsupportedMediaType)
+					return
+				}
+				t.reportSucessHandler(w, r)
+			},
+		},
+	)
+	defer server.Close()
+
+	t.setupTestClient(server, "transport:\n  compression: gzip")
+
+	err := t.client.Submit()
+	t.Require().NoError(err, "report submission should fall back to uncompressed")
+	t.Require().Equal([]string{"gzip", ""}, contentEncodings)
+
+	// the fallback only applies to the failed submission, so subsequent
+	// reports should still be sent compressed first
+	err = t.client.Generate(
+		"TELEMETRY-UNIT-TEST",
+		types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+		types.Tags{},
+	)
+	t.Require().NoError(err, "data item generation should have worked")
+	t.Require().NoError(t.client.CreateBundles(types.Tags{}), "bundle creation should have worked")
+	t.Require().NoError(t.client.CreateReports(types.Tags{}), "report creation should have worked")
+
+	err = t.client.Submit()
+	t.Require().NoError(err, "report submission should fall back to uncompressed again")
+	t.Require().Equal([]string{"gzip", "", "gzip", ""}, contentEncodings)
+	t.Require().Equal(restapi.CONTENT_ENCODING_GZIP, t.client.encoding, "configured encoding should be unchanged")
+}
+
+func (t *ClientTestSuite) Test_SubmitStreamedReport() {
+	var contentLength int64
+	var receivedReport restapi.TelemetryReportRequest
+
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				contentLength = r.ContentLength
+				body, err := restapi.ReadRequestBody(r, 0)
+				t.Require().NoError(err, "/report request should have a payload")
+				t.Require().NoError(json.Unmarshal(body, &receivedReport))
+
+				// restore the consumed body for the success handler
+				r.Body = io.NopCloser(strings.NewReader(string(body)))
+				r.Header.Del("Content-Encoding")
+				t.reportSucessHandler(w, r)
+			},
+		},
+	)
+	defer server.Close()
+
+	t.setupTestClient(server, "transport:\n  compression: zstd")
+
+	reportRows, err := t.client.Processor().GetReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+	t.Require().Len(reportRows, 1, "a single report should have been created")
+
+	err = t.client.Submit()
+	t.Require().NoError(err, "streamed report submission should have worked")
+
+	// streamed reports are sent with a chunked request body
+	t.Require().Equal(int64(-1), contentLength, "report should have been streamed")
+
+	// the checksums calculated while streaming should match the content
+	t.Require().Equal(reportRows[0].ReportId, receivedReport.Header.ReportId)
+	t.Require().NoError(receivedReport.VerifyChecksum(), "streamed report checksums should be valid")
+
+	submissions, err := t.client.Processor().GetSubmissionRows(reportRows[0].ReportId)
+	t.Require().NoError(err, "should be able to retrieve submission history")
+	t.Require().Len(submissions, 1)
+	t.Require().Equal(receivedReport.TelemetryBundles[0].Header.BundleId, submissions[0].BundleIds)
+	t.Require().Equal(receivedReport.TelemetryBundles[0].TelemetryDataItems[0].Header.TelemetryId, submissions[0].ItemIds)
+}
+
+func (t *ClientTestSuite) Test_SubmitQuarantinesCorruptedReport() {
+	var reportRequests int
+
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				// the streamed report body will be aborted by the client
+				// when the checksum mismatch is detected
+				reportRequests++
+				http.Error(w, "incomplete report", http.StatusBadRequest)
+			},
+		},
+	)
+	defer server.Close()
+
+	t.setupTestClient(server, "submission:\n  retry_delay: 10ms")
+
+	// corrupt the staged item checksums
+	t.corruptItemChecksums()
+
+	// corrupted reports are quarantined rather than retried
+	err := t.client.Submit()
+	t.Require().NoError(err, "report submission should continue past corrupted report")
+
+	quarantinedRows, err := t.client.Processor().GetQuarantinedReportRows()
+	t.Require().NoError(err, "should be able to retrieve quarantined reports")
+	t.Require().Len(quarantinedRows, 1, "corrupted report should have been quarantined")
+
+	stateRow, err := t.client.Processor().GetReportState(quarantinedRows[0])
+	t.Require().NoError(err, "should be able to retrieve report state")
+	t.Require().Contains(stateRow.Reason, "checksum", "quarantine reason should identify the checksum mismatch")
+
+	// the server may have seen the start of the streamed report, but it
+	// shouldn't have been resubmitted
+	t.Require().LessOrEqual(reportRequests, 1, "corrupted report should not be retried")
+}
+
+func (t *ClientTestSuite) Test_SubmitRefreshesExpiringToken() {
+	var requests []string
+
+	recordRequest := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.Path)
+			handler(w, r)
+		}
+	}
+
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   recordRequest(t.registerSucessHandler),
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/authenticate",
+			Func:   recordRequest(t.authenticateSucessHandler),
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func:   recordRequest(t.reportSucessHandler),
+		},
+	)
+	defer server.Close()
+
+	// register with a token that expires within the refresh window
+	t.jwt.Duration = time.Minute
+	t.setupTestClient(server, "auth:\n  refresh_window: 10m")
+
+	// subsequently issued tokens are long lived
+	t.jwt.Duration = time.Hour
+
+	err := t.client.Submit()
+	t.Require().NoError(err, "report submission should have worked")
+	t.Require().Equal(
+		[]string{"/register", "/authenticate", "/report"},
+		requests,
+		"expiring token should have been refreshed before submission",
+	)
+
+	expiration, err := t.client.AuthExpiration()
+	t.Require().NoError(err, "should be able to retrieve auth token expiration")
+	t.Require().WithinDuration(time.Now().Add(time.Hour), expiration, time.Minute)
+
+	// a long lived token should not be refreshed
+	err = t.client.RefreshIfNeeded()
+	t.Require().NoError(err, "refresh check should have worked")
+	t.Require().Len(requests, 3, "long lived token should not have been refreshed")
+}
+
+func (t *ClientTestSuite) Test_SubmitWithoutReports() {
+	var requests []string
+
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r.URL.Path)
+				t.registerSucessHandler(w, r)
+			},
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/authenticate",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r.URL.Path)
+				http.Error(w, "unavailable", http.StatusInternalServerError)
+			},
+		},
+	)
+	defer server.Close()
+
+	// register with a token that expires within the refresh window
+	t.jwt.Duration = time.Minute
+	t.setupTestClient(server, "auth:\n  refresh_window: 10m")
+
+	// remove the staged report, leaving nothing to submit
+	reportRows, err := t.client.Processor().GetReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+	for _, reportRow := range reportRows {
+		t.Require().NoError(t.client.Processor().DeleteReport(reportRow))
+	}
+
+	// the server isn't contacted if there is nothing to submit
+	err = t.client.Submit()
+	t.Require().NoError(err, "submission without reports should have worked")
+	t.Require().Equal([]string{"/register"}, requests, "auth token shouldn't have been refreshed")
+}
+
+func (t *ClientTestSuite) Test_SubmitSplitsTooLargeReport() {
+	var reportRequests int
+
+	// setup test server instance that rejects the first report as too large
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				reportRequests++
+				if reportRequests == 1 {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				t.reportSucessHandler(w, r)
+			},
+		},
+	)
+	defer server.Close()
+
+	// setupTestClient stages a report with a single bundle, so add a
+	// second bundle to the report
+	cfgPath, err := t.createTestConfig(server)
+	t.Require().NoError(err, "should have created config for test server")
+
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err, "should be able to create test client object from test config object")
+	t.Require().NoError(t.client.Register(), "client registration should succeed")
+
+	for i := 0; i < 2; i++ {
+		err = t.client.Generate(
+			"TELEMETRY-UNIT-TEST",
+			types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+			types.Tags{},
+		)
+		t.Require().NoError(err, "data item generation should have worked")
+		t.Require().NoError(t.client.CreateBundles(types.Tags{}), "bundle creation should have worked")
+	}
+	t.Require().NoError(t.client.CreateReports(types.Tags{}), "report creation should have worked")
+
+	count, err := t.client.Processor().ReportCount()
+	t.Require().NoError(err, "should be able to count reports")
+	t.Require().Equal(1, count, "a single report should have been created")
+
+	err = t.client.Submit()
+	t.Require().NoError(err, "report submission should succeed after splitting")
+	t.Require().Equal(3, reportRequests, "split reports should have been submitted")
+
+	count, err = t.client.Processor().ReportCount()
+	t.Require().NoError(err, "should be able to count reports")
+	t.Require().Equal(0, count, "all reports should have been submitted")
+}
+
+func (t *ClientTestSuite) Test_SubmitSpool() {
+	var reportRequests int
+
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				reportRequests++
+				t.reportSucessHandler(w, r)
+			},
+		},
+	)
+	defer server.Close()
+
+	spoolDir := filepath.Join(t.T().TempDir(), "spool")
+	t.setupTestClient(server, "submission:\n  method: spool\n  spool_dir: "+spoolDir)
+	t.Require().Equal(REPORT_TRANSPORT_SPOOL, t.client.ReportTransport().Name())
+
+	reportRows, err := t.client.Processor().GetReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+	t.Require().Len(reportRows, 1, "a single report should have been created")
+	reportId := reportRows[0].ReportId
+
+	// spooling reports shouldn't need the client to be authenticated
+	t.Require().NoError(t.client.creds.Remove(), "should be able to remove client credentials")
+
+	err = t.client.Submit()
+	t.Require().NoError(err, "report spooling should have worked")
+	t.Require().Equal(0, reportRequests, "server should not have been contacted")
+
+	// the spooled report should be a valid report request
+	spoolPath := filepath.Join(spoolDir, reportId+".json")
+	content, err := os.ReadFile(spoolPath)
+	t.Require().NoError(err, "spooled report should exist")
+
+	var trReq restapi.TelemetryReportRequest
+	t.Require().NoError(json.Unmarshal(content, &trReq), "spooled report should be valid JSON")
+	t.Require().Equal(reportId, trReq.Header.ReportId)
+	t.Require().NoError(trReq.Validate(), "spooled report should be valid")
+
+	// no temporary files should be left behind
+	entries, err := os.ReadDir(spoolDir)
+	t.Require().NoError(err, "should be able to list spool directory")
+	t.Require().Len(entries, 1, "only the spooled report should exist")
+
+	// the spooled report should have been removed from the datastore and
+	// recorded in the submission history
+	count, err := t.client.Processor().ReportCount()
+	t.Require().NoError(err, "should be able to count reports")
+	t.Require().Equal(0, count, "spooled report should have been deleted")
+
+	submissions, err := t.client.Processor().GetSubmissionRows(reportId)
+	t.Require().NoError(err, "should be able to retrieve submission history")
+	t.Require().Len(submissions, 1)
+	t.Require().Equal(spoolPath, submissions[0].ServerUrl)
+	t.Require().Equal(len(content), submissions[0].Size)
+}
+
+func (t *ClientTestSuite) Test_SubmitStdout() {
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+	)
+	defer server.Close()
+
+	t.setupTestClient(server, "submission:\n  method: stdout")
+	t.Require().Equal(REPORT_TRANSPORT_STDOUT, t.client.ReportTransport().Name())
+
+	// capture the output rather than writing to stdout
+	var out strings.Builder
+	t.client.SetReportTransport(newStdoutReportTransport(&out))
+
+	reportRows, err := t.client.Processor().GetReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+	t.Require().Len(reportRows, 1, "a single report should have been created")
+
+	err = t.client.Submit()
+	t.Require().NoError(err, "report output should have worked")
+
+	// each report is written as a single line of JSON
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	t.Require().Len(lines, 1, "a single report should have been written")
+
+	var trReq restapi.TelemetryReportRequest
+	t.Require().NoError(json.Unmarshal([]byte(lines[0]), &trReq), "report should be valid JSON")
+	t.Require().Equal(reportRows[0].ReportId, trReq.Header.ReportId)
+
+	count, err := t.client.Processor().ReportCount()
+	t.Require().NoError(err, "should be able to count reports")
+	t.Require().Equal(0, count, "written report should have been deleted")
+}
+
+func (t *ClientTestSuite) Test_SubmitManagedTelemetry() {
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+	)
+	defer server.Close()
+
+	cfgPath, err := t.createTestConfig(server, "submission:\n  method: stdout")
+	t.Require().NoError(err, "should have created config for test server")
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err)
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err)
+
+	t.Require().NoError(t.client.Register(), "client registration should succeed")
+
+	var out strings.Builder
+	t.client.SetReportTransport(newStdoutReportTransport(&out))
+
+	// synthesize telemetry for two managed systems
+	systemIds := []string{"system-1", "system-2"}
+	clientIds := map[string]string{}
+	for _, systemId := range systemIds {
+		err = t.client.GenerateManaged(
+			systemId,
+			"TELEMETRY-UNIT-TEST",
+			types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+			types.Tags{},
+		)
+		t.Require().NoError(err, "managed data item generation should have worked")
+
+		clientId, err := t.client.RegisterManagedClient(systemId)
+		t.Require().NoError(err)
+		t.Require().NotEqual(t.client.ClientId(), clientId)
+		clientIds[clientId] = systemId
+	}
+
+	// invalid content is rejected
+	err = t.client.GenerateManaged("system-1", "TELEMETRY-UNIT-TEST", types.NewTelemetryBlob([]byte(`{}`)), types.Tags{})
+	t.Require().Error(err)
+
+	t.Require().NoError(t.client.CreateManagedBundles(types.Tags{}))
+	t.Require().NoError(t.client.CreateReports(types.Tags{}))
+	t.Require().NoError(t.client.Submit())
+
+	// the managed bundles are aggregated into a single report from the
+	// management framework client
+	var trReq restapi.TelemetryReportRequest
+	t.Require().NoError(json.Unmarshal([]byte(strings.TrimSpace(out.String())), &trReq))
+	t.Equal(t.client.ClientId(), trReq.Header.ReportClientId)
+	t.Require().Len(trReq.TelemetryBundles, 2)
+	for _, bundle := range trReq.TelemetryBundles {
+		clientId := bundle.Header.BundleClientId
+		t.Contains(clientIds, clientId)
+		t.Contains(
+			bundle.Header.BundleAnnotations,
+			fmt.Sprintf("RELAYED_VIA=%s:%s", clientId, t.client.ClientId()),
+		)
+	}
+}
+
+func (t *ClientTestSuite) Test_GenerateEnforcesStagingLimits() {
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+	)
+	defer server.Close()
+
+	cfgPath, err := t.createTestConfig(server, "staging:\n  max_items_per_type: 2")
+	t.Require().NoError(err, "should have created config for test server")
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err)
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err)
+
+	for i := 0; i < 3; i++ {
+		err = t.client.Generate(
+			"TELEMETRY-UNIT-TEST",
+			types.NewTelemetryBlob([]byte(fmt.Sprintf(`{"version":1,"data":{"item":%d}}`, i))),
+			types.Tags{},
+		)
+		t.Require().NoError(err, "data item generation should have worked")
+	}
+
+	// the oldest item should have been evicted to stay within the limit
+	itemCount, err := t.client.Processor().ItemCount()
+	t.Require().NoError(err)
+	t.Equal(2, itemCount)
+
+	evictionRows, err := t.client.Processor().GetEvictionRows()
+	t.Require().NoError(err)
+	t.Require().Len(evictionRows, 1)
+	t.Equal(telemetrylib.EVICTION_REASON_MAX_ITEMS_PER_TYPE, evictionRows[0].Reason)
+	t.Equal("TELEMETRY-UNIT-TEST", evictionRows[0].ItemType)
+	t.Equal(1, evictionRows[0].ItemCount)
+}
+
+func (t *ClientTestSuite) Test_ReconcileConsent() {
+	var submittedItems []telemetrylib.TelemetryDataItem
+
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				body, err := restapi.ReadRequestBody(r, 0)
+				t.Require().NoError(err, "should be able to read report body")
+
+				var trReq restapi.TelemetryReportRequest
+				t.Require().NoError(json.Unmarshal(body, &trReq), "should be able to unmarshal report")
+				for _, bundle := range trReq.TelemetryBundles {
+					submittedItems = append(submittedItems, bundle.TelemetryDataItems...)
+				}
+
+				r.Body = io.NopCloser(strings.NewReader(string(body)))
+				t.reportSucessHandler(w, r)
+			},
+		},
+	)
+	defer server.Close()
+
+	// stage a report containing an opt-out item, alongside the report
+	// containing a mandatory item
+	t.setupTestClient(server)
+	err := t.client.GenerateWithClass(
+		"TELEMETRY-UNIT-TEST",
+		types.OPT_OUT_TELEMETRY,
+		types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+		types.Tags{},
+	)
+	t.Require().NoError(err, "data item generation should have worked")
+	t.Require().NoError(t.client.CreateBundles(types.Tags{}))
+	t.Require().NoError(t.client.CreateReports(types.Tags{}))
+
+	// opt-out telemetry should not be submitted once consent is withdrawn
+	t.cfg.ClassOptions.OptOut = false
+	t.Require().NoError(t.client.Submit(), "report submission should have worked")
+	t.Require().Len(submittedItems, 1, "only the mandatory item should have been submitted")
+	class, err := submittedItems[0].Header.Class()
+	t.Require().NoError(err)
+	t.Equal(types.MANDATORY_TELEMETRY, class)
+
+	// telemetry of a denied type is purged when the client is created
+	err = t.client.Generate(
+		"TELEMETRY-DENIED-TEST",
+		types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+		types.Tags{},
+	)
+	t.Require().NoError(err, "data item generation should have worked")
+	t.cfg.ClassOptions.Deny = []types.TelemetryType{"TELEMETRY-DENIED-TEST"}
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err)
+
+	itemCount, err := t.client.Processor().ItemCount()
+	t.Require().NoError(err)
+	t.Equal(0, itemCount)
+
+	// the purges are recorded as evictions
+	evictionRows, err := t.client.Processor().GetEvictionRows()
+	t.Require().NoError(err)
+	t.Require().Len(evictionRows, 2)
+	t.Equal(telemetrylib.EVICTION_REASON_CLASS_WITHDRAWN, evictionRows[0].Reason)
+	t.Equal(types.OPT_OUT_TELEMETRY, evictionRows[0].ItemClass)
+	t.Equal(telemetrylib.EVICTION_REASON_TYPE_WITHDRAWN, evictionRows[1].Reason)
+	t.Equal("TELEMETRY-DENIED-TEST", evictionRows[1].ItemType)
+}
+
+func (t *ClientTestSuite) Test_GenerateRejectsWithheldConsent() {
+	server := t.telemetryTestServer()
+	defer server.Close()
+
+	cfgPath, err := t.createTestConfig(server)
+	t.Require().NoError(err, "should have created config for test server")
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err)
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err)
+
+	content := types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`))
+
+	// opt-in telemetry isn't enabled by the test config
+	err = t.client.GenerateWithClass("TELEMETRY-UNIT-TEST", types.OPT_IN_TELEMETRY, content, types.Tags{})
+	t.ErrorIs(err, ErrTelemetryClassNotAllowed)
+	err = t.client.GenerateManagedWithClass("system-1", "TELEMETRY-UNIT-TEST", types.OPT_IN_TELEMETRY, content, types.Tags{})
+	t.ErrorIs(err, ErrTelemetryClassNotAllowed)
+
+	// nor is telemetry of a denied type
+	t.cfg.ClassOptions.Deny = []types.TelemetryType{"TELEMETRY-DENIED-TEST"}
+	err = t.client.Generate("TELEMETRY-DENIED-TEST", content, types.Tags{})
+	t.ErrorIs(err, ErrTelemetryTypeNotAllowed)
+
+	itemCount, err := t.client.Processor().ItemCount()
+	t.Require().NoError(err)
+	t.Equal(0, itemCount, "rejected telemetry should not have been staged")
+
+	// permitted telemetry is still staged
+	err = t.client.GenerateWithClass("TELEMETRY-UNIT-TEST", types.OPT_OUT_TELEMETRY, content, types.Tags{})
+	t.Require().NoError(err)
+	itemCount, err = t.client.Processor().ItemCount()
+	t.Require().NoError(err)
+	t.Equal(1, itemCount)
+}
+
+func (t *ClientTestSuite) Test_ReloadConsent() {
+	server := t.telemetryTestServer()
+	defer server.Close()
+
+	cfgPath, err := t.createTestConfig(server)
+	t.Require().NoError(err, "should have created config for test server")
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err)
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err)
+
+	err = t.client.GenerateWithClass(
+		"TELEMETRY-UNIT-TEST",
+		types.OPT_OUT_TELEMETRY,
+		types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+		types.Tags{},
+	)
+	t.Require().NoError(err, "data item generation should have worked")
+	t.Require().NoError(t.client.CreateBundles(types.Tags{}))
+
+	// withdrawing opt-out consent in the config file purges the staged
+	// opt-out telemetry once the consent settings are reloaded
+	content, err := os.ReadFile(cfgPath)
+	t.Require().NoError(err)
+	content = []byte(strings.Replace(string(content), "opt_out: true", "opt_out: false", 1))
+	t.Require().NoError(os.WriteFile(cfgPath, content, 0600))
+
+	t.Require().NoError(t.client.ReloadConsent())
+	t.False(t.cfg.ClassOptions.OptOut, "the reloaded consent settings should be in effect")
+
+	itemCount, err := t.client.Processor().ItemCount()
+	t.Require().NoError(err)
+	t.Equal(0, itemCount)
+	bundleCount, err := t.client.Processor().BundleCount()
+	t.Require().NoError(err)
+	t.Equal(0, bundleCount)
+
+	evictionRows, err := t.client.Processor().GetEvictionRows()
+	t.Require().NoError(err)
+	t.Require().Len(evictionRows, 1)
+	t.Equal(telemetrylib.EVICTION_REASON_CLASS_WITHDRAWN, evictionRows[0].Reason)
+
+	// and opt-out telemetry is now rejected
+	err = t.client.GenerateWithClass(
+		"TELEMETRY-UNIT-TEST",
+		types.OPT_OUT_TELEMETRY,
+		types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+		types.Tags{},
+	)
+	t.ErrorIs(err, ErrTelemetryClassNotAllowed)
+}
+
+func (t *ClientTestSuite) Test_ExportImportReports() {
+	var submittedReports []string
+
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				body, err := restapi.ReadRequestBody(r, 0)
+				t.Require().NoError(err, "should be able to read report body")
+
+				var trReq restapi.TelemetryReportRequest
+				t.Require().NoError(json.Unmarshal(body, &trReq), "should be able to unmarshal report")
+				submittedReports = append(submittedReports, trReq.Header.ReportId)
+
+				r.Body = io.NopCloser(strings.NewReader(string(body)))
+				t.reportSucessHandler(w, r)
+			},
+		},
+	)
+	defer server.Close()
+
+	// setupTestClient stages a single report, so stage a second one
+	t.setupTestClient(server)
+	err := t.client.Generate(
+		"TELEMETRY-UNIT-TEST",
+		types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+		types.Tags{},
+	)
+	t.Require().NoError(err, "data item generation should have worked")
+	t.Require().NoError(t.client.CreateBundles(types.Tags{}), "bundle creation should have worked")
+	t.Require().NoError(t.client.CreateReports(types.Tags{}), "report creation should have worked")
+
+	reportRows, err := t.client.Processor().GetReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+	t.Require().Len(reportRows, 2, "two reports should have been staged")
+
+	// exported reports remain staged by default
+	archivePath := filepath.Join(t.tmpDir, "reports.tar.gz")
+	manifest, err := t.client.ExportReports(archivePath, false)
+	t.Require().NoError(err, "report export should have worked")
+	t.Require().Len(manifest.Reports, 2, "both reports should have been exported")
+
+	count, err := t.client.Processor().ReportCount()
+	t.Require().NoError(err, "should be able to count reports")
+	t.Require().Equal(2, count, "exported reports should not have been removed")
+
+	count, err = t.client.Processor().SubmissionCount()
+	t.Require().NoError(err, "should be able to count submissions")
+	t.Require().Equal(0, count, "exported reports should not have been recorded")
+
+	// export the pending reports, removing them from the datastore
+	manifest, err = t.client.ExportReports(archivePath, true)
+	t.Require().NoError(err, "report export should have worked")
+	t.Require().Len(manifest.Reports, 2, "both reports should have been exported")
+	t.Require().Equal(t.client.ClientId(), manifest.ClientId)
+	t.Require().Empty(submittedReports, "export should not contact the server")
+
+	count, err = t.client.Processor().ReportCount()
+	t.Require().NoError(err, "should be able to count reports")
+	t.Require().Equal(0, count, "exported reports should have been removed")
+
+	submissions, err := t.client.Processor().GetSubmissionRows()
+	t.Require().NoError(err, "should be able to retrieve submission history")
+	t.Require().Len(submissions, 2, "exported reports should have been recorded")
+	t.Require().Equal(archivePath, submissions[0].ServerUrl)
+
+	// the archive should contain the exported reports
+	readManifest, reports, err := ReadReportArchive(archivePath)
+	t.Require().NoError(err, "archive should be valid")
+	t.Require().Equal(manifest, readManifest)
+	t.Require().Len(reports, 2)
+	for i, reportRow := range reportRows {
+		t.Require().Equal(reportRow.ReportId, reports[i].Header.ReportId)
+	}
+
+	// import the archive using a different client
+	importer := t.newImporter(server)
+
+	_, err = importer.ImportReports(archivePath)
+	t.Require().NoError(err, "report import should have worked")
+	t.Require().Equal([]string{reportRows[0].ReportId, reportRows[1].ReportId}, submittedReports)
+
+	count, err = importer.Processor().SubmissionCount()
+	t.Require().NoError(err, "should be able to count submissions")
+	t.Require().Equal(2, count, "imported reports should have been recorded")
+
+	// re-importing the archive shouldn't resubmit the reports
+	_, err = importer.ImportReports(archivePath)
+	t.Require().NoError(err, "repeated report import should have worked")
+	t.Require().Len(submittedReports, 2, "imported reports should not be resubmitted")
+}
+
+// stageMultiBundleReport stages a report containing two bundles, each
+// containing a single data item, alongside the report staged by
+// setupTestClient, returning the report
+func (t *ClientTestSuite) stageMultiBundleReport() (reportRow *telemetrylib.TelemetryReportRow) {
+	reportRows, err := t.client.Processor().GetReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+
+	for i := 0; i < 2; i++ {
+		err := t.client.Generate(
+			"TELEMETRY-UNIT-TEST",
+			types.NewTelemetryBlob([]byte(fmt.Sprintf(`{"version":1,"data":{"index":%d}}`, i))),
+			types.Tags{},
+		)
+		t.Require().NoError(err, "data item generation should have worked")
+		t.Require().NoError(t.client.CreateBundles(types.Tags{}), "bundle creation should have worked")
+	}
+	t.Require().NoError(t.client.CreateReports(types.Tags{}), "report creation should have worked")
+
+	newRows, err := t.client.Processor().GetReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+	t.Require().Len(newRows, len(reportRows)+1, "a report should have been staged")
+	for _, newRow := range newRows {
+		if !slices.ContainsFunc(reportRows, func(r *telemetrylib.TelemetryReportRow) bool { return r.ReportId == newRow.ReportId }) {
+			reportRow = newRow
+		}
+	}
+
+	return
+}
+
+// newImporter creates and registers a second client, with its own
+// datastore, that submits to the specified server
+func (t *ClientTestSuite) newImporter(server *httptest.Server) *TelemetryClient {
+	exporterTmpDir := t.tmpDir
+	t.tmpDir = filepath.Join(exporterTmpDir, "importer")
+	defer func() { t.tmpDir = exporterTmpDir }()
+	t.Require().NoError(os.MkdirAll(t.tmpDir, 0700))
+
+	cfgPath, err := t.createTestConfig(server)
+	t.Require().NoError(err, "should have created config for test server")
+	importerCfg, err := config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+	importer, err := NewTelemetryClient(importerCfg)
+	t.Require().NoError(err, "should be able to create test client object from test config object")
+	t.Require().NoError(importer.Register(), "client registration should succeed")
+
+	return importer
+}
+
+func (t *ClientTestSuite) Test_ExportReportsWithinArchiveLimits() {
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+	)
+	defer server.Close()
+
+	t.setupTestClient(server)
+	smallRows, err := t.client.Processor().GetReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+	t.Require().Len(smallRows, 1)
+	bigRow := t.stageMultiBundleReport()
+
+	_, smallSize, err := t.client.Processor().WriteReport(smallRows[0], io.Discard)
+	t.Require().NoError(err, "should be able to write report")
+	_, bigSize, err := t.client.Processor().WriteReport(bigRow, io.Discard)
+	t.Require().NoError(err, "should be able to write report")
+
+	defer func(entrySize, totalSize int64) {
+		reportArchiveMaxEntrySize = entrySize
+		reportArchiveMaxTotalSize = totalSize
+	}(reportArchiveMaxEntrySize, reportArchiveMaxTotalSize)
+
+	// reports too large for an archive entry are split for export, and
+	// reports that don't fit in the archive are left for a later export
+	reportArchiveMaxEntrySize = bigSize - 1
+	reportArchiveMaxTotalSize = smallSize + reportArchiveMaxEntrySize
+
+	archivePath := filepath.Join(t.tmpDir, "reports.tar.gz")
+	manifest, err := t.client.ExportReports(archivePath, true)
+	t.Require().NoError(err, "report export should have worked")
+	t.Require().Len(manifest.Reports, 2, "the small report and one part of the split report should fit")
+
+	var totalSize int
+	for _, entry := range manifest.Reports {
+		t.NotEqual(bigRow.ReportId, entry.ReportId, "the large report should have been split")
+		t.LessOrEqual(int64(entry.Size), reportArchiveMaxEntrySize)
+		totalSize += entry.Size
+	}
+	t.LessOrEqual(int64(totalSize), reportArchiveMaxTotalSize)
+
+	_, reports, err := ReadReportArchive(archivePath)
+	t.Require().NoError(err, "archive should be valid")
+	t.Require().Len(reports, 2)
+
+	reportRows, err := t.client.Processor().GetPendingReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+	t.Require().Len(reportRows, 1, "the report that didn't fit should still be pending")
+
+	// the remaining report can be exported to another archive
+	manifest, err = t.client.ExportReports(filepath.Join(t.tmpDir, "more-reports.tar.gz"), true)
+	t.Require().NoError(err, "report export should have worked")
+	t.Require().Len(manifest.Reports, 1)
+	t.Equal(reportRows[0].ReportId, manifest.Reports[0].ReportId)
+}
+
+func (t *ClientTestSuite) Test_ImportHandlesRejectedReports() {
+	var bigReportId, invalidReportId string
+	var submittedReports []string
+
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				body, err := restapi.ReadRequestBody(r, 0)
+				t.Require().NoError(err, "should be able to read report body")
+
+				var trReq restapi.TelemetryReportRequest
+				t.Require().NoError(json.Unmarshal(body, &trReq), "should be able to unmarshal report")
+
+				switch trReq.Header.ReportId {
+				case bigReportId:
+					http.Error(w, "too large", http.StatusRequestEntityTooLarge)
+					return
+				case invalidReportId:
+					http.Error(w, "invalid", http.StatusBadRequest)
+					return
+				}
+
+				t.Require().NoError(trReq.VerifyChecksum(), "submitted report should be valid")
+				submittedReports = append(submittedReports, trReq.Header.ReportId)
+				r.Body = io.NopCloser(strings.NewReader(string(body)))
+				t.reportSucessHandler(w, r)
+			},
+		},
+	)
+	defer server.Close()
+
+	t.setupTestClient(server)
+	invalidRows, err := t.client.Processor().GetReportRows()
+	t.Require().NoError(err, "should be able to retrieve reports")
+	t.Require().Len(invalidRows, 1)
+	invalidReportId = invalidRows[0].ReportId
+	bigReportId = t.stageMultiBundleReport().ReportId
+
+	archivePath := filepath.Join(t.tmpDir, "reports.tar.gz")
+	_, err = t.client.ExportReports(archivePath, true)
+	t.Require().NoError(err, "report export should have worked")
+
+	// the large report is split and its parts submitted, while the invalid
+	// report is rejected, without preventing the import of other reports
+	importer := t.newImporter(server)
+	manifest, err := importer.ImportReports(archivePath)
+	t.Require().ErrorIs(err, ErrReportRejected, "the invalid report should have been rejected")
+	t.Require().ErrorContains(err, invalidReportId)
+	t.Require().NotNil(manifest, "manifest should be returned for rejected reports")
+	t.Require().Len(submittedReports, 2, "the parts of the large report should have been submitted")
+	t.NotContains(submittedReports, bigReportId)
+
+	count, err := importer.Processor().SubmissionCount(bigReportId)
+	t.Require().NoError(err, "should be able to count submissions")
+	t.Equal(1, count, "the large report should have been recorded as submitted")
+	count, err = importer.Processor().SubmissionCount(invalidReportId)
+	t.Require().NoError(err, "should be able to count submissions")
+	t.Equal(0, count, "the invalid report should not have been recorded as submitted")
+
+	// re-importing the archive doesn't resubmit the large report's parts
+	_, err = importer.ImportReports(archivePath)
+	t.Require().ErrorIs(err, ErrReportRejected, "the invalid report should have been rejected again")
+	t.Len(submittedReports, 2, "imported reports should not be resubmitted")
+}
+
+// writeTestArchive writes the specified files to a gzip compressed tar
+// file, in the specified order
+func (t *ClientTestSuite) writeTestArchive(archivePath string, files []testArchiveFile) {
+	archive, err := os.Create(archivePath)
+	t.Require().NoError(err, "should be able to create archive")
+	defer archive.Close()
+
+	gzWriter := gzip.NewWriter(archive)
+	tarWriter := tar.NewWriter(gzWriter)
+	for _, file := range files {
+		name, content := file.name, file.content
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(content))}
+		t.Require().NoError(tarWriter.WriteHeader(hdr), "should be able to add archive entry")
+		_, err = tarWriter.Write(content)
+		t.Require().NoError(err, "should be able to write archive entry")
+	}
+	t.Require().NoError(tarWriter.Close(), "should be able to close tar writer")
+	t.Require().NoError(gzWriter.Close(), "should be able to close gzip writer")
+}
+
+type testArchiveFile struct {
+	name    string
+	content []byte
+}
+
+func (t *ClientTestSuite) Test_ImportRejectsInvalidArchive() {
+	var reportRequests int
+
+	server := t.telemetryTestServer(
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/register",
+			Func:   t.registerSucessHandler,
+		},
+		telemetryTestServerHandler{
+			Method: "POST",
+			Path:   "/report",
+			Func: func(w http.ResponseWriter, r *http.Request) {
+				reportRequests++
+				t.reportSucessHandler(w, r)
+			},
+		},
+	)
+	defer server.Close()
+
+	t.setupTestClient(server)
+
+	archivePath := filepath.Join(t.tmpDir, "reports.tar.gz")
+	_, err := t.client.ExportReports(archivePath, true)
+	t.Require().NoError(err, "report export should have worked")
+
+	manifest, reports, err := ReadReportArchive(archivePath)
+	t.Require().NoError(err, "archive should be valid")
+	t.Require().Len(reports, 1)
+
+	content, err := marshalReport(reports[0])
+	t.Require().NoError(err, "should be able to marshal report")
+
+	// tamper with the report, updating the manifest to match the content
+	// so that only the report checksum is wrong
+	tampered := *reports[0]
+	tampered.Header.ReportAnnotations = []string{"TAMPERED"}
+	tampered.TelemetryBundles = append([]telemetrylib.TelemetryBundle{}, tampered.TelemetryBundles...)
+	tampered.TelemetryBundles[0].Header.BundleCustomerId = "TAMPERED"
+	tamperedContent, err := marshalReport(&tampered)
+	t.Require().NoError(err, "should be able to marshal tampered report")
+
+	tamperedManifest := *manifest
+	tamperedManifest.Reports = []ReportArchiveEntry{manifest.Reports[0]}
+	tamperedManifest.Reports[0].Size = len(tamperedContent)
+	tamperedManifest.Reports[0].Sha256 = sha256Hex(tamperedContent)
+
+	manifestJSON, err := json.Marshal(manifest)
+	t.Require().NoError(err, "should be able to marshal manifest")
+	tamperedManifestJSON, err := json.Marshal(&tamperedManifest)
+	t.Require().NoError(err, "should be able to marshal tampered manifest")
+	reportFile := manifest.Reports[0].File
+
+	duplicateManifest := *manifest
+	duplicateManifest.Reports = []ReportArchiveEntry{manifest.Reports[0], manifest.Reports[0]}
+	duplicateManifestJSON, err := json.Marshal(&duplicateManifest)
+	t.Require().NoError(err, "should be able to marshal duplicate manifest")
+
+	testCases := []struct {
+		name  string
+		files []testArchiveFile
+	}{
+		{"tampered report", []testArchiveFile{
+			{REPORT_ARCHIVE_MANIFEST, tamperedManifestJSON},
+			{reportFile, tamperedContent},
+		}},
+		{"corrupt report", []testArchiveFile{
+			{REPORT_ARCHIVE_MANIFEST, manifestJSON},
+			{reportFile, append([]byte(" "), content...)},
+		}},
+		{"missing report", []testArchiveFile{
+			{REPORT_ARCHIVE_MANIFEST, manifestJSON},
+		}},
+		{"duplicate report", []testArchiveFile{
+			{REPORT_ARCHIVE_MANIFEST, duplicateManifestJSON},
+			{reportFile, content},
+			{reportFile, content},
+		}},
+		{"unlisted file", []testArchiveFile{
+			{REPORT_ARCHIVE_MANIFEST, manifestJSON},
+			{reportFile, content},
+			{"reports/extra.json", content},
+		}},
+		{"missing manifest", []testArchiveFile{
+			{reportFile, content},
+		}},
+		{"manifest not first", []testArchiveFile{
+			{reportFile, content},
+			{REPORT_ARCHIVE_MANIFEST, manifestJSON},
+		}},
+	}
+
+	for _, tc := range testCases {
+		invalidPath := filepath.Join(t.tmpDir, "invalid.tar.gz")
+		t.writeTestArchive(invalidPath, tc.files)
+
+		_, _, err = ReadReportArchive(invalidPath)
+		t.Require().ErrorIs(err, ErrInvalidReportArchive, "%s: archive should fail verification", tc.name)
+
+		_, err = t.client.ImportReports(invalidPath)
+		t.Require().ErrorIs(err, ErrInvalidReportArchive, "%s: import should fail verification", tc.name)
+	}
+
+	// the original archive remains valid
+	_, _, err = ReadReportArchive(archivePath)
+	t.Require().NoError(err, "archive should be valid")
+
+	t.Require().Equal(0, reportRequests, "no reports should have been submitted")
+}
+
+func (t *ClientTestSuite) Test_SubmitRecoversFromChallenges() {
+	server := telemetrytest.NewServer()
+	defer server.Close()
+
+	t.setupTestClient(server.Server, "submission:\n  retry_delay: 10ms")
+	t.Require().Len(server.Registrations(), 1, "client should have registered")
+
+	// the client should re-register, then re-authenticate, before the
+	// report is accepted
+	server.Inject(
+		telemetrytest.PATH_REPORT,
+		telemetrytest.ChallengeFault(restapi.AUTH_SCOPE_REGISTER),
+		telemetrytest.ChallengeFault(restapi.AUTH_SCOPE_AUTHENTICATE),
+	)
+
+	err := t.client.Submit()
+	t.Require().NoError(err, "report submission should succeed after recovering")
+	t.Require().Equal(3, server.Requests(telemetrytest.PATH_REPORT))
+	t.Require().Equal(2, server.Requests(telemetrytest.PATH_REGISTER))
+	t.Require().Equal(1, server.Requests(telemetrytest.PATH_AUTHENTICATE))
+
+	regs := server.Registrations()
+	t.Require().Len(regs, 1, "re-registration should replace the existing registration")
+	t.Require().Equal(regs[0].RegistrationId, t.client.RegistrationId())
+
+	bundles := server.Bundles()
+	t.Require().Len(bundles, 1, "server should have received the staged bundle")
+	t.Require().Equal("TELEMETRY-UNIT-TEST", string(bundles[0].TelemetryDataItems[0].Header.TelemetryType))
+}
+
+func (t *ClientTestSuite) Test_RegisterFaults() {
+	server := telemetrytest.NewServer()
+	defer server.Close()
+
+	cfgPath, err := t.createTestConfig(server.Server)
+	t.Require().NoError(err, "should have created config for test server")
+
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+
+	// a malformed response should fail registration
+	server.Inject(telemetrytest.PATH_REGISTER, telemetrytest.MalformedFault())
+
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err, "should be able to create test client object from test config object")
+
+	err = t.client.Register()
+	t.Require().Error(err, "client registration should fail with a malformed response")
+	t.Require().Zero(t.client.RegistrationId())
+
+	// a conflicting registration should be regenerated and retried once
+	server.Inject(telemetrytest.PATH_REGISTER, telemetrytest.ConflictFault())
+
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err, "should be able to create another test client object")
+
+	err = t.client.Register()
+	t.Require().NoError(err, "client registration should succeed after a conflict")
+	t.Require().Equal(3, server.Requests(telemetrytest.PATH_REGISTER))
+	t.Require().Len(server.Registrations(), 1)
+
+	// a slow server should be abandoned once the context expires
+	server.Inject(telemetrytest.PATH_REPORT, telemetrytest.SlowFault(5*time.Second))
+
+	err = t.client.Generate(
+		"TELEMETRY-UNIT-TEST",
+		types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+		types.Tags{},
+	)
+	t.Require().NoError(err, "data item generation should have worked")
+	t.Require().NoError(t.client.CreateBundles(types.Tags{}), "bundle creation should have worked")
+	t.Require().NoError(t.client.CreateReports(types.Tags{}), "report creation should have worked")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err = t.client.SubmitContext(ctx)
+	t.Require().ErrorIs(err, context.DeadlineExceeded)
+	t.Require().Empty(server.Reports(), "slow report should not have been received")
+}
+
+func (t *ClientTestSuite) Test_VerifyAuthToken() {
+	server := telemetrytest.NewServer()
+	defer server.Close()
+
+	// the server signs tokens with a key whose public key is trusted
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	t.Require().NoError(err, "should be able to generate a server signing key")
+	server.UseSigningKey(jwt.SigningMethodES256, serverKey, "")
+
+	keyDer, err := x509.MarshalPKIXPublicKey(serverKey.Public())
+	t.Require().NoError(err, "should be able to marshal the server public key")
+	keyFile, err := t.createTemp("server-key.pem")
+	t.Require().NoError(err, "should be able to create a temp public key file")
+	t.Require().NoError(pem.Encode(keyFile, &pem.Block{Type: "PUBLIC KEY", Bytes: keyDer}))
+	t.Require().NoError(keyFile.Close())
+
+	cfgPath, err := t.createTestConfig(
+		server.Server,
+		fmt.Sprintf("auth:\n  verify:\n    public_keys:\n      - %s\n    issuer: %s", keyFile.Name(), telemetrytest.TOKEN_ISSUER),
+	)
+	t.Require().NoError(err, "should have created config for test server")
+
+	t.cfg, err = config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to create test config object from test config file")
+	t.Require().True(t.cfg.Auth.Verify.Enabled(), "auth token verification should be enabled")
+
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err, "should be able to create test client object from test config object")
+
+	err = t.client.Register()
+	t.Require().NoError(err, "client registration should succeed with a trusted token")
+
+	issuer, err := t.client.AuthIssuer()
+	t.Require().NoError(err, "verified token issuer should be available")
+	t.Require().Equal(telemetrytest.TOKEN_ISSUER, issuer)
+
+	// a tampered credentials file should be detected, and replaced by
+	// re-authenticating
+	parts := strings.Split(string(t.client.creds.AuthToken), ".")
+	t.client.creds.AuthToken = strings.Join([]string{parts[0], parts[1], parts[2][:len(parts[2])-4] + "AAAA"}, ".")
+	t.Require().NoError(t.client.creds.Save(), "should be able to save tampered credentials")
+
+	t.client, err = NewTelemetryClient(t.cfg)
+	t.Require().NoError(err, "should be able to create another test client object")
+
+	_, err = t.client.AuthIssuer()
+	t.Require().Error(err, "tampered token should fail verification")
+
+	err = t.client.RefreshIfNeeded()
+	t.Require().NoError(err, "tampered token should be refreshed")
+	t.Require().Equal(1, server.Requests(telemetrytest.PATH_AUTHENTICATE))
+	_, err = t.client.AuthIssuer()
+	t.Require().NoError(err, "refreshed token should pass verification")
+
+	// tokens signed by an untrusted key should be rejected
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	t.Require().NoError(err, "should be able to generate another signing key")
+	server.UseSigningKey(jwt.SigningMethodES256, otherKey, "")
+
+	err = t.client.Authenticate()
+	t.Require().Error(err, "authentication should fail with an untrusted token")
+	_, err = t.client.AuthIssuer()
+	t.Require().NoError(err, "untrusted token should not have been saved")
+}
+
+func (t *ClientTestSuite) Test_ParseRetryAfter() {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	delay, ok := parseRetryAfter("120", now)
+	t.True(ok)
+	t.Equal(2*time.Minute, delay)
+
+	delay, ok = parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now)
+	t.True(ok)
+	t.Equal(90*time.Second, delay)
+
+	delay, ok = parseRetryAfter(now.Add(-time.Hour).Format(http.TimeFormat), now)
+	t.True(ok)
+	t.Zero(delay)
+
+	for _, invalid := range []string{"", "-5", "soon"} {
+		_, ok = parseRetryAfter(invalid, now)
+		t.False(ok, "%q should not be a valid Retry-After", invalid)
+	}
+
+	// backoff grows exponentially, with jitter, up to the max delay
+	for attempt := 0; attempt < 10; attempt++ {
+		delay = retryBackoff(attempt, time.Second, time.Minute)
+		expected := min(time.Second<<attempt, time.Minute)
+		t.GreaterOrEqual(delay, expected/2)
+		t.LessOrEqual(delay, expected)
+	}
+}
+
+func TestTelemetryClientTestSuite(t *testing.T) {
+	if !telemetrylib.DataStoreDriverAvailable(telemetrylib.DATASTORE_DRIVER_SQLITE3) {
+		t.Skip("sqlite3 datastore requires cgo")
+	}
+	suite.Run(t, &ClientTestSuite{driver: telemetrylib.DATASTORE_DRIVER_SQLITE3})
+}
+
+func TestTelemetryClientSpoolTestSuite(t *testing.T) {
+	suite.Run(t, &ClientTestSuite{driver: telemetrylib.DATASTORE_DRIVER_SPOOL})
 }
@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,7 +12,14 @@ import (
 	"github.com/SUSE/telemetry/pkg/restapi"
 )
 
+// Register registers the client with the server, if it is not already
+// registered.
 func (tc *TelemetryClient) Register() (err error) {
+	return tc.RegisterContext(context.Background())
+}
+
+// RegisterContext is the context aware variant of Register.
+func (tc *TelemetryClient) RegisterContext(ctx context.Context) (err error) {
 	// get the registration, failing if it can't be retrieved
 	reg, err := tc.getRegistration()
 	if err != nil {
@@ -41,7 +49,7 @@ func (tc *TelemetryClient) Register() (err error) {
 
 	reqUrl := tc.cfg.TelemetryBaseURL + "/register"
 	reqBuf := bytes.NewBuffer(reqBodyJSON)
-	req, err := http.NewRequest("POST", reqUrl, reqBuf)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqUrl, reqBuf)
 	if err != nil {
 		slog.Error(
 			"failed to create new HTTP request for client registration",
@@ -52,8 +60,7 @@ func (tc *TelemetryClient) Register() (err error) {
 
 	req.Header.Add("Content-Type", "application/json")
 
-	httpClient := http.DefaultClient
-	resp, err := httpClient.Do(req)
+	resp, err := tc.httpClient.Do(req)
 	if err != nil {
 		slog.Error(
 			"failed to HTTP POST client registration request",
@@ -97,7 +104,7 @@ func (tc *TelemetryClient) Register() (err error) {
 			tc.reg.DisableRetries()
 
 			// retry client registration
-			return tc.Register()
+			return tc.RegisterContext(ctx)
 		}
 		fallthrough
 
@@ -117,6 +124,11 @@ func (tc *TelemetryClient) Register() (err error) {
 		return
 	}
 
+	// don't save credentials that can't be trusted
+	if err = tc.verifyAuthToken(crResp.AuthToken); err != nil {
+		return
+	}
+
 	err = tc.creds.UpdateCreds(&crResp)
 	if err != nil {
 		slog.Error(
@@ -1,7 +1,7 @@
 package client
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,31 +14,105 @@ import (
 	"github.com/SUSE/telemetry/pkg/restapi"
 )
 
-func (tc *TelemetryClient) submitReportInternal(report *telemetrylib.TelemetryReport) (err error) {
+// httpReportTransport submits reports to the telemetry server via HTTP
+// POST requests, authenticated using the client's credentials.
+type httpReportTransport struct {
+	tc *TelemetryClient
+}
+
+func (h *httpReportTransport) Name() string {
+	return REPORT_TRANSPORT_HTTP
+}
+
+func (h *httpReportTransport) Authenticated() bool {
+	return true
+}
+
+func (h *httpReportTransport) Send(ctx context.Context, report *telemetrylib.TelemetryReport) (receipt *ReportReceipt, err error) {
 	// submit a telemetry report
-	var trReq restapi.TelemetryReportRequest
-	trReq.TelemetryReport = *report
-	reqBodyJSON, err := json.Marshal(&trReq)
+	reqBodyJSON, err := marshalReport(report)
 	if err != nil {
 		slog.Error("failed to JSON marshal trReq", slog.String("err", err.Error()))
 		return
 	}
 
+	return h.SendStream(ctx, report.Header.ReportId, func(w io.Writer) (size int64, err error) {
+		n, err := w.Write(reqBodyJSON)
+		return int64(n), err
+	})
+}
+
+// SendStream submits the report as it is written, compressing it on the
+// fly if requested, via a pipe that feeds the HTTP request body, so that
+// neither the report nor the request body need be held in memory.
+func (h *httpReportTransport) SendStream(ctx context.Context, reportId string, write ReportWriter) (receipt *ReportReceipt, err error) {
+	return h.sendStream(ctx, reportId, h.tc.encoding, write)
+}
+
+// sendStream submits the report using the specified content encoding,
+// retrying uncompressed if the server doesn't support that encoding; the
+// fallback applies only to this submission, leaving the configured
+// encoding, which concurrent submissions may be using, unchanged.
+func (h *httpReportTransport) sendStream(ctx context.Context, reportId string, encoding string, write ReportWriter) (receipt *ReportReceipt, err error) {
+	tc := h.tc
+
+	// compress the report if requested
+	reqBody, bodyWriter := io.Pipe()
+	encoder, err := restapi.NewEncodingWriter(encoding, bodyWriter)
+	if err != nil {
+		slog.Error(
+			"failed to encode telemetry report",
+			slog.String("encoding", encoding),
+			slog.String("err", err.Error()),
+		)
+		bodyWriter.Close()
+		return
+	}
+
+	// write the report while the request body is being sent
+	var size int64
+	var writeErr error
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		size, writeErr = write(encoder)
+		if writeErr == nil {
+			writeErr = encoder.Close()
+		}
+		bodyWriter.CloseWithError(writeErr)
+	}()
+
+	// stop writing the report once the request is done, e.g. because the
+	// server responded without reading all of it, and wait for the writer
+	// to finish
+	finishWriting := func() {
+		reqBody.Close()
+		<-written
+	}
+
 	reqUrl := tc.cfg.TelemetryBaseURL + "/report"
-	reqBuf := bytes.NewBuffer(reqBodyJSON)
-	req, err := http.NewRequest("POST", reqUrl, reqBuf)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqUrl, reqBody)
 	if err != nil {
+		finishWriting()
 		slog.Error("failed to create new HTTP request for telemetry report", slog.String("err", err.Error()))
 		return
 	}
 
 	req.Header.Add("Content-Type", "application/json")
+	if encoding != restapi.CONTENT_ENCODING_IDENTITY {
+		req.Header.Add("Content-Encoding", encoding)
+	}
 	req.Header.Add("Authorization", "Bearer "+tc.creds.AuthToken)
-	req.Header.Add("X-Telemetry-Registration-Id", fmt.Sprintf("%d", tc.creds.RegistrationId))
+	req.Header.Add(restapi.HEADER_REGISTRATION_ID, fmt.Sprintf("%d", tc.creds.RegistrationId))
 
-	httpClient := http.DefaultClient
-	resp, err := httpClient.Do(req)
+	resp, err := tc.httpClient.Do(req)
+	finishWriting()
 	if err != nil {
+		// a failure to write the report, such as a corrupted data item,
+		// is the cause of the request failing
+		if writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe) {
+			err = writeErr
+		}
 		slog.Error("failed HTTP POST telemetry report request", slog.String("err", err.Error()))
 		return
 	}
@@ -58,14 +132,25 @@ func (tc *TelemetryClient) submitReportInternal(report *telemetrylib.TelemetryRe
 	case http.StatusOK:
 		// nothing to do
 	case http.StatusUnauthorized:
-		return unauthorizedError(resp)
+		return nil, unauthorizedError(resp)
+	case http.StatusUnsupportedMediaType:
+		// fallback to sending uncompressed reports if the server doesn't
+		// support the requested compression
+		if encoding != restapi.CONTENT_ENCODING_IDENTITY {
+			slog.Warn(
+				"Server doesn't support compressed reports, sending uncompressed",
+				slog.String("encoding", encoding),
+			)
+			return h.sendStream(ctx, reportId, restapi.CONTENT_ENCODING_IDENTITY, write)
+		}
+		fallthrough
 	default:
 		slog.Error(
 			"failed to submit report",
 			slog.Int("StatusCode", resp.StatusCode),
 			slog.String("respBody", string(respBody)),
 		)
-		return
+		return nil, newStatusError(resp, respBody)
 	}
 
 	var trResp restapi.TelemetryReportResponse
@@ -77,19 +162,75 @@ func (tc *TelemetryClient) submitReportInternal(report *telemetrylib.TelemetryRe
 
 	slog.Debug(
 		"successfully submitted report",
-		slog.String("report", report.Header.ReportId),
+		slog.String("report", reportId),
 		slog.String("processing", trResp.ProcessingInfo()),
 	)
+
+	receipt = &ReportReceipt{
+		Destination:  tc.cfg.TelemetryBaseURL,
+		Size:         int(size),
+		ProcessingId: trResp.ProcessingId,
+		ProcessedAt:  trResp.ProcessedAt,
+	}
 	return
 }
 
+func (tc *TelemetryClient) submitReportInternal(ctx context.Context, report *telemetrylib.TelemetryReport) (submission *telemetrylib.TelemetrySubmissionRow, err error) {
+	receipt, err := tc.transport.Send(ctx, report)
+	if err != nil {
+		return
+	}
+
+	// record the details of the submission and the delivery receipt
+	submission = telemetrylib.NewTelemetrySubmissionRow(
+		report,
+		receipt.Destination,
+		receipt.Size,
+		1,
+		receipt.ProcessingId,
+		receipt.ProcessedAt,
+	)
+	return
+}
+
+// streamReportInternal submits a staged report by streaming it directly
+// from the datastore to the transport.
+func (tc *TelemetryClient) streamReportInternal(ctx context.Context, reportRow *telemetrylib.TelemetryReportRow, streamer StreamingReportTransport) (submission *telemetrylib.TelemetrySubmissionRow, err error) {
+	// the summary of the written report, without the item content, is
+	// sufficient to record the submission
+	var summary *telemetrylib.TelemetryReport
+	receipt, err := streamer.SendStream(ctx, reportRow.ReportId, func(w io.Writer) (size int64, err error) {
+		summary, size, err = tc.processor.WriteReportContext(ctx, reportRow, w)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	// record the details of the submission and the delivery receipt
+	submission = telemetrylib.NewTelemetrySubmissionRow(
+		summary,
+		receipt.Destination,
+		receipt.Size,
+		1,
+		receipt.ProcessingId,
+		receipt.ProcessedAt,
+	)
+	return
+}
+
+// reportSender makes a single attempt to submit a report
+type reportSender func(ctx context.Context) (submission *telemetrylib.TelemetrySubmissionRow, err error)
+
 func (tc *TelemetryClient) submitReportRetry(
-	report *telemetrylib.TelemetryReport,
+	ctx context.Context,
+	send reportSender,
 	maxTries int,
 	delay time.Duration,
-) (err error) {
-	// retry at most MaxTries times
-	for retry := maxTries; retry > 0; retry -= 1 {
+	maxDelay time.Duration,
+) (submission *telemetrylib.TelemetrySubmissionRow, err error) {
+	// retry at most maxTries times
+	for attempt := 0; attempt < maxTries; attempt++ {
 
 		// handle panic() calls as well as return
 		func() {
@@ -105,13 +246,26 @@ func (tc *TelemetryClient) submitReportRetry(
 					}
 				}
 			}()
-			err = tc.submitReportInternal(report)
+			submission, err = send(ctx)
 		}()
 
 		if err == nil {
+			submission.Attempts = attempt + 1
+
+			// server accepted the report so any backoff no longer applies
+			if clearErr := tc.backoff.Clear(); clearErr != nil {
+				slog.Warn(
+					"Failed to clear telemetry client backoff",
+					slog.String("error", clearErr.Error()),
+				)
+			}
 			break
 		}
 
+		// default to exponential backoff between retries
+		retryDelay := retryBackoff(attempt, delay, maxDelay)
+
+		var statusErr *StatusError
 		switch {
 		// check if we need to register again?
 		case errors.Is(err, ErrRegistrationRequired):
@@ -131,7 +285,7 @@ func (tc *TelemetryClient) submitReportRetry(
 			}
 
 			// register the telemetry client
-			err = tc.Register()
+			err = tc.RegisterContext(ctx)
 			if err != nil {
 				// if registration failed, for now don't re-try
 				return
@@ -149,7 +303,7 @@ func (tc *TelemetryClient) submitReportRetry(
 			)
 
 			// attempt to (re-)autenticate
-			err = tc.Authenticate()
+			err = tc.AuthenticateContext(ctx)
 			if err != nil {
 				// if authentication failed, for now don't re-try
 				return
@@ -159,7 +313,35 @@ func (tc *TelemetryClient) submitReportRetry(
 				"Telemetry Client Authentication Successful",
 			)
 
-		// TODO: handle server busy backoff and retry appropriately
+		// check if the server is busy, honouring any requested delay
+		case errors.As(err, &statusErr) && statusErr.ServerBusy():
+			if statusErr.RetryAfter > 0 {
+				retryDelay = statusErr.RetryAfter
+			}
+
+			slog.Info(
+				"Telemetry Server Busy",
+				slog.Int("StatusCode", statusErr.StatusCode),
+				slog.Duration("retryDelay", retryDelay),
+			)
+
+			// if the server wants us to wait longer than we are willing to
+			// wait now, record when it can next be contacted and give up
+			if retryDelay > maxDelay || attempt+1 >= maxTries {
+				return nil, tc.deferSubmission(retryDelay, err)
+			}
+
+		// a corrupted report will never be submittable
+		case errors.Is(err, telemetrylib.ErrChecksumMismatch):
+			return
+
+		// don't retry requests that will fail again
+		case errors.As(err, &statusErr) && !statusErr.Retryable():
+			slog.Debug(
+				"Non-retryable error",
+				slog.String("error", err.Error()),
+			)
+			return
 
 		default:
 			slog.Debug(
@@ -168,16 +350,113 @@ func (tc *TelemetryClient) submitReportRetry(
 			)
 		}
 
-		// sleep between retries
-		if retry > 0 {
-			time.Sleep(delay)
+		// sleep between retries, unless the context is done
+		if attempt+1 < maxTries {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(retryDelay):
+			}
 		}
 
 	}
 	return
 }
 
-func (tc *TelemetryClient) submitReport(report *telemetrylib.TelemetryReport) (err error) {
+// deferSubmission records that the server should not be contacted until
+// the specified delay has elapsed, returning an appropriate error.
+func (tc *TelemetryClient) deferSubmission(delay time.Duration, cause error) (err error) {
+	if err = tc.backoff.Defer(delay); err != nil {
+		slog.Warn(
+			"Failed to save telemetry client backoff",
+			slog.String("error", err.Error()),
+		)
+	}
+
+	return fmt.Errorf(
+		"%w: not before %s: %w",
+		ErrServerBackoff,
+		tc.backoff.NotBefore.Format(time.RFC3339),
+		cause,
+	)
+}
+
+func (tc *TelemetryClient) submitReport(ctx context.Context, report *telemetrylib.TelemetryReport) (submission *telemetrylib.TelemetrySubmissionRow, err error) {
+	if err = report.Validate(); err != nil {
+		slog.Error(
+			"validation failure",
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	// the report is always submitted at least once, with retries
+	// performed as needed, up to the configured limit
+	submitCfg := &tc.cfg.Submission
+	submission, err = tc.submitReportRetry(
+		ctx,
+		func(ctx context.Context) (*telemetrylib.TelemetrySubmissionRow, error) {
+			return tc.submitReportInternal(ctx, report)
+		},
+		max(submitCfg.Retries, 0)+1,
+		submitCfg.RetryDelay,
+		submitCfg.MaxRetryDelay,
+	)
+	return
+}
+
+// submitStagedReport submits a staged report, streaming it directly from
+// the datastore if the transport supports it, so that large reports need
+// not be held in memory, and otherwise generating the report in memory.
+func (tc *TelemetryClient) submitStagedReport(ctx context.Context, reportRow *telemetrylib.TelemetryReportRow) (submission *telemetrylib.TelemetrySubmissionRow, err error) {
+	streamer, ok := tc.transport.(StreamingReportTransport)
+	if !ok {
+		report, err := tc.processor.ToReportContext(ctx, reportRow)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate report %q: %w", reportRow.ReportId, err)
+		}
+		return tc.submitReport(ctx, report)
+	}
+
+	// the report is validated as it is written, and is always submitted
+	// at least once, with retries performed as needed, up to the
+	// configured limit
+	submitCfg := &tc.cfg.Submission
+	submission, err = tc.submitReportRetry(
+		ctx,
+		func(ctx context.Context) (*telemetrylib.TelemetrySubmissionRow, error) {
+			return tc.streamReportInternal(ctx, reportRow, streamer)
+		},
+		max(submitCfg.Retries, 0)+1,
+		submitCfg.RetryDelay,
+		submitCfg.MaxRetryDelay,
+	)
+	return
+}
+
+// SubmitReport submits a report that isn't staged locally, such as one
+// being proxied on behalf of another client, trying at most maxTries times
+// and giving up, rather than waiting, if the server requests a delay longer
+// than maxDelay.
+func (tc *TelemetryClient) SubmitReport(
+	report *telemetrylib.TelemetryReport,
+	maxTries int,
+	maxDelay time.Duration,
+) (submission *telemetrylib.TelemetrySubmissionRow, err error) {
+	return tc.SubmitReportContext(context.Background(), report, maxTries, maxDelay)
+}
+
+// SubmitReportContext is the context aware variant of SubmitReport.
+func (tc *TelemetryClient) SubmitReportContext(
+	ctx context.Context,
+	report *telemetrylib.TelemetryReport,
+	maxTries int,
+	maxDelay time.Duration,
+) (submission *telemetrylib.TelemetrySubmissionRow, err error) {
+	if err = tc.prepareSubmission(ctx); err != nil {
+		return
+	}
+
 	if err = report.Validate(); err != nil {
 		slog.Error(
 			"validation failure",
@@ -186,7 +465,14 @@ func (tc *TelemetryClient) submitReport(report *telemetrylib.TelemetryReport) (e
 		return
 	}
 
-	// TODO: make delay configurable, or possibly supplied by the request response
-	err = tc.submitReportRetry(report, 3, time.Duration(500*time.Millisecond))
+	submission, err = tc.submitReportRetry(
+		ctx,
+		func(ctx context.Context) (*telemetrylib.TelemetrySubmissionRow, error) {
+			return tc.submitReportInternal(ctx, report)
+		},
+		max(maxTries, 1),
+		tc.cfg.Submission.RetryDelay,
+		maxDelay,
+	)
 	return
 }
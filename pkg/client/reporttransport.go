@@ -0,0 +1,219 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	telemetrylib "github.com/SUSE/telemetry/pkg/lib"
+	"github.com/SUSE/telemetry/pkg/restapi"
+	"github.com/SUSE/telemetry/pkg/types"
+)
+
+const (
+	// supported report submission methods
+	REPORT_TRANSPORT_HTTP   = `http`
+	REPORT_TRANSPORT_SPOOL  = `spool`
+	REPORT_TRANSPORT_STDOUT = `stdout`
+
+	// permissions used for the spool directory and spooled reports
+	SPOOL_DIR_PERM  = 0750
+	SPOOL_FILE_PERM = 0640
+)
+
+// ReportTransport delivers telemetry reports to their destination.
+type ReportTransport interface {
+	// Name returns the submission method implemented by the transport
+	Name() string
+
+	// Authenticated returns true if the transport requires the client to
+	// be registered with, and authenticated by, the telemetry server
+	Authenticated() bool
+
+	// Send delivers the report, returning a receipt for the delivery
+	Send(ctx context.Context, report *telemetrylib.TelemetryReport) (receipt *ReportReceipt, err error)
+}
+
+// ReportWriter writes the JSON encoding of a report to w, returning the
+// number of bytes written. It may be called more than once, e.g. if the
+// report needs to be resent.
+type ReportWriter func(w io.Writer) (size int64, err error)
+
+// StreamingReportTransport is implemented by report transports that can
+// deliver a report as it is written, so that large staged reports need not
+// be held in memory while being submitted.
+type StreamingReportTransport interface {
+	ReportTransport
+
+	// SendStream delivers the report with the specified id, as written by
+	// the report writer, returning a receipt for the delivery
+	SendStream(ctx context.Context, reportId string, write ReportWriter) (receipt *ReportReceipt, err error)
+}
+
+// ReportReceipt describes the successful delivery of a report.
+type ReportReceipt struct {
+	Destination  string // where the report was delivered
+	Size         int    // size of the delivered JSON encoded report
+	ProcessingId int64  // only available if delivered to a server
+	ProcessedAt  types.TelemetryTimeStamp
+}
+
+// newReportTransport returns the report transport for the configured
+// submission method.
+func newReportTransport(tc *TelemetryClient, cfg *config.SubmissionConfig) (rt ReportTransport, err error) {
+	switch cfg.Method {
+	case "", REPORT_TRANSPORT_HTTP:
+		rt = &httpReportTransport{tc: tc}
+	case REPORT_TRANSPORT_SPOOL:
+		if cfg.SpoolDir == "" {
+			return nil, fmt.Errorf("submission method %q requires a spool_dir", cfg.Method)
+		}
+		rt = newSpoolReportTransport(cfg.SpoolDir)
+	case REPORT_TRANSPORT_STDOUT:
+		rt = newStdoutReportTransport(os.Stdout)
+	default:
+		return nil, fmt.Errorf(
+			"unsupported submission method %q, must be one of %s, %s or %s",
+			cfg.Method,
+			REPORT_TRANSPORT_HTTP,
+			REPORT_TRANSPORT_SPOOL,
+			REPORT_TRANSPORT_STDOUT,
+		)
+	}
+
+	return
+}
+
+// marshalReport returns the JSON encoding of the report as it would be
+// sent to the server, so that delivered reports can be forwarded as-is.
+func marshalReport(report *telemetrylib.TelemetryReport) (reportJSON []byte, err error) {
+	var trReq restapi.TelemetryReportRequest
+	trReq.TelemetryReport = *report
+	reportJSON, err = json.Marshal(&trReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to JSON marshal report %q: %w", report.Header.ReportId, err)
+	}
+	return
+}
+
+// spoolReportTransport writes each report as a JSON file in a spool
+// directory, for collection by a separate process.
+type spoolReportTransport struct {
+	dir string
+}
+
+func newSpoolReportTransport(dir string) *spoolReportTransport {
+	return &spoolReportTransport{dir: dir}
+}
+
+func (s *spoolReportTransport) Name() string {
+	return REPORT_TRANSPORT_SPOOL
+}
+
+func (s *spoolReportTransport) Authenticated() bool {
+	return false
+}
+
+func (s *spoolReportTransport) Send(ctx context.Context, report *telemetrylib.TelemetryReport) (receipt *ReportReceipt, err error) {
+	reportJSON, err := marshalReport(report)
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(s.dir, SPOOL_DIR_PERM); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory %q: %w", s.dir, err)
+	}
+
+	// write to a temporary file that is renamed once complete so that
+	// collectors never see partially written reports
+	reportPath := filepath.Join(s.dir, report.Header.ReportId+".json")
+	tmpFile, err := os.CreateTemp(s.dir, "."+report.Header.ReportId+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file for report %q: %w", report.Header.ReportId, err)
+	}
+	tmpPath := tmpFile.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err = tmpFile.Write(reportJSON); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("failed to write spool file %q: %w", tmpPath, err)
+	}
+
+	if err = tmpFile.Chmod(SPOOL_FILE_PERM); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("failed to set permissions on spool file %q: %w", tmpPath, err)
+	}
+
+	if err = tmpFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close spool file %q: %w", tmpPath, err)
+	}
+
+	if err = os.Rename(tmpPath, reportPath); err != nil {
+		return nil, fmt.Errorf("failed to rename spool file %q: %w", tmpPath, err)
+	}
+
+	slog.Debug(
+		"spooled report",
+		slog.String("report", report.Header.ReportId),
+		slog.String("path", reportPath),
+	)
+
+	receipt = &ReportReceipt{
+		Destination: reportPath,
+		Size:        len(reportJSON),
+		ProcessedAt: types.Now(),
+	}
+
+	return
+}
+
+// stdoutReportTransport writes each report as a single line of JSON to
+// the provided writer, which is normally stdout.
+type stdoutReportTransport struct {
+	mutex sync.Mutex
+	out   io.Writer
+}
+
+func newStdoutReportTransport(out io.Writer) *stdoutReportTransport {
+	return &stdoutReportTransport{out: out}
+}
+
+func (s *stdoutReportTransport) Name() string {
+	return REPORT_TRANSPORT_STDOUT
+}
+
+func (s *stdoutReportTransport) Authenticated() bool {
+	return false
+}
+
+func (s *stdoutReportTransport) Send(ctx context.Context, report *telemetrylib.TelemetryReport) (receipt *ReportReceipt, err error) {
+	reportJSON, err := marshalReport(report)
+	if err != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err = s.out.Write(append(reportJSON, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to write report %q: %w", report.Header.ReportId, err)
+	}
+
+	receipt = &ReportReceipt{
+		Destination: REPORT_TRANSPORT_STDOUT,
+		Size:        len(reportJSON),
+		ProcessedAt: types.Now(),
+	}
+
+	return
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusError is returned when the server responds to a request with an
+// unexpected HTTP status code.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // server specified retry delay, if any
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf(
+		"server responded with %d %s: %s",
+		e.StatusCode,
+		http.StatusText(e.StatusCode),
+		e.Body,
+	)
+}
+
+// ServerBusy returns true if the server indicated that it is overloaded
+// and that requests should be deferred.
+func (e *StatusError) ServerBusy() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// Retryable returns true if the request may succeed if retried later.
+func (e *StatusError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func newStatusError(resp *http.Response, respBody []byte) *StatusError {
+	e := &StatusError{
+		StatusCode: resp.StatusCode,
+		Body:       string(respBody),
+	}
+
+	if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		e.RetryAfter = retryAfter
+	}
+
+	return e
+}
+
+// parseRetryAfter parses a Retry-After header value, which may be either a
+// delay in seconds or an HTTP date, returning the delay relative to now.
+func parseRetryAfter(value string, now time.Time) (delay time.Duration, ok bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+
+	// delay-seconds form
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	// HTTP-date form, with dates in the past meaning retry immediately
+	retryAt, err := http.ParseTime(value)
+	if err != nil {
+		return
+	}
+
+	delay = retryAt.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+
+	return delay, true
+}
+
+// retryBackoff returns the delay to use before the next retry, doubling the
+// base delay for each preceding attempt, capped at the max delay, with
+// jitter applied to the upper half of the delay.
+func retryBackoff(attempt int, base, max time.Duration) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+
+	delay := base
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+
+	half := delay / 2
+	return half + rand.N(half+1)
+}
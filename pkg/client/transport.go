@@ -0,0 +1,193 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/SUSE/telemetry/pkg/restapi"
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	// keep alive period used for connections to the telemetry server
+	TRANSPORT_KEEP_ALIVE = 30 * time.Second
+)
+
+// loadCertPool returns the system cert pool extended with the certs found
+// in the specified CA files and directories, or nil if none were specified.
+func loadCertPool(caFiles []string, caDirs []string) (pool *x509.CertPool, err error) {
+	// if no CAs have been specified the system defaults will be used
+	if len(caFiles) == 0 && len(caDirs) == 0 {
+		return nil, nil
+	}
+
+	// start with the system cert pool so that publicly trusted server
+	// certs continue to be trusted
+	pool, err = x509.SystemCertPool()
+	if err != nil {
+		slog.Warn(
+			"Unable to load system cert pool, using only configured CAs",
+			slog.String("err", err.Error()),
+		)
+		pool = x509.NewCertPool()
+	}
+
+	// every explicitly specified CA file must contain valid PEM certs
+	for _, caFile := range caFiles {
+		pemCerts, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %q: %w", caFile, err)
+		}
+
+		if !pool.AppendCertsFromPEM(pemCerts) {
+			return nil, fmt.Errorf("no valid PEM certs found in CA file %q", caFile)
+		}
+
+		slog.Debug("Added CA file certs", slog.String("path", caFile))
+	}
+
+	// CA directories may contain non-cert files, which are skipped
+	for _, caDir := range caDirs {
+		entries, err := os.ReadDir(caDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA directory %q: %w", caDir, err)
+		}
+
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+
+			caPath := filepath.Join(caDir, entry.Name())
+			pemCerts, err := os.ReadFile(caPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA file %q: %w", caPath, err)
+			}
+
+			if !pool.AppendCertsFromPEM(pemCerts) {
+				slog.Debug(
+					"Skipping CA directory entry without valid PEM certs",
+					slog.String("path", caPath),
+				)
+				continue
+			}
+
+			slog.Debug("Added CA directory certs", slog.String("path", caPath))
+		}
+	}
+
+	return
+}
+
+// newTLSConfig creates the TLS config based upon the transport config
+func newTLSConfig(cfg *config.TransportConfig) (tlsConfig *tls.Config, err error) {
+	tlsConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	tlsConfig.RootCAs, err = loadCertPool(cfg.CAFiles, cfg.CADirs)
+	if err != nil {
+		return nil, err
+	}
+
+	// client cert and key must be specified together
+	switch {
+	case cfg.ClientCert == "" && cfg.ClientKey == "":
+		// no client cert configured
+	case cfg.ClientCert == "" || cfg.ClientKey == "":
+		return nil, fmt.Errorf("both client_cert and client_key must be specified")
+	default:
+		clientCert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to load client cert %q and key %q: %w",
+				cfg.ClientCert,
+				cfg.ClientKey,
+				err,
+			)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	return
+}
+
+// newProxyFunc creates a proxy selection function, based upon the standard
+// proxy environment settings, overridden by the transport config if set
+func newProxyFunc(cfg *config.TransportConfig) (func(*http.Request) (*url.URL, error), error) {
+	proxyCfg := httpproxy.FromEnvironment()
+
+	if cfg.ProxyURL != "" {
+		if _, err := url.Parse(cfg.ProxyURL); err != nil {
+			return nil, fmt.Errorf("invalid proxy_url %q: %w", cfg.ProxyURL, err)
+		}
+		proxyCfg.HTTPProxy = cfg.ProxyURL
+		proxyCfg.HTTPSProxy = cfg.ProxyURL
+	}
+
+	if len(cfg.NoProxy) > 0 {
+		proxyCfg.NoProxy = strings.Join(cfg.NoProxy, ",")
+	}
+
+	proxyFunc := proxyCfg.ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}, nil
+}
+
+// reportContentEncoding returns the Content-Encoding to use for report
+// submissions based upon the configured compression, with none or an
+// empty setting meaning that reports are sent uncompressed
+func reportContentEncoding(cfg *config.TransportConfig) (encoding string, err error) {
+	switch cfg.Compression {
+	case "", "none":
+		return restapi.CONTENT_ENCODING_IDENTITY, nil
+	case restapi.CONTENT_ENCODING_GZIP, restapi.CONTENT_ENCODING_ZSTD:
+		return cfg.Compression, nil
+	}
+
+	return "", fmt.Errorf("invalid compression %q, must be one of none, gzip or zstd", cfg.Compression)
+}
+
+// newHTTPClient creates the HTTP client used for all requests made to the
+// telemetry server, based upon the transport config
+func newHTTPClient(cfg *config.TransportConfig) (httpClient *http.Client, err error) {
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return
+	}
+
+	proxyFunc, err := newProxyFunc(cfg)
+	if err != nil {
+		return
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.ConnectTimeout,
+		KeepAlive: TRANSPORT_KEEP_ALIVE,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc
+	transport.DialContext = dialer.DialContext
+	transport.TLSClientConfig = tlsConfig
+	transport.TLSHandshakeTimeout = cfg.ConnectTimeout
+	transport.ResponseHeaderTimeout = cfg.ResponseTimeout
+
+	httpClient = &http.Client{
+		Transport: transport,
+	}
+
+	return
+}
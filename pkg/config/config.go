@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"path/filepath"
 	"slices"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
@@ -44,6 +45,41 @@ const (
 	// class defaults
 	DEF_CFG_OPT_OUT = true
 	DEF_CFG_OPT_IN  = false
+
+	// transport defaults
+	DEF_CFG_CONNECT_TIMEOUT  = 30 * time.Second
+	DEF_CFG_RESPONSE_TIMEOUT = 60 * time.Second
+	DEF_CFG_COMPRESSION      = `none`
+
+	// bundling defaults
+	DEF_CFG_BUNDLE_MAX_ITEMS   = 0 // no limit
+	DEF_CFG_BUNDLE_MAX_BYTES   = 0 // no limit
+	DEF_CFG_BUNDLE_TIME_WINDOW = 0 // no time windows
+
+	// staging defaults
+	DEF_CFG_STAGING_MAX_CONTENT_SIZE   = 0 // no limit
+	DEF_CFG_STAGING_MAX_AGE            = 0 // no limit
+	DEF_CFG_STAGING_MAX_ITEMS_PER_TYPE = 0 // no limit
+
+	// submission defaults
+	DEF_CFG_SUBMIT_RETRIES         = 2
+	DEF_CFG_SUBMIT_RETRY_DELAY     = 500 * time.Millisecond
+	DEF_CFG_SUBMIT_MAX_RETRY_DELAY = 5 * time.Minute
+	DEF_CFG_SUBMIT_MAX_REQ_SIZE    = 0 // no limit
+	DEF_CFG_SUBMIT_MAX_ATTEMPTS    = 5
+	DEF_CFG_SUBMIT_METHOD          = `http`
+	DEF_CFG_SUBMIT_SPOOL_DIR       = `/var/lib/` + DEF_CFG_USER + `/spool`
+
+	// auth defaults
+	DEF_CFG_AUTH_REFRESH_WINDOW = 5 * time.Minute
+
+	// relay defaults
+	DEF_CFG_RELAY_MODE           = `auto`
+	DEF_CFG_RELAY_LISTEN         = `:9999`
+	DEF_CFG_RELAY_MAX_BUNDLES    = 100
+	DEF_CFG_RELAY_MAX_AGE        = 1 * time.Hour
+	DEF_CFG_RELAY_CHECK_INTERVAL = 1 * time.Minute
+	DEF_CFG_RELAY_TOKEN_DURATION = 8 * time.Hour
 )
 
 // datastore config for staging provided telemetry data
@@ -82,6 +118,166 @@ func (cc *ClassOptionsConfig) String() string {
 	return string(str)
 }
 
+// transport config for HTTP(S) requests made to the telemetry server
+type TransportConfig struct {
+	CAFiles         []string      `yaml:"ca_files" json:"ca_files"`
+	CADirs          []string      `yaml:"ca_dirs" json:"ca_dirs"`
+	ClientCert      string        `yaml:"client_cert" json:"client_cert"`
+	ClientKey       string        `yaml:"client_key" json:"client_key"`
+	ProxyURL        string        `yaml:"proxy_url" json:"proxy_url"`
+	NoProxy         []string      `yaml:"no_proxy" json:"no_proxy"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout" json:"connect_timeout"`
+	ResponseTimeout time.Duration `yaml:"response_timeout" json:"response_timeout"`
+	Compression     string        `yaml:"compression" json:"compression"`
+}
+
+func (tc *TransportConfig) String() string {
+	str, _ := json.Marshal(tc)
+	return string(str)
+}
+
+// staging config limiting the growth of the local staging datastore, e.g.
+// while the telemetry server is unreachable, with staged data items being
+// evicted as needed to stay within the limits, and 0 meaning no limit
+type StagingConfig struct {
+	// maximum total size in bytes of the staged data items' content, as
+	// stored, possibly compressed, in the datastore; this is a budget for
+	// the item content only, excluding the bundles, reports and other
+	// records, and any datastore overhead, so the datastore itself will
+	// be somewhat larger
+	MaxContentSize int64 `yaml:"max_content_size" json:"max_content_size"`
+
+	// maximum age of staged data items
+	MaxAge time.Duration `yaml:"max_age" json:"max_age"`
+
+	// maximum number of staged data items per telemetry type
+	MaxItemsPerType int `yaml:"max_items_per_type" json:"max_items_per_type"`
+}
+
+func (sc *StagingConfig) String() string {
+	str, _ := json.Marshal(sc)
+	return string(str)
+}
+
+// submission config for retrying report submissions
+type SubmissionConfig struct {
+	Retries       int           `yaml:"retries" json:"retries"`
+	RetryDelay    time.Duration `yaml:"retry_delay" json:"retry_delay"`
+	MaxRetryDelay time.Duration `yaml:"max_retry_delay" json:"max_retry_delay"`
+
+	// maximum size in bytes of a JSON encoded report submission, measured
+	// before any content encoding compression is applied, so that the
+	// compressed request sent on the wire is smaller, with 0 meaning no
+	// limit
+	MaxRequestSize int `yaml:"max_request_size" json:"max_request_size"`
+
+	// number of failed submission attempts after which a report will be
+	// quarantined, with 0 meaning never quarantine failed reports
+	MaxAttempts int `yaml:"max_attempts" json:"max_attempts"`
+
+	// how reports are submitted, one of http, spool or stdout, with the
+	// spool method writing each report to a file in the spool directory
+	Method   string `yaml:"method" json:"method"`
+	SpoolDir string `yaml:"spool_dir" json:"spool_dir"`
+}
+
+func (sc *SubmissionConfig) String() string {
+	str, _ := json.Marshal(sc)
+	return string(str)
+}
+
+// bundling config controlling how staged data items are gathered into
+// bundles, with the default settings gathering all staged data items into
+// a single bundle
+type BundlingConfig struct {
+	// maximum number of data items, and total size in bytes of the data
+	// items' content, as JSON encoded in reports, uncompressed, per bundle,
+	// with 0 meaning no limit
+	MaxItems int `yaml:"max_items" json:"max_items"`
+	MaxBytes int `yaml:"max_bytes" json:"max_bytes"`
+
+	// data items are bundled separately for each distinct telemetry type
+	// and/or set of tags, when group_by includes type and/or tags
+	GroupBy []string `yaml:"group_by" json:"group_by"`
+
+	// data items are bundled separately for each time window, e.g. 24h
+	// for one bundle per day, with data items staged in the current time
+	// window remaining staged until it ends, and 0 meaning no time windows
+	TimeWindow time.Duration `yaml:"time_window" json:"time_window"`
+}
+
+func (bc *BundlingConfig) String() string {
+	str, _ := json.Marshal(bc)
+	return string(str)
+}
+
+// token verification config, specifying the trusted public keys that
+// auth token signatures are verified against, as PEM encoded public key
+// or certificate files and JWKS files, and the expected issuer and
+// audience, which are only checked if specified
+type TokenVerifyConfig struct {
+	PublicKeys []string `yaml:"public_keys" json:"public_keys"`
+	JWKSFiles  []string `yaml:"jwks_files" json:"jwks_files"`
+	Issuer     string   `yaml:"issuer" json:"issuer"`
+	Audience   string   `yaml:"audience" json:"audience"`
+}
+
+// Enabled returns true if any trusted public keys have been configured
+func (vc *TokenVerifyConfig) Enabled() bool {
+	return len(vc.PublicKeys) > 0 || len(vc.JWKSFiles) > 0
+}
+
+func (vc *TokenVerifyConfig) String() string {
+	str, _ := json.Marshal(vc)
+	return string(str)
+}
+
+// auth config for managing the client's auth token
+type AuthConfig struct {
+	RefreshWindow time.Duration `yaml:"refresh_window" json:"refresh_window"`
+
+	// optional verification of the auth tokens issued to the client, to
+	// detect tampered or forged credentials
+	Verify TokenVerifyConfig `yaml:"verify" json:"verify"`
+}
+
+func (ac *AuthConfig) String() string {
+	str, _ := json.Marshal(ac)
+	return string(str)
+}
+
+// relay config for serving downstream clients and forwarding their
+// telemetry upstream
+type RelayConfig struct {
+	// how received telemetry is relayed, one of stage, where bundles are
+	// staged locally and forwarded later, proxy, where each report is
+	// forwarded before responding to the client, or auto, which proxies
+	// only if the datastore isn't persistent
+	Mode string `yaml:"mode" json:"mode"`
+
+	// address on which to listen for downstream client requests
+	Listen string `yaml:"listen" json:"listen"`
+
+	// staged bundles are forwarded upstream once there are at least
+	// MaxBundles of them, or the oldest has been staged for MaxAge,
+	// checking every CheckInterval
+	MaxBundles    int           `yaml:"max_bundles" json:"max_bundles"`
+	MaxAge        time.Duration `yaml:"max_age" json:"max_age"`
+	CheckInterval time.Duration `yaml:"check_interval" json:"check_interval"`
+
+	// lifetime of the auth tokens issued to downstream clients
+	TokenDuration time.Duration `yaml:"token_duration" json:"token_duration"`
+
+	// optional verification of auth tokens presented by downstream clients
+	// that were issued by an external auth service, rather than the relay
+	Verify TokenVerifyConfig `yaml:"verify" json:"verify"`
+}
+
+func (rc *RelayConfig) String() string {
+	str, _ := json.Marshal(rc)
+	return string(str)
+}
+
 type Config struct {
 	TelemetryBaseURL string             `yaml:"telemetry_base_url"`
 	Enabled          bool               `yaml:"enabled"`
@@ -91,6 +287,12 @@ type Config struct {
 	DataStores       DBConfig           `yaml:"datastores"`
 	ClassOptions     ClassOptionsConfig `yaml:"class_options"`
 	Logging          LogConfig          `yaml:"logging"`
+	Transport        TransportConfig    `yaml:"transport"`
+	Bundling         BundlingConfig     `yaml:"bundling"`
+	Staging          StagingConfig      `yaml:"staging"`
+	Submission       SubmissionConfig   `yaml:"submission"`
+	Auth             AuthConfig         `yaml:"auth"`
+	Relay            RelayConfig        `yaml:"relay"`
 	Extras           any                `yaml:"extras,omitempty"`
 
 	cfgPath string
@@ -145,6 +347,59 @@ func NewDefaultConfig() *Config {
 			Deny:   []types.TelemetryType{},
 		},
 
+		Transport: TransportConfig{
+			CAFiles:         []string{},
+			CADirs:          []string{},
+			NoProxy:         []string{},
+			ConnectTimeout:  DEF_CFG_CONNECT_TIMEOUT,
+			ResponseTimeout: DEF_CFG_RESPONSE_TIMEOUT,
+			Compression:     DEF_CFG_COMPRESSION,
+		},
+
+		Bundling: BundlingConfig{
+			MaxItems:   DEF_CFG_BUNDLE_MAX_ITEMS,
+			MaxBytes:   DEF_CFG_BUNDLE_MAX_BYTES,
+			GroupBy:    []string{},
+			TimeWindow: DEF_CFG_BUNDLE_TIME_WINDOW,
+		},
+
+		Staging: StagingConfig{
+			MaxContentSize:  DEF_CFG_STAGING_MAX_CONTENT_SIZE,
+			MaxAge:          DEF_CFG_STAGING_MAX_AGE,
+			MaxItemsPerType: DEF_CFG_STAGING_MAX_ITEMS_PER_TYPE,
+		},
+
+		Submission: SubmissionConfig{
+			Retries:        DEF_CFG_SUBMIT_RETRIES,
+			RetryDelay:     DEF_CFG_SUBMIT_RETRY_DELAY,
+			MaxRetryDelay:  DEF_CFG_SUBMIT_MAX_RETRY_DELAY,
+			MaxRequestSize: DEF_CFG_SUBMIT_MAX_REQ_SIZE,
+			MaxAttempts:    DEF_CFG_SUBMIT_MAX_ATTEMPTS,
+			Method:         DEF_CFG_SUBMIT_METHOD,
+			SpoolDir:       DEF_CFG_SUBMIT_SPOOL_DIR,
+		},
+
+		Auth: AuthConfig{
+			RefreshWindow: DEF_CFG_AUTH_REFRESH_WINDOW,
+			Verify: TokenVerifyConfig{
+				PublicKeys: []string{},
+				JWKSFiles:  []string{},
+			},
+		},
+
+		Relay: RelayConfig{
+			Mode:          DEF_CFG_RELAY_MODE,
+			Listen:        DEF_CFG_RELAY_LISTEN,
+			MaxBundles:    DEF_CFG_RELAY_MAX_BUNDLES,
+			MaxAge:        DEF_CFG_RELAY_MAX_AGE,
+			CheckInterval: DEF_CFG_RELAY_CHECK_INTERVAL,
+			TokenDuration: DEF_CFG_RELAY_TOKEN_DURATION,
+			Verify: TokenVerifyConfig{
+				PublicKeys: []string{},
+				JWKSFiles:  []string{},
+			},
+		},
+
 		cfgPath: DEF_CFG_PATH,
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/SUSE/telemetry/pkg/types"
 	"github.com/stretchr/testify/suite"
@@ -82,10 +83,53 @@ func (t *TestConfigTestSuite) TestConfigDefaults() {
 	t.Empty(cfg.ClassOptions.Allow, "ClassOptions.Allow is expected to be empty")
 	t.Empty(cfg.ClassOptions.Deny, "ClassOptions.Deny is expected to be empty")
 
+	t.Empty(cfg.Transport.CAFiles, "Transport.CAFiles is expected to be empty")
+	t.Empty(cfg.Transport.CADirs, "Transport.CADirs is expected to be empty")
+	t.Empty(cfg.Transport.ProxyURL, "Transport.ProxyURL is expected to be empty")
+	t.Equal(DEF_CFG_CONNECT_TIMEOUT, cfg.Transport.ConnectTimeout, "Transport.ConnectTimeout is not expected value")
+	t.Equal(DEF_CFG_RESPONSE_TIMEOUT, cfg.Transport.ResponseTimeout, "Transport.ResponseTimeout is not expected value")
+	t.Equal(DEF_CFG_COMPRESSION, cfg.Transport.Compression, "Transport.Compression is not expected value")
+
+	t.Equal(DEF_CFG_BUNDLE_MAX_ITEMS, cfg.Bundling.MaxItems, "Bundling.MaxItems is not expected value")
+	t.Equal(DEF_CFG_BUNDLE_MAX_BYTES, cfg.Bundling.MaxBytes, "Bundling.MaxBytes is not expected value")
+	t.Empty(cfg.Bundling.GroupBy, "Bundling.GroupBy is expected to be empty")
+	t.Equal(time.Duration(DEF_CFG_BUNDLE_TIME_WINDOW), cfg.Bundling.TimeWindow, "Bundling.TimeWindow is not expected value")
+
+	t.Equal(int64(DEF_CFG_STAGING_MAX_CONTENT_SIZE), cfg.Staging.MaxContentSize, "Staging.MaxContentSize is not expected value")
+	t.Equal(time.Duration(DEF_CFG_STAGING_MAX_AGE), cfg.Staging.MaxAge, "Staging.MaxAge is not expected value")
+	t.Equal(DEF_CFG_STAGING_MAX_ITEMS_PER_TYPE, cfg.Staging.MaxItemsPerType, "Staging.MaxItemsPerType is not expected value")
+
+	t.Equal(DEF_CFG_SUBMIT_RETRIES, cfg.Submission.Retries, "Submission.Retries is not expected value")
+	t.Equal(DEF_CFG_SUBMIT_RETRY_DELAY, cfg.Submission.RetryDelay, "Submission.RetryDelay is not expected value")
+	t.Equal(DEF_CFG_SUBMIT_MAX_RETRY_DELAY, cfg.Submission.MaxRetryDelay, "Submission.MaxRetryDelay is not expected value")
+	t.Equal(DEF_CFG_SUBMIT_MAX_REQ_SIZE, cfg.Submission.MaxRequestSize, "Submission.MaxRequestSize is not expected value")
+	t.Equal(DEF_CFG_SUBMIT_MAX_ATTEMPTS, cfg.Submission.MaxAttempts, "Submission.MaxAttempts is not expected value")
+	t.Equal(DEF_CFG_SUBMIT_METHOD, cfg.Submission.Method, "Submission.Method is not expected value")
+	t.Equal(DEF_CFG_SUBMIT_SPOOL_DIR, cfg.Submission.SpoolDir, "Submission.SpoolDir is not expected value")
+
+	t.Equal(DEF_CFG_AUTH_REFRESH_WINDOW, cfg.Auth.RefreshWindow, "Auth.RefreshWindow is not expected value")
+	t.Empty(cfg.Auth.Verify.PublicKeys, "Auth.Verify.PublicKeys is expected to be empty")
+	t.Empty(cfg.Auth.Verify.JWKSFiles, "Auth.Verify.JWKSFiles is expected to be empty")
+	t.False(cfg.Auth.Verify.Enabled(), "Auth.Verify is expected to be disabled")
+
+	t.Equal(DEF_CFG_RELAY_MODE, cfg.Relay.Mode, "Relay.Mode is not expected value")
+	t.Equal(DEF_CFG_RELAY_LISTEN, cfg.Relay.Listen, "Relay.Listen is not expected value")
+	t.Equal(DEF_CFG_RELAY_MAX_BUNDLES, cfg.Relay.MaxBundles, "Relay.MaxBundles is not expected value")
+	t.Equal(DEF_CFG_RELAY_MAX_AGE, cfg.Relay.MaxAge, "Relay.MaxAge is not expected value")
+	t.Equal(DEF_CFG_RELAY_CHECK_INTERVAL, cfg.Relay.CheckInterval, "Relay.CheckInterval is not expected value")
+	t.Equal(DEF_CFG_RELAY_TOKEN_DURATION, cfg.Relay.TokenDuration, "Relay.TokenDuration is not expected value")
+	t.False(cfg.Relay.Verify.Enabled(), "Relay.Verify is expected to be disabled")
+
 	t.NotEmpty(cfg.String(), "string representation of config should be non-empty")
 	t.NotEmpty(cfg.ClassOptions.String(), "string representation of class options config should be non-empty")
 	t.NotEmpty(cfg.DataStores.String(), "string representation of data stores config should be non-empty")
 	t.NotEmpty(cfg.Logging.String(), "string representation of logging config should be non-empty")
+	t.NotEmpty(cfg.Transport.String(), "string representation of transport config should be non-empty")
+	t.NotEmpty(cfg.Bundling.String(), "string representation of bundling config should be non-empty")
+	t.NotEmpty(cfg.Staging.String(), "string representation of staging config should be non-empty")
+	t.NotEmpty(cfg.Submission.String(), "string representation of submission config should be non-empty")
+	t.NotEmpty(cfg.Auth.String(), "string representation of auth config should be non-empty")
+	t.NotEmpty(cfg.Relay.String(), "string representation of relay config should be non-empty")
 }
 
 func (t *TestConfigTestSuite) TestConfigLoadSaveUpdate() {
@@ -183,6 +227,141 @@ class_options:
 	t.Equal(params, config.DataStores.Params, "DataStores.Params is not the expected")
 }
 
+func (t *TestConfigTestSuite) TestConfigTransport() {
+	tmpfile, err := t.createTemp("config.yaml")
+	t.Require().NoError(err)
+	defer os.Remove(tmpfile.Name())
+
+	content := `
+telemetry_base_url: https://telemetry.example.com/telemetry
+enabled: true
+transport:
+  ca_files:
+    - /etc/ssl/private-ca.pem
+  ca_dirs:
+    - /var/lib/susetelm/certs
+  client_cert: /etc/susetelemetry/client.crt
+  client_key: /etc/susetelemetry/client.key
+  proxy_url: http://proxy.example.com:3128
+  no_proxy:
+    - localhost
+    - .example.com
+  connect_timeout: 5s
+  compression: zstd
+`
+
+	_, err = tmpfile.Write([]byte(content))
+	t.Require().NoError(err)
+	t.Require().NoError(tmpfile.Close())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	t.Require().NoError(err)
+
+	t.Equal([]string{"/etc/ssl/private-ca.pem"}, cfg.Transport.CAFiles, "Transport.CAFiles is not the expected")
+	t.Equal([]string{"/var/lib/susetelm/certs"}, cfg.Transport.CADirs, "Transport.CADirs is not the expected")
+	t.Equal("/etc/susetelemetry/client.crt", cfg.Transport.ClientCert, "Transport.ClientCert is not the expected")
+	t.Equal("/etc/susetelemetry/client.key", cfg.Transport.ClientKey, "Transport.ClientKey is not the expected")
+	t.Equal("http://proxy.example.com:3128", cfg.Transport.ProxyURL, "Transport.ProxyURL is not the expected")
+	t.Equal([]string{"localhost", ".example.com"}, cfg.Transport.NoProxy, "Transport.NoProxy is not the expected")
+	t.Equal(5*time.Second, cfg.Transport.ConnectTimeout, "Transport.ConnectTimeout is not the expected")
+	t.Equal("zstd", cfg.Transport.Compression, "Transport.Compression is not the expected")
+
+	// unspecified settings should retain their default values
+	t.Equal(DEF_CFG_RESPONSE_TIMEOUT, cfg.Transport.ResponseTimeout, "Transport.ResponseTimeout should be the default")
+}
+
+func (t *TestConfigTestSuite) TestConfigSubmission() {
+	tmpfile, err := t.createTemp("config.yaml")
+	t.Require().NoError(err)
+	defer os.Remove(tmpfile.Name())
+
+	content := `
+telemetry_base_url: https://telemetry.example.com/telemetry
+enabled: true
+submission:
+  retries: 5
+  retry_delay: 2s
+  max_request_size: 1048576
+  max_attempts: 0
+  method: spool
+  spool_dir: /tmp/telemetry/spool
+`
+
+	_, err = tmpfile.Write([]byte(content))
+	t.Require().NoError(err)
+	t.Require().NoError(tmpfile.Close())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	t.Require().NoError(err)
+
+	t.Equal(5, cfg.Submission.Retries, "Submission.Retries is not the expected")
+	t.Equal(2*time.Second, cfg.Submission.RetryDelay, "Submission.RetryDelay is not the expected")
+	t.Equal(1048576, cfg.Submission.MaxRequestSize, "Submission.MaxRequestSize is not the expected")
+	t.Equal(0, cfg.Submission.MaxAttempts, "Submission.MaxAttempts is not the expected")
+	t.Equal("spool", cfg.Submission.Method, "Submission.Method is not the expected")
+	t.Equal("/tmp/telemetry/spool", cfg.Submission.SpoolDir, "Submission.SpoolDir is not the expected")
+
+	// unspecified settings should retain their default values
+	t.Equal(DEF_CFG_SUBMIT_MAX_RETRY_DELAY, cfg.Submission.MaxRetryDelay, "Submission.MaxRetryDelay should be the default")
+}
+
+func (t *TestConfigTestSuite) TestConfigBundling() {
+	tmpfile, err := t.createTemp("config.yaml")
+	t.Require().NoError(err)
+	defer os.Remove(tmpfile.Name())
+
+	content := `
+telemetry_base_url: https://telemetry.example.com/telemetry
+enabled: true
+bundling:
+  max_items: 100
+  max_bytes: 65536
+  group_by:
+    - type
+    - tags
+  time_window: 24h
+`
+
+	_, err = tmpfile.Write([]byte(content))
+	t.Require().NoError(err)
+	t.Require().NoError(tmpfile.Close())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	t.Require().NoError(err)
+
+	t.Equal(100, cfg.Bundling.MaxItems, "Bundling.MaxItems is not the expected")
+	t.Equal(65536, cfg.Bundling.MaxBytes, "Bundling.MaxBytes is not the expected")
+	t.Equal([]string{"type", "tags"}, cfg.Bundling.GroupBy, "Bundling.GroupBy is not the expected")
+	t.Equal(24*time.Hour, cfg.Bundling.TimeWindow, "Bundling.TimeWindow is not the expected")
+}
+
+func (t *TestConfigTestSuite) TestConfigStaging() {
+	tmpfile, err := t.createTemp("config.yaml")
+	t.Require().NoError(err)
+	defer os.Remove(tmpfile.Name())
+
+	content := `
+telemetry_base_url: https://telemetry.example.com/telemetry
+enabled: true
+staging:
+  max_content_size: 104857600
+  max_age: 720h
+`
+
+	_, err = tmpfile.Write([]byte(content))
+	t.Require().NoError(err)
+	t.Require().NoError(tmpfile.Close())
+
+	cfg, err := NewConfig(tmpfile.Name())
+	t.Require().NoError(err)
+
+	t.Equal(int64(104857600), cfg.Staging.MaxContentSize, "Staging.MaxContentSize is not the expected")
+	t.Equal(720*time.Hour, cfg.Staging.MaxAge, "Staging.MaxAge is not the expected")
+
+	// unspecified settings should retain their default values
+	t.Equal(DEF_CFG_STAGING_MAX_ITEMS_PER_TYPE, cfg.Staging.MaxItemsPerType, "Staging.MaxItemsPerType should be the default")
+}
+
 func (t *TestConfigTestSuite) TestConfigFileFoundButUnparsable() {
 	tmpfile, err := t.createTemp("config.yaml")
 	t.Require().NoError(err)
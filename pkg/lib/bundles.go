@@ -1,6 +1,7 @@
 package telemetrylib
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
@@ -66,6 +67,34 @@ func (tb *TelemetryBundle) verifyDataItemChecksums() (err error) {
 	return
 }
 
+// split splits the data items of the bundle evenly between two new
+// bundles, preserving the bundle's details other than its id.
+func (tb *TelemetryBundle) split() (bundles []*TelemetryBundle, err error) {
+	if len(tb.TelemetryDataItems) < 2 {
+		return nil, fmt.Errorf(
+			"%w: bundle %q has only %d item(s)",
+			ErrReportNotSplittable,
+			tb.Header.BundleId,
+			len(tb.TelemetryDataItems),
+		)
+	}
+
+	half := len(tb.TelemetryDataItems) / 2
+	for _, items := range [][]TelemetryDataItem{tb.TelemetryDataItems[:half], tb.TelemetryDataItems[half:]} {
+		bundle := &TelemetryBundle{
+			Header:             tb.Header,
+			TelemetryDataItems: items,
+		}
+		bundle.Header.BundleId = uuid.New().String()
+		if err = bundle.UpdateChecksum(); err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, bundle)
+	}
+
+	return
+}
+
 func NewTelemetryBundle(clientId string, customerId string, tags types.Tags) (*TelemetryBundle, error) {
 	tb := new(TelemetryBundle)
 
@@ -100,23 +129,6 @@ type TelemetryBundleFooter struct {
 	Checksum string `json:"checksum,omitempty" validate:"omitempty,md5"`
 }
 
-//Database Mapping
-
-const bundlesColumns = `(
-	id INTEGER NOT NULL PRIMARY KEY,
-	bundleId VARCHAR(64) NOT NULL,
-	bundleTimestamp VARCHAR(32) NOT NULL,
-	bundleClientId VARCHAR NOT NULL,
-	bundleCustomerId VARCHAR(64) NOT NULL,
-	bundleAnnotations TEXT,
-	bundleChecksum VARCHAR(256),
-	reportId  INTEGER NULL,
-	CONSTRAINT bundles_reportId
-	  FOREIGN KEY (reportId)
-		REFERENCES reports(id)
-	  ON DELETE CASCADE
-)`
-
 type TelemetryBundleRow struct {
 	Id                int64
 	BundleId          string
@@ -147,6 +159,17 @@ func NewTelemetryBundleRow(clientId string, customerId string, tags types.Tags)
 
 }
 
+// header returns the TelemetryBundleHeader corresponding to the bundle row
+func (b *TelemetryBundleRow) header() TelemetryBundleHeader {
+	return TelemetryBundleHeader{
+		BundleId:          b.BundleId,
+		BundleTimeStamp:   b.BundleTimestamp,
+		BundleClientId:    b.BundleClientId,
+		BundleCustomerId:  b.BundleCustomerId,
+		BundleAnnotations: strings.Split(b.BundleAnnotations, ","),
+	}
+}
+
 func (b *TelemetryBundleRow) Exists(db *sql.DB) bool {
 	row := db.QueryRow(`SELECT id FROM bundles WHERE bundleId = ?`, b.BundleId)
 	if err := row.Scan(&b.Id); err != nil {
@@ -163,9 +186,35 @@ func (b *TelemetryBundleRow) Exists(db *sql.DB) bool {
 }
 
 func (b *TelemetryBundleRow) Insert(db *sql.DB, itemIDs []int64) (bundleId string, err error) {
-	res, err := db.Exec(
-		`INSERT INTO bundles(BundleId, BundleTimestamp, BundleClientId, BundleCustomerId, BundleAnnotations, reportId) VALUES(?, ?, ?, ?, ?, NULL)`,
-		b.BundleId, b.BundleTimestamp, b.BundleClientId, b.BundleCustomerId, b.BundleAnnotations,
+	return b.InsertContext(context.Background(), db, itemIDs)
+}
+
+func (b *TelemetryBundleRow) InsertContext(ctx context.Context, db *sql.DB, itemIDs []int64) (bundleId string, err error) {
+	b.ReportId = sql.NullInt64{Int64: 0, Valid: false}
+
+	// the bundle is inserted, and its items updated, atomically
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		return b.insert(ctx, tx, itemIDs, sql.NullInt64{})
+	})
+	if err != nil {
+		return
+	}
+
+	bundleId = b.BundleId
+
+	return
+}
+
+// insert inserts the bundle, with its current reportId, moving the
+// specified items that are associated with the fromBundleId bundle, or
+// with no bundle if fromBundleId is NULL, to the new bundle; items that
+// have since been moved to another bundle, e.g. by another process, are
+// skipped, failing if none of the items could be moved.
+func (b *TelemetryBundleRow) insert(ctx context.Context, db sqlExecer, itemIDs []int64, fromBundleId sql.NullInt64) (err error) {
+	res, err := db.ExecContext(
+		ctx,
+		`INSERT INTO bundles(BundleId, BundleTimestamp, BundleClientId, BundleCustomerId, BundleAnnotations, reportId) VALUES(?, ?, ?, ?, ?, ?)`,
+		b.BundleId, b.BundleTimestamp, b.BundleClientId, b.BundleCustomerId, b.BundleAnnotations, b.ReportId,
 	)
 	if err != nil {
 		slog.Error(
@@ -173,7 +222,7 @@ func (b *TelemetryBundleRow) Insert(db *sql.DB, itemIDs []int64) (bundleId strin
 			slog.String("bundleId", b.BundleId),
 			slog.String("err", err.Error()),
 		)
-		return bundleId, err
+		return
 	}
 	id, err := res.LastInsertId()
 	if err != nil {
@@ -182,31 +231,46 @@ func (b *TelemetryBundleRow) Insert(db *sql.DB, itemIDs []int64) (bundleId strin
 			slog.String("bundleId", b.BundleId),
 			slog.String("err", err.Error()),
 		)
-		return bundleId, err
+		return
 	}
 	b.Id = id
 
-	b.ReportId = sql.NullInt64{Int64: 0, Valid: false}
-
 	// Update the bundleId of the items
+	var moved int64
 	for _, itemID := range itemIDs {
-		_, err := db.Exec("UPDATE items SET bundleId = ? WHERE id = ?", b.Id, itemID)
+		res, err := db.ExecContext(
+			ctx,
+			"UPDATE items SET bundleId = ? WHERE id = ? AND bundleId IS ?",
+			b.Id, itemID, fromBundleId,
+		)
 		if err != nil {
 			slog.Error(
 				"Failed to update bundleId in item",
 				slog.Int64("itemId", itemID),
 				slog.String("error", err.Error()),
 			)
-			return "", err
+			return err
+		}
+
+		count, err := res.RowsAffected()
+		if err != nil {
+			return err
 		}
+		moved += count
 	}
 
-	bundleId = b.BundleId
+	if moved == 0 {
+		return fmt.Errorf("%w: bundle %q", ErrNoUnbundledItems, b.BundleId)
+	}
 
 	return
 }
 
 func (b *TelemetryBundleRow) Delete(db *sql.DB) (err error) {
-	_, err = db.Exec("DELETE FROM bundles WHERE bundleId = ?", b.BundleId)
+	return b.DeleteContext(context.Background(), db)
+}
+
+func (b *TelemetryBundleRow) DeleteContext(ctx context.Context, db *sql.DB) (err error) {
+	_, err = db.ExecContext(ctx, "DELETE FROM bundles WHERE bundleId = ?", b.BundleId)
 	return
 }
@@ -0,0 +1,124 @@
+package telemetrylib
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/SUSE/telemetry/pkg/types"
+)
+
+// supported bundling policy group_by values
+const (
+	BUNDLE_GROUP_BY_TYPE = `type`
+	BUNDLE_GROUP_BY_TAGS = `tags`
+)
+
+// validateBundlingPolicy checks that the bundling policy settings are valid
+func validateBundlingPolicy(policy *config.BundlingConfig) error {
+	switch {
+	case policy.MaxItems < 0:
+		return fmt.Errorf("invalid bundling max_items %d", policy.MaxItems)
+	case policy.MaxBytes < 0:
+		return fmt.Errorf("invalid bundling max_bytes %d", policy.MaxBytes)
+	case policy.TimeWindow < 0:
+		return fmt.Errorf("invalid bundling time_window %s", policy.TimeWindow)
+	}
+
+	for _, groupBy := range policy.GroupBy {
+		switch groupBy {
+		case BUNDLE_GROUP_BY_TYPE, BUNDLE_GROUP_BY_TAGS:
+		default:
+			return fmt.Errorf(
+				"unsupported bundling group_by %q, must be one of %q or %q",
+				groupBy,
+				BUNDLE_GROUP_BY_TYPE,
+				BUNDLE_GROUP_BY_TAGS,
+			)
+		}
+	}
+
+	return nil
+}
+
+// bundleGroupKey returns the key identifying the group that the item should
+// be bundled with, and whether the item can be bundled yet, which it can't
+// if it was staged in a time window that hasn't ended yet
+func bundleGroupKey(policy *config.BundlingConfig, itemRow *TelemetryStagedItemRow, now time.Time) (key string, ready bool, err error) {
+	var keys []string
+	for _, groupBy := range policy.GroupBy {
+		switch groupBy {
+		case BUNDLE_GROUP_BY_TYPE:
+			keys = append(keys, itemRow.ItemType)
+		case BUNDLE_GROUP_BY_TAGS:
+			// the same tags may have been specified in a different order
+			tags := strings.Split(itemRow.ItemAnnotations, ",")
+			slices.Sort(tags)
+			keys = append(keys, strings.Join(tags, ","))
+		}
+	}
+
+	if policy.TimeWindow > 0 {
+		timestamp, err := types.TimeStampFromString(itemRow.ItemTimestamp)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid timestamp for item %q: %w", itemRow.ItemId, err)
+		}
+
+		window := timestamp.Truncate(policy.TimeWindow)
+		if window.Add(policy.TimeWindow).After(now) {
+			return "", false, nil
+		}
+		keys = append(keys, window.UTC().Format(time.RFC3339))
+	}
+
+	return strings.Join(keys, "\x00"), true, nil
+}
+
+// groupBundleItems splits the items into groups, each of which should be
+// placed in a separate bundle, according to the bundling policy, returning
+// the ids of the items in each group; items that can't be bundled yet are
+// omitted. Groups are ordered by their first item, and an item that exceeds
+// the max_bytes limit on its own is placed in a group by itself. The
+// contentSizes map the item ids to the uncompressed size of their content,
+// and are only needed if the policy specifies max_bytes.
+func groupBundleItems(policy *config.BundlingConfig, itemRows []*TelemetryStagedItemRow, contentSizes map[int64]int, now time.Time) (groups [][]int64, err error) {
+	var keys []string
+	keyedRows := map[string][]*TelemetryStagedItemRow{}
+	for _, itemRow := range itemRows {
+		key, ready, err := bundleGroupKey(policy, itemRow, now)
+		if err != nil {
+			return nil, err
+		}
+		if !ready {
+			continue
+		}
+
+		if _, found := keyedRows[key]; !found {
+			keys = append(keys, key)
+		}
+		keyedRows[key] = append(keyedRows[key], itemRow)
+	}
+
+	for _, key := range keys {
+		var groupIDs []int64
+		var groupSize int
+		for _, itemRow := range keyedRows[key] {
+			itemSize := contentSizes[itemRow.Id]
+
+			full := (policy.MaxItems > 0 && len(groupIDs) >= policy.MaxItems) ||
+				(policy.MaxBytes > 0 && groupSize+itemSize > policy.MaxBytes)
+			if len(groupIDs) > 0 && full {
+				groups = append(groups, groupIDs)
+				groupIDs, groupSize = nil, 0
+			}
+
+			groupIDs = append(groupIDs, itemRow.Id)
+			groupSize += itemSize
+		}
+		groups = append(groups, groupIDs)
+	}
+
+	return
+}
@@ -1,6 +1,8 @@
 package telemetrylib
 
 import (
+	"context"
+
 	"github.com/SUSE/telemetry/pkg/config"
 )
 
@@ -16,43 +18,52 @@ type TelemetryCommon interface {
 
 	// Get a count of telemetry data items that are not associated with a bundle
 	ItemCount(bundleIds ...any) (int, error)
+	ItemCountContext(ctx context.Context, bundleIds ...any) (int, error)
 
 	// Get all telemetry data items from the items table
 	GetItemRows(bundleIds ...any) ([]*TelemetryDataItemRow, error)
+	GetItemRowsContext(ctx context.Context, bundleIds ...any) ([]*TelemetryDataItemRow, error)
 
 	// Delete a specified telemetry data item from the items table
 	DeleteItem(dataItemRow *TelemetryDataItemRow) error
+	DeleteItemContext(ctx context.Context, dataItemRow *TelemetryDataItemRow) error
 
 	// Get a count of telemetry bundles that are not associated with a report
 	BundleCount(bundleIds ...any) (int, error)
+	BundleCountContext(ctx context.Context, bundleIds ...any) (int, error)
 
 	// Get telemetry bundles from the bundles table
 	GetBundleRows(reportIds ...any) ([]*TelemetryBundleRow, error)
+	GetBundleRowsContext(ctx context.Context, reportIds ...any) ([]*TelemetryBundleRow, error)
 
 	// Delete a specified telemetry bundle from the bundles table
 	DeleteBundle(bundleRow *TelemetryBundleRow) error
+	DeleteBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow) error
 
 	// Get a count of telemetry reports
 	ReportCount(ids ...any) (int, error)
+	ReportCountContext(ctx context.Context, ids ...any) (int, error)
 
 	// Get telemetry reports from the reports table
 	GetReportRows(ids ...any) ([]*TelemetryReportRow, error)
+	GetReportRowsContext(ctx context.Context, ids ...any) ([]*TelemetryReportRow, error)
 
 	// Delete a specified telemetry report from the reports table
 	DeleteReport(reportRow *TelemetryReportRow) error
+	DeleteReportContext(ctx context.Context, reportRow *TelemetryReportRow) error
 }
 
 type TelemetryCommonImpl struct {
-	storer *DatabaseStore
+	storer DataStore
 }
 
 func (t *TelemetryCommonImpl) setup(cfg *config.DBConfig) (err error) {
-	t.storer, err = NewDatabaseStore(*cfg)
+	t.storer, err = NewDataStore(*cfg)
 	return
 }
 
 func (t *TelemetryCommonImpl) cleanup() (err error) {
-	err = t.storer.dropTables()
+	err = t.storer.cleanup()
 	return
 }
 
@@ -62,54 +73,89 @@ func (t *TelemetryCommonImpl) Persistent() bool {
 }
 
 func (t *TelemetryCommonImpl) ItemCount(bundleIds ...any) (count int, err error) {
+	return t.ItemCountContext(context.Background(), bundleIds...)
+}
+
+func (t *TelemetryCommonImpl) ItemCountContext(ctx context.Context, bundleIds ...any) (count int, err error) {
 	// count of items matched by specified bundleIds
-	count, err = t.storer.GetItemCount(bundleIds...)
+	count, err = t.storer.GetItemCountContext(ctx, bundleIds...)
 	return
 }
 
 func (t *TelemetryCommonImpl) BundleCount(reportIds ...any) (count int, err error) {
+	return t.BundleCountContext(context.Background(), reportIds...)
+}
+
+func (t *TelemetryCommonImpl) BundleCountContext(ctx context.Context, reportIds ...any) (count int, err error) {
 	// count of bundles matched by specified reportIds
-	count, err = t.storer.GetBundleCount(reportIds...)
+	count, err = t.storer.GetBundleCountContext(ctx, reportIds...)
 	return
 }
 
 func (t *TelemetryCommonImpl) ReportCount(ids ...any) (count int, err error) {
+	return t.ReportCountContext(context.Background(), ids...)
+}
+
+func (t *TelemetryCommonImpl) ReportCountContext(ctx context.Context, ids ...any) (count int, err error) {
 	// count of reports matched by specified ids
-	count, err = t.storer.GetReportCount(ids...)
+	count, err = t.storer.GetReportCountContext(ctx, ids...)
 	return
 }
 
 func (t *TelemetryCommonImpl) DeleteItem(itemRow *TelemetryDataItemRow) (err error) {
-	err = itemRow.Delete(t.storer.Conn)
+	return t.DeleteItemContext(context.Background(), itemRow)
+}
+
+func (t *TelemetryCommonImpl) DeleteItemContext(ctx context.Context, itemRow *TelemetryDataItemRow) (err error) {
+	err = t.storer.DeleteItemContext(ctx, itemRow)
 	return
 }
 
 func (t *TelemetryCommonImpl) DeleteBundle(bundleRow *TelemetryBundleRow) (err error) {
-	// foreign key constraint will trigger cascaded delete of
-	// associated items
-	err = bundleRow.Delete(t.storer.Conn)
+	return t.DeleteBundleContext(context.Background(), bundleRow)
+}
+
+func (t *TelemetryCommonImpl) DeleteBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow) (err error) {
+	// deleting a bundle also deletes its associated items
+	err = t.storer.DeleteBundleContext(ctx, bundleRow)
 	return
 }
 
 func (t *TelemetryCommonImpl) DeleteReport(reportRow *TelemetryReportRow) (err error) {
-	// foreign key constraints will trigger cascaded delete of
-	// associated bundles, and their associated items
-	err = reportRow.Delete(t.storer.Conn)
+	return t.DeleteReportContext(context.Background(), reportRow)
+}
+
+func (t *TelemetryCommonImpl) DeleteReportContext(ctx context.Context, reportRow *TelemetryReportRow) (err error) {
+	// deleting a report also deletes its associated bundles, and
+	// their associated items
+	err = t.storer.DeleteReportContext(ctx, reportRow)
 	return
 }
 
 func (t *TelemetryCommonImpl) GetItemRows(bundleIds ...any) (itemRows []*TelemetryDataItemRow, err error) {
-	_, itemRows, err = t.storer.GetItems(bundleIds...)
+	return t.GetItemRowsContext(context.Background(), bundleIds...)
+}
+
+func (t *TelemetryCommonImpl) GetItemRowsContext(ctx context.Context, bundleIds ...any) (itemRows []*TelemetryDataItemRow, err error) {
+	_, itemRows, err = t.storer.GetItemsContext(ctx, bundleIds...)
 	return
 }
 
 func (t *TelemetryCommonImpl) GetBundleRows(reportIds ...any) (bundleRows []*TelemetryBundleRow, err error) {
-	_, bundleRows, err = t.storer.GetBundles(reportIds...)
+	return t.GetBundleRowsContext(context.Background(), reportIds...)
+}
+
+func (t *TelemetryCommonImpl) GetBundleRowsContext(ctx context.Context, reportIds ...any) (bundleRows []*TelemetryBundleRow, err error) {
+	_, bundleRows, err = t.storer.GetBundlesContext(ctx, reportIds...)
 	return
 }
 
 func (t *TelemetryCommonImpl) GetReportRows(ids ...any) (reportRows []*TelemetryReportRow, err error) {
-	_, reportRows, err = t.storer.GetReports(ids...)
+	return t.GetReportRowsContext(context.Background(), ids...)
+}
+
+func (t *TelemetryCommonImpl) GetReportRowsContext(ctx context.Context, ids ...any) (reportRows []*TelemetryReportRow, err error) {
+	_, reportRows, err = t.storer.GetReportsContext(ctx, ids...)
 	return
 }
 
@@ -0,0 +1,191 @@
+package telemetrylib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/stretchr/testify/suite"
+)
+
+// environment variables used to run the test binary as a hammer worker,
+// sharing the specified datastore with the test process
+const (
+	HAMMER_WORKER_DRIVER = "TELEMETRY_HAMMER_DRIVER"
+	HAMMER_WORKER_PARAMS = "TELEMETRY_HAMMER_PARAMS"
+	HAMMER_WORKER_ID     = "TELEMETRY_HAMMER_ID"
+)
+
+const (
+	hammerWorkers    = 4
+	hammerIterations = 20
+	hammerItems      = 3
+	hammerReportSize = 4096
+	hammerClientId   = "5b0e7a8e-3f0a-4c55-9d1e-6a1f4f2f8c11"
+	hammerCustomerId = "1234567890"
+)
+
+func TestMain(m *testing.M) {
+	if driver := os.Getenv(HAMMER_WORKER_DRIVER); driver != "" {
+		if err := runHammerWorker(driver, os.Getenv(HAMMER_WORKER_PARAMS), os.Getenv(HAMMER_WORKER_ID)); err != nil {
+			fmt.Fprintf(os.Stderr, "hammer worker failed: %s\n", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// runHammerWorker repeatedly adds items, and generates bundles and reports
+// from whatever is pending, competing with the other workers to do so.
+func runHammerWorker(driver, params, workerId string) (err error) {
+	processor, err := NewTelemetryProcessor(&config.DBConfig{Driver: driver, Params: params})
+	if err != nil {
+		return
+	}
+
+	// the datastore is shared, and cleaned up by the test process
+	tags := types.Tags{"HAMMER"}
+	for i := 0; i < hammerIterations; i++ {
+		for j := 0; j < hammerItems; j++ {
+			payload := types.NewTelemetryBlob([]byte(fmt.Sprintf(
+				`{"version": 1, "worker": %q, "iteration": %d, "item": %d}`,
+				workerId, i, j,
+			)))
+			if err = processor.AddData("HAMMER-TEST", payload, tags); err != nil {
+				return fmt.Errorf("add data: %w", err)
+			}
+		}
+
+		_, err = processor.GenerateBundle(hammerClientId, hammerCustomerId, tags)
+		if err != nil && !errors.Is(err, ErrNoUnbundledItems) {
+			return fmt.Errorf("generate bundle: %w", err)
+		}
+
+		_, err = processor.GenerateReports(hammerClientId, tags, hammerReportSize)
+		if err != nil && !errors.Is(err, ErrNoUnreportedBundles) {
+			return fmt.Errorf("generate reports: %w", err)
+		}
+		err = nil
+	}
+
+	return
+}
+
+type ConcurrencyTestSuite struct {
+	suite.Suite
+}
+
+// hammer runs multiple worker processes against the specified datastore,
+// and then verifies that every item ended up in exactly one bundle, and
+// every bundle in exactly one report.
+func (t *ConcurrencyTestSuite) hammer(dbConfig config.DBConfig) {
+	var wg sync.WaitGroup
+	outputs := make([][]byte, hammerWorkers)
+	errs := make([]error, hammerWorkers)
+	for w := 0; w < hammerWorkers; w++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(
+			os.Environ(),
+			HAMMER_WORKER_DRIVER+"="+dbConfig.Driver,
+			HAMMER_WORKER_PARAMS+"="+dbConfig.Params,
+			HAMMER_WORKER_ID+"="+strconv.Itoa(w),
+		)
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			outputs[w], errs[w] = cmd.CombinedOutput()
+		}(w)
+	}
+	wg.Wait()
+
+	for w := range errs {
+		t.Require().NoError(errs[w], "worker %d: %s", w, outputs[w])
+	}
+
+	processor, err := NewTelemetryProcessor(&dbConfig)
+	t.Require().NoError(err)
+	defer processor.cleanup()
+
+	// collect any leftovers that the workers raced past
+	tags := types.Tags{"HAMMER"}
+	_, err = processor.GenerateBundle(hammerClientId, hammerCustomerId, tags)
+	if !errors.Is(err, ErrNoUnbundledItems) {
+		t.Require().NoError(err)
+	}
+	_, err = processor.GenerateReports(hammerClientId, tags, hammerReportSize)
+	if !errors.Is(err, ErrNoUnreportedBundles) {
+		t.Require().NoError(err)
+	}
+
+	itemCount, err := processor.ItemCount()
+	t.Require().NoError(err)
+	t.Equal(hammerWorkers*hammerIterations*hammerItems, itemCount)
+
+	unbundled, err := processor.ItemCount("NULL")
+	t.Require().NoError(err)
+	t.Equal(0, unbundled, "no items should be left unbundled")
+
+	unreported, err := processor.BundleCount("NULL")
+	t.Require().NoError(err)
+	t.Equal(0, unreported, "no bundles should be left unreported")
+
+	bundleRows, err := processor.GetBundleRows()
+	t.Require().NoError(err)
+	bundledItems := 0
+	for _, bundleRow := range bundleRows {
+		count, err := processor.ItemCount(bundleRow.Id)
+		t.Require().NoError(err)
+		t.NotZero(count, "bundle %d has no items", bundleRow.Id)
+		bundledItems += count
+	}
+	t.Equal(itemCount, bundledItems)
+
+	reportRows, err := processor.GetReportRows()
+	t.Require().NoError(err)
+	reportedBundles := 0
+	for _, reportRow := range reportRows {
+		count, err := processor.BundleCount(reportRow.Id)
+		t.Require().NoError(err)
+		t.NotZero(count, "report %d has no bundles", reportRow.Id)
+		reportedBundles += count
+
+		report, err := processor.ToReport(reportRow)
+		t.Require().NoError(err)
+		t.Require().NoError(report.Validate())
+	}
+	t.Equal(len(bundleRows), reportedBundles)
+}
+
+func (t *ConcurrencyTestSuite) TestHammerSqlite3() {
+	if !sqlite3Available {
+		t.T().Skip("sqlite3 datastore requires cgo")
+	}
+
+	t.hammer(config.DBConfig{
+		Driver: DATASTORE_DRIVER_SQLITE3,
+		Params: filepath.Join(t.T().TempDir(), "telemetry.db"),
+	})
+}
+
+func (t *ConcurrencyTestSuite) TestHammerSpool() {
+	t.hammer(config.DBConfig{
+		Driver: DATASTORE_DRIVER_SPOOL,
+		Params: filepath.Join(t.T().TempDir(), "spool"),
+	})
+}
+
+func TestConcurrencyTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping multi-process tests in short mode")
+	}
+	suite.Run(t, new(ConcurrencyTestSuite))
+}
@@ -0,0 +1,57 @@
+package telemetrylib
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/SUSE/telemetry/pkg/types"
+)
+
+// relayedBundle returns whether the bundle was relayed on behalf of another
+// telemetry client, which made its own consent decisions, rather than being
+// generated locally, or synthesized for one of the specified managed
+// clients, whose telemetry is collected under the local consent settings.
+func relayedBundle(bundleRow *TelemetryBundleRow, managedClientIds map[string]bool) bool {
+	if managedClientIds[bundleRow.BundleClientId] {
+		return false
+	}
+
+	return slices.ContainsFunc(
+		strings.Split(bundleRow.BundleAnnotations, ","),
+		func(annotation string) bool {
+			return strings.HasPrefix(annotation, RELAYED_VIA_TAG+"=")
+		},
+	)
+}
+
+// selectWithdrawals selects the staged items that the current consent
+// settings no longer allow to be submitted, either because their telemetry
+// class is no longer enabled, or their telemetry type is no longer enabled,
+// ignoring items in the specified relayed bundles. Items are selected in id
+// order, so that the same items are always selected.
+func selectWithdrawals(cfg *config.Config, stagedRows []*TelemetryStagedItemRow, relayedBundleIds map[int64]bool) (withdrawals []*stagedEviction) {
+	for _, stagedRow := range stagedRows {
+		if stagedRow.BundleId.Valid && relayedBundleIds[stagedRow.BundleId.Int64] {
+			continue
+		}
+
+		var reason string
+		switch {
+		case !cfg.TelemetryClassEnabled(stagedRow.ItemClass):
+			reason = EVICTION_REASON_CLASS_WITHDRAWN
+		case !cfg.TelemetryTypeEnabled(types.TelemetryType(stagedRow.ItemType)):
+			reason = EVICTION_REASON_TYPE_WITHDRAWN
+		default:
+			continue
+		}
+
+		withdrawal := &stagedEviction{stagedRow: stagedRow, reason: reason}
+		if timestamp, err := types.TimeStampFromString(stagedRow.ItemTimestamp); err == nil {
+			withdrawal.timestamp = timestamp.Time
+		}
+		withdrawals = append(withdrawals, withdrawal)
+	}
+
+	return
+}
@@ -1,18 +1,148 @@
 package telemetrylib
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/SUSE/telemetry/pkg/config"
 	"github.com/SUSE/telemetry/pkg/utils"
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// supported datastore drivers
+const (
+	DATASTORE_DRIVER_SQLITE3 = `sqlite3`
+	DATASTORE_DRIVER_SPOOL   = `spool`
+)
+
+var (
+	// returned when the configured datastore driver is not supported
+	ErrUnsupportedDataStoreDriver = errors.New("unsupported datastore driver")
+
+	// returned when the configured datastore driver is supported, but
+	// not available in this build, e.g. sqlite3 in a build without cgo
+	ErrDataStoreDriverUnavailable = errors.New("datastore driver not available in this build")
+
+	// returned when none of the items specified for a new bundle are
+	// still available, e.g. because another process has bundled them
+	ErrNoUnbundledItems = errors.New("no unbundled items")
+
+	// returned when none of the bundles specified for a new report are
+	// still available, e.g. because another process has reported them
+	ErrNoUnreportedBundles = errors.New("no unreported bundles")
+)
+
+// time, in milliseconds, that sqlite3 datastore operations wait for
+// another process to release the database lock before failing
+const SQLITE3_BUSY_TIMEOUT = 10000
+
+// DataStore is implemented by the backends used to stage telemetry data
+// items, bundles and reports, along with the report submission state and
+// history, and the managed client registrations. Deleting a bundle also
+// deletes its items, and deleting a report also deletes its bundles and
+// its submission state.
+//
+// Bundles and reports are created atomically, and only claim the items or
+// bundles that are not already associated with a bundle or report when
+// they are created, so that multiple processes can safely generate them
+// concurrently; creation fails with ErrNoUnbundledItems or
+// ErrNoUnreportedBundles, rather than creating an empty bundle or report,
+// if none of the specified items or bundles could be claimed.
+type DataStore interface {
+	String() string
+
+	// Whether the datastore is persistent or not
+	Persistent() bool
+
+	// Remove all staged content, for testing support
+	cleanup() error
+
+	// Telemetry data items, selected by the ids of their bundles
+	InsertItemContext(ctx context.Context, itemRow *TelemetryDataItemRow) error
+	DeleteItemContext(ctx context.Context, itemRow *TelemetryDataItemRow) error
+	GetItemsContext(ctx context.Context, bundleIds ...any) ([]int64, []*TelemetryDataItemRow, error)
+	WalkItemsContext(ctx context.Context, fn func(itemRow *TelemetryDataItemRow) error, bundleIds ...any) error
+	GetItemCountContext(ctx context.Context, bundleIds ...any) (int, error)
+	GetUnmanagedItemIdsContext(ctx context.Context) ([]int64, error)
+	GetStagedItemsContext(ctx context.Context) ([]*TelemetryStagedItemRow, error)
+
+	// Telemetry bundles, selected by the ids of their reports
+	BundleExistsContext(ctx context.Context, bundleRow *TelemetryBundleRow) bool
+	InsertBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow, itemIDs []int64) error
+	InsertBundleWithItemsContext(ctx context.Context, bundleRow *TelemetryBundleRow, itemRows []*TelemetryDataItemRow) error
+	SplitBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow, newRows []*TelemetryBundleRow, itemGroups [][]int64) error
+	DeleteBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow) error
+	GetBundlesContext(ctx context.Context, reportIds ...any) ([]int64, []*TelemetryBundleRow, error)
+	GetBundleCountContext(ctx context.Context, reportIds ...any) (int, error)
+
+	// Telemetry reports, selected by their ids
+	InsertReportContext(ctx context.Context, reportRow *TelemetryReportRow, bundleIDs []int64) error
+	SplitReportContext(ctx context.Context, reportRow *TelemetryReportRow, newRows []*TelemetryReportRow, bundleGroups [][]int64) error
+	DeleteReportContext(ctx context.Context, reportRow *TelemetryReportRow) error
+	GetReportsContext(ctx context.Context, ids ...any) ([]int64, []*TelemetryReportRow, error)
+	GetReportCountContext(ctx context.Context, ids ...any) (int, error)
+	GetPendingReportsContext(ctx context.Context) ([]int64, []*TelemetryReportRow, error)
+	GetQuarantinedReportsContext(ctx context.Context) ([]int64, []*TelemetryReportRow, error)
+
+	// Report submission state
+	GetReportStateContext(ctx context.Context, reportRow *TelemetryReportRow) (*TelemetryReportStateRow, error)
+	UpsertReportStateContext(ctx context.Context, stateRow *TelemetryReportStateRow) error
+	DeleteReportStateContext(ctx context.Context, stateRow *TelemetryReportStateRow) error
+
+	// Report submission history, selected by report UUIDs
+	InsertSubmissionContext(ctx context.Context, submissionRow *TelemetrySubmissionRow) error
+	GetSubmissionsContext(ctx context.Context, reportIds ...any) ([]*TelemetrySubmissionRow, error)
+	GetSubmissionCountContext(ctx context.Context, reportIds ...any) (int, error)
+
+	// Records of staged data items evicted to enforce the staging limits,
+	// or because consent for them was withdrawn; EvictItemsContext
+	// atomically deletes the items, along with any bundles and reports
+	// left empty as a result, and records the evictions
+	EvictItemsContext(ctx context.Context, itemIDs []int64, evictionRows []*TelemetryEvictionRow) error
+	InsertEvictionContext(ctx context.Context, evictionRow *TelemetryEvictionRow) error
+	DeleteEvictionContext(ctx context.Context, evictionRow *TelemetryEvictionRow) error
+	GetEvictionsContext(ctx context.Context) ([]*TelemetryEvictionRow, error)
+
+	// Managed client registrations, and the data items staged for them
+	ManagedClientExistsContext(ctx context.Context, managedRow *TelemetryManagedClientRow) bool
+	InsertManagedClientContext(ctx context.Context, managedRow *TelemetryManagedClientRow) error
+	InsertManagedItemContext(ctx context.Context, managedRow *TelemetryManagedClientRow, itemRow *TelemetryDataItemRow) error
+	GetManagedClientsContext(ctx context.Context) ([]*TelemetryManagedClientRow, error)
+	GetManagedItemIdsContext(ctx context.Context, managedRow *TelemetryManagedClientRow) ([]int64, error)
+}
+
+// DataStoreDriverAvailable returns whether the datastore driver is
+// supported and available in this build; the sqlite3 driver requires cgo.
+func DataStoreDriverAvailable(driver string) bool {
+	switch driver {
+	case DATASTORE_DRIVER_SQLITE3:
+		return sqlite3Available
+	case DATASTORE_DRIVER_SPOOL:
+		return true
+	}
+
+	return false
+}
+
+// NewDataStore creates the datastore backend specified by the config.
+func NewDataStore(dbConfig config.DBConfig) (DataStore, error) {
+	switch dbConfig.Driver {
+	case DATASTORE_DRIVER_SQLITE3:
+		return NewDatabaseStore(dbConfig)
+	case DATASTORE_DRIVER_SPOOL:
+		return NewSpoolStore(dbConfig)
+	}
+
+	slog.Error("unsupported datastore driver", slog.String("driver", dbConfig.Driver))
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedDataStoreDriver, dbConfig.Driver)
+}
+
 // DatabaseStorer is an implementation for storing data in a database.
 type DatabaseStore struct {
 	Conn       *sql.DB
@@ -25,7 +155,11 @@ func NewDatabaseStore(dbConfig config.DBConfig) (ds *DatabaseStore, err error) {
 	ds = &DatabaseStore{}
 
 	switch dbConfig.Driver {
-	case "sqlite3":
+	case DATASTORE_DRIVER_SQLITE3:
+		if !sqlite3Available {
+			return nil, fmt.Errorf("%w: %q requires cgo", ErrDataStoreDriverUnavailable, dbConfig.Driver)
+		}
+
 		dbPath, opts, optsFound := strings.Cut(dbConfig.Params, "?")
 
 		if !strings.Contains(dbPath, `:memory:`) {
@@ -55,7 +189,8 @@ func NewDatabaseStore(dbConfig config.DBConfig) (ds *DatabaseStore, err error) {
 			ds.persistent = true
 		}
 
-		// exsure foreign_keys and journal_mode options are specified
+		// exsure foreign_keys, journal_mode, busy_timeout and txlock
+		// options are specified
 		if !optsFound {
 			opts = ""
 		}
@@ -66,6 +201,17 @@ func NewDatabaseStore(dbConfig config.DBConfig) (ds *DatabaseStore, err error) {
 		if !strings.Contains(opts, "_journal_mode=") {
 			extraOpts = append(extraOpts, "_journal_mode=WAL")
 		}
+
+		// wait for, rather than immediately failing due to, concurrent
+		// updates by other processes, and have transactions take the
+		// write lock when they begin, rather than failing if another
+		// process updates the database after they have read from it
+		if !strings.Contains(opts, "_busy_timeout=") {
+			extraOpts = append(extraOpts, fmt.Sprintf("_busy_timeout=%d", SQLITE3_BUSY_TIMEOUT))
+		}
+		if !strings.Contains(opts, "_txlock=") {
+			extraOpts = append(extraOpts, "_txlock=immediate")
+		}
 		if len(extraOpts) > 0 {
 			if len(opts) > 0 {
 				opts += "&"
@@ -80,7 +226,7 @@ func NewDatabaseStore(dbConfig config.DBConfig) (ds *DatabaseStore, err error) {
 
 	default:
 		slog.Error("unsupported database type", slog.String("dbDriver", dbConfig.Driver))
-		return nil, err
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedDataStoreDriver, dbConfig.Driver)
 	}
 
 	err = ds.EnsureTablesExist()
@@ -123,28 +269,43 @@ func (d *DatabaseStore) Connect() (err error) {
 	return
 }
 
+// EnsureTablesExist ensures that the datastore tables exist, with the
+// latest schema, by applying any pending schema migrations.
 func (d *DatabaseStore) EnsureTablesExist() (err error) {
-	for name, columns := range dbTables {
-		createCmd := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s %s", name, columns)
-		_, err = d.Conn.Exec(createCmd)
-		if err != nil {
-			slog.Error(
-				"failed to create table",
-				slog.String("table", name),
-				slog.String("err", err.Error()),
-			)
-			return
-		}
-	}
+	return d.Migrate()
+}
 
-	return
+// sqlExecer is implemented by both *sql.DB and *sql.Tx, allowing rows to
+// be inserted as part of a transaction
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 }
 
-// list of predefined tables
-var dbTables = map[string]string{
-	"items":   itemsColumns,
-	"bundles": bundlesColumns,
-	"reports": reportsColumns,
+// withTx runs fn in a transaction, which is committed if fn succeeds, and
+// rolled back otherwise.
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error(
+			"failed to begin transaction",
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		slog.Error(
+			"failed to commit transaction",
+			slog.String("err", err.Error()),
+		)
+	}
+
+	return
 }
 
 func genSqlPopulateQuery(table string, fields []string, matchField string, inputValues []any) (query string, outputValues []any) {
@@ -188,16 +349,45 @@ func genSqlCountQuery(table, countField, matchField string, inputValues []any) (
 }
 
 func (d *DatabaseStore) GetItems(bundleIds ...any) (itemRowIds []int64, itemRows []*TelemetryDataItemRow, err error) {
+	return d.GetItemsContext(context.Background(), bundleIds...)
+}
+
+func (d *DatabaseStore) GetItemsContext(ctx context.Context, bundleIds ...any) (itemRowIds []int64, itemRows []*TelemetryDataItemRow, err error) {
+	err = d.WalkItemsContext(
+		ctx,
+		func(itemRow *TelemetryDataItemRow) error {
+			itemRows = append(itemRows, itemRow)
+			itemRowIds = append(itemRowIds, itemRow.Id)
+			return nil
+		},
+		bundleIds...,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return
+}
+
+// WalkItems calls fn for each of the items associated with the specified
+// bundleIds, in id order, retrieving and decompressing one item at a time
+// so that large bundles need not be held in memory, stopping if fn fails.
+func (d *DatabaseStore) WalkItems(fn func(itemRow *TelemetryDataItemRow) error, bundleIds ...any) (err error) {
+	return d.WalkItemsContext(context.Background(), fn, bundleIds...)
+}
+
+func (d *DatabaseStore) WalkItemsContext(ctx context.Context, fn func(itemRow *TelemetryDataItemRow) error, bundleIds ...any) (err error) {
 	// generate the SQL populate query statement for the items table
 	query, queryBundleIds := genSqlPopulateQuery(
 		"items",
-		[]string{"id", "itemId", "itemType", "itemTimestamp", "itemAnnotations", "itemData", "itemChecksum", "compression", "bundleId"},
+		[]string{"id", "itemId", "itemType", "itemTimestamp", "itemAnnotations", "itemData", "itemChecksum", "compression", "bundleId", "itemClass"},
 		"bundleId",
 		bundleIds,
 	)
+	query += " ORDER BY id"
 
 	// NOTE: Query() extra args must be of type any hence queryIds is type []any
-	rows, err := d.Conn.Query(query, queryBundleIds...)
+	rows, err := d.Conn.QueryContext(ctx, query, queryBundleIds...)
 	if err != nil {
 		slog.Error(
 			"Failed to retrieve items with specified bundleIds",
@@ -220,12 +410,13 @@ func (d *DatabaseStore) GetItems(bundleIds ...any) (itemRowIds []int64, itemRows
 			&itemRow.ItemData,
 			&itemRow.ItemChecksum,
 			&itemRow.Compression,
-			&itemRow.BundleId); err != nil {
+			&itemRow.BundleId,
+			&itemRow.ItemClass); err != nil {
 			slog.Error(
 				"Failed to scan item row",
 				slog.String("error", err.Error()),
 			)
-			return nil, nil, err
+			return err
 		}
 
 		// ItemData can be stored as compressed data
@@ -236,11 +427,12 @@ func (d *DatabaseStore) GetItems(bundleIds ...any) (itemRowIds []int64, itemRows
 				slog.String("itemId", itemRow.ItemId),
 				slog.String("error", err.Error()),
 			)
-			return nil, nil, err
+			return err
 		}
 
-		itemRows = append(itemRows, &itemRow)
-		itemRowIds = append(itemRowIds, itemRow.Id)
+		if err = fn(&itemRow); err != nil {
+			return err
+		}
 	}
 
 	if err = rows.Err(); err != nil {
@@ -255,6 +447,10 @@ func (d *DatabaseStore) GetItems(bundleIds ...any) (itemRowIds []int64, itemRows
 }
 
 func (d *DatabaseStore) GetBundles(reportIds ...any) (bundleRowIds []int64, bundleRows []*TelemetryBundleRow, err error) {
+	return d.GetBundlesContext(context.Background(), reportIds...)
+}
+
+func (d *DatabaseStore) GetBundlesContext(ctx context.Context, reportIds ...any) (bundleRowIds []int64, bundleRows []*TelemetryBundleRow, err error) {
 	// generate the SQL populate query statement for the bundles table
 	query, queryBundleIds := genSqlPopulateQuery(
 		"bundles",
@@ -264,7 +460,7 @@ func (d *DatabaseStore) GetBundles(reportIds ...any) (bundleRowIds []int64, bund
 	)
 
 	// NOTE: Query() extra args must be of type any hence queryIds is type []any
-	rows, err := d.Conn.Query(query, queryBundleIds...)
+	rows, err := d.Conn.QueryContext(ctx, query, queryBundleIds...)
 	if err != nil {
 		slog.Error(
 			"Failed to retrieve bundles with specified reportIds",
@@ -308,6 +504,10 @@ func (d *DatabaseStore) GetBundles(reportIds ...any) (bundleRowIds []int64, bund
 }
 
 func (d *DatabaseStore) GetReports(ids ...any) (reportRowIds []int64, reportRows []*TelemetryReportRow, err error) {
+	return d.GetReportsContext(context.Background(), ids...)
+}
+
+func (d *DatabaseStore) GetReportsContext(ctx context.Context, ids ...any) (reportRowIds []int64, reportRows []*TelemetryReportRow, err error) {
 	// generate the SQL populate query statement for the reports table
 	query, queryIds := genSqlPopulateQuery(
 		"reports",
@@ -317,7 +517,7 @@ func (d *DatabaseStore) GetReports(ids ...any) (reportRowIds []int64, reportRows
 	)
 
 	// NOTE: Query() extra args must be of type any hence queryIds is type []any
-	rows, err := d.Conn.Query(query, queryIds...)
+	reportRowIds, reportRows, err = d.queryReportsContext(ctx, query, queryIds...)
 	if err != nil {
 		slog.Error(
 			"Failed to retrieve reports with specified ids",
@@ -326,6 +526,240 @@ func (d *DatabaseStore) GetReports(ids ...any) (reportRowIds []int64, reportRows
 		)
 		return
 	}
+
+	return
+}
+
+func (d *DatabaseStore) GetPendingReports() (reportRowIds []int64, reportRows []*TelemetryReportRow, err error) {
+	return d.GetPendingReportsContext(context.Background())
+}
+
+func (d *DatabaseStore) GetPendingReportsContext(ctx context.Context) (reportRowIds []int64, reportRows []*TelemetryReportRow, err error) {
+	// reports without an associated state haven't failed submission
+	reportRowIds, reportRows, err = d.queryReportsContext(
+		ctx,
+		`SELECT reports.id,
+		        reports.reportId,
+		        reports.reportTimestamp,
+		        reports.reportClientId,
+		        reports.reportAnnotations
+		 FROM reports LEFT JOIN reportStates ON reportStates.reportId = reports.id
+		 WHERE reportStates.quarantined IS NULL OR reportStates.quarantined = 0`,
+	)
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve pending reports",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+func (d *DatabaseStore) GetQuarantinedReports() (reportRowIds []int64, reportRows []*TelemetryReportRow, err error) {
+	return d.GetQuarantinedReportsContext(context.Background())
+}
+
+func (d *DatabaseStore) GetQuarantinedReportsContext(ctx context.Context) (reportRowIds []int64, reportRows []*TelemetryReportRow, err error) {
+	reportRowIds, reportRows, err = d.queryReportsContext(
+		ctx,
+		`SELECT reports.id,
+		        reports.reportId,
+		        reports.reportTimestamp,
+		        reports.reportClientId,
+		        reports.reportAnnotations
+		 FROM reports JOIN reportStates ON reportStates.reportId = reports.id
+		 WHERE reportStates.quarantined != 0`,
+	)
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve quarantined reports",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+// GetUnmanagedItemIds returns the ids of the data items that are not yet
+// associated with a bundle, excluding any staged for managed clients
+func (d *DatabaseStore) GetUnmanagedItemIds() (itemRowIds []int64, err error) {
+	return d.GetUnmanagedItemIdsContext(context.Background())
+}
+
+func (d *DatabaseStore) GetUnmanagedItemIdsContext(ctx context.Context) (itemRowIds []int64, err error) {
+	return d.queryIdsContext(
+		ctx,
+		`SELECT items.id FROM items
+		 LEFT JOIN managedItems ON managedItems.itemId = items.id
+		 WHERE items.bundleId IS NULL AND managedItems.itemId IS NULL`,
+	)
+}
+
+// GetStagedItems returns summaries of all of the staged data items, in id
+// order, without their content
+func (d *DatabaseStore) GetStagedItems() (stagedRows []*TelemetryStagedItemRow, err error) {
+	return d.GetStagedItemsContext(context.Background())
+}
+
+func (d *DatabaseStore) GetStagedItemsContext(ctx context.Context) (stagedRows []*TelemetryStagedItemRow, err error) {
+	rows, err := d.Conn.QueryContext(
+		ctx,
+		`SELECT id, itemId, itemType, itemTimestamp, COALESCE(itemAnnotations, ''), itemChecksum, itemClass, LENGTH(itemData), itemContentSize, bundleId
+		 FROM items ORDER BY id`,
+	)
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve staged items",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stagedRow TelemetryStagedItemRow
+
+		if err := rows.Scan(
+			&stagedRow.Id,
+			&stagedRow.ItemId,
+			&stagedRow.ItemType,
+			&stagedRow.ItemTimestamp,
+			&stagedRow.ItemAnnotations,
+			&stagedRow.ItemChecksum,
+			&stagedRow.ItemClass,
+			&stagedRow.ItemSize,
+			&stagedRow.ItemContentSize,
+			&stagedRow.BundleId,
+		); err != nil {
+			slog.Error(
+				"Failed to scan staged item row",
+				slog.String("error", err.Error()),
+			)
+			return nil, err
+		}
+		stagedRows = append(stagedRows, &stagedRow)
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error(
+			"Failed to process retrieved staged item rows",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+// GetManagedItemIds returns the ids of the data items staged for the
+// managed client that are not yet associated with a bundle
+func (d *DatabaseStore) GetManagedItemIds(managedRow *TelemetryManagedClientRow) (itemRowIds []int64, err error) {
+	return d.GetManagedItemIdsContext(context.Background(), managedRow)
+}
+
+func (d *DatabaseStore) GetManagedItemIdsContext(ctx context.Context, managedRow *TelemetryManagedClientRow) (itemRowIds []int64, err error) {
+	return d.queryIdsContext(
+		ctx,
+		`SELECT items.id FROM items
+		 JOIN managedItems ON managedItems.itemId = items.id
+		 WHERE items.bundleId IS NULL AND managedItems.managedClientId = ?`,
+		managedRow.Id,
+	)
+}
+
+// queryIdsContext retrieves the row ids returned by the specified query,
+// which must select a single id column
+func (d *DatabaseStore) queryIdsContext(ctx context.Context, query string, args ...any) (ids []int64, err error) {
+	rows, err := d.Conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve row ids",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			slog.Error(
+				"Failed to scan row id",
+				slog.String("error", err.Error()),
+			)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error(
+			"Failed to process retrieved row ids",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+func (d *DatabaseStore) GetManagedClients() (managedRows []*TelemetryManagedClientRow, err error) {
+	return d.GetManagedClientsContext(context.Background())
+}
+
+func (d *DatabaseStore) GetManagedClientsContext(ctx context.Context) (managedRows []*TelemetryManagedClientRow, err error) {
+	rows, err := d.Conn.QueryContext(
+		ctx,
+		`SELECT id, systemId, clientId, registeredAt FROM managedClients ORDER BY id`,
+	)
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve managed clients",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var managedRow TelemetryManagedClientRow
+
+		if err = rows.Scan(
+			&managedRow.Id,
+			&managedRow.SystemId,
+			&managedRow.ClientId,
+			&managedRow.RegisteredAt,
+		); err != nil {
+			slog.Error(
+				"Failed to scan managed client row",
+				slog.String("error", err.Error()),
+			)
+			return nil, err
+		}
+		managedRows = append(managedRows, &managedRow)
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error(
+			"Failed to process retrieved managed client rows",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+// queryReportsContext retrieves the report rows returned by the specified
+// query, which must select all of the reports table columns in order
+func (d *DatabaseStore) queryReportsContext(ctx context.Context, query string, args ...any) (reportRowIds []int64, reportRows []*TelemetryReportRow, err error) {
+	rows, err := d.Conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
 	defer rows.Close()
 
 	for rows.Next() {
@@ -359,7 +793,187 @@ func (d *DatabaseStore) GetReports(ids ...any) (reportRowIds []int64, reportRows
 	return
 }
 
+func (d *DatabaseStore) GetReportState(reportRow *TelemetryReportRow) (stateRow *TelemetryReportStateRow, err error) {
+	return d.GetReportStateContext(context.Background(), reportRow)
+}
+
+func (d *DatabaseStore) GetReportStateContext(ctx context.Context, reportRow *TelemetryReportRow) (stateRow *TelemetryReportStateRow, err error) {
+	stateRow = NewTelemetryReportStateRow(reportRow)
+
+	var reason sql.NullString
+	err = d.Conn.QueryRowContext(
+		ctx,
+		`SELECT id, attempts, quarantined, reason, updatedAt FROM reportStates WHERE reportId = ?`,
+		reportRow.Id,
+	).Scan(
+		&stateRow.Id,
+		&stateRow.Attempts,
+		&stateRow.Quarantined,
+		&reason,
+		&stateRow.UpdatedAt,
+	)
+	switch err {
+	case nil:
+		stateRow.Reason = reason.String
+	case sql.ErrNoRows:
+		// no state recorded yet for the report
+		err = nil
+	default:
+		slog.Error(
+			"Failed to retrieve state of report",
+			slog.String("reportId", reportRow.ReportId),
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+
+	return
+}
+
+func (d *DatabaseStore) GetSubmissions(reportIds ...any) (submissionRows []*TelemetrySubmissionRow, err error) {
+	return d.GetSubmissionsContext(context.Background(), reportIds...)
+}
+
+func (d *DatabaseStore) GetSubmissionsContext(ctx context.Context, reportIds ...any) (submissionRows []*TelemetrySubmissionRow, err error) {
+	// generate the SQL populate query statement for the submissions table
+	query, queryIds := genSqlPopulateQuery(
+		"submissions",
+		[]string{"id", "reportId", "bundleIds", "itemIds", "itemTypes", "size", "serverUrl", "processingId", "processedAt", "attempts", "submittedAt"},
+		"reportId",
+		reportIds,
+	)
+
+	// NOTE: Query() extra args must be of type any hence queryIds is type []any
+	rows, err := d.Conn.QueryContext(ctx, query, queryIds...)
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve submissions with specified reportIds",
+			slog.Any("reportIds", reportIds),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var submissionRow TelemetrySubmissionRow
+
+		if err := rows.Scan(
+			&submissionRow.Id,
+			&submissionRow.ReportId,
+			&submissionRow.BundleIds,
+			&submissionRow.ItemIds,
+			&submissionRow.ItemTypes,
+			&submissionRow.Size,
+			&submissionRow.ServerUrl,
+			&submissionRow.ProcessingId,
+			&submissionRow.ProcessedAt,
+			&submissionRow.Attempts,
+			&submissionRow.SubmittedAt,
+		); err != nil {
+			slog.Error(
+				"Failed to scan submission row",
+				slog.String("error", err.Error()),
+			)
+			return nil, err
+		}
+		submissionRows = append(submissionRows, &submissionRow)
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error(
+			"Failed to process retrieved submission rows",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+func (d *DatabaseStore) GetSubmissionCount(reportIds ...any) (count int, err error) {
+	return d.GetSubmissionCountContext(context.Background(), reportIds...)
+}
+
+func (d *DatabaseStore) GetSubmissionCountContext(ctx context.Context, reportIds ...any) (count int, err error) {
+	// generate the SQL count query statement for the submissions table
+	query, queryIds := genSqlCountQuery(
+		"submissions",
+		"id",
+		"reportId",
+		reportIds,
+	)
+	// NOTE: Query() extra args must be of type any hence queryIds is type []any
+	err = d.Conn.QueryRowContext(ctx, query, queryIds...).Scan(&count)
+	if err != nil {
+		slog.Error(
+			"Failed to count submissions associated with specified reportIds",
+			slog.Any("reportIds", reportIds),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	return
+}
+
+func (d *DatabaseStore) GetEvictions() (evictionRows []*TelemetryEvictionRow, err error) {
+	return d.GetEvictionsContext(context.Background())
+}
+
+func (d *DatabaseStore) GetEvictionsContext(ctx context.Context) (evictionRows []*TelemetryEvictionRow, err error) {
+	rows, err := d.Conn.QueryContext(
+		ctx,
+		`SELECT id, reason, itemType, itemClass, itemCount, itemBytes, oldestTimestamp, newestTimestamp, evictedAt
+		 FROM evictions ORDER BY id`,
+	)
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve evictions",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var evictionRow TelemetryEvictionRow
+
+		if err := rows.Scan(
+			&evictionRow.Id,
+			&evictionRow.Reason,
+			&evictionRow.ItemType,
+			&evictionRow.ItemClass,
+			&evictionRow.ItemCount,
+			&evictionRow.ItemBytes,
+			&evictionRow.OldestTimestamp,
+			&evictionRow.NewestTimestamp,
+			&evictionRow.EvictedAt,
+		); err != nil {
+			slog.Error(
+				"Failed to scan eviction row",
+				slog.String("error", err.Error()),
+			)
+			return nil, err
+		}
+		evictionRows = append(evictionRows, &evictionRow)
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error(
+			"Failed to process retrieved eviction rows",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
 func (d *DatabaseStore) GetItemCount(bundleIds ...any) (count int, err error) {
+	return d.GetItemCountContext(context.Background(), bundleIds...)
+}
+
+func (d *DatabaseStore) GetItemCountContext(ctx context.Context, bundleIds ...any) (count int, err error) {
 	// generate the SQL count query statement for the items table
 	query, queryIds := genSqlCountQuery(
 		"items",
@@ -368,7 +982,7 @@ func (d *DatabaseStore) GetItemCount(bundleIds ...any) (count int, err error) {
 		bundleIds,
 	)
 	// NOTE: Query() extra args must be of type any hence queryIds is type []any
-	err = d.Conn.QueryRow(query, queryIds...).Scan(&count)
+	err = d.Conn.QueryRowContext(ctx, query, queryIds...).Scan(&count)
 	if err != nil {
 		slog.Error(
 			"Failed to count items associated with specified bundles",
@@ -381,6 +995,10 @@ func (d *DatabaseStore) GetItemCount(bundleIds ...any) (count int, err error) {
 }
 
 func (d *DatabaseStore) GetBundleCount(reportIds ...any) (count int, err error) {
+	return d.GetBundleCountContext(context.Background(), reportIds...)
+}
+
+func (d *DatabaseStore) GetBundleCountContext(ctx context.Context, reportIds ...any) (count int, err error) {
 	// generate the SQL count query statement for the bundles table
 	query, queryIds := genSqlCountQuery(
 		"bundles",
@@ -389,7 +1007,7 @@ func (d *DatabaseStore) GetBundleCount(reportIds ...any) (count int, err error)
 		reportIds,
 	)
 	// NOTE: Query() extra args must be of type any hence queryIds is type []any
-	err = d.Conn.QueryRow(query, queryIds...).Scan(&count)
+	err = d.Conn.QueryRowContext(ctx, query, queryIds...).Scan(&count)
 	if err != nil {
 		slog.Error(
 			"Failed to count bundles associated with specified reports",
@@ -402,6 +1020,10 @@ func (d *DatabaseStore) GetBundleCount(reportIds ...any) (count int, err error)
 }
 
 func (d *DatabaseStore) GetReportCount(ids ...any) (count int, err error) {
+	return d.GetReportCountContext(context.Background(), ids...)
+}
+
+func (d *DatabaseStore) GetReportCountContext(ctx context.Context, ids ...any) (count int, err error) {
 	// generate the SQL count query statement for the reports table
 	query, queryIds := genSqlCountQuery(
 		"reports",
@@ -410,7 +1032,7 @@ func (d *DatabaseStore) GetReportCount(ids ...any) (count int, err error) {
 		ids,
 	)
 	// NOTE: Query() extra args must be of type any hence queryIds is type []any
-	err = d.Conn.QueryRow(query, queryIds...).Scan(&count)
+	err = d.Conn.QueryRowContext(ctx, query, queryIds...).Scan(&count)
 	if err != nil {
 		slog.Error(
 			"Failed to count reports with specified ids",
@@ -423,8 +1045,13 @@ func (d *DatabaseStore) GetReportCount(ids ...any) (count int, err error) {
 }
 
 func (d *DatabaseStore) GetDataItemRowsInABundle(bundleId string) (itemRows []*TelemetryDataItemRow, err error) {
+	return d.GetDataItemRowsInABundleContext(context.Background(), bundleId)
+}
+
+func (d *DatabaseStore) GetDataItemRowsInABundleContext(ctx context.Context, bundleId string) (itemRows []*TelemetryDataItemRow, err error) {
 	//perform a join between the items table and the bundle table to filter the items by the bundle ID.
-	rows, err := d.Conn.Query(
+	rows, err := d.Conn.QueryContext(
+		ctx,
 		`SELECT items.id,
 		        items.itemId,
 						items.itemType,
@@ -460,7 +1087,8 @@ func (d *DatabaseStore) GetDataItemRowsInABundle(bundleId string) (itemRows []*T
 			&itemRow.ItemData,
 			&itemRow.ItemChecksum,
 			&itemRow.Compression,
-			&itemRow.BundleId); err != nil {
+			&itemRow.BundleId,
+			&itemRow.ItemClass); err != nil {
 			slog.Error(
 				"Failed to scan item row",
 				slog.String("error", err.Error()),
@@ -495,8 +1123,13 @@ func (d *DatabaseStore) GetDataItemRowsInABundle(bundleId string) (itemRows []*T
 }
 
 func (d *DatabaseStore) GetBundleRowsInAReport(reportId string) (bundleRows []*TelemetryBundleRow, err error) {
+	return d.GetBundleRowsInAReportContext(context.Background(), reportId)
+}
+
+func (d *DatabaseStore) GetBundleRowsInAReportContext(ctx context.Context, reportId string) (bundleRows []*TelemetryBundleRow, err error) {
 	//perform a join between the bundles table and the report table to filter the bundles by the report ID.
-	rows, err := d.Conn.Query(
+	rows, err := d.Conn.QueryContext(
+		ctx,
 		`SELECT bundles.id,
 		        bundles.bundleId,
 						bundles.bundleTimestamp,
@@ -551,10 +1184,221 @@ func (d *DatabaseStore) GetBundleRowsInAReport(reportId string) (bundleRows []*T
 	return bundleRows, err
 }
 
+//
+// Row insertion and deletion, via the row specific methods
+//
+
+func (d *DatabaseStore) InsertItemContext(ctx context.Context, itemRow *TelemetryDataItemRow) error {
+	return itemRow.InsertContext(ctx, d.Conn)
+}
+
+func (d *DatabaseStore) DeleteItemContext(ctx context.Context, itemRow *TelemetryDataItemRow) error {
+	return itemRow.DeleteContext(ctx, d.Conn)
+}
+
+func (d *DatabaseStore) BundleExistsContext(ctx context.Context, bundleRow *TelemetryBundleRow) bool {
+	return bundleRow.Exists(d.Conn)
+}
+
+func (d *DatabaseStore) InsertBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow, itemIDs []int64) (err error) {
+	_, err = bundleRow.InsertContext(ctx, d.Conn, itemIDs)
+	return
+}
+
+// InsertBundleWithItemsContext atomically inserts the items and a bundle
+// containing them.
+func (d *DatabaseStore) InsertBundleWithItemsContext(ctx context.Context, bundleRow *TelemetryBundleRow, itemRows []*TelemetryDataItemRow) error {
+	bundleRow.ReportId = sql.NullInt64{Int64: 0, Valid: false}
+
+	return withTx(ctx, d.Conn, func(tx *sql.Tx) (err error) {
+		itemIDs := make([]int64, 0, len(itemRows))
+		for _, itemRow := range itemRows {
+			if err = itemRow.insert(ctx, tx); err != nil {
+				return
+			}
+			itemIDs = append(itemIDs, itemRow.Id)
+		}
+
+		return bundleRow.insert(ctx, tx, itemIDs, sql.NullInt64{})
+	})
+}
+
+// SplitBundleContext atomically replaces the bundle with the new bundles,
+// moving the items in each of the groups from the bundle to the
+// corresponding new bundle.
+func (d *DatabaseStore) SplitBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow, newRows []*TelemetryBundleRow, itemGroups [][]int64) error {
+	return withTx(ctx, d.Conn, func(tx *sql.Tx) (err error) {
+		fromBundleId := sql.NullInt64{Int64: bundleRow.Id, Valid: true}
+		for i, newRow := range newRows {
+			if err = newRow.insert(ctx, tx, itemGroups[i], fromBundleId); err != nil {
+				return
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM bundles WHERE id = ?", bundleRow.Id)
+		return
+	})
+}
+
+func (d *DatabaseStore) DeleteBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow) error {
+	// foreign key constraint will trigger cascaded delete of
+	// associated items
+	return bundleRow.DeleteContext(ctx, d.Conn)
+}
+
+func (d *DatabaseStore) InsertReportContext(ctx context.Context, reportRow *TelemetryReportRow, bundleIDs []int64) (err error) {
+	_, err = reportRow.InsertContext(ctx, d.Conn, bundleIDs)
+	return
+}
+
+// SplitReportContext atomically replaces the report with the new reports,
+// moving the bundles in each of the groups from the report to the
+// corresponding new report.
+func (d *DatabaseStore) SplitReportContext(ctx context.Context, reportRow *TelemetryReportRow, newRows []*TelemetryReportRow, bundleGroups [][]int64) error {
+	return withTx(ctx, d.Conn, func(tx *sql.Tx) (err error) {
+		fromReportId := sql.NullInt64{Int64: reportRow.Id, Valid: true}
+		for i, newRow := range newRows {
+			if err = newRow.insert(ctx, tx, bundleGroups[i], fromReportId); err != nil {
+				return
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM reports WHERE id = ?", reportRow.Id)
+		return
+	})
+}
+
+func (d *DatabaseStore) DeleteReportContext(ctx context.Context, reportRow *TelemetryReportRow) error {
+	// foreign key constraints will trigger cascaded delete of
+	// associated bundles, and their associated items
+	return reportRow.DeleteContext(ctx, d.Conn)
+}
+
+func (d *DatabaseStore) UpsertReportStateContext(ctx context.Context, stateRow *TelemetryReportStateRow) error {
+	return stateRow.UpsertContext(ctx, d.Conn)
+}
+
+func (d *DatabaseStore) DeleteReportStateContext(ctx context.Context, stateRow *TelemetryReportStateRow) error {
+	return stateRow.DeleteContext(ctx, d.Conn)
+}
+
+func (d *DatabaseStore) InsertSubmissionContext(ctx context.Context, submissionRow *TelemetrySubmissionRow) error {
+	return submissionRow.InsertContext(ctx, d.Conn)
+}
+
+// EvictItemsContext atomically deletes the items, along with any bundles
+// that no longer contain any items, and any reports that no longer contain
+// any bundles, as a result, recording the evictions.
+func (d *DatabaseStore) EvictItemsContext(ctx context.Context, itemIDs []int64, evictionRows []*TelemetryEvictionRow) error {
+	return withTx(ctx, d.Conn, func(tx *sql.Tx) (err error) {
+		var bundleIDs []int64
+		for _, itemID := range itemIDs {
+			var bundleId sql.NullInt64
+			err = tx.QueryRowContext(ctx, "SELECT bundleId FROM items WHERE id = ?", itemID).Scan(&bundleId)
+			if errors.Is(err, sql.ErrNoRows) {
+				// already deleted, e.g. by another process
+				continue
+			}
+			if err != nil {
+				return
+			}
+
+			if _, err = tx.ExecContext(ctx, "DELETE FROM items WHERE id = ?", itemID); err != nil {
+				return
+			}
+			if bundleId.Valid && !slices.Contains(bundleIDs, bundleId.Int64) {
+				bundleIDs = append(bundleIDs, bundleId.Int64)
+			}
+		}
+
+		var reportIDs []int64
+		for _, bundleID := range bundleIDs {
+			var count int
+			err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM items WHERE bundleId = ?", bundleID).Scan(&count)
+			if err != nil {
+				return
+			}
+			if count > 0 {
+				continue
+			}
+
+			var reportId sql.NullInt64
+			err = tx.QueryRowContext(ctx, "SELECT reportId FROM bundles WHERE id = ?", bundleID).Scan(&reportId)
+			if err != nil {
+				return
+			}
+			if _, err = tx.ExecContext(ctx, "DELETE FROM bundles WHERE id = ?", bundleID); err != nil {
+				return
+			}
+			if reportId.Valid && !slices.Contains(reportIDs, reportId.Int64) {
+				reportIDs = append(reportIDs, reportId.Int64)
+			}
+		}
+
+		for _, reportID := range reportIDs {
+			var count int
+			err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM bundles WHERE reportId = ?", reportID).Scan(&count)
+			if err != nil {
+				return
+			}
+			if count > 0 {
+				continue
+			}
+
+			// foreign key constraint will trigger cascaded delete of
+			// the associated report state
+			if _, err = tx.ExecContext(ctx, "DELETE FROM reports WHERE id = ?", reportID); err != nil {
+				return
+			}
+		}
+
+		for _, evictionRow := range evictionRows {
+			if err = evictionRow.insert(ctx, tx); err != nil {
+				return
+			}
+		}
+
+		return
+	})
+}
+
+func (d *DatabaseStore) InsertEvictionContext(ctx context.Context, evictionRow *TelemetryEvictionRow) error {
+	return evictionRow.InsertContext(ctx, d.Conn)
+}
+
+func (d *DatabaseStore) DeleteEvictionContext(ctx context.Context, evictionRow *TelemetryEvictionRow) error {
+	return evictionRow.DeleteContext(ctx, d.Conn)
+}
+
+func (d *DatabaseStore) ManagedClientExistsContext(ctx context.Context, managedRow *TelemetryManagedClientRow) bool {
+	return managedRow.ExistsContext(ctx, d.Conn)
+}
+
+func (d *DatabaseStore) InsertManagedClientContext(ctx context.Context, managedRow *TelemetryManagedClientRow) error {
+	return managedRow.InsertContext(ctx, d.Conn)
+}
+
+// InsertManagedItemContext atomically inserts the item, recording that it
+// was staged on behalf of the managed client, so that it is never seen as
+// an unmanaged item.
+func (d *DatabaseStore) InsertManagedItemContext(ctx context.Context, managedRow *TelemetryManagedClientRow, itemRow *TelemetryDataItemRow) error {
+	return withTx(ctx, d.Conn, func(tx *sql.Tx) (err error) {
+		if err = itemRow.insert(ctx, tx); err != nil {
+			return
+		}
+
+		return managedRow.addItem(ctx, tx, itemRow)
+	})
+}
+
+func (d *DatabaseStore) cleanup() error {
+	return d.dropTables()
+}
+
 // only for testing
 func (d *DatabaseStore) dropTables() (err error) {
 
-	for name := range dbTables {
+	for _, name := range dbTables {
 		dropCmd := fmt.Sprintf("DROP TABLE IF EXISTS %s", name)
 
 		_, err = d.Conn.Exec(dropCmd)
@@ -570,3 +1414,6 @@ func (d *DatabaseStore) dropTables() (err error) {
 
 	return
 }
+
+// validate that DatabaseStore implements the DataStore interface
+var _ DataStore = (*DatabaseStore)(nil)
@@ -0,0 +1,10 @@
+//go:build cgo
+
+package telemetrylib
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// the sqlite3 driver requires cgo
+const sqlite3Available = true
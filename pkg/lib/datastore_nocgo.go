@@ -0,0 +1,7 @@
+//go:build !cgo
+
+package telemetrylib
+
+// the sqlite3 driver requires cgo, so isn't available in static builds,
+// which should use the spool driver instead
+const sqlite3Available = false
@@ -0,0 +1,82 @@
+package telemetrylib
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/SUSE/telemetry/pkg/types"
+)
+
+// reasons for evicting staged data items
+const (
+	EVICTION_REASON_MAX_AGE            = `max_age`
+	EVICTION_REASON_MAX_ITEMS_PER_TYPE = `max_items_per_type`
+	EVICTION_REASON_MAX_CONTENT_SIZE   = `max_content_size`
+	EVICTION_REASON_CLASS_WITHDRAWN    = `class_withdrawn`
+	EVICTION_REASON_TYPE_WITHDRAWN     = `type_withdrawn`
+)
+
+// TelemetryEvictionRow records the staged data items of a given telemetry
+// type and class that were evicted for the same reason when the staging
+// limits were enforced, or consent for them was withdrawn, along with the
+// number and total stored size of the evicted items, and the range of their
+// timestamps, so that the evictions can be reported.
+type TelemetryEvictionRow struct {
+	Id              int64
+	Reason          string
+	ItemType        string
+	ItemClass       types.TelemetryClass
+	ItemCount       int
+	ItemBytes       int64
+	OldestTimestamp string
+	NewestTimestamp string
+	EvictedAt       string
+}
+
+func (e *TelemetryEvictionRow) Insert(db *sql.DB) (err error) {
+	return e.InsertContext(context.Background(), db)
+}
+
+func (e *TelemetryEvictionRow) InsertContext(ctx context.Context, db *sql.DB) (err error) {
+	return e.insert(ctx, db)
+}
+
+func (e *TelemetryEvictionRow) insert(ctx context.Context, db sqlExecer) (err error) {
+	res, err := db.ExecContext(
+		ctx,
+		`INSERT INTO evictions(reason, itemType, itemClass, itemCount, itemBytes, oldestTimestamp, newestTimestamp, evictedAt) VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Reason, e.ItemType, e.ItemClass, e.ItemCount, e.ItemBytes, e.OldestTimestamp, e.NewestTimestamp, e.EvictedAt,
+	)
+	if err != nil {
+		slog.Error(
+			"failed to add eviction entry",
+			slog.String("reason", e.Reason),
+			slog.String("itemType", e.ItemType),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	e.Id, err = res.LastInsertId()
+	if err != nil {
+		slog.Error(
+			"failed to retrieve id for inserted eviction",
+			slog.String("reason", e.Reason),
+			slog.String("itemType", e.ItemType),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+func (e *TelemetryEvictionRow) Delete(db *sql.DB) (err error) {
+	return e.DeleteContext(context.Background(), db)
+}
+
+func (e *TelemetryEvictionRow) DeleteContext(ctx context.Context, db *sql.DB) (err error) {
+	_, err = db.ExecContext(ctx, "DELETE FROM evictions WHERE id = ?", e.Id)
+	return
+}
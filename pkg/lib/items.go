@@ -1,6 +1,7 @@
 package telemetrylib
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -48,12 +49,20 @@ func (tdi *TelemetryDataItem) VerifyChecksum() (err error) {
 	return
 }
 
+// NewTelemetryDataItem creates a mandatory telemetry data item.
 func NewTelemetryDataItem(telemetry types.TelemetryType, tags types.Tags, content *types.TelemetryBlob) (*TelemetryDataItem, error) {
+	return NewTelemetryDataItemWithClass(telemetry, types.MANDATORY_TELEMETRY, tags, content)
+}
+
+// NewTelemetryDataItemWithClass creates a telemetry data item, recording
+// the telemetry class it was collected under.
+func NewTelemetryDataItemWithClass(telemetry types.TelemetryType, class types.TelemetryClass, tags types.Tags, content *types.TelemetryBlob) (*TelemetryDataItem, error) {
 	tdi := new(TelemetryDataItem)
 
 	// fill in header fields
 	tdi.Header.TelemetryId = uuid.New().String()
 	tdi.Header.TelemetryType = string(telemetry)
+	tdi.Header.TelemetryClass = headerClass(class)
 	tdi.Header.TelemetryTimeStamp = types.Now().String()
 	for _, a := range tags {
 		tdi.Header.TelemetryAnnotations = append(tdi.Header.TelemetryAnnotations, string(a))
@@ -75,30 +84,40 @@ type TelemetryDataItemHeader struct {
 	TelemetryTimeStamp   string   `json:"telemetryTimeStamp"  validate:"required"`
 	TelemetryType        string   `json:"telemetryType"  validate:"required,min=5"`
 	TelemetryAnnotations []string `json:"telemetryAnnotations,omitempty"`
+	// the consent basis under which the item was collected; mandatory
+	// items, including those from older clients, don't specify it
+	TelemetryClass string `json:"telemetryClass,omitempty"  validate:"omitempty,oneof=MANDATORY OPT-OUT OPT-IN"`
+}
+
+// headerClass returns the telemetry class to specify in a data item
+// header. Mandatory telemetry is left unspecified, as older clients did,
+// so that servers that predate telemetry classes calculate the same
+// bundle and report checksums for reports containing only mandatory
+// telemetry.
+func headerClass(class types.TelemetryClass) string {
+	if class == types.MANDATORY_TELEMETRY {
+		return ""
+	}
+
+	return class.String()
+}
+
+// Class returns the telemetry class of the data item, defaulting to
+// mandatory if none was specified
+func (h *TelemetryDataItemHeader) Class() (class types.TelemetryClass, err error) {
+	if h.TelemetryClass == "" {
+		return types.MANDATORY_TELEMETRY, nil
+	}
+
+	return types.TelemetryClassFromString(h.TelemetryClass)
 }
 
 type TelemetryDataItemFooter struct {
 	Checksum string `json:"checksum"  validate:"required"`
 }
 
-//Database Mapping
-
-const itemsColumns = `(
-	id INTEGER NOT NULL PRIMARY KEY,
-	itemId VARCHAR(64) NOT NULL,
-	itemType VARCHAR(64) NOT NULL,
-	itemTimestamp VARCHAR(32) NOT NULL,
-	itemAnnotations TEXT NULL,
-	itemData BLOB NOT NULL,
-	itemChecksum VARCHAR(256),
-	compression VARCHAR NULL,
-	bundleId INTEGER NULL,
-	CONSTRAINT items_bundleId
-	  FOREIGN KEY (bundleId)
-		REFERENCES bundles(id)
-	  ON DELETE CASCADE
-)`
-
+// TelemetryDataItemRow is a staged data item, with the telemetry class of
+// items staged before the class was recorded defaulting to mandatory.
 type TelemetryDataItemRow struct {
 	Id              int64
 	ItemId          string
@@ -109,11 +128,58 @@ type TelemetryDataItemRow struct {
 	ItemChecksum    string
 	Compression     sql.NullString
 	BundleId        sql.NullInt64
+	ItemClass       types.TelemetryClass
+}
+
+// TelemetryStagedItemRow summarises a staged data item, without its
+// content, with the size being that of the content as stored, and the
+// content size being that of the content when JSON encoded in a report,
+// which is unknown for items staged before it was recorded.
+type TelemetryStagedItemRow struct {
+	Id              int64
+	ItemId          string
+	ItemType        string
+	ItemTimestamp   string
+	ItemAnnotations string
+	ItemChecksum    string
+	ItemClass       types.TelemetryClass
+	ItemSize        int64
+	ItemContentSize sql.NullInt64
+	BundleId        sql.NullInt64
 }
 
+// header returns the header of the corresponding data item
+func (t *TelemetryStagedItemRow) header() TelemetryDataItemHeader {
+	return TelemetryDataItemHeader{
+		TelemetryId:          t.ItemId,
+		TelemetryTimeStamp:   t.ItemTimestamp,
+		TelemetryType:        t.ItemType,
+		TelemetryAnnotations: strings.Split(t.ItemAnnotations, ","),
+		TelemetryClass:       headerClass(t.ItemClass),
+	}
+}
+
+// itemContentSize returns the size of the item content when JSON encoded
+// in a report, which compacts it and escapes any HTML characters
+func itemContentSize(content []byte) (size int64, err error) {
+	contentJSON, err := json.Marshal(json.RawMessage(content))
+	if err != nil {
+		return 0, fmt.Errorf("failed to JSON marshal item content: %w", err)
+	}
+
+	return int64(len(contentJSON)), nil
+}
+
+// NewTelemetryDataItemRow creates a mandatory telemetry data item row.
 func NewTelemetryDataItemRow(telemetry types.TelemetryType, tags types.Tags, content *types.TelemetryBlob) (itemRow *TelemetryDataItemRow, err error) {
+	return NewTelemetryDataItemRowWithClass(telemetry, types.MANDATORY_TELEMETRY, tags, content)
+}
+
+// NewTelemetryDataItemRowWithClass creates a telemetry data item row,
+// recording the telemetry class it was collected under.
+func NewTelemetryDataItemRowWithClass(telemetry types.TelemetryType, class types.TelemetryClass, tags types.Tags, content *types.TelemetryBlob) (itemRow *TelemetryDataItemRow, err error) {
 
-	item, err := NewTelemetryDataItem(telemetry, tags, content)
+	item, err := NewTelemetryDataItemWithClass(telemetry, class, tags, content)
 	if err != nil {
 		return
 	}
@@ -125,6 +191,7 @@ func NewTelemetryDataItemRow(telemetry types.TelemetryType, tags types.Tags, con
 	itemRow.ItemAnnotations = strings.Join(item.Header.TelemetryAnnotations, ",")
 	itemRow.ItemData = content.Bytes()
 	itemRow.ItemChecksum = item.Footer.Checksum
+	itemRow.ItemClass = class
 
 	return
 }
@@ -146,13 +213,26 @@ func (t *TelemetryDataItemRow) Exists(db *sql.DB) bool {
 }
 
 func (t *TelemetryDataItemRow) Insert(db *sql.DB) (err error) {
+	return t.InsertContext(context.Background(), db)
+}
+
+func (t *TelemetryDataItemRow) InsertContext(ctx context.Context, db *sql.DB) (err error) {
+	return t.insert(ctx, db)
+}
+
+func (t *TelemetryDataItemRow) insert(ctx context.Context, db sqlExecer) (err error) {
+	contentSize, err := itemContentSize(t.ItemData)
+	if err != nil {
+		return
+	}
 	itemData, compression, err := utils.CompressWhenNeeded(t.ItemData)
 	if err != nil {
 		return
 	}
-	res, err := db.Exec(
-		`INSERT INTO items(ItemId, ItemType, ItemTimestamp, ItemAnnotations, ItemData, ItemChecksum, Compression) VALUES(?, ?, ?, ?, ?, ?, ?)`,
-		t.ItemId, t.ItemType, t.ItemTimestamp, t.ItemAnnotations, itemData, t.ItemChecksum, compression,
+	res, err := db.ExecContext(
+		ctx,
+		`INSERT INTO items(ItemId, ItemType, ItemTimestamp, ItemAnnotations, ItemData, ItemChecksum, Compression, ItemClass, ItemContentSize) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ItemId, t.ItemType, t.ItemTimestamp, t.ItemAnnotations, itemData, t.ItemChecksum, compression, t.ItemClass, contentSize,
 	)
 	if err != nil {
 		slog.Error(
@@ -178,6 +258,10 @@ func (t *TelemetryDataItemRow) Insert(db *sql.DB) (err error) {
 }
 
 func (t *TelemetryDataItemRow) Delete(db *sql.DB) (err error) {
-	_, err = db.Exec("DELETE FROM items WHERE id = ?", t.Id)
+	return t.DeleteContext(context.Background(), db)
+}
+
+func (t *TelemetryDataItemRow) DeleteContext(ctx context.Context, db *sql.DB) (err error) {
+	_, err = db.ExecContext(ctx, "DELETE FROM items WHERE id = ?", t.Id)
 	return
 }
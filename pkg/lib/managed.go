@@ -0,0 +1,129 @@
+package telemetrylib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/google/uuid"
+)
+
+// tag used to annotate bundles with the path via which they were relayed
+const RELAYED_VIA_TAG = `RELAYED_VIA`
+
+// TelemetryManagedClientRow is a client system, such as one managed by
+// SUSE Manager, that doesn't report telemetry itself, and on whose behalf
+// telemetry is synthesized by a management framework. Each managed client
+// is identified by a framework specific system id, and is persistently
+// assigned a unique telemetry client id.
+type TelemetryManagedClientRow struct {
+	Id           int64
+	SystemId     string
+	ClientId     string
+	RegisteredAt string
+}
+
+func NewTelemetryManagedClientRow(systemId string) *TelemetryManagedClientRow {
+	return &TelemetryManagedClientRow{
+		SystemId:     systemId,
+		ClientId:     uuid.New().String(),
+		RegisteredAt: types.Now().String(),
+	}
+}
+
+// RelayedViaTag returns the tag used to annotate bundles synthesized on
+// behalf of the managed client by the specified management framework.
+func (m *TelemetryManagedClientRow) RelayedViaTag(frameworkClientId string) types.Tag {
+	return types.Tag(fmt.Sprintf("%s=%s:%s", RELAYED_VIA_TAG, m.ClientId, frameworkClientId))
+}
+
+func (m *TelemetryManagedClientRow) Exists(db *sql.DB) bool {
+	return m.ExistsContext(context.Background(), db)
+}
+
+func (m *TelemetryManagedClientRow) ExistsContext(ctx context.Context, db *sql.DB) bool {
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT id, clientId, registeredAt FROM managedClients WHERE systemId = ?`,
+		m.SystemId,
+	)
+	if err := row.Scan(&m.Id, &m.ClientId, &m.RegisteredAt); err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error(
+				"failed when checking for existence of managed client",
+				slog.String("systemId", m.SystemId),
+				slog.String("err", err.Error()),
+			)
+		}
+		return false
+	}
+	return true
+}
+
+func (m *TelemetryManagedClientRow) Insert(db *sql.DB) (err error) {
+	return m.InsertContext(context.Background(), db)
+}
+
+func (m *TelemetryManagedClientRow) InsertContext(ctx context.Context, db *sql.DB) (err error) {
+	res, err := db.ExecContext(
+		ctx,
+		`INSERT INTO managedClients(systemId, clientId, registeredAt) VALUES(?, ?, ?)`,
+		m.SystemId, m.ClientId, m.RegisteredAt,
+	)
+	if err != nil {
+		slog.Error(
+			"failed to add managed client entry",
+			slog.String("systemId", m.SystemId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	m.Id, err = res.LastInsertId()
+	if err != nil {
+		slog.Error(
+			"failed to retrieve id for inserted managed client",
+			slog.String("systemId", m.SystemId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+func (m *TelemetryManagedClientRow) Delete(db *sql.DB) (err error) {
+	return m.DeleteContext(context.Background(), db)
+}
+
+func (m *TelemetryManagedClientRow) DeleteContext(ctx context.Context, db *sql.DB) (err error) {
+	_, err = db.ExecContext(ctx, "DELETE FROM managedClients WHERE id = ?", m.Id)
+	return
+}
+
+// AddItemContext records that the data item was staged on behalf of the
+// managed client.
+func (m *TelemetryManagedClientRow) AddItemContext(ctx context.Context, db *sql.DB, itemRow *TelemetryDataItemRow) (err error) {
+	return m.addItem(ctx, db, itemRow)
+}
+
+func (m *TelemetryManagedClientRow) addItem(ctx context.Context, db sqlExecer, itemRow *TelemetryDataItemRow) (err error) {
+	_, err = db.ExecContext(
+		ctx,
+		`INSERT INTO managedItems(itemId, managedClientId) VALUES(?, ?)`,
+		itemRow.Id, m.Id,
+	)
+	if err != nil {
+		slog.Error(
+			"failed to add managed item entry",
+			slog.String("systemId", m.SystemId),
+			slog.String("itemId", itemRow.ItemId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	return
+}
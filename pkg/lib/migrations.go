@@ -0,0 +1,322 @@
+package telemetrylib
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/SUSE/telemetry/pkg/types"
+)
+
+// returned when the datastore schema is newer than this build supports,
+// e.g. after a downgrade
+var ErrDataStoreSchemaTooNew = errors.New("datastore schema version is newer than supported")
+
+// schemaVersionColumns records the schema migrations that have been
+// applied to the datastore
+const schemaVersionColumns = `(
+	version INTEGER NOT NULL PRIMARY KEY,
+	description TEXT NOT NULL,
+	appliedAt VARCHAR(32) NOT NULL
+)`
+
+// schemaMigration is an ordered change to the datastore schema
+type schemaMigration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+func createTable(name, columns string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s %s", name, columns)
+}
+
+// schemaMigrations are the changes made to the datastore schema, in the
+// order that they must be applied. Migrations that have been released
+// must never be changed; any change to a table's columns must instead be
+// made by appending a new migration. For that reason each migration's
+// statements are written out in full, rather than being derived from
+// definitions shared with the rest of the code, which could change.
+//
+// The tables are created using IF NOT EXISTS so that datastores created
+// before schema versioning was introduced, which may contain some or all
+// of the tables, are adopted.
+var schemaMigrations = []schemaMigration{
+	{
+		version:     1,
+		description: "items, bundles and reports",
+		statements: []string{
+			createTable("reports", `(
+				id INTEGER NOT NULL PRIMARY KEY,
+				reportId VARCHAR(64) NOT NULL,
+				reportTimestamp VARCHAR(32) NOT NULL,
+				reportClientId VARCHAR NOT NULL,
+				reportAnnotations TEXT,
+				reportChecksum VARCHAR(256)
+			)`),
+			createTable("bundles", `(
+				id INTEGER NOT NULL PRIMARY KEY,
+				bundleId VARCHAR(64) NOT NULL,
+				bundleTimestamp VARCHAR(32) NOT NULL,
+				bundleClientId VARCHAR NOT NULL,
+				bundleCustomerId VARCHAR(64) NOT NULL,
+				bundleAnnotations TEXT,
+				bundleChecksum VARCHAR(256),
+				reportId  INTEGER NULL,
+				CONSTRAINT bundles_reportId
+				  FOREIGN KEY (reportId)
+					REFERENCES reports(id)
+				  ON DELETE CASCADE
+			)`),
+			createTable("items", `(
+				id INTEGER NOT NULL PRIMARY KEY,
+				itemId VARCHAR(64) NOT NULL,
+				itemType VARCHAR(64) NOT NULL,
+				itemTimestamp VARCHAR(32) NOT NULL,
+				itemAnnotations TEXT NULL,
+				itemData BLOB NOT NULL,
+				itemChecksum VARCHAR(256),
+				compression VARCHAR NULL,
+				bundleId INTEGER NULL,
+				CONSTRAINT items_bundleId
+				  FOREIGN KEY (bundleId)
+					REFERENCES bundles(id)
+				  ON DELETE CASCADE
+			)`),
+		},
+	},
+	{
+		version:     2,
+		description: "report submission history",
+		statements: []string{
+			createTable("submissions", `(
+				id INTEGER NOT NULL PRIMARY KEY,
+				reportId VARCHAR(64) NOT NULL,
+				bundleIds TEXT,
+				itemIds TEXT,
+				itemTypes TEXT,
+				size INTEGER NOT NULL,
+				serverUrl VARCHAR NOT NULL,
+				processingId INTEGER NOT NULL,
+				processedAt VARCHAR(32) NOT NULL,
+				attempts INTEGER NOT NULL,
+				submittedAt VARCHAR(32) NOT NULL
+			)`),
+		},
+	},
+	{
+		version:     3,
+		description: "report submission failure tracking",
+		statements: []string{
+			createTable("reportStates", `(
+				id INTEGER NOT NULL PRIMARY KEY,
+				reportId INTEGER NOT NULL UNIQUE,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				quarantined INTEGER NOT NULL DEFAULT 0,
+				reason TEXT,
+				updatedAt VARCHAR(32) NOT NULL,
+				CONSTRAINT reportStates_reportId
+				  FOREIGN KEY (reportId)
+					REFERENCES reports(id)
+				  ON DELETE CASCADE
+			)`),
+		},
+	},
+	{
+		version:     4,
+		description: "managed clients",
+		statements: []string{
+			createTable("managedClients", `(
+				id INTEGER NOT NULL PRIMARY KEY,
+				systemId VARCHAR(256) NOT NULL UNIQUE,
+				clientId VARCHAR(64) NOT NULL UNIQUE,
+				registeredAt VARCHAR(32) NOT NULL
+			)`),
+			createTable("managedItems", `(
+				itemId INTEGER NOT NULL PRIMARY KEY,
+				managedClientId INTEGER NOT NULL,
+				CONSTRAINT managedItems_itemId
+				  FOREIGN KEY (itemId)
+					REFERENCES items(id)
+				  ON DELETE CASCADE,
+				CONSTRAINT managedItems_managedClientId
+				  FOREIGN KEY (managedClientId)
+					REFERENCES managedClients(id)
+				  ON DELETE CASCADE
+			)`),
+		},
+	},
+	{
+		version:     5,
+		description: "staging limits",
+		statements: []string{
+			createTable("evictions", `(
+				id INTEGER NOT NULL PRIMARY KEY,
+				reason VARCHAR(32) NOT NULL,
+				itemType VARCHAR(64) NOT NULL,
+				itemClass INTEGER NOT NULL,
+				itemCount INTEGER NOT NULL,
+				itemBytes INTEGER NOT NULL,
+				oldestTimestamp VARCHAR(32) NOT NULL,
+				newestTimestamp VARCHAR(32) NOT NULL,
+				evictedAt VARCHAR(32) NOT NULL
+			)`),
+		},
+	},
+	{
+		version:     6,
+		description: "telemetry class",
+		statements: []string{
+			`ALTER TABLE items ADD COLUMN itemClass INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		version:     7,
+		description: "item content sizes",
+		statements: []string{
+			`ALTER TABLE items ADD COLUMN itemContentSize INTEGER`,
+		},
+	},
+}
+
+// list of predefined tables, in the order that they can be dropped
+var dbTables = []string{
+	"evictions",
+	"managedItems",
+	"managedClients",
+	"submissions",
+	"reportStates",
+	"items",
+	"bundles",
+	"reports",
+	"schemaVersion",
+}
+
+// LatestSchemaVersion returns the schema version that datastores are
+// migrated to.
+func LatestSchemaVersion() int {
+	return schemaMigrations[len(schemaMigrations)-1].version
+}
+
+type sqlQueryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func querySchemaVersion(ctx context.Context, db sqlQueryRower) (version int, err error) {
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schemaVersion`).Scan(&version)
+	return
+}
+
+func (d *DatabaseStore) SchemaVersion() (version int, err error) {
+	return d.SchemaVersionContext(context.Background())
+}
+
+// SchemaVersionContext returns the version of the datastore schema, which
+// is 0 if no migrations have been applied.
+func (d *DatabaseStore) SchemaVersionContext(ctx context.Context) (version int, err error) {
+	version, err = querySchemaVersion(ctx, d.Conn)
+	if err != nil {
+		slog.Error(
+			"failed to retrieve schema version",
+			slog.String("err", err.Error()),
+		)
+	}
+
+	return
+}
+
+func (d *DatabaseStore) Migrate() error {
+	return d.MigrateContext(context.Background())
+}
+
+// MigrateContext applies any pending schema migrations, in order, each in
+// its own transaction, failing if the datastore schema is newer than is
+// supported.
+func (d *DatabaseStore) MigrateContext(ctx context.Context) (err error) {
+	if _, err = d.Conn.ExecContext(ctx, createTable("schemaVersion", schemaVersionColumns)); err != nil {
+		slog.Error(
+			"failed to create table",
+			slog.String("table", "schemaVersion"),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	version, err := d.SchemaVersionContext(ctx)
+	if err != nil {
+		return
+	}
+
+	if version > LatestSchemaVersion() {
+		err = fmt.Errorf("%w: %d > %d", ErrDataStoreSchemaTooNew, version, LatestSchemaVersion())
+		slog.Error(
+			"unsupported schema version",
+			slog.Int("version", version),
+			slog.Int("latest", LatestSchemaVersion()),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	for i := range schemaMigrations {
+		if schemaMigrations[i].version <= version {
+			continue
+		}
+
+		if err = d.applyMigration(ctx, &schemaMigrations[i]); err != nil {
+			slog.Error(
+				"failed to apply schema migration",
+				slog.Int("version", schemaMigrations[i].version),
+				slog.String("description", schemaMigrations[i].description),
+				slog.String("err", err.Error()),
+			)
+			return
+		}
+	}
+
+	return
+}
+
+// applyMigration applies the migration, and records it as applied, in a
+// single transaction, unless another process has already applied it.
+func (d *DatabaseStore) applyMigration(ctx context.Context, m *schemaMigration) (err error) {
+	tx, err := d.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	version, err := querySchemaVersion(ctx, tx)
+	if err != nil || version >= m.version {
+		return
+	}
+
+	for _, statement := range m.statements {
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			return
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO schemaVersion(version, description, appliedAt) VALUES(?, ?, ?)`,
+		m.version, m.description, types.Now().String(),
+	)
+	if err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+
+	slog.Debug(
+		"applied schema migration",
+		slog.Int("version", m.version),
+		slog.String("description", m.description),
+	)
+
+	return
+}
@@ -0,0 +1,220 @@
+package telemetrylib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/stretchr/testify/suite"
+)
+
+type MigrationsTestSuite struct {
+	suite.Suite
+}
+
+func (t *MigrationsTestSuite) SetupSuite() {
+	if !sqlite3Available {
+		t.T().Skip("sqlite3 datastore requires cgo")
+	}
+}
+
+// newFixtureDB creates a database file populated by the named fixture in
+// testdata/schema, returning its path
+func (t *MigrationsTestSuite) newFixtureDB(fixture string) string {
+	dbPath := filepath.Join(t.T().TempDir(), "telemetry.db")
+
+	script, err := os.ReadFile(filepath.Join("testdata", "schema", fixture+".sql"))
+	t.Require().NoError(err)
+
+	db, err := sql.Open(DATASTORE_DRIVER_SQLITE3, dbPath)
+	t.Require().NoError(err)
+	defer db.Close()
+
+	_, err = db.Exec(string(script))
+	t.Require().NoError(err)
+
+	return dbPath
+}
+
+func (t *MigrationsTestSuite) openStore(dbPath string) (*DatabaseStore, error) {
+	return NewDatabaseStore(config.DBConfig{Driver: DATASTORE_DRIVER_SQLITE3, Params: dbPath})
+}
+
+func (t *MigrationsTestSuite) TestMigrateNewDatastore() {
+	ds, err := t.openStore(filepath.Join(t.T().TempDir(), "telemetry.db"))
+	t.Require().NoError(err)
+	defer ds.Conn.Close()
+
+	version, err := ds.SchemaVersion()
+	t.Require().NoError(err)
+	t.Equal(LatestSchemaVersion(), version)
+
+	var applied int
+	t.Require().NoError(ds.Conn.QueryRow(`SELECT COUNT(version) FROM schemaVersion`).Scan(&applied))
+	t.Equal(len(schemaMigrations), applied)
+}
+
+func (t *MigrationsTestSuite) TestMigrateOlderSchemas() {
+	tests := []struct {
+		fixture     string
+		submissions int
+	}{
+		{"unversioned", 0},
+		{"v2", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run("migrating "+tt.fixture+" datastore", func() {
+			dbPath := t.newFixtureDB(tt.fixture)
+
+			ds, err := t.openStore(dbPath)
+			t.Require().NoError(err)
+
+			version, err := ds.SchemaVersion()
+			t.Require().NoError(err)
+			t.Equal(LatestSchemaVersion(), version)
+
+			// existing content is preserved
+			ctx := context.Background()
+			count, err := ds.GetItemCountContext(ctx)
+			t.Require().NoError(err)
+			t.Equal(2, count)
+			count, err = ds.GetItemCountContext(ctx, "NULL")
+			t.Require().NoError(err)
+			t.Equal(1, count)
+			count, err = ds.GetBundleCountContext(ctx)
+			t.Require().NoError(err)
+			t.Equal(1, count)
+			count, err = ds.GetSubmissionCountContext(ctx)
+			t.Require().NoError(err)
+			t.Equal(tt.submissions, count)
+
+			_, itemRows, err := ds.GetItemsContext(ctx, "NULL")
+			t.Require().NoError(err)
+			t.Require().Len(itemRows, 1)
+			t.Equal(`{"version":1,"ItemB":2}`, string(itemRows[0].ItemData))
+			t.Equal(types.MANDATORY_TELEMETRY, itemRows[0].ItemClass, "existing items should default to mandatory")
+			stagedRows, err := ds.GetStagedItemsContext(ctx)
+			t.Require().NoError(err)
+			for _, stagedRow := range stagedRows {
+				t.False(stagedRow.ItemContentSize.Valid, "existing items should have an unknown content size")
+			}
+
+			// tables added by the migrations are usable
+			_, reportRows, err := ds.GetReportsContext(ctx)
+			t.Require().NoError(err)
+			t.Require().Len(reportRows, 1)
+			t.Require().NoError(ds.UpsertReportStateContext(ctx, NewTelemetryReportStateRow(reportRows[0])))
+			t.Require().NoError(ds.InsertManagedClientContext(ctx, NewTelemetryManagedClientRow("system-1")))
+
+			// re-opening a migrated datastore is a no-op
+			ds.Conn.Close()
+			ds, err = t.openStore(dbPath)
+			t.Require().NoError(err)
+			defer ds.Conn.Close()
+
+			version, err = ds.SchemaVersion()
+			t.Require().NoError(err)
+			t.Equal(LatestSchemaVersion(), version)
+
+			managedRows, err := ds.GetManagedClientsContext(ctx)
+			t.Require().NoError(err)
+			t.Len(managedRows, 1)
+		})
+	}
+}
+
+// tableColumns returns the column definitions of each of the datastore's
+// tables, as reported by sqlite3
+func (t *MigrationsTestSuite) tableColumns(ds *DatabaseStore) map[string][]string {
+	columns := map[string][]string{}
+	for _, table := range dbTables {
+		rows, err := ds.Conn.Query(`SELECT name, type, "notnull", COALESCE(dflt_value, ''), pk FROM pragma_table_info(?) ORDER BY name`, table)
+		t.Require().NoError(err)
+
+		for rows.Next() {
+			var name, colType, dfltValue string
+			var notNull, pk int
+			t.Require().NoError(rows.Scan(&name, &colType, &notNull, &dfltValue, &pk))
+			columns[table] = append(columns[table], fmt.Sprintf("%s %s notnull=%d default=%q pk=%d", name, colType, notNull, dfltValue, pk))
+		}
+		t.Require().NoError(rows.Err())
+		rows.Close()
+	}
+
+	return columns
+}
+
+func (t *MigrationsTestSuite) TestMigratedSchemaMatchesNew() {
+	newStore, err := t.openStore(filepath.Join(t.T().TempDir(), "telemetry.db"))
+	t.Require().NoError(err)
+	defer newStore.Conn.Close()
+
+	for _, fixture := range []string{"unversioned", "v2"} {
+		migratedStore, err := t.openStore(t.newFixtureDB(fixture))
+		t.Require().NoError(err)
+
+		t.Equal(t.tableColumns(newStore), t.tableColumns(migratedStore), "%s datastore schema should match a new one", fixture)
+		migratedStore.Conn.Close()
+	}
+}
+
+func (t *MigrationsTestSuite) TestSchemaTooNew() {
+	dbPath := t.newFixtureDB("v2")
+
+	db, err := sql.Open(DATASTORE_DRIVER_SQLITE3, dbPath)
+	t.Require().NoError(err)
+	_, err = db.Exec(
+		`INSERT INTO schemaVersion(version, description, appliedAt) VALUES(?, 'from the future', '2030-01-01T00:00:00Z')`,
+		LatestSchemaVersion()+1,
+	)
+	db.Close()
+	t.Require().NoError(err)
+
+	_, err = t.openStore(dbPath)
+	t.ErrorIs(err, ErrDataStoreSchemaTooNew)
+}
+
+func (t *MigrationsTestSuite) TestFailedMigrationRollsBack() {
+	dbPath := t.newFixtureDB("v2")
+
+	// append a migration that fails part way through
+	savedMigrations := schemaMigrations
+	defer func() { schemaMigrations = savedMigrations }()
+	schemaMigrations = append(
+		append([]schemaMigration{}, savedMigrations...),
+		schemaMigration{
+			version:     LatestSchemaVersion() + 1,
+			description: "broken",
+			statements: []string{
+				`CREATE TABLE brokenMigration (id INTEGER NOT NULL PRIMARY KEY)`,
+				`ALTER TABLE noSuchTable ADD COLUMN broken INTEGER`,
+			},
+		},
+	)
+
+	_, err := t.openStore(dbPath)
+	t.Require().Error(err)
+
+	// the preceding migrations were applied, but none of the failed one
+	db, err := sql.Open(DATASTORE_DRIVER_SQLITE3, dbPath)
+	t.Require().NoError(err)
+	defer db.Close()
+
+	version, err := querySchemaVersion(context.Background(), db)
+	t.Require().NoError(err)
+	t.Equal(len(savedMigrations), version)
+
+	var tables int
+	t.Require().NoError(db.QueryRow(`SELECT COUNT(name) FROM sqlite_master WHERE type = 'table' AND name = 'brokenMigration'`).Scan(&tables))
+	t.Equal(0, tables)
+}
+
+func TestMigrationsTestSuite(t *testing.T) {
+	suite.Run(t, new(MigrationsTestSuite))
+}
@@ -1,42 +1,285 @@
 package telemetrylib
 
 import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/SUSE/telemetry/pkg/config"
 	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/google/uuid"
+)
+
+var (
+	// returned when a report can't be split into smaller reports
+	ErrReportNotSplittable = errors.New("report cannot be split further")
+
+	// returned when a data item's content doesn't match its checksum
+	ErrChecksumMismatch = errors.New("item checksum mismatch")
 )
 
 type TelemetryProcessor interface {
 	TelemetryCommon
 
-	// Add telemetry data - a method to process jsonData as a byte[]
+	// Add telemetry data - a method to process jsonData as a byte[] - as
+	// mandatory telemetry; use AddDataWithClass for other classes
 	AddData(
 		telemetry types.TelemetryType,
 		content *types.TelemetryBlob,
 		tags types.Tags,
 	) (err error)
+	AddDataContext(
+		ctx context.Context,
+		telemetry types.TelemetryType,
+		content *types.TelemetryBlob,
+		tags types.Tags,
+	) (err error)
 
-	// Generate telemetry bundle
+	// Add telemetry data, recording the telemetry class it was collected
+	// under, rather than treating it as mandatory telemetry
+	AddDataWithClass(
+		telemetry types.TelemetryType,
+		class types.TelemetryClass,
+		content *types.TelemetryBlob,
+		tags types.Tags,
+	) (err error)
+	AddDataWithClassContext(
+		ctx context.Context,
+		telemetry types.TelemetryType,
+		class types.TelemetryClass,
+		content *types.TelemetryBlob,
+		tags types.Tags,
+	) (err error)
+
+	// Add a telemetry bundle, and its data items, that was received from
+	// elsewhere, such as a relayed client, extending its annotations with
+	// the specified tags; adding an already staged bundle is a no-op
+	AddBundle(
+		bundle *TelemetryBundle,
+		tags types.Tags,
+	) (bundleRow *TelemetryBundleRow, err error)
+	AddBundleContext(
+		ctx context.Context,
+		bundle *TelemetryBundle,
+		tags types.Tags,
+	) (bundleRow *TelemetryBundleRow, err error)
+
+	// Register a managed client system, identified by a management
+	// framework specific system id, on whose behalf telemetry will be
+	// synthesized, persistently assigning it a unique telemetry client id;
+	// registering an existing system returns its existing registration
+	RegisterManagedClient(systemId string) (managedRow *TelemetryManagedClientRow, err error)
+	RegisterManagedClientContext(ctx context.Context, systemId string) (managedRow *TelemetryManagedClientRow, err error)
+
+	// Get the registered managed client systems
+	GetManagedClientRows() (managedRows []*TelemetryManagedClientRow, err error)
+	GetManagedClientRowsContext(ctx context.Context) (managedRows []*TelemetryManagedClientRow, err error)
+
+	// Add telemetry data on behalf of a managed client system, as mandatory
+	// telemetry; use AddManagedDataWithClass for other classes
+	AddManagedData(
+		managedRow *TelemetryManagedClientRow,
+		telemetry types.TelemetryType,
+		content *types.TelemetryBlob,
+		tags types.Tags,
+	) (err error)
+	AddManagedDataContext(
+		ctx context.Context,
+		managedRow *TelemetryManagedClientRow,
+		telemetry types.TelemetryType,
+		content *types.TelemetryBlob,
+		tags types.Tags,
+	) (err error)
+
+	// Add telemetry data on behalf of a managed client system, recording
+	// the telemetry class it was collected under
+	AddManagedDataWithClass(
+		managedRow *TelemetryManagedClientRow,
+		telemetry types.TelemetryType,
+		class types.TelemetryClass,
+		content *types.TelemetryBlob,
+		tags types.Tags,
+	) (err error)
+	AddManagedDataWithClassContext(
+		ctx context.Context,
+		managedRow *TelemetryManagedClientRow,
+		telemetry types.TelemetryType,
+		class types.TelemetryClass,
+		content *types.TelemetryBlob,
+		tags types.Tags,
+	) (err error)
+
+	// Generate a telemetry bundle for each managed client system with
+	// staged data items, using the managed client's id as the bundle
+	// client id, and annotating it with a RELAYED_VIA tag identifying the
+	// managed client and the management framework
+	GenerateManagedBundles(
+		frameworkClientId string,
+		customerId string,
+		tags types.Tags,
+	) (bundleRows []*TelemetryBundleRow, err error)
+	GenerateManagedBundlesContext(
+		ctx context.Context,
+		frameworkClientId string,
+		customerId string,
+		tags types.Tags,
+	) (bundleRows []*TelemetryBundleRow, err error)
+
+	// Generate telemetry bundle, failing with ErrNoUnbundledItems if there
+	// are no unbundled items, e.g. because another process bundled them
 	GenerateBundle(
 		clientId string,
 		customerId string,
 		tags types.Tags,
 	) (bundleRow *TelemetryBundleRow, err error)
+	GenerateBundleContext(
+		ctx context.Context,
+		clientId string,
+		customerId string,
+		tags types.Tags,
+	) (bundleRow *TelemetryBundleRow, err error)
+
+	// Generate telemetry bundles from the unbundled items, excluding any
+	// staged on behalf of managed clients, limiting and grouping the items
+	// in each bundle according to the bundling policy, with a nil policy
+	// gathering all of the items into a single bundle; no bundles are
+	// generated if there are no unbundled items
+	GenerateBundles(
+		clientId string,
+		customerId string,
+		tags types.Tags,
+		policy *config.BundlingConfig,
+	) (bundleRows []*TelemetryBundleRow, err error)
+	GenerateBundlesContext(
+		ctx context.Context,
+		clientId string,
+		customerId string,
+		tags types.Tags,
+		policy *config.BundlingConfig,
+	) (bundleRows []*TelemetryBundleRow, err error)
 
-	// Generate telemetry report
+	// Generate telemetry report, failing with ErrNoUnreportedBundles if
+	// there are no unreported bundles, e.g. because another process
+	// reported them
 	GenerateReport(
 		clientId string,
 		tags types.Tags,
 	) (reportRow *TelemetryReportRow, err error)
+	GenerateReportContext(
+		ctx context.Context,
+		clientId string,
+		tags types.Tags,
+	) (reportRow *TelemetryReportRow, err error)
+
+	// Generate telemetry reports, splitting the available bundles across
+	// as many reports as needed to keep each report within maxSize bytes
+	// when JSON encoded, with a maxSize of 0 meaning no limit
+	GenerateReports(
+		clientId string,
+		tags types.Tags,
+		maxSize int,
+	) (reportRows []*TelemetryReportRow, err error)
+	GenerateReportsContext(
+		ctx context.Context,
+		clientId string,
+		tags types.Tags,
+		maxSize int,
+	) (reportRows []*TelemetryReportRow, err error)
+
+	// Write the JSON encoding of a staged telemetry report, as it would be
+	// submitted, directly from the datastore content, one data item at a
+	// time, so that the report need never be held in memory, returning a
+	// summary of the written report, without the data items' content, and
+	// the number of bytes written; fails with ErrChecksumMismatch if any
+	// of the report's data items are corrupted
+	WriteReport(reportRow *TelemetryReportRow, w io.Writer) (summary *TelemetryReport, size int64, err error)
+	WriteReportContext(ctx context.Context, reportRow *TelemetryReportRow, w io.Writer) (summary *TelemetryReport, size int64, err error)
+
+	// Split a telemetry report into two smaller reports
+	SplitReport(reportRow *TelemetryReportRow) (reportRows []*TelemetryReportRow, err error)
+	SplitReportContext(ctx context.Context, reportRow *TelemetryReportRow) (reportRows []*TelemetryReportRow, err error)
+
+	// Enforce the staging limits, evicting staged data items, whether or
+	// not they have been bundled or reported, as needed to bring the
+	// staging datastore within the limits, along with any bundles and
+	// reports that are left empty as a result, and recording what was
+	// evicted; opt-in data items are evicted before opt-out data items,
+	// which are evicted before mandatory data items, oldest first
+	EnforceStagingLimits(limits *config.StagingConfig) (evictionRows []*TelemetryEvictionRow, err error)
+	EnforceStagingLimitsContext(ctx context.Context, limits *config.StagingConfig) (evictionRows []*TelemetryEvictionRow, err error)
+
+	// Purge staged data items, whether or not they have been bundled or
+	// reported, that the consent settings of the specified config no
+	// longer allow to be submitted, because their telemetry class or type
+	// is no longer enabled, along with any bundles and reports that are
+	// left empty as a result, recording what was purged as evictions;
+	// bundles relayed on behalf of other telemetry clients are unaffected
+	PurgeWithdrawnConsent(cfg *config.Config) (evictionRows []*TelemetryEvictionRow, err error)
+	PurgeWithdrawnConsentContext(ctx context.Context, cfg *config.Config) (evictionRows []*TelemetryEvictionRow, err error)
+
+	// Get the recorded evictions of staged data items
+	GetEvictionRows() (evictionRows []*TelemetryEvictionRow, err error)
+	GetEvictionRowsContext(ctx context.Context) (evictionRows []*TelemetryEvictionRow, err error)
+
+	// Delete a recorded eviction, e.g. once it has been reported
+	DeleteEviction(evictionRow *TelemetryEvictionRow) (err error)
+	DeleteEvictionContext(ctx context.Context, evictionRow *TelemetryEvictionRow) (err error)
+
+	// Record the successful submission of a report
+	RecordSubmission(submissionRow *TelemetrySubmissionRow) (err error)
+	RecordSubmissionContext(ctx context.Context, submissionRow *TelemetrySubmissionRow) (err error)
+
+	// Get a count of recorded report submissions
+	SubmissionCount(reportIds ...any) (count int, err error)
+	SubmissionCountContext(ctx context.Context, reportIds ...any) (count int, err error)
+
+	// Get the recorded report submission history, optionally limited to
+	// the specified reportIds
+	GetSubmissionRows(reportIds ...any) (submissionRows []*TelemetrySubmissionRow, err error)
+	GetSubmissionRowsContext(ctx context.Context, reportIds ...any) (submissionRows []*TelemetrySubmissionRow, err error)
+
+	// Get telemetry reports that are pending submission, excluding
+	// any quarantined reports
+	GetPendingReportRows() (reportRows []*TelemetryReportRow, err error)
+	GetPendingReportRowsContext(ctx context.Context) (reportRows []*TelemetryReportRow, err error)
+
+	// Get telemetry reports that have been quarantined
+	GetQuarantinedReportRows() (reportRows []*TelemetryReportRow, err error)
+	GetQuarantinedReportRowsContext(ctx context.Context) (reportRows []*TelemetryReportRow, err error)
+
+	// Get the submission state of a telemetry report
+	GetReportState(reportRow *TelemetryReportRow) (stateRow *TelemetryReportStateRow, err error)
+	GetReportStateContext(ctx context.Context, reportRow *TelemetryReportRow) (stateRow *TelemetryReportStateRow, err error)
+
+	// Record a failed submission attempt for a telemetry report, which
+	// will be quarantined once maxAttempts failures have been recorded,
+	// with a maxAttempts of 0 meaning no limit
+	RecordReportFailure(reportRow *TelemetryReportRow, reason string, maxAttempts int) (stateRow *TelemetryReportStateRow, err error)
+	RecordReportFailureContext(ctx context.Context, reportRow *TelemetryReportRow, reason string, maxAttempts int) (stateRow *TelemetryReportStateRow, err error)
+
+	// Quarantine a telemetry report so that it won't be submitted
+	QuarantineReport(reportRow *TelemetryReportRow, reason string) (err error)
+	QuarantineReportContext(ctx context.Context, reportRow *TelemetryReportRow, reason string) (err error)
+
+	// Re-queue a quarantined telemetry report for submission, clearing
+	// any recorded failed submission attempts
+	RequeueReport(reportRow *TelemetryReportRow) (err error)
+	RequeueReportContext(ctx context.Context, reportRow *TelemetryReportRow) (err error)
 
 	// Convert TelemetryReportRow structure to TelemetryReport
 	ToReport(reportRow *TelemetryReportRow) (report *TelemetryReport, err error)
+	ToReportContext(ctx context.Context, reportRow *TelemetryReportRow) (report *TelemetryReport, err error)
 
 	// Convert TelemetryBundleRow structure to TelemetryBundle
 	ToBundle(bundleRow *TelemetryBundleRow) (bundle *TelemetryBundle, err error)
+	ToBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow) (bundle *TelemetryBundle, err error)
 
 	// Convert TelemetryDataItemRow structure to TelemetryDataItem
 	ToItem(itemRow *TelemetryDataItemRow) (item *TelemetryDataItem, err error)
@@ -65,38 +308,74 @@ func (p *TelemetryProcessorImpl) ItemCount(bundleIds ...any) (count int, err err
 	return p.t.ItemCount(bundleIds...)
 }
 
+func (p *TelemetryProcessorImpl) ItemCountContext(ctx context.Context, bundleIds ...any) (count int, err error) {
+	return p.t.ItemCountContext(ctx, bundleIds...)
+}
+
 func (p *TelemetryProcessorImpl) BundleCount(reportIds ...any) (count int, err error) {
 	return p.t.BundleCount(reportIds...)
 }
 
+func (p *TelemetryProcessorImpl) BundleCountContext(ctx context.Context, reportIds ...any) (count int, err error) {
+	return p.t.BundleCountContext(ctx, reportIds...)
+}
+
 func (p *TelemetryProcessorImpl) ReportCount(ids ...any) (count int, err error) {
 	return p.t.ReportCount(ids...)
 }
 
+func (p *TelemetryProcessorImpl) ReportCountContext(ctx context.Context, ids ...any) (count int, err error) {
+	return p.t.ReportCountContext(ctx, ids...)
+}
+
 func (p *TelemetryProcessorImpl) GetItemRows(bundleIds ...any) (dataitemsRows []*TelemetryDataItemRow, err error) {
 	return p.t.GetItemRows(bundleIds...)
 }
 
+func (p *TelemetryProcessorImpl) GetItemRowsContext(ctx context.Context, bundleIds ...any) (dataitemsRows []*TelemetryDataItemRow, err error) {
+	return p.t.GetItemRowsContext(ctx, bundleIds...)
+}
+
 func (p *TelemetryProcessorImpl) DeleteItem(dataItemRow *TelemetryDataItemRow) (err error) {
 	return p.t.DeleteItem(dataItemRow)
 }
 
+func (p *TelemetryProcessorImpl) DeleteItemContext(ctx context.Context, dataItemRow *TelemetryDataItemRow) (err error) {
+	return p.t.DeleteItemContext(ctx, dataItemRow)
+}
+
 func (p *TelemetryProcessorImpl) GetBundleRows(reportIds ...any) (bundleRows []*TelemetryBundleRow, err error) {
 	return p.t.GetBundleRows(reportIds...)
 }
 
+func (p *TelemetryProcessorImpl) GetBundleRowsContext(ctx context.Context, reportIds ...any) (bundleRows []*TelemetryBundleRow, err error) {
+	return p.t.GetBundleRowsContext(ctx, reportIds...)
+}
+
 func (p *TelemetryProcessorImpl) DeleteBundle(bundleRow *TelemetryBundleRow) (err error) {
 	return p.t.DeleteBundle(bundleRow)
 }
 
+func (p *TelemetryProcessorImpl) DeleteBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow) (err error) {
+	return p.t.DeleteBundleContext(ctx, bundleRow)
+}
+
 func (p *TelemetryProcessorImpl) GetReportRows(ids ...any) (reportRows []*TelemetryReportRow, err error) {
 	return p.t.GetReportRows(ids...)
 }
 
+func (p *TelemetryProcessorImpl) GetReportRowsContext(ctx context.Context, ids ...any) (reportRows []*TelemetryReportRow, err error) {
+	return p.t.GetReportRowsContext(ctx, ids...)
+}
+
 func (p *TelemetryProcessorImpl) DeleteReport(reportRow *TelemetryReportRow) (err error) {
 	return p.t.DeleteReport(reportRow)
 }
 
+func (p *TelemetryProcessorImpl) DeleteReportContext(ctx context.Context, reportRow *TelemetryReportRow) (err error) {
+	return p.t.DeleteReportContext(ctx, reportRow)
+}
+
 // validate TelemetryProcessorImpl implements the TelemetryProcessor interface
 var _ TelemetryProcessor = (*TelemetryProcessorImpl)(nil)
 
@@ -110,36 +389,293 @@ func NewTelemetryProcessor(cfg *config.DBConfig) (TelemetryProcessor, error) {
 }
 
 func (p *TelemetryProcessorImpl) AddData(telemetry types.TelemetryType, marshaledData *types.TelemetryBlob, tags types.Tags) (err error) {
-	dataItemRow, err := NewTelemetryDataItemRow(telemetry, tags, marshaledData)
+	return p.AddDataContext(context.Background(), telemetry, marshaledData, tags)
+}
+
+func (p *TelemetryProcessorImpl) AddDataContext(ctx context.Context, telemetry types.TelemetryType, marshaledData *types.TelemetryBlob, tags types.Tags) (err error) {
+	return p.AddDataWithClassContext(ctx, telemetry, types.MANDATORY_TELEMETRY, marshaledData, tags)
+}
+
+func (p *TelemetryProcessorImpl) AddDataWithClass(telemetry types.TelemetryType, class types.TelemetryClass, marshaledData *types.TelemetryBlob, tags types.Tags) (err error) {
+	return p.AddDataWithClassContext(context.Background(), telemetry, class, marshaledData, tags)
+}
+
+func (p *TelemetryProcessorImpl) AddDataWithClassContext(ctx context.Context, telemetry types.TelemetryType, class types.TelemetryClass, marshaledData *types.TelemetryBlob, tags types.Tags) (err error) {
+	dataItemRow, err := NewTelemetryDataItemRowWithClass(telemetry, class, tags, marshaledData)
 	if err != nil {
 		return err
 	}
 
-	return dataItemRow.Insert(p.t.storer.Conn)
+	return p.t.storer.InsertItemContext(ctx, dataItemRow)
+}
+
+func (p *TelemetryProcessorImpl) AddBundle(bundle *TelemetryBundle, tags types.Tags) (bundleRow *TelemetryBundleRow, err error) {
+	return p.AddBundleContext(context.Background(), bundle, tags)
+}
+
+func (p *TelemetryProcessorImpl) AddBundleContext(ctx context.Context, bundle *TelemetryBundle, tags types.Tags) (bundleRow *TelemetryBundleRow, err error) {
+	// extend the bundle annotations with any new tags
+	annotations := append([]string{}, bundle.Header.BundleAnnotations...)
+	for _, tag := range tags {
+		if !slices.Contains(annotations, string(tag)) {
+			annotations = append(annotations, string(tag))
+		}
+	}
+
+	bundleRow = &TelemetryBundleRow{
+		BundleId:          bundle.Header.BundleId,
+		BundleTimestamp:   bundle.Header.BundleTimeStamp,
+		BundleClientId:    bundle.Header.BundleClientId,
+		BundleCustomerId:  bundle.Header.BundleCustomerId,
+		BundleAnnotations: strings.Join(annotations, ","),
+	}
+
+	// the bundle may be resent if the sender didn't see our response
+	if p.t.storer.BundleExistsContext(ctx, bundleRow) {
+		slog.Debug(
+			"Bundle already staged",
+			slog.String("bundleId", bundleRow.BundleId),
+		)
+		return
+	}
+
+	// verify all item checksums before staging anything
+	for i := range bundle.TelemetryDataItems {
+		if err = bundle.TelemetryDataItems[i].VerifyChecksum(); err != nil {
+			return nil, fmt.Errorf("%w: bundle %q: %w", ErrChecksumMismatch, bundleRow.BundleId, err)
+		}
+	}
+
+	var itemRows []*TelemetryDataItemRow
+	for _, item := range bundle.TelemetryDataItems {
+		class, err := item.Header.Class()
+		if err != nil {
+			return nil, fmt.Errorf("invalid item %q in bundle %q: %w", item.Header.TelemetryId, bundleRow.BundleId, err)
+		}
+
+		itemRows = append(itemRows, &TelemetryDataItemRow{
+			ItemId:          item.Header.TelemetryId,
+			ItemType:        item.Header.TelemetryType,
+			ItemTimestamp:   item.Header.TelemetryTimeStamp,
+			ItemAnnotations: strings.Join(item.Header.TelemetryAnnotations, ","),
+			ItemData:        item.TelemetryData,
+			ItemChecksum:    item.Footer.Checksum,
+			ItemClass:       class,
+		})
+	}
+
+	// the items are inserted along with the bundle, so that they are
+	// never seen as unbundled items
+	if err = p.t.storer.InsertBundleWithItemsContext(ctx, bundleRow, itemRows); err != nil {
+		return nil, fmt.Errorf("unable to insert bundle %q: %w", bundleRow.BundleId, err)
+	}
+
+	return
+}
+
+func (p *TelemetryProcessorImpl) RegisterManagedClient(systemId string) (managedRow *TelemetryManagedClientRow, err error) {
+	return p.RegisterManagedClientContext(context.Background(), systemId)
+}
+
+func (p *TelemetryProcessorImpl) RegisterManagedClientContext(ctx context.Context, systemId string) (managedRow *TelemetryManagedClientRow, err error) {
+	if systemId == "" {
+		return nil, fmt.Errorf("managed client system id must be specified")
+	}
+
+	managedRow = NewTelemetryManagedClientRow(systemId)
+	if p.t.storer.ManagedClientExistsContext(ctx, managedRow) {
+		return
+	}
+
+	if err = p.t.storer.InsertManagedClientContext(ctx, managedRow); err != nil {
+		return nil, fmt.Errorf("unable to register managed client %q: %w", systemId, err)
+	}
+
+	return
+}
+
+func (p *TelemetryProcessorImpl) GetManagedClientRows() (managedRows []*TelemetryManagedClientRow, err error) {
+	return p.GetManagedClientRowsContext(context.Background())
+}
+
+func (p *TelemetryProcessorImpl) GetManagedClientRowsContext(ctx context.Context) (managedRows []*TelemetryManagedClientRow, err error) {
+	return p.t.storer.GetManagedClientsContext(ctx)
+}
+
+func (p *TelemetryProcessorImpl) AddManagedData(managedRow *TelemetryManagedClientRow, telemetry types.TelemetryType, content *types.TelemetryBlob, tags types.Tags) (err error) {
+	return p.AddManagedDataContext(context.Background(), managedRow, telemetry, content, tags)
+}
+
+func (p *TelemetryProcessorImpl) AddManagedDataContext(ctx context.Context, managedRow *TelemetryManagedClientRow, telemetry types.TelemetryType, content *types.TelemetryBlob, tags types.Tags) (err error) {
+	return p.AddManagedDataWithClassContext(ctx, managedRow, telemetry, types.MANDATORY_TELEMETRY, content, tags)
+}
+
+func (p *TelemetryProcessorImpl) AddManagedDataWithClass(managedRow *TelemetryManagedClientRow, telemetry types.TelemetryType, class types.TelemetryClass, content *types.TelemetryBlob, tags types.Tags) (err error) {
+	return p.AddManagedDataWithClassContext(context.Background(), managedRow, telemetry, class, content, tags)
+}
+
+func (p *TelemetryProcessorImpl) AddManagedDataWithClassContext(ctx context.Context, managedRow *TelemetryManagedClientRow, telemetry types.TelemetryType, class types.TelemetryClass, content *types.TelemetryBlob, tags types.Tags) (err error) {
+	dataItemRow, err := NewTelemetryDataItemRowWithClass(telemetry, class, tags, content)
+	if err != nil {
+		return err
+	}
+
+	return p.t.storer.InsertManagedItemContext(ctx, managedRow, dataItemRow)
+}
+
+func (p *TelemetryProcessorImpl) GenerateManagedBundles(frameworkClientId string, customerId string, tags types.Tags) (bundleRows []*TelemetryBundleRow, err error) {
+	return p.GenerateManagedBundlesContext(context.Background(), frameworkClientId, customerId, tags)
+}
+
+func (p *TelemetryProcessorImpl) GenerateManagedBundlesContext(ctx context.Context, frameworkClientId string, customerId string, tags types.Tags) (bundleRows []*TelemetryBundleRow, err error) {
+	managedRows, err := p.t.storer.GetManagedClientsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get managed clients for bundle generation: %w", err)
+	}
+
+	for _, managedRow := range managedRows {
+		itemIDs, err := p.t.storer.GetManagedItemIdsContext(ctx, managedRow)
+		if err != nil {
+			return bundleRows, fmt.Errorf("unable to get items for managed client %q: %w", managedRow.SystemId, err)
+		}
+
+		// nothing to bundle for this managed client
+		if len(itemIDs) == 0 {
+			continue
+		}
+
+		bundleTags := append(slices.Clone(tags), managedRow.RelayedViaTag(frameworkClientId))
+		bundleRow, err := NewTelemetryBundleRow(managedRow.ClientId, customerId, bundleTags)
+		if err != nil {
+			return bundleRows, fmt.Errorf("unable to create bundle for managed client %q: %w", managedRow.SystemId, err)
+		}
+
+		err = p.t.storer.InsertBundleContext(ctx, bundleRow, itemIDs)
+		switch {
+		// another process has bundled the items
+		case errors.Is(err, ErrNoUnbundledItems):
+			continue
+		case err != nil:
+			return bundleRows, fmt.Errorf("unable to insert bundle for managed client %q: %w", managedRow.SystemId, err)
+		}
+
+		bundleRows = append(bundleRows, bundleRow)
+	}
+
+	return
 }
 
 func (p *TelemetryProcessorImpl) GenerateBundle(clientId string, customerId string, tags types.Tags) (bundleRow *TelemetryBundleRow, err error) {
+	return p.GenerateBundleContext(context.Background(), clientId, customerId, tags)
+}
+
+func (p *TelemetryProcessorImpl) GenerateBundleContext(ctx context.Context, clientId string, customerId string, tags types.Tags) (bundleRow *TelemetryBundleRow, err error) {
 
 	bundleRow, err = NewTelemetryBundleRow(clientId, customerId, tags)
 	if err != nil {
 		return bundleRow, fmt.Errorf("unable to create bundle: %s", err.Error())
 	}
 
-	//List all items that are not associated with bundle yet
-	itemIDs, _, err := p.t.storer.GetItems("NULL")
+	//List all items that are not associated with bundle yet, excluding
+	//any staged on behalf of managed clients
+	itemIDs, err := p.t.storer.GetUnmanagedItemIdsContext(ctx)
 	if err != nil {
 		return bundleRow, fmt.Errorf("unable to get items for bundle generation: %s", err.Error())
 	}
 
-	_, err = bundleRow.Insert(p.t.storer.Conn, itemIDs)
+	err = p.t.storer.InsertBundleContext(ctx, bundleRow, itemIDs)
+
+	if err != nil {
+		return bundleRow, fmt.Errorf("unable to insert bundle: %w", err)
+	}
+	return
+}
+
+func (p *TelemetryProcessorImpl) GenerateBundles(clientId string, customerId string, tags types.Tags, policy *config.BundlingConfig) (bundleRows []*TelemetryBundleRow, err error) {
+	return p.GenerateBundlesContext(context.Background(), clientId, customerId, tags, policy)
+}
+
+func (p *TelemetryProcessorImpl) GenerateBundlesContext(ctx context.Context, clientId string, customerId string, tags types.Tags, policy *config.BundlingConfig) (bundleRows []*TelemetryBundleRow, err error) {
+	if policy == nil {
+		policy = &config.BundlingConfig{}
+	}
+	if err = validateBundlingPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	//List all items that are not associated with bundle yet, excluding
+	//any staged on behalf of managed clients
+	itemIDs, err := p.t.storer.GetUnmanagedItemIdsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get items for bundle generation: %w", err)
+	}
+
+	// nothing to do if there are no unbundled items
+	if len(itemIDs) == 0 {
+		return
+	}
+
+	// only the item summaries are needed to group the items
+	itemRows, err := p.t.storer.GetStagedItemsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get items for bundle generation: %w", err)
+	}
+	unmanaged := make(map[int64]bool, len(itemIDs))
+	for _, itemID := range itemIDs {
+		unmanaged[itemID] = true
+	}
+	itemRows = slices.DeleteFunc(itemRows, func(itemRow *TelemetryStagedItemRow) bool {
+		return itemRow.BundleId.Valid || !unmanaged[itemRow.Id]
+	})
+
+	// max_bytes limits the JSON encoded content size, as recorded in the
+	// datastore for all but items staged before it was recorded
+	var contentSizes map[int64]int
+	if policy.MaxBytes > 0 {
+		contentSizes, err = p.itemContentSizes(ctx, itemRows, "NULL")
+		if err != nil {
+			return nil, fmt.Errorf("unable to get item sizes for bundle generation: %w", err)
+		}
+	}
 
+	groups, err := groupBundleItems(policy, itemRows, contentSizes, time.Now())
 	if err != nil {
-		return bundleRow, fmt.Errorf("unable to insert bundle: %s", err.Error())
+		return nil, fmt.Errorf("unable to group items for bundle generation: %w", err)
 	}
+
+	for _, groupIDs := range groups {
+		bundleRow, err := NewTelemetryBundleRow(clientId, customerId, tags)
+		if err != nil {
+			return bundleRows, fmt.Errorf("unable to create bundle: %w", err)
+		}
+
+		err = p.t.storer.InsertBundleContext(ctx, bundleRow, groupIDs)
+		switch {
+		// another process has bundled the items
+		case errors.Is(err, ErrNoUnbundledItems):
+			continue
+		case err != nil:
+			return bundleRows, fmt.Errorf("unable to insert bundle: %w", err)
+		}
+
+		bundleRows = append(bundleRows, bundleRow)
+	}
+
+	slog.Debug(
+		"Generated bundles",
+		slog.Int("items", len(itemRows)),
+		slog.Int("bundles", len(bundleRows)),
+		slog.String("policy", policy.String()),
+	)
+
 	return
 }
 
 func (p *TelemetryProcessorImpl) GenerateReport(clientId string, tags types.Tags) (reportRow *TelemetryReportRow, err error) {
+	return p.GenerateReportContext(context.Background(), clientId, tags)
+}
+
+func (p *TelemetryProcessorImpl) GenerateReportContext(ctx context.Context, clientId string, tags types.Tags) (reportRow *TelemetryReportRow, err error) {
 
 	reportRow, err = NewTelemetryReportRow(clientId, tags)
 	if err != nil {
@@ -147,35 +683,597 @@ func (p *TelemetryProcessorImpl) GenerateReport(clientId string, tags types.Tags
 	}
 
 	//List all bundles that are not associated with report yet
-	bundleIDs, _, err := p.t.storer.GetBundles("NULL")
+	bundleIDs, _, err := p.t.storer.GetBundlesContext(ctx, "NULL")
 
 	if err != nil {
 		return reportRow, fmt.Errorf("unable to get bundles for the report generation: %s", err.Error())
 	}
 
-	_, err = reportRow.Insert(p.t.storer.Conn, bundleIDs)
+	err = p.t.storer.InsertReportContext(ctx, reportRow, bundleIDs)
 
 	if err != nil {
-		return reportRow, fmt.Errorf("unable to insert report: %s", err.Error())
+		return reportRow, fmt.Errorf("unable to insert report: %w", err)
 	}
 
 	return
 
 }
 
-func (p *TelemetryProcessorImpl) ToReport(reportRow *TelemetryReportRow) (report *TelemetryReport, err error) {
-	// Convert TelemetryReportRow structure to TelemetryReport
+func (p *TelemetryProcessorImpl) GenerateReports(clientId string, tags types.Tags, maxSize int) (reportRows []*TelemetryReportRow, err error) {
+	return p.GenerateReportsContext(context.Background(), clientId, tags, maxSize)
+}
 
-	annotations := strings.Split(reportRow.ReportAnnotations, ",")
+func (p *TelemetryProcessorImpl) GenerateReportsContext(ctx context.Context, clientId string, tags types.Tags, maxSize int) (reportRows []*TelemetryReportRow, err error) {
 
-	reportHeader := TelemetryReportHeader{
-		ReportId:          reportRow.ReportId,
-		ReportTimeStamp:   reportRow.ReportTimestamp,
-		ReportClientId:    reportRow.ReportClientId,
-		ReportAnnotations: annotations,
+	//List all bundles that are not associated with report yet
+	bundleIDs, bundleRows, err := p.t.storer.GetBundlesContext(ctx, "NULL")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get bundles for the report generation: %s", err.Error())
+	}
+
+	// nothing to do if there are no unassigned bundles
+	if len(bundleIDs) == 0 {
+		return
+	}
+
+	// without a size limit all bundles go in a single report
+	if maxSize <= 0 {
+		reportRow, err := p.insertReport(ctx, clientId, tags, bundleIDs)
+		switch {
+		// another process has reported the bundles
+		case errors.Is(err, ErrNoUnreportedBundles):
+			return nil, nil
+		case err != nil:
+			return nil, err
+		}
+		return []*TelemetryReportRow{reportRow}, nil
 	}
 
-	_, bundleRows, err := p.t.storer.GetBundles(reportRow.Id)
+	// the bundle sizes are calculated from the summaries of their items
+	stagedRows, err := p.t.storer.GetStagedItemsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get items for the report generation: %w", err)
+	}
+	bundleItemRows := map[int64][]*TelemetryStagedItemRow{}
+	for _, stagedRow := range stagedRows {
+		if stagedRow.BundleId.Valid {
+			bundleItemRows[stagedRow.BundleId.Int64] = append(bundleItemRows[stagedRow.BundleId.Int64], stagedRow)
+		}
+	}
+
+	reportRow, groupSize, err := newSizedReportRow(clientId, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	// greedily assign bundles to reports, in order, starting a new report
+	// whenever adding a bundle would exceed the size limit; a bundle that
+	// exceeds the size limit on its own is placed in a report by itself
+	var groupIDs []int64
+	for i, bundleRow := range bundleRows {
+		bundleSize, err := p.bundleSize(ctx, bundleRow, bundleItemRows[bundleRow.Id])
+		if err != nil {
+			return nil, err
+		}
+
+		// allow for the separating comma between bundles
+		if len(groupIDs) > 0 && groupSize+1+bundleSize > maxSize {
+			if reportRows, err = p.insertReportGroup(ctx, reportRows, reportRow, groupIDs); err != nil {
+				return nil, err
+			}
+
+			reportRow, groupSize, err = newSizedReportRow(clientId, tags)
+			if err != nil {
+				return nil, err
+			}
+			groupIDs = nil
+		}
+
+		if len(groupIDs) > 0 {
+			groupSize += 1
+		}
+		groupIDs = append(groupIDs, bundleIDs[i])
+		groupSize += bundleSize
+	}
+
+	if reportRows, err = p.insertReportGroup(ctx, reportRows, reportRow, groupIDs); err != nil {
+		return nil, err
+	}
+
+	slog.Debug(
+		"Generated reports",
+		slog.Int("bundles", len(bundleIDs)),
+		slog.Int("reports", len(reportRows)),
+		slog.Int("maxSize", maxSize),
+	)
+
+	return
+}
+
+func (p *TelemetryProcessorImpl) SplitReport(reportRow *TelemetryReportRow) (reportRows []*TelemetryReportRow, err error) {
+	return p.SplitReportContext(context.Background(), reportRow)
+}
+
+func (p *TelemetryProcessorImpl) SplitReportContext(ctx context.Context, reportRow *TelemetryReportRow) (reportRows []*TelemetryReportRow, err error) {
+	bundleIDs, bundleRows, err := p.t.storer.GetBundlesContext(ctx, reportRow.Id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get bundles for report %q: %w", reportRow.ReportId, err)
+	}
+
+	var groups [][]int64
+	switch {
+	// split the bundles evenly between two new reports
+	case len(bundleIDs) > 1:
+		half := len(bundleIDs) / 2
+		groups = [][]int64{bundleIDs[:half], bundleIDs[half:]}
+
+	// split the items of a single bundle evenly between two new bundles
+	case len(bundleIDs) == 1:
+		groups, err = p.splitBundle(ctx, bundleRows[0])
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: report %q has no bundles", ErrReportNotSplittable, reportRow.ReportId)
+	}
+
+	// replace the original report with new reports, preserving the
+	// original report's details
+	for range groups {
+		newRow := *reportRow
+		newRow.ReportId = uuid.New().String()
+		reportRows = append(reportRows, &newRow)
+	}
+
+	if err = p.t.storer.SplitReportContext(ctx, reportRow, reportRows, groups); err != nil {
+		return nil, fmt.Errorf("unable to split report %q: %w", reportRow.ReportId, err)
+	}
+
+	slog.Debug(
+		"Split report",
+		slog.String("reportId", reportRow.ReportId),
+		slog.String("first", reportRows[0].ReportId),
+		slog.String("second", reportRows[1].ReportId),
+	)
+
+	return
+}
+
+// splitBundle splits the items of a bundle evenly between two new bundles,
+// preserving the original bundle's details, returning the new bundle ids
+func (p *TelemetryProcessorImpl) splitBundle(ctx context.Context, bundleRow *TelemetryBundleRow) (groups [][]int64, err error) {
+	itemIDs, _, err := p.t.storer.GetItemsContext(ctx, bundleRow.Id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get items for bundle %q: %w", bundleRow.BundleId, err)
+	}
+
+	if len(itemIDs) < 2 {
+		return nil, fmt.Errorf(
+			"%w: bundle %q has only %d item(s)",
+			ErrReportNotSplittable,
+			bundleRow.BundleId,
+			len(itemIDs),
+		)
+	}
+
+	// replace the original bundle with new bundles, in the same report,
+	// preserving the original bundle's details
+	half := len(itemIDs) / 2
+	itemGroups := [][]int64{itemIDs[:half], itemIDs[half:]}
+	var newRows []*TelemetryBundleRow
+	for range itemGroups {
+		newRow := *bundleRow
+		newRow.BundleId = uuid.New().String()
+		newRows = append(newRows, &newRow)
+	}
+
+	if err = p.t.storer.SplitBundleContext(ctx, bundleRow, newRows, itemGroups); err != nil {
+		return nil, fmt.Errorf("unable to split bundle %q: %w", bundleRow.BundleId, err)
+	}
+
+	for _, newRow := range newRows {
+		groups = append(groups, []int64{newRow.Id})
+	}
+
+	return
+}
+
+// insertReport creates a new report containing the specified bundles
+func (p *TelemetryProcessorImpl) insertReport(ctx context.Context, clientId string, tags types.Tags, bundleIDs []int64) (reportRow *TelemetryReportRow, err error) {
+	reportRow, err = NewTelemetryReportRow(clientId, tags)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create report: %s", err.Error())
+	}
+
+	err = p.t.storer.InsertReportContext(ctx, reportRow, bundleIDs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to insert report: %w", err)
+	}
+
+	return
+}
+
+// insertReportGroup inserts the report containing the group of bundles,
+// appending it to the report rows, unless another process has already
+// reported all of the bundles
+func (p *TelemetryProcessorImpl) insertReportGroup(ctx context.Context, reportRows []*TelemetryReportRow, reportRow *TelemetryReportRow, groupIDs []int64) ([]*TelemetryReportRow, error) {
+	err := p.t.storer.InsertReportContext(ctx, reportRow, groupIDs)
+	switch {
+	case errors.Is(err, ErrNoUnreportedBundles):
+		return reportRows, nil
+	case err != nil:
+		return nil, fmt.Errorf("unable to insert report: %w", err)
+	}
+
+	return append(reportRows, reportRow), nil
+}
+
+// itemContentSizes maps the ids of the staged items to the size of their
+// content when JSON encoded, retrieving the content, for the items of the
+// specified bundles, only for items staged before the size was recorded.
+func (p *TelemetryProcessorImpl) itemContentSizes(ctx context.Context, itemRows []*TelemetryStagedItemRow, bundleIds ...any) (contentSizes map[int64]int, err error) {
+	contentSizes = make(map[int64]int, len(itemRows))
+	var unknown bool
+	for _, itemRow := range itemRows {
+		if !itemRow.ItemContentSize.Valid {
+			unknown = true
+			continue
+		}
+		contentSizes[itemRow.Id] = int(itemRow.ItemContentSize.Int64)
+	}
+	if !unknown {
+		return
+	}
+
+	err = p.t.storer.WalkItemsContext(
+		ctx,
+		func(itemRow *TelemetryDataItemRow) error {
+			if _, found := contentSizes[itemRow.Id]; found {
+				return nil
+			}
+			size, err := itemContentSize(itemRow.ItemData)
+			if err != nil {
+				return err
+			}
+			contentSizes[itemRow.Id] = int(size)
+			return nil
+		},
+		bundleIds...,
+	)
+
+	return
+}
+
+// bundleSize returns the size of the bundle when JSON encoded, before any
+// content encoding compression, calculated from the bundle's staged items
+// and the size of their content, as recorded in the datastore, without
+// retrieving the content.
+func (p *TelemetryProcessorImpl) bundleSize(ctx context.Context, bundleRow *TelemetryBundleRow, itemRows []*TelemetryStagedItemRow) (size int, err error) {
+	contentSizes, err := p.itemContentSizes(ctx, itemRows, bundleRow.Id)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get item sizes for bundle %q: %w", bundleRow.BundleId, err)
+	}
+
+	// the bundle checksum is a hex encoded MD5 hash
+	bundle := &TelemetryBundle{
+		Header: bundleRow.header(),
+		Footer: TelemetryBundleFooter{Checksum: strings.Repeat("0", 2*md5.Size)},
+	}
+	bundleJSON, err := json.Marshal(bundle)
+	if err != nil {
+		return 0, fmt.Errorf("failed to JSON marshal bundle %q: %w", bundleRow.BundleId, err)
+	}
+
+	// account for the omitted empty data items list
+	size = len(bundleJSON) + len(`,"telemetryDataItems":[]`)
+
+	for i, itemRow := range itemRows {
+		// the item content is omitted, being encoded as null
+		item := &TelemetryDataItem{
+			Header: itemRow.header(),
+			Footer: TelemetryDataItemFooter{Checksum: itemRow.ItemChecksum},
+		}
+		itemJSON, err := json.Marshal(item)
+		if err != nil {
+			return 0, fmt.Errorf("failed to JSON marshal item %q: %w", itemRow.ItemId, err)
+		}
+
+		// allow for the separating comma between items
+		if i > 0 {
+			size += 1
+		}
+		size += len(itemJSON) - len(`null`) + contentSizes[itemRow.Id]
+	}
+
+	return
+}
+
+// newSizedReportRow creates a new report row, returning the size of the
+// corresponding JSON encoded report, excluding the content of its bundles
+func newSizedReportRow(clientId string, tags types.Tags) (reportRow *TelemetryReportRow, size int, err error) {
+	reportRow, err = NewTelemetryReportRow(clientId, tags)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to create report: %s", err.Error())
+	}
+
+	report := &TelemetryReport{
+		Header: reportRow.header(),
+	}
+	if err = report.UpdateChecksum(); err != nil {
+		return nil, 0, err
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to JSON marshal report: %w", err)
+	}
+
+	// account for the omitted empty bundles list
+	size = len(reportJSON) + len(`,"telemetryBundles":[]`)
+
+	return
+}
+
+func (p *TelemetryProcessorImpl) EnforceStagingLimits(limits *config.StagingConfig) (evictionRows []*TelemetryEvictionRow, err error) {
+	return p.EnforceStagingLimitsContext(context.Background(), limits)
+}
+
+func (p *TelemetryProcessorImpl) EnforceStagingLimitsContext(ctx context.Context, limits *config.StagingConfig) (evictionRows []*TelemetryEvictionRow, err error) {
+	if limits == nil {
+		return
+	}
+	if err = validateStagingLimits(limits); err != nil {
+		return nil, err
+	}
+
+	// nothing to do if there are no limits
+	if !stagingLimited(limits) {
+		return
+	}
+
+	stagedRows, err := p.t.storer.GetStagedItemsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get staged items to enforce staging limits: %w", err)
+	}
+
+	evictions := selectEvictions(limits, stagedRows, time.Now())
+
+	return p.evictStagedItems(ctx, evictions, "Evicted staged telemetry")
+}
+
+func (p *TelemetryProcessorImpl) PurgeWithdrawnConsent(cfg *config.Config) (evictionRows []*TelemetryEvictionRow, err error) {
+	return p.PurgeWithdrawnConsentContext(context.Background(), cfg)
+}
+
+func (p *TelemetryProcessorImpl) PurgeWithdrawnConsentContext(ctx context.Context, cfg *config.Config) (evictionRows []*TelemetryEvictionRow, err error) {
+	// nothing is submitted while telemetry is disabled, so leave the
+	// staged telemetry as is until it is re-enabled
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	stagedRows, err := p.t.storer.GetStagedItemsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get staged items to purge withdrawn telemetry: %w", err)
+	}
+	if len(stagedRows) == 0 {
+		return
+	}
+
+	managedRows, err := p.t.storer.GetManagedClientsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get managed clients to purge withdrawn telemetry: %w", err)
+	}
+	managedClientIds := map[string]bool{}
+	for _, managedRow := range managedRows {
+		managedClientIds[managedRow.ClientId] = true
+	}
+
+	_, bundleRows, err := p.t.storer.GetBundlesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get bundles to purge withdrawn telemetry: %w", err)
+	}
+	relayedBundleIds := map[int64]bool{}
+	for _, bundleRow := range bundleRows {
+		if relayedBundle(bundleRow, managedClientIds) {
+			relayedBundleIds[bundleRow.Id] = true
+		}
+	}
+
+	withdrawals := selectWithdrawals(cfg, stagedRows, relayedBundleIds)
+
+	return p.evictStagedItems(ctx, withdrawals, "Purged staged telemetry for which consent was withdrawn")
+}
+
+// evictStagedItems atomically deletes the selected staged items, along
+// with any bundles and reports that are left empty as a result, recording
+// and logging the evictions
+func (p *TelemetryProcessorImpl) evictStagedItems(ctx context.Context, evictions []*stagedEviction, msg string) (evictionRows []*TelemetryEvictionRow, err error) {
+	if len(evictions) == 0 {
+		return
+	}
+
+	itemIDs := make([]int64, 0, len(evictions))
+	for _, eviction := range evictions {
+		itemIDs = append(itemIDs, eviction.stagedRow.Id)
+	}
+
+	evictionRows = newEvictionRows(evictions, types.Now())
+	if err = p.t.storer.EvictItemsContext(ctx, itemIDs, evictionRows); err != nil {
+		return nil, fmt.Errorf("unable to evict %d staged items: %w", len(itemIDs), err)
+	}
+
+	for _, evictionRow := range evictionRows {
+		slog.Warn(
+			msg,
+			slog.String("reason", evictionRow.Reason),
+			slog.String("type", evictionRow.ItemType),
+			slog.String("class", evictionRow.ItemClass.String()),
+			slog.Int("items", evictionRow.ItemCount),
+			slog.Int64("bytes", evictionRow.ItemBytes),
+		)
+	}
+
+	return
+}
+
+func (p *TelemetryProcessorImpl) GetEvictionRows() (evictionRows []*TelemetryEvictionRow, err error) {
+	return p.GetEvictionRowsContext(context.Background())
+}
+
+func (p *TelemetryProcessorImpl) GetEvictionRowsContext(ctx context.Context) (evictionRows []*TelemetryEvictionRow, err error) {
+	return p.t.storer.GetEvictionsContext(ctx)
+}
+
+func (p *TelemetryProcessorImpl) DeleteEviction(evictionRow *TelemetryEvictionRow) (err error) {
+	return p.DeleteEvictionContext(context.Background(), evictionRow)
+}
+
+func (p *TelemetryProcessorImpl) DeleteEvictionContext(ctx context.Context, evictionRow *TelemetryEvictionRow) (err error) {
+	return p.t.storer.DeleteEvictionContext(ctx, evictionRow)
+}
+
+func (p *TelemetryProcessorImpl) RecordSubmission(submissionRow *TelemetrySubmissionRow) (err error) {
+	return p.RecordSubmissionContext(context.Background(), submissionRow)
+}
+
+func (p *TelemetryProcessorImpl) RecordSubmissionContext(ctx context.Context, submissionRow *TelemetrySubmissionRow) (err error) {
+	err = p.t.storer.InsertSubmissionContext(ctx, submissionRow)
+	if err != nil {
+		return fmt.Errorf("unable to record submission of report %q: %w", submissionRow.ReportId, err)
+	}
+	return
+}
+
+func (p *TelemetryProcessorImpl) SubmissionCount(reportIds ...any) (count int, err error) {
+	return p.SubmissionCountContext(context.Background(), reportIds...)
+}
+
+func (p *TelemetryProcessorImpl) SubmissionCountContext(ctx context.Context, reportIds ...any) (count int, err error) {
+	return p.t.storer.GetSubmissionCountContext(ctx, reportIds...)
+}
+
+func (p *TelemetryProcessorImpl) GetSubmissionRows(reportIds ...any) (submissionRows []*TelemetrySubmissionRow, err error) {
+	return p.GetSubmissionRowsContext(context.Background(), reportIds...)
+}
+
+func (p *TelemetryProcessorImpl) GetSubmissionRowsContext(ctx context.Context, reportIds ...any) (submissionRows []*TelemetrySubmissionRow, err error) {
+	return p.t.storer.GetSubmissionsContext(ctx, reportIds...)
+}
+
+func (p *TelemetryProcessorImpl) GetPendingReportRows() (reportRows []*TelemetryReportRow, err error) {
+	return p.GetPendingReportRowsContext(context.Background())
+}
+
+func (p *TelemetryProcessorImpl) GetPendingReportRowsContext(ctx context.Context) (reportRows []*TelemetryReportRow, err error) {
+	_, reportRows, err = p.t.storer.GetPendingReportsContext(ctx)
+	return
+}
+
+func (p *TelemetryProcessorImpl) GetQuarantinedReportRows() (reportRows []*TelemetryReportRow, err error) {
+	return p.GetQuarantinedReportRowsContext(context.Background())
+}
+
+func (p *TelemetryProcessorImpl) GetQuarantinedReportRowsContext(ctx context.Context) (reportRows []*TelemetryReportRow, err error) {
+	_, reportRows, err = p.t.storer.GetQuarantinedReportsContext(ctx)
+	return
+}
+
+func (p *TelemetryProcessorImpl) GetReportState(reportRow *TelemetryReportRow) (stateRow *TelemetryReportStateRow, err error) {
+	return p.GetReportStateContext(context.Background(), reportRow)
+}
+
+func (p *TelemetryProcessorImpl) GetReportStateContext(ctx context.Context, reportRow *TelemetryReportRow) (stateRow *TelemetryReportStateRow, err error) {
+	return p.t.storer.GetReportStateContext(ctx, reportRow)
+}
+
+func (p *TelemetryProcessorImpl) RecordReportFailure(reportRow *TelemetryReportRow, reason string, maxAttempts int) (stateRow *TelemetryReportStateRow, err error) {
+	return p.RecordReportFailureContext(context.Background(), reportRow, reason, maxAttempts)
+}
+
+func (p *TelemetryProcessorImpl) RecordReportFailureContext(ctx context.Context, reportRow *TelemetryReportRow, reason string, maxAttempts int) (stateRow *TelemetryReportStateRow, err error) {
+	stateRow, err = p.t.storer.GetReportStateContext(ctx, reportRow)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get state of report %q: %w", reportRow.ReportId, err)
+	}
+
+	stateRow.Attempts++
+	stateRow.Reason = reason
+	if maxAttempts > 0 && stateRow.Attempts >= maxAttempts {
+		stateRow.Quarantined = true
+	}
+
+	if err = p.t.storer.UpsertReportStateContext(ctx, stateRow); err != nil {
+		return nil, fmt.Errorf("unable to update state of report %q: %w", reportRow.ReportId, err)
+	}
+
+	if stateRow.Quarantined {
+		slog.Warn(
+			"Report quarantined",
+			slog.String("reportId", reportRow.ReportId),
+			slog.Int("attempts", stateRow.Attempts),
+			slog.String("reason", reason),
+		)
+	}
+
+	return
+}
+
+func (p *TelemetryProcessorImpl) QuarantineReport(reportRow *TelemetryReportRow, reason string) (err error) {
+	return p.QuarantineReportContext(context.Background(), reportRow, reason)
+}
+
+func (p *TelemetryProcessorImpl) QuarantineReportContext(ctx context.Context, reportRow *TelemetryReportRow, reason string) (err error) {
+	stateRow, err := p.t.storer.GetReportStateContext(ctx, reportRow)
+	if err != nil {
+		return fmt.Errorf("unable to get state of report %q: %w", reportRow.ReportId, err)
+	}
+
+	stateRow.Quarantined = true
+	stateRow.Reason = reason
+
+	if err = p.t.storer.UpsertReportStateContext(ctx, stateRow); err != nil {
+		return fmt.Errorf("unable to quarantine report %q: %w", reportRow.ReportId, err)
+	}
+
+	slog.Warn(
+		"Report quarantined",
+		slog.String("reportId", reportRow.ReportId),
+		slog.String("reason", reason),
+	)
+
+	return
+}
+
+func (p *TelemetryProcessorImpl) RequeueReport(reportRow *TelemetryReportRow) (err error) {
+	return p.RequeueReportContext(context.Background(), reportRow)
+}
+
+func (p *TelemetryProcessorImpl) RequeueReportContext(ctx context.Context, reportRow *TelemetryReportRow) (err error) {
+	// removing the state resets the report to pending with no failures
+	stateRow := NewTelemetryReportStateRow(reportRow)
+	if err = p.t.storer.DeleteReportStateContext(ctx, stateRow); err != nil {
+		return fmt.Errorf("unable to re-queue report %q: %w", reportRow.ReportId, err)
+	}
+
+	slog.Info(
+		"Report re-queued",
+		slog.String("reportId", reportRow.ReportId),
+	)
+
+	return
+}
+
+func (p *TelemetryProcessorImpl) ToReport(reportRow *TelemetryReportRow) (report *TelemetryReport, err error) {
+	return p.ToReportContext(context.Background(), reportRow)
+}
+
+func (p *TelemetryProcessorImpl) ToReportContext(ctx context.Context, reportRow *TelemetryReportRow) (report *TelemetryReport, err error) {
+	// Convert TelemetryReportRow structure to TelemetryReport
+	reportHeader := reportRow.header()
+
+	_, bundleRows, err := p.t.storer.GetBundlesContext(ctx, reportRow.Id)
 	if err != nil {
 		slog.Error(
 			"Failed to retrieve bundles associated with reportId from data store",
@@ -190,7 +1288,7 @@ func (p *TelemetryProcessorImpl) ToReport(reportRow *TelemetryReportRow) (report
 	for _, bundleRow := range bundleRows {
 		var bundle *TelemetryBundle
 
-		bundle, err = p.ToBundle(bundleRow)
+		bundle, err = p.ToBundleContext(ctx, bundleRow)
 		if err != nil {
 			slog.Error(
 				"Failed to generate bundle from datastore content",
@@ -225,18 +1323,14 @@ func (p *TelemetryProcessorImpl) ToReport(reportRow *TelemetryReportRow) (report
 }
 
 func (p *TelemetryProcessorImpl) ToBundle(bundleRow *TelemetryBundleRow) (bundle *TelemetryBundle, err error) {
-	// Convert TelemetryBundleRow structure to TelemetryBundle
-	annotations := strings.Split(bundleRow.BundleAnnotations, ",")
+	return p.ToBundleContext(context.Background(), bundleRow)
+}
 
-	bundleHeader := TelemetryBundleHeader{
-		BundleId:          bundleRow.BundleId,
-		BundleTimeStamp:   bundleRow.BundleTimestamp,
-		BundleClientId:    bundleRow.BundleClientId,
-		BundleCustomerId:  bundleRow.BundleCustomerId,
-		BundleAnnotations: annotations,
-	}
+func (p *TelemetryProcessorImpl) ToBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow) (bundle *TelemetryBundle, err error) {
+	// Convert TelemetryBundleRow structure to TelemetryBundle
+	bundleHeader := bundleRow.header()
 
-	_, itemRows, err := p.t.storer.GetItems(bundleRow.Id)
+	_, itemRows, err := p.t.storer.GetItemsContext(ctx, bundleRow.Id)
 	if err != nil {
 		slog.Error(
 			"Failed to retrieve items associated with the bundleId from data store",
@@ -286,6 +1380,7 @@ func (p *TelemetryProcessorImpl) ToItem(itemRow *TelemetryDataItemRow) (item *Te
 		TelemetryTimeStamp:   itemRow.ItemTimestamp,
 		TelemetryType:        itemRow.ItemType,
 		TelemetryAnnotations: annotations,
+		TelemetryClass:       headerClass(itemRow.ItemClass),
 	}
 
 	item = &TelemetryDataItem{
@@ -302,7 +1397,9 @@ func (p *TelemetryProcessorImpl) ToItem(itemRow *TelemetryDataItemRow) (item *Te
 	// verify that the checksum matches what was recorded in the DB
 	if item.Footer.Checksum != itemRow.ItemChecksum {
 		err = fmt.Errorf(
-			"item checksum mismatch after retrieving from data store: %q != %q",
+			"%w after retrieving item %q from data store: %q != %q",
+			ErrChecksumMismatch,
+			itemRow.ItemId,
 			item.Footer.Checksum,
 			itemRow.ItemChecksum,
 		)
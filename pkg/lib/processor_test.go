@@ -1,9 +1,15 @@
 package telemetrylib
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"os"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/SUSE/telemetry/pkg/config"
 	"github.com/SUSE/telemetry/pkg/types"
@@ -57,6 +63,7 @@ func (t *telemetryProcessorTestEnv) cleanup() {
 
 type TelemetryProcessorTestSuite struct {
 	suite.Suite
+	cfgPath    string
 	defaultEnv *telemetryProcessorTestEnv
 }
 
@@ -65,7 +72,7 @@ func (t *TelemetryProcessorTestSuite) TearDownSuite() {
 }
 
 func (t *TelemetryProcessorTestSuite) SetupTest() {
-	t.defaultEnv, _ = NewProcessorTestEnv("./testdata/config/processor/defaultEnvProcessor.yaml")
+	t.defaultEnv, _ = NewProcessorTestEnv(t.cfgPath)
 }
 
 func (t *TelemetryProcessorTestSuite) AfterTest() {
@@ -152,7 +159,7 @@ func (t *TelemetryProcessorTestSuite) TestReport() {
 	tests := []struct {
 		cfgPath string
 	}{
-		{"./testdata/config/processor/defaultEnvProcessor.yaml"},
+		{t.cfgPath},
 	}
 
 	for _, tt := range tests {
@@ -325,6 +332,1197 @@ func (t *TelemetryProcessorTestSuite) TestReport() {
 
 }
 
+func (t *TelemetryProcessorTestSuite) TestGenerateReportsWithSizeLimit() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+	processorImpl := telemetryprocessor.(*TelemetryProcessorImpl)
+	storer := &contentCountingStore{DataStore: processorImpl.t.storer}
+	processorImpl.t.storer = storer
+
+	// no reports are generated if there are no bundles
+	reportRows, err := telemetryprocessor.GenerateReports(env.cfg.ClientId, types.Tags{}, 0)
+	t.Require().NoError(err)
+	t.Empty(reportRows, "no reports should be generated without bundles")
+
+	// bundleItems returns the summaries of the bundle's items
+	bundleItems := func(bundleRow *TelemetryBundleRow) []*TelemetryStagedItemRow {
+		stagedRows, err := storer.GetStagedItemsContext(context.Background())
+		t.Require().NoError(err)
+		return slices.DeleteFunc(stagedRows, func(stagedRow *TelemetryStagedItemRow) bool {
+			return stagedRow.BundleId.Int64 != bundleRow.Id
+		})
+	}
+
+	// create 4 bundles, each containing 2 items
+	var bundleRows []*TelemetryBundleRow
+	var bundleSizes []int
+	for i := 0; i < 4; i++ {
+		t.Require().NoError(addDataItems(2, telemetryprocessor))
+		bundleRow, err := telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+		t.Require().NoError(err)
+		bundleRows = append(bundleRows, bundleRow)
+
+		size, err := processorImpl.bundleSize(context.Background(), bundleRow, bundleItems(bundleRow))
+		t.Require().NoError(err)
+		bundleSizes = append(bundleSizes, size)
+
+		// the calculated size matches the JSON encoded bundle
+		bundle, err := telemetryprocessor.ToBundle(bundleRow)
+		t.Require().NoError(err)
+		bundleJSON, err := json.Marshal(bundle)
+		t.Require().NoError(err)
+		t.Equal(len(bundleJSON), size, "bundle size should match its JSON encoding")
+	}
+	storer.contentReads = 0
+
+	// limit reports to the size of a report containing the first 2 bundles,
+	// allowing for variation in the length of report timestamps
+	_, overhead, err := newSizedReportRow(env.cfg.ClientId, types.Tags{})
+	t.Require().NoError(err)
+	maxSize := overhead + bundleSizes[0] + 1 + bundleSizes[1] + len(time.RFC3339Nano)
+
+	reportRows, err = telemetryprocessor.GenerateReports(env.cfg.ClientId, types.Tags{}, maxSize)
+	t.Require().NoError(err)
+	t.Require().Len(reportRows, 2, "bundles should have been split across 2 reports")
+	t.Equal(0, storer.contentReads, "item content shouldn't have been retrieved to size the bundles")
+
+	for _, reportRow := range reportRows {
+		count, _ := telemetryprocessor.BundleCount(reportRow.Id)
+		t.Equal(2, count, "each report should contain 2 bundles")
+
+		report, err := telemetryprocessor.ToReport(reportRow)
+		t.Require().NoError(err)
+		reportJSON, err := json.Marshal(report)
+		t.Require().NoError(err)
+		t.LessOrEqual(len(reportJSON), maxSize, "report should not exceed the size limit")
+	}
+
+	// the content of items staged before their sizes were recorded is
+	// retrieved to size their bundles
+	t.forgetItemContentSizes(storer.DataStore)
+	storer.contentReads = 0
+	size, err := processorImpl.bundleSize(context.Background(), bundleRows[0], bundleItems(bundleRows[0]))
+	t.Require().NoError(err)
+	t.Equal(bundleSizes[0], size)
+	t.Equal(2, storer.contentReads)
+
+	// a bundle exceeding the size limit on its own gets its own report
+	t.Require().NoError(addDataItems(2, telemetryprocessor))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+
+	reportRows, err = telemetryprocessor.GenerateReports(env.cfg.ClientId, types.Tags{}, 1)
+	t.Require().NoError(err)
+	t.Require().Len(reportRows, 1)
+
+	reportsCount, _ := telemetryprocessor.ReportCount()
+	t.Equal(3, reportsCount)
+}
+
+func (t *TelemetryProcessorTestSuite) TestGenerateBundlesWithPolicy() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+	storer := telemetryprocessor.(*TelemetryProcessorImpl).t.storer
+	ctx := context.Background()
+
+	// bundleItemCounts returns the number of items in each bundle
+	bundleItemCounts := func(bundleRows []*TelemetryBundleRow) (counts []int) {
+		for _, bundleRow := range bundleRows {
+			count, err := telemetryprocessor.ItemCount(bundleRow.Id)
+			t.Require().NoError(err)
+			counts = append(counts, count)
+		}
+		return
+	}
+
+	// addItem stages an item of the specified type and tags, staged at the
+	// specified time
+	addItem := func(telemetryType types.TelemetryType, tags types.Tags, staged time.Time) {
+		itemRow, err := NewTelemetryDataItemRow(telemetryType, tags, types.NewTelemetryBlob([]byte(`{"version":1}`)))
+		t.Require().NoError(err)
+		itemRow.ItemTimestamp = types.TelemetryTimeStamp{Time: staged}.String()
+		t.Require().NoError(storer.InsertItemContext(ctx, itemRow))
+	}
+
+	// no bundles are generated if there are no items
+	bundleRows, err := telemetryprocessor.GenerateBundles(env.cfg.ClientId, "customer id", types.Tags{}, nil)
+	t.Require().NoError(err)
+	t.Empty(bundleRows, "no bundles should be generated without items")
+	bundleCount, err := telemetryprocessor.BundleCount()
+	t.Require().NoError(err)
+	t.Equal(0, bundleCount, "no bundles should have been created")
+
+	// invalid policies are rejected
+	t.Require().NoError(addDataItems(1, telemetryprocessor))
+	for _, policy := range []*config.BundlingConfig{
+		{MaxItems: -1},
+		{MaxBytes: -1},
+		{TimeWindow: -time.Hour},
+		{GroupBy: []string{"customer"}},
+	} {
+		_, err = telemetryprocessor.GenerateBundles(env.cfg.ClientId, "customer id", types.Tags{}, policy)
+		t.Error(err, "policy %s should be rejected", policy.String())
+	}
+
+	// max_items limits the number of items per bundle
+	t.Require().NoError(addDataItems(4, telemetryprocessor))
+	bundleRows, err = telemetryprocessor.GenerateBundles(env.cfg.ClientId, "customer id", types.Tags{}, &config.BundlingConfig{MaxItems: 2})
+	t.Require().NoError(err)
+	t.Equal([]int{2, 2, 1}, bundleItemCounts(bundleRows))
+
+	// max_bytes limits the size of the items per bundle
+	t.Require().NoError(addDataItems(3, telemetryprocessor))
+	itemRows, err := telemetryprocessor.GetItemRows("NULL")
+	t.Require().NoError(err)
+	t.Require().Len(itemRows, 3)
+	itemSize := len(itemRows[0].ItemData)
+
+	bundleRows, err = telemetryprocessor.GenerateBundles(env.cfg.ClientId, "customer id", types.Tags{}, &config.BundlingConfig{MaxBytes: 2*itemSize + 1})
+	t.Require().NoError(err)
+	t.Equal([]int{2, 1}, bundleItemCounts(bundleRows))
+
+	// an item exceeding max_bytes on its own is bundled by itself
+	t.Require().NoError(addDataItems(2, telemetryprocessor))
+	bundleRows, err = telemetryprocessor.GenerateBundles(env.cfg.ClientId, "customer id", types.Tags{}, &config.BundlingConfig{MaxBytes: 1})
+	t.Require().NoError(err)
+	t.Equal([]int{1, 1}, bundleItemCounts(bundleRows))
+
+	// items are grouped by type and tags, ignoring the order of the tags
+	now := time.Now()
+	addItem("SLE-SERVER-Test", types.Tags{"key1", "key2"}, now)
+	addItem("SLE-SERVER-Pkg", types.Tags{"key1", "key2"}, now)
+	addItem("SLE-SERVER-Test", types.Tags{"key2", "key1"}, now)
+	addItem("SLE-SERVER-Test", types.Tags{"key3"}, now)
+	addItem("SLE-SERVER-Pkg", types.Tags{"key1", "key2"}, now)
+
+	bundleRows, err = telemetryprocessor.GenerateBundles(env.cfg.ClientId, "customer id", types.Tags{}, &config.BundlingConfig{GroupBy: []string{BUNDLE_GROUP_BY_TYPE, BUNDLE_GROUP_BY_TAGS}})
+	t.Require().NoError(err)
+	t.Require().Equal([]int{2, 2, 1}, bundleItemCounts(bundleRows))
+	for _, bundleRow := range bundleRows {
+		bundle, err := telemetryprocessor.ToBundle(bundleRow)
+		t.Require().NoError(err)
+		for _, item := range bundle.TelemetryDataItems {
+			t.Equal(bundle.TelemetryDataItems[0].Header.TelemetryType, item.Header.TelemetryType)
+		}
+	}
+
+	// items are bundled per time window, once the time window has ended
+	window := 24 * time.Hour
+	current := now.Truncate(window)
+	addItem("SLE-SERVER-Test", types.Tags{}, current.Add(-2*window))
+	addItem("SLE-SERVER-Test", types.Tags{}, current.Add(-window))
+	addItem("SLE-SERVER-Test", types.Tags{}, current.Add(-2*window+time.Hour))
+	addItem("SLE-SERVER-Test", types.Tags{}, current)
+
+	bundleRows, err = telemetryprocessor.GenerateBundles(env.cfg.ClientId, "customer id", types.Tags{}, &config.BundlingConfig{TimeWindow: window})
+	t.Require().NoError(err)
+	t.Equal([]int{2, 1}, bundleItemCounts(bundleRows))
+
+	unbundled, err := telemetryprocessor.ItemCount("NULL")
+	t.Require().NoError(err)
+	t.Equal(1, unbundled, "items in the current time window should not be bundled")
+}
+
+// contentCountingStore counts the staged items whose content is retrieved
+type contentCountingStore struct {
+	DataStore
+	contentReads int
+}
+
+func (s *contentCountingStore) GetItemsContext(ctx context.Context, bundleIds ...any) (itemRowIds []int64, itemRows []*TelemetryDataItemRow, err error) {
+	itemRowIds, itemRows, err = s.DataStore.GetItemsContext(ctx, bundleIds...)
+	s.contentReads += len(itemRows)
+	return
+}
+
+func (s *contentCountingStore) WalkItemsContext(ctx context.Context, fn func(itemRow *TelemetryDataItemRow) error, bundleIds ...any) error {
+	return s.DataStore.WalkItemsContext(
+		ctx,
+		func(itemRow *TelemetryDataItemRow) error {
+			s.contentReads++
+			return fn(itemRow)
+		},
+		bundleIds...,
+	)
+}
+
+func (t *TelemetryProcessorTestSuite) TestGenerateBundlesContentRetrieval() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+	impl := telemetryprocessor.(*TelemetryProcessorImpl)
+	storer := &contentCountingStore{DataStore: impl.t.storer}
+	impl.t.storer = storer
+
+	// item content isn't retrieved unless max_bytes needs its size
+	t.Require().NoError(addDataItems(3, telemetryprocessor))
+	bundleRows, err := telemetryprocessor.GenerateBundles(env.cfg.ClientId, "customer id", types.Tags{}, nil)
+	t.Require().NoError(err)
+	t.Len(bundleRows, 1)
+	t.Require().NoError(addDataItems(3, telemetryprocessor))
+	bundleRows, err = telemetryprocessor.GenerateBundles(env.cfg.ClientId, "customer id", types.Tags{}, &config.BundlingConfig{MaxItems: 2, GroupBy: []string{BUNDLE_GROUP_BY_TYPE, BUNDLE_GROUP_BY_TAGS}})
+	t.Require().NoError(err)
+	t.Len(bundleRows, 2)
+	t.Equal(0, storer.contentReads, "item content shouldn't have been retrieved")
+
+	// nor is it retrieved for max_bytes, the content sizes being recorded
+	t.Require().NoError(addDataItems(2, telemetryprocessor))
+	bundleRows, err = telemetryprocessor.GenerateBundles(env.cfg.ClientId, "customer id", types.Tags{}, &config.BundlingConfig{MaxBytes: 1})
+	t.Require().NoError(err)
+	t.Len(bundleRows, 2)
+	t.Equal(0, storer.contentReads, "item content shouldn't have been retrieved")
+
+	// only the unbundled items are retrieved if their sizes are unknown
+	t.Require().NoError(addDataItems(2, telemetryprocessor))
+	t.forgetItemContentSizes(storer.DataStore)
+	bundleRows, err = telemetryprocessor.GenerateBundles(env.cfg.ClientId, "customer id", types.Tags{}, &config.BundlingConfig{MaxBytes: 1})
+	t.Require().NoError(err)
+	t.Len(bundleRows, 2)
+	t.Equal(2, storer.contentReads, "only the unbundled item content should have been retrieved")
+}
+
+func (t *TelemetryProcessorTestSuite) TestEnforceStagingLimits() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+	storer := telemetryprocessor.(*TelemetryProcessorImpl).t.storer
+	ctx := context.Background()
+	now := time.Now()
+
+	// addItem stages an item of the specified type and class, staged the
+	// specified time ago, returning its id
+	content := []byte(`{"version":1}`)
+	addItem := func(telemetryType types.TelemetryType, class types.TelemetryClass, age time.Duration) string {
+		itemRow, err := NewTelemetryDataItemRowWithClass(telemetryType, class, types.Tags{}, types.NewTelemetryBlob(content))
+		t.Require().NoError(err)
+		itemRow.ItemTimestamp = types.TelemetryTimeStamp{Time: now.Add(-age)}.String()
+		t.Require().NoError(storer.InsertItemContext(ctx, itemRow))
+		return itemRow.ItemId
+	}
+
+	// stagedItemIds returns the ids of the remaining staged items
+	stagedItemIds := func() (itemIds []string) {
+		itemRows, err := telemetryprocessor.GetItemRows()
+		t.Require().NoError(err)
+		for _, itemRow := range itemRows {
+			itemIds = append(itemIds, itemRow.ItemId)
+		}
+		return
+	}
+
+	// nothing is evicted without limits
+	oldItem := addItem("SLE-SERVER-Test", types.OPT_IN_TELEMETRY, 48*time.Hour)
+	evictionRows, err := telemetryprocessor.EnforceStagingLimits(nil)
+	t.Require().NoError(err)
+	t.Empty(evictionRows)
+	evictionRows, err = telemetryprocessor.EnforceStagingLimits(&config.StagingConfig{})
+	t.Require().NoError(err)
+	t.Empty(evictionRows)
+
+	// invalid limits are rejected
+	for _, limits := range []*config.StagingConfig{
+		{MaxContentSize: -1},
+		{MaxAge: -time.Hour},
+		{MaxItemsPerType: -1},
+	} {
+		_, err = telemetryprocessor.EnforceStagingLimits(limits)
+		t.Error(err, "limits %s should be rejected", limits.String())
+	}
+
+	// items older than max_age are evicted, regardless of class
+	mandatoryOld := addItem("SLE-SERVER-Test", types.MANDATORY_TELEMETRY, 36*time.Hour)
+	mandatoryNew := addItem("SLE-SERVER-Test", types.MANDATORY_TELEMETRY, time.Hour)
+	evictionRows, err = telemetryprocessor.EnforceStagingLimits(&config.StagingConfig{MaxAge: 24 * time.Hour})
+	t.Require().NoError(err)
+	t.Require().Len(evictionRows, 2, "an eviction should be recorded for each class")
+	t.Equal(EVICTION_REASON_MAX_AGE, evictionRows[0].Reason)
+	t.Equal(types.OPT_IN_TELEMETRY, evictionRows[0].ItemClass)
+	t.Equal(1, evictionRows[0].ItemCount)
+	t.Equal(int64(len(content)), evictionRows[0].ItemBytes)
+	t.Equal(types.MANDATORY_TELEMETRY, evictionRows[1].ItemClass)
+	t.NotContains(stagedItemIds(), oldItem)
+	t.NotContains(stagedItemIds(), mandatoryOld)
+	t.Equal([]string{mandatoryNew}, stagedItemIds())
+
+	// opt-in items are evicted before opt-out items, before mandatory
+	// items, and then oldest first, to meet max_items_per_type
+	optOutOld := addItem("SLE-SERVER-Test", types.OPT_OUT_TELEMETRY, 3*time.Hour)
+	optOutNew := addItem("SLE-SERVER-Test", types.OPT_OUT_TELEMETRY, 2*time.Hour)
+	optIn := addItem("SLE-SERVER-Test", types.OPT_IN_TELEMETRY, 0)
+	otherType := addItem("SLE-SERVER-Pkg", types.OPT_IN_TELEMETRY, 0)
+	evictionRows, err = telemetryprocessor.EnforceStagingLimits(&config.StagingConfig{MaxItemsPerType: 2})
+	t.Require().NoError(err)
+	t.Require().Len(evictionRows, 2)
+	t.Equal(EVICTION_REASON_MAX_ITEMS_PER_TYPE, evictionRows[0].Reason)
+	t.Equal(types.OPT_IN_TELEMETRY, evictionRows[0].ItemClass)
+	t.Equal(types.OPT_OUT_TELEMETRY, evictionRows[1].ItemClass)
+	t.ElementsMatch([]string{mandatoryNew, optOutNew, otherType}, stagedItemIds())
+	t.NotContains(stagedItemIds(), optIn)
+	t.NotContains(stagedItemIds(), optOutOld)
+
+	// items are evicted, in eviction order, to meet max_content_size,
+	// along with any bundles and reports left empty as a result
+	bundleRow, err := telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+	_, err = telemetryprocessor.GenerateReport(env.cfg.ClientId, types.Tags{})
+	t.Require().NoError(err)
+	t.Require().NoError(addDataItems(1, telemetryprocessor))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+
+	evictionRows, err = telemetryprocessor.EnforceStagingLimits(&config.StagingConfig{MaxContentSize: 1})
+	t.Require().NoError(err)
+	t.Require().Len(evictionRows, 3)
+	for _, evictionRow := range evictionRows {
+		t.Equal(EVICTION_REASON_MAX_CONTENT_SIZE, evictionRow.Reason)
+	}
+	t.Equal(types.OPT_IN_TELEMETRY, evictionRows[0].ItemClass)
+	t.Equal(types.OPT_OUT_TELEMETRY, evictionRows[1].ItemClass)
+	t.Equal(types.MANDATORY_TELEMETRY, evictionRows[2].ItemClass)
+	t.Equal(2, evictionRows[2].ItemCount, "mandatory items of the same type should be recorded together")
+	t.Empty(stagedItemIds())
+
+	bundleCount, err := telemetryprocessor.BundleCount()
+	t.Require().NoError(err)
+	t.Equal(0, bundleCount, "bundle %q should have been deleted", bundleRow.BundleId)
+	reportCount, err := telemetryprocessor.ReportCount()
+	t.Require().NoError(err)
+	t.Equal(0, reportCount, "the report should have been deleted")
+
+	// the evictions are recorded until they are deleted
+	evictionRows, err = telemetryprocessor.GetEvictionRows()
+	t.Require().NoError(err)
+	t.Len(evictionRows, 7)
+	for _, evictionRow := range evictionRows {
+		t.Require().NoError(telemetryprocessor.DeleteEviction(evictionRow))
+	}
+	evictionRows, err = telemetryprocessor.GetEvictionRows()
+	t.Require().NoError(err)
+	t.Empty(evictionRows)
+}
+
+func (t *TelemetryProcessorTestSuite) TestEnforceStagingLimitsAtomically() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+
+	t.Require().NoError(addDataItems(2, telemetryprocessor))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+	t.Require().NoError(addDataItems(1, telemetryprocessor))
+
+	// prevent the evictions from being recorded
+	switch storer := telemetryprocessor.(*TelemetryProcessorImpl).t.storer.(type) {
+	case *DatabaseStore:
+		_, err = storer.Conn.Exec("DROP TABLE evictions")
+		t.Require().NoError(err)
+	case *SpoolStore:
+		evictionsDir := storer.tableDir(spoolEvictions)
+		t.Require().NoError(os.RemoveAll(evictionsDir))
+		t.Require().NoError(os.WriteFile(evictionsDir, nil, 0600))
+	default:
+		t.FailNow("unexpected datastore", storer.String())
+	}
+
+	// nothing should be evicted if the evictions can't be recorded
+	_, err = telemetryprocessor.EnforceStagingLimits(&config.StagingConfig{MaxContentSize: 1})
+	t.Require().Error(err)
+
+	itemCount, err := telemetryprocessor.ItemCount()
+	t.Require().NoError(err)
+	t.Equal(3, itemCount, "no items should have been evicted")
+	bundleCount, err := telemetryprocessor.BundleCount()
+	t.Require().NoError(err)
+	t.Equal(1, bundleCount, "the bundle should not have been deleted")
+}
+
+func (t *TelemetryProcessorTestSuite) TestEnforceStagingLimitsByStagedClass() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+
+	// stage mandatory items first, so that age alone would evict them
+	content := types.NewTelemetryBlob([]byte(`{"version":1}`))
+	t.Require().NoError(telemetryprocessor.AddData("SLE-SERVER-Test", content, types.Tags{}))
+	t.Require().NoError(telemetryprocessor.AddDataWithClass("SLE-SERVER-Test", types.MANDATORY_TELEMETRY, content, types.Tags{}))
+	t.Require().NoError(telemetryprocessor.AddDataWithClass("SLE-SERVER-Test", types.OPT_OUT_TELEMETRY, content, types.Tags{}))
+	t.Require().NoError(telemetryprocessor.AddDataWithClass("SLE-SERVER-Test", types.OPT_IN_TELEMETRY, content, types.Tags{}))
+
+	// the class each item was staged with is used to order evictions
+	evictionRows, err := telemetryprocessor.EnforceStagingLimits(&config.StagingConfig{MaxItemsPerType: 2})
+	t.Require().NoError(err)
+	t.Require().Len(evictionRows, 2)
+	t.Equal(types.OPT_IN_TELEMETRY, evictionRows[0].ItemClass)
+	t.Equal(types.OPT_OUT_TELEMETRY, evictionRows[1].ItemClass)
+
+	itemRows, err := telemetryprocessor.GetItemRows()
+	t.Require().NoError(err)
+	t.Require().Len(itemRows, 2)
+	for _, itemRow := range itemRows {
+		t.Equal(types.MANDATORY_TELEMETRY, itemRow.ItemClass)
+	}
+}
+
+func (t *TelemetryProcessorTestSuite) TestPurgeWithdrawnConsent() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+
+	cfg := config.NewDefaultConfig()
+	cfg.Enabled = true
+	cfg.ClassOptions.OptIn = true
+
+	content := types.NewTelemetryBlob([]byte(`{"version":1}`))
+	addItem := func(telemetryType types.TelemetryType, class types.TelemetryClass) {
+		t.Require().NoError(telemetryprocessor.AddDataWithClass(telemetryType, class, content, types.Tags{}))
+	}
+
+	// stagedItemTypes returns the types and classes of the remaining
+	// staged items
+	stagedItemTypes := func() (itemTypes []string) {
+		itemRows, err := telemetryprocessor.GetItemRows()
+		t.Require().NoError(err)
+		for _, itemRow := range itemRows {
+			itemTypes = append(itemTypes, itemRow.ItemType+"/"+itemRow.ItemClass.String())
+		}
+		return
+	}
+
+	// a relayed bundle of opt-in items, collected under the consent of
+	// another client
+	relayedClientId := uuid.New().String()
+	addItem("SLE-SERVER-Relayed", types.OPT_IN_TELEMETRY)
+	_, err = telemetryprocessor.GenerateBundle(relayedClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+	reportRow, err := telemetryprocessor.GenerateReport(relayedClientId, types.Tags{})
+	t.Require().NoError(err)
+	report, err := telemetryprocessor.ToReport(reportRow)
+	t.Require().NoError(err)
+	t.Require().NoError(telemetryprocessor.DeleteReport(reportRow))
+
+	// a reported opt-in item, a bundled opt-out item and unbundled items,
+	// including a managed client's opt-in item
+	addItem("SLE-SERVER-Test", types.OPT_IN_TELEMETRY)
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+	_, err = telemetryprocessor.GenerateReport(env.cfg.ClientId, types.Tags{})
+	t.Require().NoError(err)
+	_, err = telemetryprocessor.AddBundle(&report.TelemetryBundles[0], types.Tags{"RELAYED_VIA=1:2"})
+	t.Require().NoError(err)
+	addItem("SLE-SERVER-Test", types.OPT_OUT_TELEMETRY)
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+	addItem("SLE-SERVER-Test", types.MANDATORY_TELEMETRY)
+	addItem("SLE-SERVER-Denied", types.MANDATORY_TELEMETRY)
+	managedRow, err := telemetryprocessor.RegisterManagedClient("system-1")
+	t.Require().NoError(err)
+	t.Require().NoError(telemetryprocessor.AddManagedDataWithClass(managedRow, "SLE-SERVER-Test", types.OPT_IN_TELEMETRY, content, types.Tags{}))
+	_, err = telemetryprocessor.GenerateManagedBundles(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+
+	// nothing is purged while consent is given, or telemetry is disabled
+	evictionRows, err := telemetryprocessor.PurgeWithdrawnConsent(cfg)
+	t.Require().NoError(err)
+	t.Empty(evictionRows)
+	cfg.ClassOptions.OptIn = false
+	cfg.Enabled = false
+	evictionRows, err = telemetryprocessor.PurgeWithdrawnConsent(cfg)
+	t.Require().NoError(err)
+	t.Empty(evictionRows)
+	t.Len(stagedItemTypes(), 6)
+
+	// withdrawing opt-in consent purges the local and managed opt-in
+	// items, along with the bundles and report left empty as a result,
+	// but not the relayed items
+	cfg.Enabled = true
+	evictionRows, err = telemetryprocessor.PurgeWithdrawnConsent(cfg)
+	t.Require().NoError(err)
+	t.Require().Len(evictionRows, 1)
+	t.Equal(EVICTION_REASON_CLASS_WITHDRAWN, evictionRows[0].Reason)
+	t.Equal("SLE-SERVER-Test", evictionRows[0].ItemType)
+	t.Equal(types.OPT_IN_TELEMETRY, evictionRows[0].ItemClass)
+	t.Equal(2, evictionRows[0].ItemCount)
+	t.ElementsMatch(
+		[]string{
+			"SLE-SERVER-Relayed/OPT-IN",
+			"SLE-SERVER-Test/OPT-OUT",
+			"SLE-SERVER-Test/MANDATORY",
+			"SLE-SERVER-Denied/MANDATORY",
+		},
+		stagedItemTypes(),
+	)
+	bundleCount, err := telemetryprocessor.BundleCount()
+	t.Require().NoError(err)
+	t.Equal(2, bundleCount, "only the relayed and opt-out bundles should remain")
+	reportCount, err := telemetryprocessor.ReportCount()
+	t.Require().NoError(err)
+	t.Equal(0, reportCount, "the report should have been deleted")
+
+	// withdrawing opt-out consent, and denying a type, purges the
+	// matching items, even if they are mandatory
+	cfg.ClassOptions.OptOut = false
+	cfg.ClassOptions.Deny = []types.TelemetryType{"SLE-SERVER-Denied"}
+	evictionRows, err = telemetryprocessor.PurgeWithdrawnConsent(cfg)
+	t.Require().NoError(err)
+	t.Require().Len(evictionRows, 2)
+	t.Equal(EVICTION_REASON_CLASS_WITHDRAWN, evictionRows[0].Reason)
+	t.Equal(types.OPT_OUT_TELEMETRY, evictionRows[0].ItemClass)
+	t.Equal(EVICTION_REASON_TYPE_WITHDRAWN, evictionRows[1].Reason)
+	t.Equal("SLE-SERVER-Denied", evictionRows[1].ItemType)
+	t.ElementsMatch(
+		[]string{"SLE-SERVER-Relayed/OPT-IN", "SLE-SERVER-Test/MANDATORY"},
+		stagedItemTypes(),
+	)
+
+	// the purges are recorded as evictions
+	evictionRows, err = telemetryprocessor.GetEvictionRows()
+	t.Require().NoError(err)
+	t.Len(evictionRows, 3)
+}
+
+func (t *TelemetryProcessorTestSuite) TestSplitReport() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+
+	// create a report containing 2 bundles, the first with 3 items
+	// and the second with 1 item
+	t.Require().NoError(addDataItems(3, telemetryprocessor))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+	t.Require().NoError(addDataItems(1, telemetryprocessor))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+
+	reportRows, err := telemetryprocessor.GenerateReports(env.cfg.ClientId, types.Tags{types.Tag("key1")}, 0)
+	t.Require().NoError(err)
+	t.Require().Len(reportRows, 1)
+
+	// splitting a multi-bundle report splits the bundles between reports
+	splitRows, err := telemetryprocessor.SplitReport(reportRows[0])
+	t.Require().NoError(err)
+	t.Require().Len(splitRows, 2)
+
+	reportsCount, _ := telemetryprocessor.ReportCount()
+	t.Equal(2, reportsCount, "original report should have been replaced")
+	bundlesCount, _ := telemetryprocessor.BundleCount()
+	t.Equal(2, bundlesCount, "bundles should have been retained")
+	itemsCount, _ := telemetryprocessor.ItemCount()
+	t.Equal(4, itemsCount, "items should have been retained")
+
+	for _, splitRow := range splitRows {
+		t.Equal(reportRows[0].ReportAnnotations, splitRow.ReportAnnotations)
+		count, _ := telemetryprocessor.BundleCount(splitRow.Id)
+		t.Equal(1, count, "each split report should contain 1 bundle")
+	}
+
+	// splitting a single bundle report splits the items between bundles
+	itemSplitRows, err := telemetryprocessor.SplitReport(splitRows[0])
+	t.Require().NoError(err)
+	t.Require().Len(itemSplitRows, 2)
+
+	bundlesCount, _ = telemetryprocessor.BundleCount()
+	t.Equal(3, bundlesCount, "original bundle should have been replaced")
+	itemsCount, _ = telemetryprocessor.ItemCount()
+	t.Equal(4, itemsCount, "items should have been retained")
+
+	var itemCounts []int
+	for _, itemSplitRow := range itemSplitRows {
+		report, err := telemetryprocessor.ToReport(itemSplitRow)
+		t.Require().NoError(err, "split report should be valid")
+		t.Require().Len(report.TelemetryBundles, 1)
+		itemCounts = append(itemCounts, len(report.TelemetryBundles[0].TelemetryDataItems))
+	}
+	t.ElementsMatch([]int{1, 2}, itemCounts)
+
+	// a report with a single bundle containing a single item can't be split
+	_, err = telemetryprocessor.SplitReport(splitRows[1])
+	t.ErrorIs(err, ErrReportNotSplittable)
+}
+
+func (t *TelemetryProcessorTestSuite) TestSplitTelemetryReport() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+
+	// create a report containing 2 bundles, the first with 3 items
+	// and the second with 1 item
+	t.Require().NoError(addDataItems(3, telemetryprocessor))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+	t.Require().NoError(addDataItems(1, telemetryprocessor))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+
+	reportRow, err := telemetryprocessor.GenerateReport(env.cfg.ClientId, types.Tags{types.Tag("key1")})
+	t.Require().NoError(err)
+	report, err := telemetryprocessor.ToReport(reportRow)
+	t.Require().NoError(err)
+
+	// splitting a multi-bundle report splits the bundles between reports
+	splitReports, err := report.Split()
+	t.Require().NoError(err)
+	t.Require().Len(splitReports, 2)
+	for _, splitReport := range splitReports {
+		t.NotEqual(report.Header.ReportId, splitReport.Header.ReportId)
+		t.Equal(report.Header.ReportAnnotations, splitReport.Header.ReportAnnotations)
+		t.Require().Len(splitReport.TelemetryBundles, 1, "each split report should contain 1 bundle")
+		t.Require().NoError(splitReport.VerifyChecksum(), "split report checksum should be valid")
+		t.Require().NoError(splitReport.Validate(), "split report should be valid")
+	}
+
+	// splitting a single bundle report splits the items between bundles
+	itemSplitReports, err := splitReports[0].Split()
+	t.Require().NoError(err)
+	t.Require().Len(itemSplitReports, 2)
+
+	var itemCounts []int
+	for _, itemSplitReport := range itemSplitReports {
+		t.Require().Len(itemSplitReport.TelemetryBundles, 1)
+		t.NotEqual(splitReports[0].TelemetryBundles[0].Header.BundleId, itemSplitReport.TelemetryBundles[0].Header.BundleId)
+		t.Require().NoError(itemSplitReport.VerifyChecksum(), "split report checksum should be valid")
+		itemCounts = append(itemCounts, len(itemSplitReport.TelemetryBundles[0].TelemetryDataItems))
+	}
+	t.ElementsMatch([]int{1, 2}, itemCounts)
+
+	// a report with a single bundle containing a single item can't be split
+	_, err = splitReports[1].Split()
+	t.ErrorIs(err, ErrReportNotSplittable)
+}
+
+func (t *TelemetryProcessorTestSuite) TestSubmissionHistory() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+
+	// no submissions recorded initially
+	count, err := telemetryprocessor.SubmissionCount()
+	t.Require().NoError(err)
+	t.Equal(0, count)
+
+	// create a report with 2 bundles containing 3 items
+	t.Require().NoError(addDataItems(2, telemetryprocessor))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+	t.Require().NoError(addDataItems(1, telemetryprocessor))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+
+	reportRows, err := telemetryprocessor.GenerateReports(env.cfg.ClientId, types.Tags{}, 0)
+	t.Require().NoError(err)
+	t.Require().Len(reportRows, 1)
+
+	report, err := telemetryprocessor.ToReport(reportRows[0])
+	t.Require().NoError(err)
+
+	// record the submission, and delete the submitted report
+	processedAt := types.Now()
+	submissionRow := NewTelemetrySubmissionRow(report, "https://telemetry.example.com/", 1234, 2, 42, processedAt)
+	t.Require().NoError(telemetryprocessor.RecordSubmission(submissionRow))
+	t.Require().NoError(telemetryprocessor.DeleteReport(reportRows[0]))
+
+	// submission history should be retained after the report is deleted
+	count, err = telemetryprocessor.SubmissionCount(report.Header.ReportId)
+	t.Require().NoError(err)
+	t.Equal(1, count)
+
+	submissionRows, err := telemetryprocessor.GetSubmissionRows(report.Header.ReportId)
+	t.Require().NoError(err)
+	t.Require().Len(submissionRows, 1)
+
+	submission := submissionRows[0]
+	t.Equal(report.Header.ReportId, submission.ReportId)
+	t.Equal(
+		report.TelemetryBundles[0].Header.BundleId+","+report.TelemetryBundles[1].Header.BundleId,
+		submission.BundleIds,
+	)
+	t.Len(strings.Split(submission.ItemIds, ","), 3)
+	t.Equal("SLE-SERVER-Test,SLE-SERVER-Test,SLE-SERVER-Test", submission.ItemTypes)
+	t.Equal(1234, submission.Size)
+	t.Equal("https://telemetry.example.com/", submission.ServerUrl)
+	t.Equal(int64(42), submission.ProcessingId)
+	t.Equal(processedAt.String(), submission.ProcessedAt)
+	t.Equal(2, submission.Attempts)
+	t.NotEmpty(submission.SubmittedAt)
+
+	// unknown reports have no submission history
+	submissionRows, err = telemetryprocessor.GetSubmissionRows("unknown")
+	t.Require().NoError(err)
+	t.Empty(submissionRows)
+}
+
+func (t *TelemetryProcessorTestSuite) TestQuarantineReport() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+
+	// create two reports, each with a single bundle
+	var reportRows []*TelemetryReportRow
+	for i := 0; i < 2; i++ {
+		t.Require().NoError(addDataItems(1, telemetryprocessor))
+		_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+		t.Require().NoError(err)
+		reportRow, err := telemetryprocessor.GenerateReport(env.cfg.ClientId, types.Tags{})
+		t.Require().NoError(err)
+		reportRows = append(reportRows, reportRow)
+	}
+	poisonRow, otherRow := reportRows[0], reportRows[1]
+
+	// a report without recorded failures has an empty state
+	stateRow, err := telemetryprocessor.GetReportState(poisonRow)
+	t.Require().NoError(err)
+	t.Equal(0, stateRow.Attempts)
+	t.False(stateRow.Quarantined)
+
+	// first failure is recorded but doesn't quarantine the report
+	stateRow, err = telemetryprocessor.RecordReportFailure(poisonRow, "first failure", 2)
+	t.Require().NoError(err)
+	t.Equal(1, stateRow.Attempts)
+	t.False(stateRow.Quarantined)
+
+	pendingRows, err := telemetryprocessor.GetPendingReportRows()
+	t.Require().NoError(err)
+	t.Len(pendingRows, 2)
+
+	// second failure reaches the limit, quarantining the report
+	stateRow, err = telemetryprocessor.RecordReportFailure(poisonRow, "second failure", 2)
+	t.Require().NoError(err)
+	t.Equal(2, stateRow.Attempts)
+	t.True(stateRow.Quarantined)
+
+	stateRow, err = telemetryprocessor.GetReportState(poisonRow)
+	t.Require().NoError(err)
+	t.Equal(2, stateRow.Attempts)
+	t.True(stateRow.Quarantined)
+	t.Equal("second failure", stateRow.Reason)
+	t.NotEmpty(stateRow.UpdatedAt)
+
+	pendingRows, err = telemetryprocessor.GetPendingReportRows()
+	t.Require().NoError(err)
+	t.Require().Len(pendingRows, 1)
+	t.Equal(otherRow.ReportId, pendingRows[0].ReportId)
+
+	quarantinedRows, err := telemetryprocessor.GetQuarantinedReportRows()
+	t.Require().NoError(err)
+	t.Require().Len(quarantinedRows, 1)
+	t.Equal(poisonRow.ReportId, quarantinedRows[0].ReportId)
+
+	// quarantined reports are still reports
+	reportCount, err := telemetryprocessor.ReportCount()
+	t.Require().NoError(err)
+	t.Equal(2, reportCount)
+
+	// re-queueing the report makes it pending again, with no failures
+	t.Require().NoError(telemetryprocessor.RequeueReport(poisonRow))
+
+	quarantinedRows, err = telemetryprocessor.GetQuarantinedReportRows()
+	t.Require().NoError(err)
+	t.Empty(quarantinedRows)
+
+	stateRow, err = telemetryprocessor.GetReportState(poisonRow)
+	t.Require().NoError(err)
+	t.Equal(0, stateRow.Attempts)
+	t.False(stateRow.Quarantined)
+
+	// without a limit failures never quarantine a report
+	for i := 0; i < 10; i++ {
+		stateRow, err = telemetryprocessor.RecordReportFailure(otherRow, "failure", 0)
+		t.Require().NoError(err)
+		t.False(stateRow.Quarantined)
+	}
+
+	// reports can be explicitly quarantined
+	t.Require().NoError(telemetryprocessor.QuarantineReport(otherRow, "rejected"))
+
+	stateRow, err = telemetryprocessor.GetReportState(otherRow)
+	t.Require().NoError(err)
+	t.Equal(10, stateRow.Attempts)
+	t.True(stateRow.Quarantined)
+	t.Equal("rejected", stateRow.Reason)
+
+	pendingRows, err = telemetryprocessor.GetPendingReportRows()
+	t.Require().NoError(err)
+	t.Require().Len(pendingRows, 1)
+	t.Equal(poisonRow.ReportId, pendingRows[0].ReportId)
+
+	// deleting a quarantined report removes its state
+	t.Require().NoError(telemetryprocessor.DeleteReport(otherRow))
+
+	quarantinedRows, err = telemetryprocessor.GetQuarantinedReportRows()
+	t.Require().NoError(err)
+	t.Empty(quarantinedRows)
+
+	t.Equal(0, t.reportStateCount(telemetryprocessor))
+}
+
+func (t *TelemetryProcessorTestSuite) TestChecksumMismatch() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+
+	t.Require().NoError(addDataItems(1, telemetryprocessor))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+	reportRow, err := telemetryprocessor.GenerateReport(env.cfg.ClientId, types.Tags{})
+	t.Require().NoError(err)
+
+	// corrupt the recorded item checksum
+	t.corruptItemChecksums(telemetryprocessor)
+
+	_, err = telemetryprocessor.ToReport(reportRow)
+	t.Require().ErrorIs(err, ErrChecksumMismatch)
+}
+
+func (t *TelemetryProcessorTestSuite) TestWriteReport() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+
+	// a report with multiple bundles, including content that needs to be
+	// compacted and escaped when JSON encoded
+	t.Require().NoError(addDataItems(3, telemetryprocessor))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{"abc=pqr"})
+	t.Require().NoError(err)
+	payload := types.NewTelemetryBlob([]byte("{\n  \"version\": 1,\n  \"html\": \"<a href='x'>&</a>\"\n}"))
+	t.Require().NoError(telemetryprocessor.AddDataWithClass("SLE-SERVER-Test", types.OPT_OUT_TELEMETRY, payload, types.Tags{}))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+	reportRow, err := telemetryprocessor.GenerateReport(env.cfg.ClientId, types.Tags{"xyz=123"})
+	t.Require().NoError(err)
+
+	// the streamed report matches the JSON encoding of the in-memory report
+	report, err := telemetryprocessor.ToReport(reportRow)
+	t.Require().NoError(err)
+	expected, err := json.Marshal(report)
+	t.Require().NoError(err)
+
+	var streamed strings.Builder
+	summary, size, err := telemetryprocessor.WriteReport(reportRow, &streamed)
+	t.Require().NoError(err)
+	t.Equal(string(expected), streamed.String())
+	t.Equal(int64(len(expected)), size)
+
+	// the streamed report's checksums can be verified
+	var decoded TelemetryReport
+	t.Require().NoError(json.Unmarshal([]byte(streamed.String()), &decoded))
+	t.Require().NoError(decoded.VerifyChecksum())
+
+	// the summary describes the report, without the item content
+	t.Equal(report.Header, summary.Header)
+	t.Equal(report.Footer, summary.Footer)
+	t.Require().Len(summary.TelemetryBundles, 2)
+	for i, bundle := range summary.TelemetryBundles {
+		t.Equal(report.TelemetryBundles[i].Header, bundle.Header)
+		t.Equal(report.TelemetryBundles[i].Footer, bundle.Footer)
+		t.Require().Len(bundle.TelemetryDataItems, len(report.TelemetryBundles[i].TelemetryDataItems))
+		for j, item := range bundle.TelemetryDataItems {
+			t.Equal(report.TelemetryBundles[i].TelemetryDataItems[j].Header, item.Header)
+			t.Nil(item.TelemetryData)
+		}
+	}
+
+	// corrupted items are detected while writing
+	t.corruptItemChecksums(telemetryprocessor)
+	_, _, err = telemetryprocessor.WriteReport(reportRow, &strings.Builder{})
+	t.Require().ErrorIs(err, ErrChecksumMismatch)
+}
+
+func (t *TelemetryProcessorTestSuite) TestAddBundle() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+
+	// generate a report and convert it to its JSON representation, as a
+	// relay would receive it, then remove it from the data store
+	t.Require().NoError(addDataItems(3, telemetryprocessor))
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{"abc=pqr"})
+	t.Require().NoError(err)
+	reportRow, err := telemetryprocessor.GenerateReport(env.cfg.ClientId, types.Tags{})
+	t.Require().NoError(err)
+	report, err := telemetryprocessor.ToReport(reportRow)
+	t.Require().NoError(err)
+	t.Require().NoError(telemetryprocessor.DeleteReport(reportRow))
+
+	bundle := &report.TelemetryBundles[0]
+	bundleRow, err := telemetryprocessor.AddBundle(bundle, types.Tags{"RELAYED_VIA=1:2", "abc=pqr"})
+	t.Require().NoError(err)
+	t.Equal(bundle.Header.BundleId, bundleRow.BundleId)
+	t.Equal("abc=pqr,RELAYED_VIA=1:2", bundleRow.BundleAnnotations)
+
+	count, err := telemetryprocessor.ItemCount(bundleRow.Id)
+	t.Require().NoError(err)
+	t.Equal(3, count)
+
+	// adding the same bundle again is a no-op
+	_, err = telemetryprocessor.AddBundle(bundle, types.Tags{"RELAYED_VIA=1:2"})
+	t.Require().NoError(err)
+	count, err = telemetryprocessor.BundleCount()
+	t.Require().NoError(err)
+	t.Equal(1, count)
+	count, err = telemetryprocessor.ItemCount()
+	t.Require().NoError(err)
+	t.Equal(3, count)
+
+	// the staged bundle can be reported with its items intact
+	reportRow, err = telemetryprocessor.GenerateReport(env.cfg.ClientId, types.Tags{})
+	t.Require().NoError(err)
+	staged, err := telemetryprocessor.ToReport(reportRow)
+	t.Require().NoError(err)
+	t.Require().Len(staged.TelemetryBundles, 1)
+	t.Equal(bundle.TelemetryDataItems, staged.TelemetryBundles[0].TelemetryDataItems)
+	t.Equal([]string{"abc=pqr", "RELAYED_VIA=1:2"}, staged.TelemetryBundles[0].Header.BundleAnnotations)
+
+	// bundles with corrupted items are rejected
+	corrupt := *bundle
+	corrupt.Header.BundleId = "corrupt"
+	corrupt.TelemetryDataItems = append([]TelemetryDataItem{}, bundle.TelemetryDataItems...)
+	corrupt.TelemetryDataItems[0].Footer.Checksum = "corrupted"
+	_, err = telemetryprocessor.AddBundle(&corrupt, types.Tags{})
+	t.Require().ErrorIs(err, ErrChecksumMismatch)
+}
+
+func (t *TelemetryProcessorTestSuite) TestTelemetryClass() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+
+	// the class each item was collected under is carried into the report
+	classes := []types.TelemetryClass{types.MANDATORY_TELEMETRY, types.OPT_OUT_TELEMETRY, types.OPT_IN_TELEMETRY}
+	for _, class := range classes {
+		payload := types.NewTelemetryBlob([]byte(`{"version":1}`))
+		t.Require().NoError(telemetryprocessor.AddDataWithClass("SLE-SERVER-Test", class, payload, types.Tags{}))
+	}
+
+	// items added without a class are mandatory telemetry
+	payload := types.NewTelemetryBlob([]byte(`{"version":1}`))
+	t.Require().NoError(telemetryprocessor.AddData("SLE-SERVER-Test", payload, types.Tags{}))
+	classes = append(classes, types.MANDATORY_TELEMETRY)
+	_, err = telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+	reportRow, err := telemetryprocessor.GenerateReport(env.cfg.ClientId, types.Tags{})
+	t.Require().NoError(err)
+	report, err := telemetryprocessor.ToReport(reportRow)
+	t.Require().NoError(err)
+	t.Require().NoError(report.Validate())
+	t.Require().NoError(telemetryprocessor.DeleteReport(reportRow))
+
+	items := report.TelemetryBundles[0].TelemetryDataItems
+	t.Require().Len(items, len(classes))
+	for i, class := range classes {
+		itemClass, err := items[i].Header.Class()
+		t.Require().NoError(err)
+		t.Equal(class, itemClass)
+	}
+
+	// mandatory items don't specify their class, so that servers that
+	// predate telemetry classes calculate the same checksums
+	t.Empty(items[0].Header.TelemetryClass)
+	itemJSON, err := json.Marshal(&items[0])
+	t.Require().NoError(err)
+	t.NotContains(string(itemJSON), "telemetryClass")
+	t.Equal("OPT-OUT", items[1].Header.TelemetryClass)
+
+	// relayed items retain their class, with items from older clients,
+	// which don't specify one, being treated as mandatory
+	bundle := report.TelemetryBundles[0]
+	bundle.TelemetryDataItems = append([]TelemetryDataItem{}, items...)
+	bundle.TelemetryDataItems[2].Header.TelemetryClass = ""
+	_, err = telemetryprocessor.AddBundle(&bundle, types.Tags{})
+	t.Require().NoError(err)
+
+	reportRow, err = telemetryprocessor.GenerateReport(env.cfg.ClientId, types.Tags{})
+	t.Require().NoError(err)
+	staged, err := telemetryprocessor.ToReport(reportRow)
+	t.Require().NoError(err)
+	stagedItems := staged.TelemetryBundles[0].TelemetryDataItems
+	t.Require().Len(stagedItems, len(classes))
+	t.Equal("", stagedItems[0].Header.TelemetryClass)
+	t.Equal("OPT-OUT", stagedItems[1].Header.TelemetryClass)
+	t.Equal("", stagedItems[2].Header.TelemetryClass)
+
+	// relayed items with an unknown class are rejected
+	bundle.Header.BundleId = "unknown-class"
+	bundle.TelemetryDataItems[0].Header.TelemetryClass = "UNKNOWN"
+	_, err = telemetryprocessor.AddBundle(&bundle, types.Tags{})
+	t.Require().Error(err)
+}
+
+func (t *TelemetryProcessorTestSuite) TestManagedClients() {
+	env, err := NewProcessorTestEnv(t.cfgPath)
+	t.Require().NoError(err)
+	env.cleanup()
+	env.setup()
+	defer env.cleanup()
+	telemetryprocessor := env.telemetryprocessor
+
+	// managed clients are persistently assigned a unique client id
+	sys1, err := telemetryprocessor.RegisterManagedClient("system-1")
+	t.Require().NoError(err)
+	sys1Again, err := telemetryprocessor.RegisterManagedClient("system-1")
+	t.Require().NoError(err)
+	t.Equal(sys1.ClientId, sys1Again.ClientId)
+	t.Equal(sys1.Id, sys1Again.Id)
+	sys2, err := telemetryprocessor.RegisterManagedClient("system-2")
+	t.Require().NoError(err)
+	t.NotEqual(sys1.ClientId, sys2.ClientId)
+
+	_, err = telemetryprocessor.RegisterManagedClient("")
+	t.Require().Error(err)
+
+	managedRows, err := telemetryprocessor.GetManagedClientRows()
+	t.Require().NoError(err)
+	t.Len(managedRows, 2)
+
+	// stage items for the local client and the managed clients
+	t.Require().NoError(addDataItems(1, telemetryprocessor))
+	content := types.NewTelemetryBlob([]byte(`{"version":1,"data":{"managed":true}}`))
+	for _, managedRow := range []*TelemetryManagedClientRow{sys1, sys1, sys2} {
+		err = telemetryprocessor.AddManagedData(managedRow, "SLE-SERVER-Test", content, types.Tags{})
+		t.Require().NoError(err)
+	}
+
+	// the local client's bundle excludes the managed items
+	localBundle, err := telemetryprocessor.GenerateBundle(env.cfg.ClientId, "customer id", types.Tags{})
+	t.Require().NoError(err)
+	count, err := telemetryprocessor.ItemCount(localBundle.Id)
+	t.Require().NoError(err)
+	t.Equal(1, count)
+
+	// each managed client gets its own annotated bundle
+	bundleRows, err := telemetryprocessor.GenerateManagedBundles("framework-id", "customer id", types.Tags{"abc=pqr"})
+	t.Require().NoError(err)
+	t.Require().Len(bundleRows, 2)
+	for i, expected := range []struct {
+		managedRow *TelemetryManagedClientRow
+		items      int
+	}{
+		{sys1, 2},
+		{sys2, 1},
+	} {
+		t.Equal(expected.managedRow.ClientId, bundleRows[i].BundleClientId)
+		t.Equal(
+			"abc=pqr,RELAYED_VIA="+expected.managedRow.ClientId+":framework-id",
+			bundleRows[i].BundleAnnotations,
+		)
+		count, err := telemetryprocessor.ItemCount(bundleRows[i].Id)
+		t.Require().NoError(err)
+		t.Equal(expected.items, count)
+	}
+
+	// no bundles are generated if no managed items are staged
+	bundleRows, err = telemetryprocessor.GenerateManagedBundles("framework-id", "customer id", types.Tags{})
+	t.Require().NoError(err)
+	t.Empty(bundleRows)
+
+	// all bundles are aggregated into a single report
+	reportRow, err := telemetryprocessor.GenerateReport(env.cfg.ClientId, types.Tags{})
+	t.Require().NoError(err)
+	report, err := telemetryprocessor.ToReport(reportRow)
+	t.Require().NoError(err)
+	t.Len(report.TelemetryBundles, 3)
+}
+
+// reportStateCount returns the number of report states in the datastore
+func (t *TelemetryProcessorTestSuite) reportStateCount(processor TelemetryProcessor) (count int) {
+	switch store := processor.(*TelemetryProcessorImpl).t.storer.(type) {
+	case *DatabaseStore:
+		t.Require().NoError(store.Conn.QueryRow(`SELECT COUNT(id) FROM reportStates`).Scan(&count))
+	case *SpoolStore:
+		entries, err := store.listSpoolEntries(context.Background(), spoolReportStates)
+		t.Require().NoError(err)
+		count = len(entries)
+	default:
+		t.FailNow("unsupported datastore", "%T", store)
+	}
+	return
+}
+
+// corruptItemChecksums overwrites the recorded checksum of all items
+func (t *TelemetryProcessorTestSuite) corruptItemChecksums(processor TelemetryProcessor) {
+	switch store := processor.(*TelemetryProcessorImpl).t.storer.(type) {
+	case *DatabaseStore:
+		_, err := store.Conn.Exec(`UPDATE items SET itemChecksum = 'corrupted'`)
+		t.Require().NoError(err)
+	case *SpoolStore:
+		items, err := store.readItems(context.Background(), allSpoolRows)
+		t.Require().NoError(err)
+		for _, item := range items {
+			item.ItemChecksum = "corrupted"
+			entry := spoolEntry{id: item.Id, parent: item.BundleId}
+			t.Require().NoError(store.updateRow(spoolItems, entry, item))
+		}
+	default:
+		t.FailNow("unsupported datastore", "%T", store)
+	}
+}
+
+// forgetItemContentSizes clears the recorded content sizes of the staged
+// items, as for items staged before the sizes were recorded
+func (t *TelemetryProcessorTestSuite) forgetItemContentSizes(storer DataStore) {
+	switch store := storer.(type) {
+	case *DatabaseStore:
+		_, err := store.Conn.Exec(`UPDATE items SET itemContentSize = NULL`)
+		t.Require().NoError(err)
+	case *SpoolStore:
+		items, err := store.readItems(context.Background(), allSpoolRows)
+		t.Require().NoError(err)
+		for _, item := range items {
+			item.ContentSize = 0
+			entry := spoolEntry{id: item.Id, parent: item.BundleId}
+			t.Require().NoError(store.updateRow(spoolItems, entry, item))
+		}
+	default:
+		t.FailNow("unsupported datastore", "%T", store)
+	}
+}
+
 func addDataItems(totalItems int, processor TelemetryProcessor) error {
 
 	telemetryType := types.TelemetryType("SLE-SERVER-Test")
@@ -359,5 +1557,12 @@ func addDataItems(totalItems int, processor TelemetryProcessor) error {
 }
 
 func TestTelemetryProcessorTestSuite(t *testing.T) {
-	suite.Run(t, new(TelemetryProcessorTestSuite))
+	if !sqlite3Available {
+		t.Skip("sqlite3 datastore requires cgo")
+	}
+	suite.Run(t, &TelemetryProcessorTestSuite{cfgPath: "./testdata/config/processor/defaultEnvProcessor.yaml"})
+}
+
+func TestTelemetryProcessorSpoolTestSuite(t *testing.T) {
+	suite.Run(t, &TelemetryProcessorTestSuite{cfgPath: "./testdata/config/processor/spoolEnvProcessor.yaml"})
 }
@@ -1,6 +1,7 @@
 package telemetrylib
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
@@ -99,6 +100,45 @@ func NewTelemetryReport(clientId string, tags types.Tags) (*TelemetryReport, err
 	return tr, nil
 }
 
+// Split splits the report into two smaller reports, preserving the
+// report's details other than its id, in the same way that SplitReport
+// splits a staged report: the bundles are split evenly between the new
+// reports, or if there is only one bundle, its data items are split evenly
+// between two new bundles. Fails with ErrReportNotSplittable if the report
+// can't be split further.
+func (tr *TelemetryReport) Split() (reports []*TelemetryReport, err error) {
+	var groups [][]TelemetryBundle
+	switch {
+	case len(tr.TelemetryBundles) > 1:
+		half := len(tr.TelemetryBundles) / 2
+		groups = [][]TelemetryBundle{tr.TelemetryBundles[:half], tr.TelemetryBundles[half:]}
+
+	case len(tr.TelemetryBundles) == 1:
+		bundles, err := tr.TelemetryBundles[0].split()
+		if err != nil {
+			return nil, err
+		}
+		groups = [][]TelemetryBundle{{*bundles[0]}, {*bundles[1]}}
+
+	default:
+		return nil, fmt.Errorf("%w: report %q has no bundles", ErrReportNotSplittable, tr.Header.ReportId)
+	}
+
+	for _, group := range groups {
+		report := &TelemetryReport{
+			Header:           tr.Header,
+			TelemetryBundles: group,
+		}
+		report.Header.ReportId = uuid.New().String()
+		if err = report.UpdateChecksum(); err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return
+}
+
 type TelemetryReportHeader struct {
 	// NOTE: omitempty option used in json tags to support generating test scenarios
 	ReportId          string   `json:"reportId,omitempty" validate:"required,uuid|uuid_rfc4122"`
@@ -112,16 +152,6 @@ type TelemetryReportFooter struct {
 	Checksum string `json:"checksum,omitempty" validate:"omitempty,md5"`
 }
 
-// Database
-const reportsColumns = `(
-	id INTEGER NOT NULL PRIMARY KEY,
-	reportId VARCHAR(64) NOT NULL,
-	reportTimestamp VARCHAR(32) NOT NULL,
-	reportClientId VARCHAR NOT NULL,
-	reportAnnotations TEXT,
-	reportChecksum VARCHAR(256)
-)`
-
 type TelemetryReportRow struct {
 	Id                int64
 	ReportId          string
@@ -147,6 +177,16 @@ func NewTelemetryReportRow(clientId string, tags types.Tags) (*TelemetryReportRo
 
 }
 
+// header returns the TelemetryReportHeader corresponding to the report row
+func (r *TelemetryReportRow) header() TelemetryReportHeader {
+	return TelemetryReportHeader{
+		ReportId:          r.ReportId,
+		ReportTimeStamp:   r.ReportTimestamp,
+		ReportClientId:    r.ReportClientId,
+		ReportAnnotations: strings.Split(r.ReportAnnotations, ","),
+	}
+}
+
 func (r *TelemetryReportRow) Exists(db *sql.DB) bool {
 	row := db.QueryRow(`SELECT id FROM reports WHERE reportId = ?`, r.ReportId)
 	if err := row.Scan(&r.Id); err != nil {
@@ -163,7 +203,31 @@ func (r *TelemetryReportRow) Exists(db *sql.DB) bool {
 }
 
 func (r *TelemetryReportRow) Insert(db *sql.DB, bundleIDs []int64) (reportId string, err error) {
-	res, err := db.Exec(
+	return r.InsertContext(context.Background(), db, bundleIDs)
+}
+
+func (r *TelemetryReportRow) InsertContext(ctx context.Context, db *sql.DB, bundleIDs []int64) (reportId string, err error) {
+	// the report is inserted, and its bundles updated, atomically
+	err = withTx(ctx, db, func(tx *sql.Tx) error {
+		return r.insert(ctx, tx, bundleIDs, sql.NullInt64{})
+	})
+	if err != nil {
+		return
+	}
+
+	reportId = r.ReportId
+
+	return
+}
+
+// insert inserts the report, moving the specified bundles that are
+// associated with the fromReportId report, or with no report if
+// fromReportId is NULL, to the new report; bundles that have since been
+// moved to another report, e.g. by another process, are skipped, failing
+// if none of the bundles could be moved.
+func (r *TelemetryReportRow) insert(ctx context.Context, db sqlExecer, bundleIDs []int64, fromReportId sql.NullInt64) (err error) {
+	res, err := db.ExecContext(
+		ctx,
 		`INSERT INTO Reports(ReportId, ReportTimestamp, ReportClientId, ReportAnnotations) VALUES(?, ?, ?, ?)`,
 		r.ReportId, r.ReportTimestamp, r.ReportClientId, r.ReportAnnotations,
 	)
@@ -173,7 +237,7 @@ func (r *TelemetryReportRow) Insert(db *sql.DB, bundleIDs []int64) (reportId str
 			slog.String("reportId", r.ReportId),
 			slog.String("err", err.Error()),
 		)
-		return reportId, err
+		return
 	}
 	id, err := res.LastInsertId()
 	if err != nil {
@@ -182,27 +246,46 @@ func (r *TelemetryReportRow) Insert(db *sql.DB, bundleIDs []int64) (reportId str
 			slog.String("reportId", r.ReportId),
 			slog.String("err", err.Error()),
 		)
-		return reportId, err
+		return
 	}
 	r.Id = id
 
 	// Update the reportId of the bundles
+	var moved int64
 	for _, bundleID := range bundleIDs {
-		_, err := db.Exec("UPDATE bundles SET ReportId = ? WHERE id = ?", r.Id, bundleID)
+		res, err := db.ExecContext(
+			ctx,
+			"UPDATE bundles SET ReportId = ? WHERE id = ? AND reportId IS ?",
+			r.Id, bundleID, fromReportId,
+		)
 		if err != nil {
 			slog.Error(
 				"Failed to update reportId in bundle",
 				slog.Int64("bundleId", bundleID),
 				slog.String("error", err.Error()),
 			)
-			return "", err
+			return err
 		}
+
+		count, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		moved += count
 	}
-	reportId = r.ReportId
+
+	if moved == 0 {
+		return fmt.Errorf("%w: report %q", ErrNoUnreportedBundles, r.ReportId)
+	}
+
 	return
 }
 
 func (r *TelemetryReportRow) Delete(db *sql.DB) (err error) {
-	_, err = db.Exec("DELETE FROM reports WHERE reportId = ?", r.ReportId)
+	return r.DeleteContext(context.Background(), db)
+}
+
+func (r *TelemetryReportRow) DeleteContext(ctx context.Context, db *sql.DB) (err error) {
+	_, err = db.ExecContext(ctx, "DELETE FROM reports WHERE reportId = ?", r.ReportId)
 	return
 }
@@ -0,0 +1,66 @@
+package telemetrylib
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/SUSE/telemetry/pkg/types"
+)
+
+// TelemetryReportStateRow tracks the failed submission attempts for a
+// report, and whether the report has been quarantined, in which case it
+// will not be submitted until it has been re-queued. Reports without an
+// associated state row have no recorded failures.
+type TelemetryReportStateRow struct {
+	Id          int64
+	ReportId    int64
+	Attempts    int
+	Quarantined bool
+	Reason      string
+	UpdatedAt   string
+}
+
+func NewTelemetryReportStateRow(reportRow *TelemetryReportRow) *TelemetryReportStateRow {
+	return &TelemetryReportStateRow{
+		ReportId: reportRow.Id,
+	}
+}
+
+func (s *TelemetryReportStateRow) Upsert(db *sql.DB) (err error) {
+	return s.UpsertContext(context.Background(), db)
+}
+
+func (s *TelemetryReportStateRow) UpsertContext(ctx context.Context, db *sql.DB) (err error) {
+	s.UpdatedAt = types.Now().String()
+
+	_, err = db.ExecContext(
+		ctx,
+		`INSERT INTO reportStates(reportId, attempts, quarantined, reason, updatedAt) VALUES(?, ?, ?, ?, ?)
+		 ON CONFLICT(reportId) DO UPDATE SET
+		   attempts = excluded.attempts,
+		   quarantined = excluded.quarantined,
+		   reason = excluded.reason,
+		   updatedAt = excluded.updatedAt`,
+		s.ReportId, s.Attempts, s.Quarantined, s.Reason, s.UpdatedAt,
+	)
+	if err != nil {
+		slog.Error(
+			"failed to update report state entry",
+			slog.Int64("reportId", s.ReportId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+func (s *TelemetryReportStateRow) Delete(db *sql.DB) (err error) {
+	return s.DeleteContext(context.Background(), db)
+}
+
+func (s *TelemetryReportStateRow) DeleteContext(ctx context.Context, db *sql.DB) (err error) {
+	_, err = db.ExecContext(ctx, "DELETE FROM reportStates WHERE reportId = ?", s.ReportId)
+	return
+}
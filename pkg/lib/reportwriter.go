@@ -0,0 +1,228 @@
+package telemetrylib
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// countingWriter counts the bytes written to the underlying writer
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.count += int64(n)
+	return
+}
+
+// reportWriter writes the JSON encoding of a staged report, one data item
+// at a time, producing exactly the same output as json.Marshal() would for
+// the equivalent TelemetryReport. The bundle and report checksums, which
+// are the MD5 hashes of the JSON encoded data items and bundles lists, are
+// calculated from the content as it is written, with each footer being
+// written once its checksum is known.
+type reportWriter struct {
+	p        *TelemetryProcessorImpl
+	out      *countingWriter
+	validate *validator.Validate
+
+	// summary of the written report, without the item content
+	summary *TelemetryReport
+}
+
+// write writes the JSON encoding of the value to each of the writers
+func (rw *reportWriter) write(value any, writers ...io.Writer) (err error) {
+	var content []byte
+	switch v := value.(type) {
+	case string:
+		content = []byte(v)
+	default:
+		if content, err = json.Marshal(v); err != nil {
+			return
+		}
+	}
+
+	_, err = io.MultiWriter(writers...).Write(content)
+	return
+}
+
+// checksum returns the hex encoded hash
+func checksum(hasher hash.Hash) string {
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+func (rw *reportWriter) writeReport(ctx context.Context, reportRow *TelemetryReportRow) (err error) {
+	header := reportRow.header()
+	if err = rw.validate.Struct(&header); err != nil {
+		return fmt.Errorf("report struct validation check failed: %w", err)
+	}
+
+	_, bundleRows, err := rw.p.t.storer.GetBundlesContext(ctx, reportRow.Id)
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve bundles associated with reportId from data store",
+			slog.String("reportId", reportRow.ReportId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+	if len(bundleRows) == 0 {
+		return fmt.Errorf("report struct validation check failed: report %q has no bundles", reportRow.ReportId)
+	}
+
+	rw.summary = &TelemetryReport{Header: header}
+
+	if err = rw.write(`{"header":`, rw.out); err != nil {
+		return
+	}
+	if err = rw.write(&header, rw.out); err != nil {
+		return
+	}
+
+	// the report checksum covers the bundles list
+	reportHasher := md5.New()
+	if err = rw.write(`,"telemetryBundles":`, rw.out); err != nil {
+		return
+	}
+	if err = rw.write(`[`, rw.out, reportHasher); err != nil {
+		return
+	}
+	for i, bundleRow := range bundleRows {
+		if i > 0 {
+			if err = rw.write(`,`, rw.out, reportHasher); err != nil {
+				return
+			}
+		}
+		if err = rw.writeBundle(ctx, bundleRow, reportHasher); err != nil {
+			return
+		}
+	}
+	if err = rw.write(`]`, rw.out, reportHasher); err != nil {
+		return
+	}
+
+	rw.summary.Footer.Checksum = checksum(reportHasher)
+	if err = rw.write(`,"footer":`, rw.out); err != nil {
+		return
+	}
+	if err = rw.write(&rw.summary.Footer, rw.out); err != nil {
+		return
+	}
+
+	return rw.write(`}`, rw.out)
+}
+
+func (rw *reportWriter) writeBundle(ctx context.Context, bundleRow *TelemetryBundleRow, reportHasher hash.Hash) (err error) {
+	bundle := TelemetryBundle{Header: bundleRow.header()}
+	if err = rw.validate.Struct(&bundle.Header); err != nil {
+		return fmt.Errorf("report struct validation check failed: %w", err)
+	}
+
+	if err = rw.write(`{"header":`, rw.out, reportHasher); err != nil {
+		return
+	}
+	if err = rw.write(&bundle.Header, rw.out, reportHasher); err != nil {
+		return
+	}
+
+	// the bundle checksum covers the data items list
+	bundleHasher := md5.New()
+	if err = rw.write(`,"telemetryDataItems":`, rw.out, reportHasher); err != nil {
+		return
+	}
+	if err = rw.write(`[`, rw.out, reportHasher, bundleHasher); err != nil {
+		return
+	}
+	err = rw.p.t.storer.WalkItemsContext(
+		ctx,
+		func(itemRow *TelemetryDataItemRow) (err error) {
+			// ToItem verifies the item checksum
+			item, err := rw.p.ToItem(itemRow)
+			if err != nil {
+				return
+			}
+			// validating the header and footer separately avoids diving
+			// through every byte of the item content
+			if err = rw.validate.Struct(&item.Header); err != nil {
+				return fmt.Errorf("report struct validation check failed: %w", err)
+			}
+			if err = rw.validate.Struct(&item.Footer); err != nil {
+				return fmt.Errorf("report struct validation check failed: %w", err)
+			}
+			if len(item.TelemetryData) == 0 {
+				return fmt.Errorf("report struct validation check failed: item %q has no content", item.Header.TelemetryId)
+			}
+
+			if len(bundle.TelemetryDataItems) > 0 {
+				if err = rw.write(`,`, rw.out, reportHasher, bundleHasher); err != nil {
+					return
+				}
+			}
+			if err = rw.write(item, rw.out, reportHasher, bundleHasher); err != nil {
+				return
+			}
+
+			// retain only the item header and footer in the summary
+			item.TelemetryData = nil
+			bundle.TelemetryDataItems = append(bundle.TelemetryDataItems, *item)
+			return
+		},
+		bundleRow.Id,
+	)
+	if err != nil {
+		slog.Error(
+			"Failed to write bundle from datastore content",
+			slog.String("bundleRow", bundleRow.BundleId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+	if len(bundle.TelemetryDataItems) == 0 {
+		return fmt.Errorf("report struct validation check failed: bundle %q has no data items", bundleRow.BundleId)
+	}
+	if err = rw.write(`]`, rw.out, reportHasher, bundleHasher); err != nil {
+		return
+	}
+
+	bundle.Footer.Checksum = checksum(bundleHasher)
+	if err = rw.write(`,"footer":`, rw.out, reportHasher); err != nil {
+		return
+	}
+	if err = rw.write(&bundle.Footer, rw.out, reportHasher); err != nil {
+		return
+	}
+	if err = rw.write(`}`, rw.out, reportHasher); err != nil {
+		return
+	}
+
+	rw.summary.TelemetryBundles = append(rw.summary.TelemetryBundles, bundle)
+	return
+}
+
+func (p *TelemetryProcessorImpl) WriteReport(reportRow *TelemetryReportRow, w io.Writer) (summary *TelemetryReport, size int64, err error) {
+	return p.WriteReportContext(context.Background(), reportRow, w)
+}
+
+func (p *TelemetryProcessorImpl) WriteReportContext(ctx context.Context, reportRow *TelemetryReportRow, w io.Writer) (summary *TelemetryReport, size int64, err error) {
+	rw := &reportWriter{
+		p:        p,
+		out:      &countingWriter{w: w},
+		validate: validator.New(validator.WithRequiredStructEnabled()),
+	}
+
+	if err = rw.writeReport(ctx, reportRow); err != nil {
+		return nil, rw.out.count, err
+	}
+
+	return rw.summary, rw.out.count, nil
+}
@@ -0,0 +1,184 @@
+package telemetrylib
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/SUSE/telemetry/pkg/limits"
+	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/google/uuid"
+)
+
+const (
+	benchReportItemsPerBundle = 50
+
+	// loading reports with more maximum size items than this into memory,
+	// as ToReport() does, needs more memory than many systems have
+	benchInMemoryMaxItems = 50
+)
+
+// numbers of maximum size items in the benchmarked reports
+var benchReportItems = []int{50, 200}
+
+// benchItemPayload returns a maximum size JSON telemetry payload, whose
+// data is random hex content, so that it doesn't compress unrealistically
+// well when staged.
+func benchItemPayload(rng *rand.Rand, index int) []byte {
+	prefix := fmt.Sprintf(`{"version":1,"index":%d,"data":"`, index)
+	suffix := `"}`
+
+	data := make([]byte, (int(limits.TELEMETRY_DATA_MAX_SIZE)-len(prefix)-len(suffix))/2)
+	rng.Read(data)
+
+	payload := make([]byte, 0, limits.TELEMETRY_DATA_MAX_SIZE)
+	payload = append(payload, prefix...)
+	payload = hex.AppendEncode(payload, data)
+	return append(payload, suffix...)
+}
+
+// setupBenchReport stages a report containing the specified number of
+// maximum size data items, using the specified datastore driver.
+func setupBenchReport(b *testing.B, driver, params string, numItems int) (processor TelemetryProcessor, reportRow *TelemetryReportRow) {
+	b.Helper()
+
+	processor, err := NewTelemetryProcessor(&config.DBConfig{Driver: driver, Params: params})
+	if err != nil {
+		b.Fatalf("failed to setup %s telemetry processor: %s", driver, err.Error())
+	}
+	b.Cleanup(func() { processor.cleanup() })
+
+	clientId := uuid.NewString()
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < numItems; i++ {
+		payload := types.NewTelemetryBlob(benchItemPayload(rng, i))
+		if err = processor.AddData("SLE-SERVER-Bench", payload, types.Tags{}); err != nil {
+			b.Fatalf("failed to add data item %d: %s", i, err.Error())
+		}
+
+		if (i+1)%benchReportItemsPerBundle == 0 || i+1 == numItems {
+			if _, err = processor.GenerateBundle(clientId, "customer id", types.Tags{}); err != nil {
+				b.Fatalf("failed to generate bundle: %s", err.Error())
+			}
+		}
+	}
+
+	if reportRow, err = processor.GenerateReport(clientId, types.Tags{}); err != nil {
+		b.Fatalf("failed to generate report: %s", err.Error())
+	}
+
+	return
+}
+
+// heapSampler periodically samples the in use heap size, tracking the
+// peak size seen since it was started.
+type heapSampler struct {
+	peak uint64
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func startHeapSampler() *heapSampler {
+	runtime.GC()
+
+	h := &heapSampler{stop: make(chan struct{})}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			h.peak = max(h.peak, stats.HeapInuse)
+
+			select {
+			case <-h.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return h
+}
+
+// report stops the sampler and reports the peak heap size as a benchmark
+// metric.
+func (h *heapSampler) report(b *testing.B) {
+	close(h.stop)
+	h.wg.Wait()
+	b.ReportMetric(float64(h.peak)/(1<<20), "peak-heap-MB")
+}
+
+func benchmarkReportSerialization(b *testing.B, driver, params string, numItems int) {
+	processor, reportRow := setupBenchReport(b, driver, params, numItems)
+
+	// streaming the report directly from the datastore
+	b.Run("WriteReport", func(b *testing.B) {
+		b.ReportAllocs()
+		sampler := startHeapSampler()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			_, size, err := processor.WriteReport(reportRow, io.Discard)
+			if err != nil {
+				b.Fatalf("failed to write report: %s", err.Error())
+			}
+			b.SetBytes(size)
+		}
+
+		b.StopTimer()
+		sampler.report(b)
+	})
+
+	// loading the whole report into memory and marshaling it
+	b.Run("ToReportMarshal", func(b *testing.B) {
+		if numItems > benchInMemoryMaxItems {
+			b.Skipf("loading %d maximum size items into memory needs too much memory", numItems)
+		}
+
+		b.ReportAllocs()
+		sampler := startHeapSampler()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			report, err := processor.ToReport(reportRow)
+			if err != nil {
+				b.Fatalf("failed to render report: %s", err.Error())
+			}
+			reportBytes, err := json.Marshal(report)
+			if err != nil {
+				b.Fatalf("failed to marshal report: %s", err.Error())
+			}
+			b.SetBytes(int64(len(reportBytes)))
+		}
+
+		b.StopTimer()
+		sampler.report(b)
+	})
+}
+
+func BenchmarkReportSerialization(b *testing.B) {
+	for _, numItems := range benchReportItems {
+		if sqlite3Available {
+			b.Run(fmt.Sprintf("sqlite3/items=%d", numItems), func(b *testing.B) {
+				benchmarkReportSerialization(b, "sqlite3", filepath.Join(b.TempDir(), "telemetry.db"), numItems)
+			})
+		}
+
+		b.Run(fmt.Sprintf("spool/items=%d", numItems), func(b *testing.B) {
+			benchmarkReportSerialization(b, "spool", filepath.Join(b.TempDir(), "spool"), numItems)
+		})
+	}
+}
@@ -0,0 +1,1674 @@
+package telemetrylib
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/SUSE/telemetry/pkg/utils"
+)
+
+// spool sub-directories, one per table
+const (
+	spoolItems          = `items`
+	spoolBundles        = `bundles`
+	spoolReports        = `reports`
+	spoolReportStates   = `reportStates`
+	spoolSubmissions    = `submissions`
+	spoolManagedClients = `managedClients`
+	spoolEvictions      = `evictions`
+)
+
+var spoolTables = []string{
+	spoolItems,
+	spoolBundles,
+	spoolReports,
+	spoolReportStates,
+	spoolSubmissions,
+	spoolManagedClients,
+	spoolEvictions,
+}
+
+// spool file extensions, the prefix used for temporary files, and the
+// name of the lock file
+const (
+	spoolRowExt     = `.json`
+	spoolDataExt    = `.data`
+	spoolPendingExt = `.pending`
+	spoolTmp        = `.tmp-`
+	spoolLock       = `spool.lock`
+)
+
+// SpoolStore is a pure Go datastore, which doesn't require cgo, that
+// stores each row as a JSON file in a per-table sub-directory of the spool
+// directory, with the (possibly compressed) data of each item being stored
+// in a separate file alongside the item.
+//
+// Row files are named for the row id and, for items and bundles, the id
+// of the bundle or report they are associated with, if any, e.g. 12.json
+// for an unbundled item, and 12.5.json once it is in bundle 5, so that the
+// directory listing indexes the rows by their bundle or report. Rows can
+// be selected, counted and moved to another bundle or report without
+// reading any rows, with only the selected rows being read and decoded.
+//
+// Files are written to a temporary file that is then linked or renamed
+// into place, so that a partially written row is never seen, with new
+// row ids being claimed by exclusively linking the row's first file into
+// place, so that concurrent writers can't claim the same id. Access to
+// the spool is serialized, between processes, using a lock file.
+type SpoolStore struct {
+	Dir      string
+	mutex    sync.Mutex
+	lockFile *os.File
+}
+
+// spoolItem is the stored form of an item row, with the item data being
+// stored separately, along with the managed client it was staged for.
+type spoolItem struct {
+	TelemetryDataItemRow
+	ManagedClientId int64
+	ContentSize     int64
+}
+
+// spoolEntry identifies a row file by the row id, and the id of the
+// bundle or report that the row is associated with, if any.
+type spoolEntry struct {
+	id     int64
+	parent sql.NullInt64
+}
+
+func NewSpoolStore(dbConfig config.DBConfig) (s *SpoolStore, err error) {
+	if dbConfig.Params == "" {
+		return nil, fmt.Errorf("spool datastore directory must be specified as the datastore params")
+	}
+
+	s = &SpoolStore{Dir: dbConfig.Params}
+
+	for _, table := range spoolTables {
+		if err = os.MkdirAll(s.tableDir(table), 0700); err != nil {
+			slog.Error(
+				"Failed to create spool directory",
+				slog.String("dir", s.tableDir(table)),
+				slog.String("error", err.Error()),
+			)
+			return nil, err
+		}
+	}
+
+	s.lockFile, err = os.OpenFile(filepath.Join(s.Dir, spoolLock), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		slog.Error(
+			"Failed to open spool lock file",
+			slog.String("dir", s.Dir),
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+
+	return
+}
+
+// lock serializes access to the spool, between both goroutines and
+// processes
+func (s *SpoolStore) lock() (err error) {
+	s.mutex.Lock()
+	if err = lockSpool(s.lockFile); err != nil {
+		s.mutex.Unlock()
+		slog.Error(
+			"failed to lock spool",
+			slog.String("dir", s.Dir),
+			slog.String("err", err.Error()),
+		)
+	}
+
+	return
+}
+
+func (s *SpoolStore) unlock() {
+	unlockSpool(s.lockFile)
+	s.mutex.Unlock()
+}
+
+func (s *SpoolStore) String() string {
+	return fmt.Sprintf("%p<%s,%s,persistent>", s, DATASTORE_DRIVER_SPOOL, s.Dir)
+}
+
+func (s *SpoolStore) Persistent() bool {
+	return true
+}
+
+// only for testing
+func (s *SpoolStore) cleanup() (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	for _, table := range spoolTables {
+		if err = os.RemoveAll(s.tableDir(table)); err != nil {
+			slog.Error(
+				"failed to remove spool directory",
+				slog.String("dir", s.tableDir(table)),
+				slog.String("err", err.Error()),
+			)
+			return
+		}
+	}
+
+	return
+}
+
+func (s *SpoolStore) tableDir(table string) string {
+	return filepath.Join(s.Dir, table)
+}
+
+func (s *SpoolStore) rowPath(table string, id int64, ext string) string {
+	return filepath.Join(s.tableDir(table), strconv.FormatInt(id, 10)+ext)
+}
+
+// entryPath returns the path of the row file identified by the entry
+func (s *SpoolStore) entryPath(table string, entry spoolEntry) string {
+	name := strconv.FormatInt(entry.id, 10)
+	if entry.parent.Valid {
+		name += "." + strconv.FormatInt(entry.parent.Int64, 10)
+	}
+
+	return filepath.Join(s.tableDir(table), name+spoolRowExt)
+}
+
+// spoolId returns the row id that the spool file is named for
+func spoolId(name string) (id int64, ok bool) {
+	if strings.HasPrefix(name, spoolTmp) {
+		return
+	}
+
+	idStr, _, _ := strings.Cut(name, ".")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// spoolRowEntry returns the entry identifying the row file with the name
+func spoolRowEntry(name string) (entry spoolEntry, ok bool) {
+	base, isRow := strings.CutSuffix(name, spoolRowExt)
+	if !isRow {
+		return
+	}
+
+	if entry.id, ok = spoolId(base); !ok {
+		return
+	}
+
+	if _, parentStr, found := strings.Cut(base, "."); found {
+		parent, err := strconv.ParseInt(parentStr, 10, 64)
+		if err != nil {
+			return entry, false
+		}
+		entry.parent = sql.NullInt64{Int64: parent, Valid: true}
+	}
+
+	return
+}
+
+// listSpoolEntries returns the entries of the rows in the table, in id
+// order, without reading any of the rows
+func (s *SpoolStore) listSpoolEntries(ctx context.Context, table string) (entries []spoolEntry, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	dirEntries, err := os.ReadDir(s.tableDir(table))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+
+	for _, dirEntry := range dirEntries {
+		if entry, ok := spoolRowEntry(dirEntry.Name()); ok {
+			entries = append(entries, entry)
+		}
+	}
+	slices.SortFunc(entries, func(a, b spoolEntry) int {
+		return cmp.Compare(a.id, b.id)
+	})
+
+	return
+}
+
+// spoolEntriesById returns the entries of the rows in the table, keyed by
+// their row ids
+func (s *SpoolStore) spoolEntriesById(ctx context.Context, table string) (entries map[int64]spoolEntry, err error) {
+	list, err := s.listSpoolEntries(ctx, table)
+	if err != nil {
+		return
+	}
+
+	entries = make(map[int64]spoolEntry, len(list))
+	for _, entry := range list {
+		entries[entry.id] = entry
+	}
+
+	return
+}
+
+// countSpoolEntries counts the rows in the table whose entries match,
+// without reading any of the rows
+func (s *SpoolStore) countSpoolEntries(ctx context.Context, table string, match func(spoolEntry) bool) (count int, err error) {
+	entries, err := s.listSpoolEntries(ctx, table)
+	for _, entry := range entries {
+		if match(entry) {
+			count++
+		}
+	}
+
+	return
+}
+
+// writeTemp writes the content to a new temporary file in the table dir,
+// returning its path
+func (s *SpoolStore) writeTemp(table string, content []byte) (tmpPath string, err error) {
+	dir := s.tableDir(table)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+
+	file, err := os.CreateTemp(dir, spoolTmp+"*")
+	if err != nil {
+		return
+	}
+	tmpPath = file.Name()
+
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+
+	return
+}
+
+// claim stores the content as a file with the specified extension, named
+// for the next available row id in the table, returning the claimed id
+func (s *SpoolStore) claim(ctx context.Context, table, ext string, content []byte) (id int64, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	tmpPath, err := s.writeTemp(table, content)
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmpPath)
+
+	dirEntries, err := os.ReadDir(s.tableDir(table))
+	if err != nil {
+		return
+	}
+	for _, dirEntry := range dirEntries {
+		if entryId, ok := spoolId(dirEntry.Name()); ok && entryId > id {
+			id = entryId
+		}
+	}
+
+	// linking fails if the file already exists, in which case another
+	// writer has claimed the id, so try the next one
+	for id++; ; id++ {
+		err = os.Link(tmpPath, s.rowPath(table, id, ext))
+		if !errors.Is(err, os.ErrExist) {
+			break
+		}
+	}
+
+	return
+}
+
+// replace atomically replaces the content of the file
+func (s *SpoolStore) replace(table string, path string, content []byte) (err error) {
+	tmpPath, err := s.writeTemp(table, content)
+	if err != nil {
+		return
+	}
+
+	if err = os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+	}
+
+	return
+}
+
+// removeFile removes the file, ignoring it if it doesn't exist
+func removeFile(path string) (err error) {
+	if err = os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return
+}
+
+// removeRow removes the row file identified by the entry, along with the
+// data file of an item
+func (s *SpoolStore) removeRow(table string, entry spoolEntry) (err error) {
+	if err = removeFile(s.entryPath(table, entry)); err != nil {
+		return
+	}
+
+	if table == spoolItems {
+		return removeFile(s.rowPath(spoolItems, entry.id, spoolDataExt))
+	}
+
+	return
+}
+
+func (s *SpoolStore) insertRow(ctx context.Context, table string, row any) (id int64, err error) {
+	content, err := json.Marshal(row)
+	if err != nil {
+		return
+	}
+
+	return s.claim(ctx, table, spoolRowExt, content)
+}
+
+// updateRow writes the row to the file identified by the entry; the row's
+// id, and the id of its bundle or report, are recorded by the file name
+func (s *SpoolStore) updateRow(table string, entry spoolEntry, row any) (err error) {
+	content, err := json.Marshal(row)
+	if err != nil {
+		return
+	}
+
+	return s.replace(table, s.entryPath(table, entry), content)
+}
+
+// readSpoolRow reads the row file identified by the entry
+func readSpoolRow[T any](s *SpoolStore, table string, entry spoolEntry) (row *T, err error) {
+	path := s.entryPath(table, entry)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	row = new(T)
+	if err = json.Unmarshal(content, row); err != nil {
+		return nil, fmt.Errorf("failed to decode spool file %q: %w", path, err)
+	}
+
+	return
+}
+
+// readSpoolRows reads the rows in the table whose entries match, in id
+// order, setting the ids of each row from its entry
+func readSpoolRows[T any](ctx context.Context, s *SpoolStore, table string, match func(spoolEntry) bool, setIds func(*T, spoolEntry)) (rows []*T, err error) {
+	entries, err := s.listSpoolEntries(ctx, table)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !match(entry) {
+			continue
+		}
+
+		row, err := readSpoolRow[T](s, table, entry)
+		if errors.Is(err, os.ErrNotExist) {
+			// deleted since the directory was read
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		setIds(row, entry)
+		rows = append(rows, row)
+	}
+
+	return
+}
+
+// allSpoolRows matches all of the rows in a table
+func allSpoolRows(spoolEntry) bool {
+	return true
+}
+
+// spoolMatcher mirrors genSqlPopulateQuery's handling of the ids used to
+// select rows: no ids matches all rows, an initial "NULL" matches rows
+// that have no associated id, and otherwise rows whose associated id is
+// one of the specified ids are matched.
+func spoolMatcher(ids []any) func(valid bool, value any) bool {
+	if len(ids) == 0 {
+		return func(bool, any) bool { return true }
+	}
+
+	if ids[0] == "NULL" {
+		return func(valid bool, _ any) bool { return !valid }
+	}
+
+	matching := map[string]bool{}
+	for _, id := range ids {
+		matching[fmt.Sprint(id)] = true
+	}
+	return func(valid bool, value any) bool { return valid && matching[fmt.Sprint(value)] }
+}
+
+// spoolParentMatcher matches the entries of the rows associated with the
+// specified bundle or report ids, as per spoolMatcher
+func spoolParentMatcher(parentIds []any) func(spoolEntry) bool {
+	match := spoolMatcher(parentIds)
+	return func(entry spoolEntry) bool { return match(entry.parent.Valid, entry.parent.Int64) }
+}
+
+// spoolIdMatcher matches the entries of the rows with the specified ids,
+// as per spoolMatcher
+func spoolIdMatcher(ids []any) func(spoolEntry) bool {
+	match := spoolMatcher(ids)
+	return func(entry spoolEntry) bool { return match(true, entry.id) }
+}
+
+// sameSpoolParent returns whether the parent ids are the same, or both
+// NULL
+func sameSpoolParent(a, b sql.NullInt64) bool {
+	return a.Valid == b.Valid && (!a.Valid || a.Int64 == b.Int64)
+}
+
+// moveSpoolRows moves the rows in the table with the specified ids from
+// the from parent to the to parent, by renaming their files, skipping any
+// that are no longer associated with the from parent, e.g. because
+// another process has moved them, returning the ids of the rows that were
+// moved.
+func (s *SpoolStore) moveSpoolRows(ctx context.Context, table string, ids []int64, from, to sql.NullInt64) (moved []int64, err error) {
+	entries, err := s.spoolEntriesById(ctx, table)
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		entry, found := entries[id]
+		if !found || !sameSpoolParent(entry.parent, from) {
+			continue
+		}
+
+		err = os.Rename(s.entryPath(table, entry), s.entryPath(table, spoolEntry{id: id, parent: to}))
+		if err != nil {
+			return
+		}
+		moved = append(moved, id)
+	}
+
+	return
+}
+
+//
+// Items, indexed by their bundle
+//
+
+func (s *SpoolStore) readItems(ctx context.Context, match func(spoolEntry) bool) ([]*spoolItem, error) {
+	return readSpoolRows(ctx, s, spoolItems, match, func(item *spoolItem, entry spoolEntry) {
+		item.Id = entry.id
+		item.BundleId = entry.parent
+	})
+}
+
+// readItemData reads and decompresses the item's data
+func (s *SpoolStore) readItemData(item *spoolItem) (itemData []byte, err error) {
+	itemData, err = os.ReadFile(s.rowPath(spoolItems, item.Id, spoolDataExt))
+	if err != nil {
+		slog.Error(
+			"Failed to read item data",
+			slog.String("itemId", item.ItemId),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	// ItemData can be stored as compressed data
+	itemData, err = utils.DecompressWhenNeeded(itemData, item.Compression)
+	if err != nil {
+		slog.Error(
+			"Failed to decompress item data",
+			slog.String("itemId", item.ItemId),
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+
+	return
+}
+
+func (s *SpoolStore) InsertItemContext(ctx context.Context, itemRow *TelemetryDataItemRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	return s.insertItem(ctx, itemRow, 0)
+}
+
+// insertItem inserts the item, staged on behalf of the managed client
+// with the specified id, or not on behalf of a managed client if 0.
+func (s *SpoolStore) insertItem(ctx context.Context, itemRow *TelemetryDataItemRow, managedClientId int64) (err error) {
+	contentSize, err := itemContentSize(itemRow.ItemData)
+	if err != nil {
+		return
+	}
+	itemData, compression, err := utils.CompressWhenNeeded(itemRow.ItemData)
+	if err != nil {
+		return
+	}
+
+	// the item data is written first, claiming the item id, and the item
+	// becomes visible once its row has been written
+	id, err := s.claim(ctx, spoolItems, spoolDataExt, itemData)
+	if err != nil {
+		slog.Error(
+			"failed to add item data",
+			slog.String("itemId", itemRow.ItemId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	item := &spoolItem{TelemetryDataItemRow: *itemRow, ManagedClientId: managedClientId, ContentSize: contentSize}
+	item.Id = 0
+	item.ItemData = nil
+	item.BundleId = sql.NullInt64{}
+	if compression != nil {
+		item.Compression = sql.NullString{String: *compression, Valid: true}
+	}
+
+	if err = s.updateRow(spoolItems, spoolEntry{id: id}, item); err != nil {
+		slog.Error(
+			"failed to add item entry",
+			slog.String("itemId", itemRow.ItemId),
+			slog.String("err", err.Error()),
+		)
+		removeFile(s.rowPath(spoolItems, id, spoolDataExt))
+		return
+	}
+
+	itemRow.Id = id
+	itemRow.BundleId = sql.NullInt64{Int64: 0, Valid: false}
+
+	return
+}
+
+func (s *SpoolStore) DeleteItemContext(ctx context.Context, itemRow *TelemetryDataItemRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	entries, err := s.spoolEntriesById(ctx, spoolItems)
+	if err != nil {
+		return
+	}
+	if entry, found := entries[itemRow.Id]; found {
+		return s.removeRow(spoolItems, entry)
+	}
+
+	return
+}
+
+// deleteItems deletes the items associated with the bundle
+func (s *SpoolStore) deleteItems(ctx context.Context, bundleId int64) (err error) {
+	entries, err := s.listSpoolEntries(ctx, spoolItems)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.parent.Valid && entry.parent.Int64 == bundleId {
+			if err = s.removeRow(spoolItems, entry); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (s *SpoolStore) GetItemsContext(ctx context.Context, bundleIds ...any) (itemRowIds []int64, itemRows []*TelemetryDataItemRow, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	items, err := s.readItems(ctx, spoolParentMatcher(bundleIds))
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve items with specified bundleIds",
+			slog.Any("bundleIds", bundleIds),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	for _, item := range items {
+		itemRow := item.TelemetryDataItemRow
+		if itemRow.ItemData, err = s.readItemData(item); err != nil {
+			return nil, nil, err
+		}
+
+		itemRows = append(itemRows, &itemRow)
+		itemRowIds = append(itemRowIds, itemRow.Id)
+	}
+
+	return
+}
+
+// WalkItemsContext calls fn for each of the items associated with the
+// specified bundleIds, in id order, reading and decompressing one item at
+// a time. The spool is only locked while reading each item, so that other
+// processes aren't blocked while fn is processing the items.
+func (s *SpoolStore) WalkItemsContext(ctx context.Context, fn func(itemRow *TelemetryDataItemRow) error, bundleIds ...any) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	entries, err := s.listSpoolEntries(ctx, spoolItems)
+	s.unlock()
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve items with specified bundleIds",
+			slog.Any("bundleIds", bundleIds),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	match := spoolParentMatcher(bundleIds)
+	for _, entry := range entries {
+		if !match(entry) {
+			continue
+		}
+
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		var item *spoolItem
+		var itemData []byte
+		if err = s.lock(); err != nil {
+			return
+		}
+		item, err = readSpoolRow[spoolItem](s, spoolItems, entry)
+		if err == nil {
+			item.Id = entry.id
+			item.BundleId = entry.parent
+			itemData, err = s.readItemData(item)
+		}
+		s.unlock()
+		if errors.Is(err, os.ErrNotExist) {
+			// deleted, or moved to another bundle, since the directory
+			// was read
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		itemRow := item.TelemetryDataItemRow
+		itemRow.ItemData = itemData
+		if err = fn(&itemRow); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (s *SpoolStore) GetItemCountContext(ctx context.Context, bundleIds ...any) (count int, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	count, err = s.countSpoolEntries(ctx, spoolItems, spoolParentMatcher(bundleIds))
+	if err != nil {
+		slog.Error(
+			"Failed to count items associated with specified bundles",
+			slog.Any("bundleIds", bundleIds),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	return
+}
+
+// unbundledItemIds returns the ids of the items that are not yet
+// associated with a bundle, and were staged for the managed client with
+// the specified id, or weren't staged for a managed client if 0.
+func (s *SpoolStore) unbundledItemIds(ctx context.Context, managedClientId int64) (itemRowIds []int64, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	items, err := s.readItems(ctx, spoolParentMatcher([]any{"NULL"}))
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve row ids",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	for _, item := range items {
+		if item.ManagedClientId == managedClientId {
+			itemRowIds = append(itemRowIds, item.Id)
+		}
+	}
+
+	return
+}
+
+func (s *SpoolStore) GetUnmanagedItemIdsContext(ctx context.Context) (itemRowIds []int64, err error) {
+	return s.unbundledItemIds(ctx, 0)
+}
+
+// GetStagedItemsContext returns summaries of all of the staged data items,
+// in id order, without their content
+func (s *SpoolStore) GetStagedItemsContext(ctx context.Context) (stagedRows []*TelemetryStagedItemRow, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	items, err := s.readItems(ctx, allSpoolRows)
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve staged items",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	for _, item := range items {
+		info, err := os.Stat(s.rowPath(spoolItems, item.Id, spoolDataExt))
+		if err != nil {
+			slog.Error(
+				"Failed to stat item data",
+				slog.String("itemId", item.ItemId),
+				slog.String("error", err.Error()),
+			)
+			return nil, err
+		}
+
+		stagedRows = append(stagedRows, &TelemetryStagedItemRow{
+			Id:              item.Id,
+			ItemId:          item.ItemId,
+			ItemType:        item.ItemType,
+			ItemTimestamp:   item.ItemTimestamp,
+			ItemAnnotations: item.ItemAnnotations,
+			ItemChecksum:    item.ItemChecksum,
+			ItemClass:       item.ItemClass,
+			ItemSize:        info.Size(),
+			ItemContentSize: sql.NullInt64{Int64: item.ContentSize, Valid: item.ContentSize > 0},
+			BundleId:        item.BundleId,
+		})
+	}
+
+	return
+}
+
+//
+// Bundles, indexed by their report
+//
+
+func (s *SpoolStore) readBundles(ctx context.Context, match func(spoolEntry) bool) ([]*TelemetryBundleRow, error) {
+	return readSpoolRows(ctx, s, spoolBundles, match, func(bundleRow *TelemetryBundleRow, entry spoolEntry) {
+		bundleRow.Id = entry.id
+		bundleRow.ReportId = entry.parent
+	})
+}
+
+// BundleExistsContext checks for an existing bundle with the same bundle
+// id, which isn't indexed, so all of the bundles must be read.
+func (s *SpoolStore) BundleExistsContext(ctx context.Context, bundleRow *TelemetryBundleRow) bool {
+	if s.lock() != nil {
+		return false
+	}
+	defer s.unlock()
+
+	bundleRows, err := s.readBundles(ctx, allSpoolRows)
+	if err != nil {
+		slog.Error(
+			"failed to check bundle id existence",
+			slog.String("bundleId", bundleRow.BundleId),
+			slog.String("err", err.Error()),
+		)
+		return false
+	}
+
+	for _, existing := range bundleRows {
+		if existing.BundleId == bundleRow.BundleId {
+			bundleRow.Id = existing.Id
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *SpoolStore) InsertBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow, itemIDs []int64) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	bundleRow.ReportId = sql.NullInt64{Int64: 0, Valid: false}
+
+	return s.insertBundle(ctx, bundleRow, itemIDs, sql.NullInt64{})
+}
+
+func (s *SpoolStore) InsertBundleWithItemsContext(ctx context.Context, bundleRow *TelemetryBundleRow, itemRows []*TelemetryDataItemRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	bundleRow.ReportId = sql.NullInt64{Int64: 0, Valid: false}
+
+	itemIDs := make([]int64, 0, len(itemRows))
+	for _, itemRow := range itemRows {
+		if err = s.insertItem(ctx, itemRow, 0); err != nil {
+			break
+		}
+		itemIDs = append(itemIDs, itemRow.Id)
+	}
+
+	if err == nil {
+		err = s.insertBundle(ctx, bundleRow, itemIDs, sql.NullInt64{})
+	}
+
+	// remove any inserted items if the bundle couldn't be inserted
+	if err != nil {
+		for _, itemID := range itemIDs {
+			s.removeRow(spoolItems, spoolEntry{id: itemID})
+		}
+	}
+
+	return
+}
+
+func (s *SpoolStore) SplitBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow, newRows []*TelemetryBundleRow, itemGroups [][]int64) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	fromBundleId := sql.NullInt64{Int64: bundleRow.Id, Valid: true}
+	for i, newRow := range newRows {
+		if err = s.insertBundle(ctx, newRow, itemGroups[i], fromBundleId); err != nil {
+			return
+		}
+	}
+
+	return s.deleteBundles(ctx, spoolIdMatcher([]any{bundleRow.Id}))
+}
+
+// insertBundle inserts the bundle, as per TelemetryBundleRow.insert; the
+// bundle id is reserved while the items are moved, with the bundle only
+// becoming visible once they have been.
+func (s *SpoolStore) insertBundle(ctx context.Context, bundleRow *TelemetryBundleRow, itemIDs []int64, fromBundleId sql.NullInt64) (err error) {
+	id, err := s.claim(ctx, spoolBundles, spoolPendingExt, nil)
+	if err != nil {
+		slog.Error(
+			"failed to add bundle entry with bundleId",
+			slog.String("bundleId", bundleRow.BundleId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+	defer removeFile(s.rowPath(spoolBundles, id, spoolPendingExt))
+
+	toBundleId := sql.NullInt64{Int64: id, Valid: true}
+
+	// Update the bundleId of the items
+	movedIDs, err := s.moveSpoolRows(ctx, spoolItems, itemIDs, fromBundleId, toBundleId)
+	if err == nil && len(movedIDs) == 0 {
+		err = fmt.Errorf("%w: bundle %q", ErrNoUnbundledItems, bundleRow.BundleId)
+	}
+	if err == nil {
+		row := *bundleRow
+		row.Id = 0
+		row.ReportId = sql.NullInt64{}
+		err = s.updateRow(spoolBundles, spoolEntry{id: id, parent: bundleRow.ReportId}, &row)
+	}
+	if err != nil {
+		slog.Error(
+			"failed to add bundle entry with bundleId",
+			slog.String("bundleId", bundleRow.BundleId),
+			slog.String("err", err.Error()),
+		)
+		s.moveSpoolRows(ctx, spoolItems, movedIDs, toBundleId, fromBundleId)
+		return
+	}
+
+	bundleRow.Id = id
+
+	return
+}
+
+// deleteBundles deletes the bundles whose entries match, along with their
+// items
+func (s *SpoolStore) deleteBundles(ctx context.Context, match func(spoolEntry) bool) (err error) {
+	entries, err := s.listSpoolEntries(ctx, spoolBundles)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !match(entry) {
+			continue
+		}
+
+		// delete the items first so that they are never orphaned
+		if err = s.deleteItems(ctx, entry.id); err != nil {
+			return
+		}
+		if err = s.removeRow(spoolBundles, entry); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (s *SpoolStore) DeleteBundleContext(ctx context.Context, bundleRow *TelemetryBundleRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	// bundles are deleted by bundle id, which isn't indexed
+	bundleRows, err := s.readBundles(ctx, allSpoolRows)
+	if err != nil {
+		return
+	}
+
+	var ids []any
+	for _, existing := range bundleRows {
+		if existing.BundleId == bundleRow.BundleId {
+			ids = append(ids, existing.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	return s.deleteBundles(ctx, spoolIdMatcher(ids))
+}
+
+func (s *SpoolStore) GetBundlesContext(ctx context.Context, reportIds ...any) (bundleRowIds []int64, bundleRows []*TelemetryBundleRow, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	bundleRows, err = s.readBundles(ctx, spoolParentMatcher(reportIds))
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve bundles with specified reportIds",
+			slog.Any("reportIds", reportIds),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	for _, bundleRow := range bundleRows {
+		bundleRowIds = append(bundleRowIds, bundleRow.Id)
+	}
+
+	return
+}
+
+func (s *SpoolStore) GetBundleCountContext(ctx context.Context, reportIds ...any) (count int, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	count, err = s.countSpoolEntries(ctx, spoolBundles, spoolParentMatcher(reportIds))
+	if err != nil {
+		slog.Error(
+			"Failed to count bundles associated with specified reports",
+			slog.Any("reportIds", reportIds),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	return
+}
+
+//
+// Reports
+//
+
+func (s *SpoolStore) readReports(ctx context.Context, match func(spoolEntry) bool) ([]*TelemetryReportRow, error) {
+	return readSpoolRows(ctx, s, spoolReports, match, func(reportRow *TelemetryReportRow, entry spoolEntry) {
+		reportRow.Id = entry.id
+	})
+}
+
+func (s *SpoolStore) InsertReportContext(ctx context.Context, reportRow *TelemetryReportRow, bundleIDs []int64) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	return s.insertReport(ctx, reportRow, bundleIDs, sql.NullInt64{})
+}
+
+func (s *SpoolStore) SplitReportContext(ctx context.Context, reportRow *TelemetryReportRow, newRows []*TelemetryReportRow, bundleGroups [][]int64) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	fromReportId := sql.NullInt64{Int64: reportRow.Id, Valid: true}
+	for i, newRow := range newRows {
+		if err = s.insertReport(ctx, newRow, bundleGroups[i], fromReportId); err != nil {
+			return
+		}
+	}
+
+	return s.deleteReports(ctx, spoolIdMatcher([]any{reportRow.Id}))
+}
+
+// insertReport inserts the report, as per TelemetryReportRow.insert; the
+// report id is reserved while the bundles are moved, with the report only
+// becoming visible once they have been.
+func (s *SpoolStore) insertReport(ctx context.Context, reportRow *TelemetryReportRow, bundleIDs []int64, fromReportId sql.NullInt64) (err error) {
+	id, err := s.claim(ctx, spoolReports, spoolPendingExt, nil)
+	if err != nil {
+		slog.Error(
+			"failed to add Report entry",
+			slog.String("reportId", reportRow.ReportId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+	defer removeFile(s.rowPath(spoolReports, id, spoolPendingExt))
+
+	toReportId := sql.NullInt64{Int64: id, Valid: true}
+
+	// Update the reportId of the bundles
+	movedIDs, err := s.moveSpoolRows(ctx, spoolBundles, bundleIDs, fromReportId, toReportId)
+	if err == nil && len(movedIDs) == 0 {
+		err = fmt.Errorf("%w: report %q", ErrNoUnreportedBundles, reportRow.ReportId)
+	}
+	if err == nil {
+		row := *reportRow
+		row.Id = 0
+		err = s.updateRow(spoolReports, spoolEntry{id: id}, &row)
+	}
+	if err != nil {
+		slog.Error(
+			"failed to add Report entry",
+			slog.String("reportId", reportRow.ReportId),
+			slog.String("err", err.Error()),
+		)
+		s.moveSpoolRows(ctx, spoolBundles, movedIDs, toReportId, fromReportId)
+		return
+	}
+
+	reportRow.Id = id
+
+	return
+}
+
+func (s *SpoolStore) DeleteReportContext(ctx context.Context, reportRow *TelemetryReportRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	// reports are deleted by report id, which isn't indexed
+	reportRows, err := s.readReports(ctx, allSpoolRows)
+	if err != nil {
+		return
+	}
+
+	var ids []any
+	for _, existing := range reportRows {
+		if existing.ReportId == reportRow.ReportId {
+			ids = append(ids, existing.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	return s.deleteReports(ctx, spoolIdMatcher(ids))
+}
+
+// deleteReports deletes the reports whose entries match, along with their
+// bundles, their items, and their state
+func (s *SpoolStore) deleteReports(ctx context.Context, match func(spoolEntry) bool) (err error) {
+	entries, err := s.listSpoolEntries(ctx, spoolReports)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !match(entry) {
+			continue
+		}
+
+		// delete the bundles, and their items, and the state first so
+		// that they are never orphaned
+		if err = s.deleteBundles(ctx, spoolParentMatcher([]any{entry.id})); err != nil {
+			return
+		}
+		if err = s.removeRow(spoolReportStates, spoolEntry{id: entry.id}); err != nil {
+			return
+		}
+		if err = s.removeRow(spoolReports, entry); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (s *SpoolStore) GetReportsContext(ctx context.Context, ids ...any) (reportRowIds []int64, reportRows []*TelemetryReportRow, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	reportRows, err = s.readReports(ctx, spoolIdMatcher(ids))
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve reports with specified ids",
+			slog.Any("ids", ids),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	for _, reportRow := range reportRows {
+		reportRowIds = append(reportRowIds, reportRow.Id)
+	}
+
+	return
+}
+
+func (s *SpoolStore) GetReportCountContext(ctx context.Context, ids ...any) (count int, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	count, err = s.countSpoolEntries(ctx, spoolReports, spoolIdMatcher(ids))
+	if err != nil {
+		slog.Error(
+			"Failed to count reports with specified ids",
+			slog.Any("ids", ids),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	return
+}
+
+// reportsByState returns the reports that are, or are not, quarantined;
+// only the states of reports that have failed submission are recorded, so
+// only those states need to be read
+func (s *SpoolStore) reportsByState(ctx context.Context, quarantined bool) (reportRowIds []int64, reportRows []*TelemetryReportRow, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	stateRows, err := readSpoolRows(ctx, s, spoolReportStates, allSpoolRows, func(stateRow *TelemetryReportStateRow, entry spoolEntry) {
+		stateRow.ReportId = entry.id
+	})
+	if err != nil {
+		return
+	}
+	quarantinedIds := map[int64]bool{}
+	for _, stateRow := range stateRows {
+		if stateRow.Quarantined {
+			quarantinedIds[stateRow.ReportId] = true
+		}
+	}
+
+	reportRows, err = s.readReports(ctx, func(entry spoolEntry) bool {
+		return quarantinedIds[entry.id] == quarantined
+	})
+	if err != nil {
+		return
+	}
+
+	for _, reportRow := range reportRows {
+		reportRowIds = append(reportRowIds, reportRow.Id)
+	}
+
+	return
+}
+
+func (s *SpoolStore) GetPendingReportsContext(ctx context.Context) (reportRowIds []int64, reportRows []*TelemetryReportRow, err error) {
+	reportRowIds, reportRows, err = s.reportsByState(ctx, false)
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve pending reports",
+			slog.String("error", err.Error()),
+		)
+	}
+
+	return
+}
+
+func (s *SpoolStore) GetQuarantinedReportsContext(ctx context.Context) (reportRowIds []int64, reportRows []*TelemetryReportRow, err error) {
+	reportRowIds, reportRows, err = s.reportsByState(ctx, true)
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve quarantined reports",
+			slog.String("error", err.Error()),
+		)
+	}
+
+	return
+}
+
+//
+// Report states, stored with the same id as their report
+//
+
+func (s *SpoolStore) GetReportStateContext(ctx context.Context, reportRow *TelemetryReportRow) (stateRow *TelemetryReportStateRow, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	stateRow, err = readSpoolRow[TelemetryReportStateRow](s, spoolReportStates, spoolEntry{id: reportRow.Id})
+	switch {
+	case err == nil:
+		stateRow.ReportId = reportRow.Id
+	case errors.Is(err, os.ErrNotExist):
+		// no state recorded yet for the report
+		stateRow, err = NewTelemetryReportStateRow(reportRow), nil
+	default:
+		slog.Error(
+			"Failed to retrieve state of report",
+			slog.String("reportId", reportRow.ReportId),
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+
+	return
+}
+
+func (s *SpoolStore) UpsertReportStateContext(ctx context.Context, stateRow *TelemetryReportStateRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	// the report must exist, as per the reportStates foreign key
+	entry := spoolEntry{id: stateRow.ReportId}
+	if _, err = os.Stat(s.entryPath(spoolReports, entry)); err != nil {
+		err = fmt.Errorf("report %d not found: %w", stateRow.ReportId, err)
+	} else {
+		stateRow.UpdatedAt = types.Now().String()
+		stored := *stateRow
+		stored.Id = stateRow.ReportId
+		err = s.updateRow(spoolReportStates, entry, &stored)
+	}
+	if err != nil {
+		slog.Error(
+			"failed to update report state entry",
+			slog.Int64("reportId", stateRow.ReportId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+func (s *SpoolStore) DeleteReportStateContext(ctx context.Context, stateRow *TelemetryReportStateRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	return s.removeRow(spoolReportStates, spoolEntry{id: stateRow.ReportId})
+}
+
+//
+// Submissions
+//
+
+func (s *SpoolStore) InsertSubmissionContext(ctx context.Context, submissionRow *TelemetrySubmissionRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	submissionRow.Id, err = s.insertRow(ctx, spoolSubmissions, submissionRow)
+	if err != nil {
+		slog.Error(
+			"failed to add submission entry",
+			slog.String("reportId", submissionRow.ReportId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+func (s *SpoolStore) GetSubmissionsContext(ctx context.Context, reportIds ...any) (submissionRows []*TelemetrySubmissionRow, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	allRows, err := readSpoolRows(ctx, s, spoolSubmissions, allSpoolRows, func(submissionRow *TelemetrySubmissionRow, entry spoolEntry) {
+		submissionRow.Id = entry.id
+	})
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve submissions with specified reportIds",
+			slog.Any("reportIds", reportIds),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	match := spoolMatcher(reportIds)
+	for _, submissionRow := range allRows {
+		if match(true, submissionRow.ReportId) {
+			submissionRows = append(submissionRows, submissionRow)
+		}
+	}
+
+	return
+}
+
+func (s *SpoolStore) GetSubmissionCountContext(ctx context.Context, reportIds ...any) (count int, err error) {
+	submissionRows, err := s.GetSubmissionsContext(ctx, reportIds...)
+	return len(submissionRows), err
+}
+
+//
+// Evictions
+//
+
+// EvictItemsContext deletes the items, along with any bundles that no
+// longer contain any items, and any reports that no longer contain any
+// bundles, as a result, recording the evictions, all while holding the
+// spool lock so that other processes never see a partial eviction.
+func (s *SpoolStore) EvictItemsContext(ctx context.Context, itemIDs []int64, evictionRows []*TelemetryEvictionRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	// the evictions are recorded first, so that nothing is deleted if
+	// they can't be recorded
+	var recordedIDs []int64
+	for _, evictionRow := range evictionRows {
+		if err = s.insertEviction(ctx, evictionRow); err != nil {
+			for _, id := range recordedIDs {
+				s.removeRow(spoolEvictions, spoolEntry{id: id})
+			}
+			return
+		}
+		recordedIDs = append(recordedIDs, evictionRow.Id)
+	}
+
+	itemEntries, err := s.spoolEntriesById(ctx, spoolItems)
+	if err != nil {
+		return
+	}
+
+	emptiedBundleIds := map[int64]bool{}
+	for _, itemID := range itemIDs {
+		entry, found := itemEntries[itemID]
+		if !found {
+			// already deleted, e.g. by another process
+			continue
+		}
+
+		if err = s.removeRow(spoolItems, entry); err != nil {
+			return
+		}
+		delete(itemEntries, itemID)
+		if entry.parent.Valid {
+			emptiedBundleIds[entry.parent.Int64] = true
+		}
+	}
+	if len(emptiedBundleIds) == 0 {
+		return
+	}
+
+	// only the bundles that no longer contain any items have been emptied
+	for _, entry := range itemEntries {
+		if entry.parent.Valid {
+			delete(emptiedBundleIds, entry.parent.Int64)
+		}
+	}
+
+	bundleEntries, err := s.listSpoolEntries(ctx, spoolBundles)
+	if err != nil {
+		return
+	}
+	emptiedReportIds := map[int64]bool{}
+	for _, entry := range bundleEntries {
+		if emptiedBundleIds[entry.id] && entry.parent.Valid {
+			emptiedReportIds[entry.parent.Int64] = true
+		}
+	}
+	for _, entry := range bundleEntries {
+		if !emptiedBundleIds[entry.id] && entry.parent.Valid {
+			delete(emptiedReportIds, entry.parent.Int64)
+		}
+	}
+
+	err = s.deleteBundles(ctx, func(entry spoolEntry) bool {
+		return emptiedBundleIds[entry.id]
+	})
+	if err != nil {
+		return
+	}
+
+	return s.deleteReports(ctx, func(entry spoolEntry) bool {
+		return emptiedReportIds[entry.id]
+	})
+}
+
+func (s *SpoolStore) InsertEvictionContext(ctx context.Context, evictionRow *TelemetryEvictionRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	return s.insertEviction(ctx, evictionRow)
+}
+
+func (s *SpoolStore) insertEviction(ctx context.Context, evictionRow *TelemetryEvictionRow) (err error) {
+	evictionRow.Id, err = s.insertRow(ctx, spoolEvictions, evictionRow)
+	if err != nil {
+		slog.Error(
+			"failed to add eviction entry",
+			slog.String("reason", evictionRow.Reason),
+			slog.String("itemType", evictionRow.ItemType),
+			slog.String("err", err.Error()),
+		)
+	}
+
+	return
+}
+
+func (s *SpoolStore) DeleteEvictionContext(ctx context.Context, evictionRow *TelemetryEvictionRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	return s.removeRow(spoolEvictions, spoolEntry{id: evictionRow.Id})
+}
+
+func (s *SpoolStore) GetEvictionsContext(ctx context.Context) (evictionRows []*TelemetryEvictionRow, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	evictionRows, err = readSpoolRows(ctx, s, spoolEvictions, allSpoolRows, func(evictionRow *TelemetryEvictionRow, entry spoolEntry) {
+		evictionRow.Id = entry.id
+	})
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve evictions",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+//
+// Managed clients
+//
+
+func (s *SpoolStore) readManagedClients(ctx context.Context) ([]*TelemetryManagedClientRow, error) {
+	return readSpoolRows(ctx, s, spoolManagedClients, allSpoolRows, func(managedRow *TelemetryManagedClientRow, entry spoolEntry) {
+		managedRow.Id = entry.id
+	})
+}
+
+func (s *SpoolStore) ManagedClientExistsContext(ctx context.Context, managedRow *TelemetryManagedClientRow) bool {
+	if s.lock() != nil {
+		return false
+	}
+	defer s.unlock()
+
+	managedRows, err := s.readManagedClients(ctx)
+	if err != nil {
+		slog.Error(
+			"failed when checking for existence of managed client",
+			slog.String("systemId", managedRow.SystemId),
+			slog.String("err", err.Error()),
+		)
+		return false
+	}
+
+	for _, existing := range managedRows {
+		if existing.SystemId == managedRow.SystemId {
+			*managedRow = *existing
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *SpoolStore) InsertManagedClientContext(ctx context.Context, managedRow *TelemetryManagedClientRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	managedRows, err := s.readManagedClients(ctx)
+	if err == nil {
+		// system and client ids must be unique, as per the managedClients
+		// table constraints
+		for _, existing := range managedRows {
+			if existing.SystemId == managedRow.SystemId || existing.ClientId == managedRow.ClientId {
+				err = fmt.Errorf("managed client already exists with system id %q or client id %q", managedRow.SystemId, managedRow.ClientId)
+				break
+			}
+		}
+	}
+	if err == nil {
+		managedRow.Id, err = s.insertRow(ctx, spoolManagedClients, managedRow)
+	}
+	if err != nil {
+		slog.Error(
+			"failed to add managed client entry",
+			slog.String("systemId", managedRow.SystemId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+func (s *SpoolStore) InsertManagedItemContext(ctx context.Context, managedRow *TelemetryManagedClientRow, itemRow *TelemetryDataItemRow) (err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	if err = s.insertItem(ctx, itemRow, managedRow.Id); err != nil {
+		slog.Error(
+			"failed to add managed item entry",
+			slog.String("systemId", managedRow.SystemId),
+			slog.String("itemId", itemRow.ItemId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+func (s *SpoolStore) GetManagedClientsContext(ctx context.Context) (managedRows []*TelemetryManagedClientRow, err error) {
+	if err = s.lock(); err != nil {
+		return
+	}
+	defer s.unlock()
+
+	managedRows, err = s.readManagedClients(ctx)
+	if err != nil {
+		slog.Error(
+			"Failed to retrieve managed clients",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+func (s *SpoolStore) GetManagedItemIdsContext(ctx context.Context, managedRow *TelemetryManagedClientRow) (itemRowIds []int64, err error) {
+	return s.unbundledItemIds(ctx, managedRow.Id)
+}
+
+// validate that SpoolStore implements the DataStore interface
+var _ DataStore = (*SpoolStore)(nil)
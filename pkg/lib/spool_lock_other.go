@@ -0,0 +1,17 @@
+//go:build !unix
+
+package telemetrylib
+
+import (
+	"os"
+)
+
+// file locking isn't supported, so access to the spool is only serialized
+// within a process
+func lockSpool(file *os.File) error {
+	return nil
+}
+
+func unlockSpool(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package telemetrylib
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockSpool takes an exclusive lock on the spool lock file, waiting until
+// any other process holding it releases it
+func lockSpool(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
+
+func unlockSpool(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
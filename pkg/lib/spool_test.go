@@ -0,0 +1,116 @@
+package telemetrylib
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/stretchr/testify/suite"
+)
+
+type SpoolStoreTestSuite struct {
+	suite.Suite
+	store *SpoolStore
+}
+
+func (t *SpoolStoreTestSuite) SetupTest() {
+	var err error
+	t.store, err = NewSpoolStore(config.DBConfig{
+		Driver: DATASTORE_DRIVER_SPOOL,
+		Params: filepath.Join(t.T().TempDir(), "spool"),
+	})
+	t.Require().NoError(err)
+}
+
+func (t *SpoolStoreTestSuite) insertItems(count int) (itemIds []int64) {
+	for i := 0; i < count; i++ {
+		itemRow, err := NewTelemetryDataItemRow(
+			"SLE-SERVER-Test",
+			types.Tags{},
+			types.NewTelemetryBlob([]byte(`{"version":1}`)),
+		)
+		t.Require().NoError(err)
+		t.Require().NoError(t.store.InsertItemContext(context.Background(), itemRow))
+		itemIds = append(itemIds, itemRow.Id)
+	}
+
+	return
+}
+
+func (t *SpoolStoreTestSuite) TestIndexedByParent() {
+	ctx := context.Background()
+
+	itemIds := t.insertItems(3)
+	bundleRow, err := NewTelemetryBundleRow("client id", "customer id", types.Tags{})
+	t.Require().NoError(err)
+	t.Require().NoError(t.store.InsertBundleContext(ctx, bundleRow, itemIds[:2]))
+
+	// bundled items are named for their bundle
+	bundleId := sql.NullInt64{Int64: bundleRow.Id, Valid: true}
+	for _, itemId := range itemIds[:2] {
+		t.FileExists(t.store.entryPath(spoolItems, spoolEntry{id: itemId, parent: bundleId}))
+	}
+	t.FileExists(t.store.entryPath(spoolItems, spoolEntry{id: itemIds[2]}))
+
+	// corrupt the unbundled item, which must not be read when selecting,
+	// or counting, the bundled items
+	t.Require().NoError(os.WriteFile(t.store.entryPath(spoolItems, spoolEntry{id: itemIds[2]}), []byte("corrupted"), 0600))
+
+	_, itemRows, err := t.store.GetItemsContext(ctx, bundleRow.Id)
+	t.Require().NoError(err)
+	t.Require().Len(itemRows, 2)
+	for _, itemRow := range itemRows {
+		t.Equal(bundleId, itemRow.BundleId)
+	}
+
+	count, err := t.store.GetItemCountContext(ctx)
+	t.Require().NoError(err)
+	t.Equal(3, count, "items should be counted without being read")
+
+	_, _, err = t.store.GetItemsContext(ctx)
+	t.Error(err, "reading all items should fail on the corrupted item")
+}
+
+func (t *SpoolStoreTestSuite) TestEvictItems() {
+	ctx := context.Background()
+
+	itemIds := t.insertItems(3)
+	bundleRow, err := NewTelemetryBundleRow("client id", "customer id", types.Tags{})
+	t.Require().NoError(err)
+	t.Require().NoError(t.store.InsertBundleContext(ctx, bundleRow, itemIds[:2]))
+	reportRow, err := NewTelemetryReportRow("client id", types.Tags{})
+	t.Require().NoError(err)
+	t.Require().NoError(t.store.InsertReportContext(ctx, reportRow, []int64{bundleRow.Id}))
+
+	// evicting some of a bundle's items leaves the bundle and its report
+	evictionRows := []*TelemetryEvictionRow{{Reason: EVICTION_REASON_MAX_AGE, ItemType: "SLE-SERVER-Test", ItemCount: 1}}
+	t.Require().NoError(t.store.EvictItemsContext(ctx, itemIds[:1], evictionRows))
+	count, err := t.store.GetBundleCountContext(ctx)
+	t.Require().NoError(err)
+	t.Equal(1, count)
+
+	// evicting the rest of them deletes the emptied bundle and report
+	t.Require().NoError(t.store.EvictItemsContext(ctx, itemIds[1:2], evictionRows))
+	count, err = t.store.GetBundleCountContext(ctx)
+	t.Require().NoError(err)
+	t.Equal(0, count)
+	count, err = t.store.GetReportCountContext(ctx)
+	t.Require().NoError(err)
+	t.Equal(0, count)
+
+	count, err = t.store.GetItemCountContext(ctx)
+	t.Require().NoError(err)
+	t.Equal(1, count, "the unbundled item should remain")
+
+	evictions, err := t.store.GetEvictionsContext(ctx)
+	t.Require().NoError(err)
+	t.Len(evictions, 2)
+}
+
+func TestSpoolStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(SpoolStoreTestSuite))
+}
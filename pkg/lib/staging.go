@@ -0,0 +1,181 @@
+package telemetrylib
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/SUSE/telemetry/pkg/types"
+)
+
+// validateStagingLimits checks that the staging limits are valid
+func validateStagingLimits(limits *config.StagingConfig) error {
+	switch {
+	case limits.MaxContentSize < 0:
+		return fmt.Errorf("invalid staging max_content_size %d", limits.MaxContentSize)
+	case limits.MaxAge < 0:
+		return fmt.Errorf("invalid staging max_age %s", limits.MaxAge)
+	case limits.MaxItemsPerType < 0:
+		return fmt.Errorf("invalid staging max_items_per_type %d", limits.MaxItemsPerType)
+	}
+
+	return nil
+}
+
+// stagingLimited returns whether any staging limits are specified
+func stagingLimited(limits *config.StagingConfig) bool {
+	return limits.MaxContentSize > 0 || limits.MaxAge > 0 || limits.MaxItemsPerType > 0
+}
+
+// evictionRank orders telemetry classes for eviction, with opt-in telemetry
+// being evicted before opt-out telemetry, which is evicted before mandatory
+// telemetry
+func evictionRank(class types.TelemetryClass) int {
+	switch class {
+	case types.OPT_IN_TELEMETRY:
+		return 0
+	case types.OPT_OUT_TELEMETRY:
+		return 1
+	}
+
+	return 2
+}
+
+// stagedEviction is a staged item selected for eviction, along with the
+// reason it was selected
+type stagedEviction struct {
+	stagedRow *TelemetryStagedItemRow
+	timestamp time.Time
+	reason    string
+}
+
+// selectEvictions selects the staged items that must be evicted to bring
+// the staging datastore within the staging limits. Items are considered in
+// eviction order, by telemetry class and then oldest first, with the item
+// id breaking ties, so that the same items are always selected; items that
+// are older than max_age are evicted first, followed by the items needed to
+// bring each telemetry type within max_items_per_type, and then the items
+// needed to bring the total stored size of the item content within
+// max_content_size. Items with an invalid timestamp are treated as the
+// oldest items.
+func selectEvictions(limits *config.StagingConfig, stagedRows []*TelemetryStagedItemRow, now time.Time) (evictions []*stagedEviction) {
+	candidates := make([]*stagedEviction, 0, len(stagedRows))
+	for _, stagedRow := range stagedRows {
+		candidate := &stagedEviction{stagedRow: stagedRow}
+		if timestamp, err := types.TimeStampFromString(stagedRow.ItemTimestamp); err == nil {
+			candidate.timestamp = timestamp.Time
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	slices.SortFunc(candidates, func(a, b *stagedEviction) int {
+		return cmp.Or(
+			cmp.Compare(evictionRank(a.stagedRow.ItemClass), evictionRank(b.stagedRow.ItemClass)),
+			a.timestamp.Compare(b.timestamp),
+			cmp.Compare(a.stagedRow.Id, b.stagedRow.Id),
+		)
+	})
+
+	evict := func(candidate *stagedEviction, reason string) {
+		candidate.reason = reason
+		evictions = append(evictions, candidate)
+	}
+
+	if limits.MaxAge > 0 {
+		cutoff := now.Add(-limits.MaxAge)
+		for _, candidate := range candidates {
+			if candidate.timestamp.Before(cutoff) {
+				evict(candidate, EVICTION_REASON_MAX_AGE)
+			}
+		}
+	}
+
+	if limits.MaxItemsPerType > 0 {
+		typeCounts := map[string]int{}
+		for _, candidate := range candidates {
+			if candidate.reason == "" {
+				typeCounts[candidate.stagedRow.ItemType]++
+			}
+		}
+
+		for _, candidate := range candidates {
+			itemType := candidate.stagedRow.ItemType
+			if candidate.reason == "" && typeCounts[itemType] > limits.MaxItemsPerType {
+				evict(candidate, EVICTION_REASON_MAX_ITEMS_PER_TYPE)
+				typeCounts[itemType]--
+			}
+		}
+	}
+
+	if limits.MaxContentSize > 0 {
+		var totalSize int64
+		for _, candidate := range candidates {
+			if candidate.reason == "" {
+				totalSize += candidate.stagedRow.ItemSize
+			}
+		}
+
+		for _, candidate := range candidates {
+			if totalSize <= limits.MaxContentSize {
+				break
+			}
+			if candidate.reason == "" {
+				evict(candidate, EVICTION_REASON_MAX_CONTENT_SIZE)
+				totalSize -= candidate.stagedRow.ItemSize
+			}
+		}
+	}
+
+	return
+}
+
+// newEvictionRows summarises the evictions as eviction rows, one for each
+// combination of reason, telemetry type and class, in eviction order
+func newEvictionRows(evictions []*stagedEviction, evictedAt types.TelemetryTimeStamp) (evictionRows []*TelemetryEvictionRow) {
+	type evictionKey struct {
+		reason    string
+		itemType  string
+		itemClass types.TelemetryClass
+	}
+	type evictionSummary struct {
+		row            *TelemetryEvictionRow
+		oldest, newest time.Time
+	}
+
+	summaries := map[evictionKey]*evictionSummary{}
+	for _, eviction := range evictions {
+		key := evictionKey{eviction.reason, eviction.stagedRow.ItemType, eviction.stagedRow.ItemClass}
+		summary, found := summaries[key]
+		if !found {
+			summary = &evictionSummary{
+				row: &TelemetryEvictionRow{
+					Reason:          key.reason,
+					ItemType:        key.itemType,
+					ItemClass:       key.itemClass,
+					OldestTimestamp: eviction.stagedRow.ItemTimestamp,
+					NewestTimestamp: eviction.stagedRow.ItemTimestamp,
+					EvictedAt:       evictedAt.String(),
+				},
+				oldest: eviction.timestamp,
+				newest: eviction.timestamp,
+			}
+			summaries[key] = summary
+			evictionRows = append(evictionRows, summary.row)
+		}
+
+		summary.row.ItemCount++
+		summary.row.ItemBytes += eviction.stagedRow.ItemSize
+		if eviction.timestamp.Before(summary.oldest) {
+			summary.oldest = eviction.timestamp
+			summary.row.OldestTimestamp = eviction.stagedRow.ItemTimestamp
+		}
+		if eviction.timestamp.After(summary.newest) {
+			summary.newest = eviction.timestamp
+			summary.row.NewestTimestamp = eviction.stagedRow.ItemTimestamp
+		}
+	}
+
+	return
+}
@@ -0,0 +1,92 @@
+package telemetrylib
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+
+	"github.com/SUSE/telemetry/pkg/types"
+)
+
+// TelemetrySubmissionRow records the successful submission of a report to
+// a server, along with the server's processing receipt. The bundle ids,
+// item ids and item types are stored as comma separated lists, with the
+// item types listed in the same order as the item ids.
+type TelemetrySubmissionRow struct {
+	Id           int64
+	ReportId     string
+	BundleIds    string
+	ItemIds      string
+	ItemTypes    string
+	Size         int
+	ServerUrl    string
+	ProcessingId int64
+	ProcessedAt  string
+	Attempts     int
+	SubmittedAt  string
+}
+
+func NewTelemetrySubmissionRow(
+	report *TelemetryReport,
+	serverUrl string,
+	size int,
+	attempts int,
+	processingId int64,
+	processedAt types.TelemetryTimeStamp,
+) *TelemetrySubmissionRow {
+	var bundleIds, itemIds, itemTypes []string
+
+	for _, bundle := range report.TelemetryBundles {
+		bundleIds = append(bundleIds, bundle.Header.BundleId)
+		for _, item := range bundle.TelemetryDataItems {
+			itemIds = append(itemIds, item.Header.TelemetryId)
+			itemTypes = append(itemTypes, item.Header.TelemetryType)
+		}
+	}
+
+	return &TelemetrySubmissionRow{
+		ReportId:     report.Header.ReportId,
+		BundleIds:    strings.Join(bundleIds, ","),
+		ItemIds:      strings.Join(itemIds, ","),
+		ItemTypes:    strings.Join(itemTypes, ","),
+		Size:         size,
+		ServerUrl:    serverUrl,
+		ProcessingId: processingId,
+		ProcessedAt:  processedAt.String(),
+		Attempts:     attempts,
+		SubmittedAt:  types.Now().String(),
+	}
+}
+
+func (s *TelemetrySubmissionRow) Insert(db *sql.DB) (err error) {
+	return s.InsertContext(context.Background(), db)
+}
+
+func (s *TelemetrySubmissionRow) InsertContext(ctx context.Context, db *sql.DB) (err error) {
+	res, err := db.ExecContext(
+		ctx,
+		`INSERT INTO submissions(reportId, bundleIds, itemIds, itemTypes, size, serverUrl, processingId, processedAt, attempts, submittedAt) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ReportId, s.BundleIds, s.ItemIds, s.ItemTypes, s.Size, s.ServerUrl, s.ProcessingId, s.ProcessedAt, s.Attempts, s.SubmittedAt,
+	)
+	if err != nil {
+		slog.Error(
+			"failed to add submission entry",
+			slog.String("reportId", s.ReportId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	s.Id, err = res.LastInsertId()
+	if err != nil {
+		slog.Error(
+			"failed to retrieve id for inserted submission",
+			slog.String("reportId", s.ReportId),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	return
+}
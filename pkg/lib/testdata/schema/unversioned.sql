@@ -0,0 +1,43 @@
+-- datastore created before schema versioning was introduced, containing
+-- only the items, bundles and reports tables
+CREATE TABLE reports (
+	id INTEGER NOT NULL PRIMARY KEY,
+	reportId VARCHAR(64) NOT NULL,
+	reportTimestamp VARCHAR(32) NOT NULL,
+	reportClientId VARCHAR NOT NULL,
+	reportAnnotations TEXT,
+	reportChecksum VARCHAR(256)
+);
+CREATE TABLE bundles (
+	id INTEGER NOT NULL PRIMARY KEY,
+	bundleId VARCHAR(64) NOT NULL,
+	bundleTimestamp VARCHAR(32) NOT NULL,
+	bundleClientId VARCHAR NOT NULL,
+	bundleCustomerId VARCHAR(64) NOT NULL,
+	bundleAnnotations TEXT,
+	bundleChecksum VARCHAR(256),
+	reportId  INTEGER NULL,
+	CONSTRAINT bundles_reportId
+	  FOREIGN KEY (reportId)
+		REFERENCES reports(id)
+	  ON DELETE CASCADE
+);
+CREATE TABLE items (
+	id INTEGER NOT NULL PRIMARY KEY,
+	itemId VARCHAR(64) NOT NULL,
+	itemType VARCHAR(64) NOT NULL,
+	itemTimestamp VARCHAR(32) NOT NULL,
+	itemAnnotations TEXT NULL,
+	itemData BLOB NOT NULL,
+	itemChecksum VARCHAR(256),
+	compression VARCHAR NULL,
+	bundleId INTEGER NULL,
+	CONSTRAINT items_bundleId
+	  FOREIGN KEY (bundleId)
+		REFERENCES bundles(id)
+	  ON DELETE CASCADE
+);
+INSERT INTO reports VALUES(1, '8c3a61d6-4c31-4c1e-9a0c-6c0e8f4f6a01', '2024-06-01T10:00:02Z', 'a6a7a21e-1d8c-4d3c-bb0b-1d9d2c3b4e50', '', NULL);
+INSERT INTO bundles VALUES(1, '5d1f7f2a-0b8e-4f55-8c1e-3b7a9e2d4c10', '2024-06-01T10:00:01Z', 'a6a7a21e-1d8c-4d3c-bb0b-1d9d2c3b4e50', '1234567890', '', NULL, 1);
+INSERT INTO items VALUES(1, '0f6c3c6e-6a55-4a4e-9a51-0d2f1c7b8e21', 'SLE-SERVER-Test', '2024-06-01T10:00:00Z', 'key1=value1', '{"version":1,"ItemA":1}', '5f3d2ba2b4b0e1f9ea9e8d2a1c5e8f45', NULL, 1);
+INSERT INTO items VALUES(2, '7b2e9d4c-3a1f-4c8e-b5d6-9e0a1b2c3d42', 'SLE-SERVER-Test', '2024-06-01T10:00:03Z', 'key1=value1', '{"version":1,"ItemB":2}', 'c0a8e6d1f2b3a4c5d6e7f8091a2b3c4d', NULL, NULL);
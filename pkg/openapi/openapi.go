@@ -0,0 +1,201 @@
+// Package openapi generates an OpenAPI 3 specification of the telemetry
+// client REST API, deriving the request and response schemas from the
+// restapi and telemetrylib structs and their validate tags, so that the
+// specification can't drift from the code.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// OpenAPI specification version that generated documents conform to
+	OPENAPI_VERSION = `3.0.3`
+
+	// version of the telemetry client REST API being described
+	API_VERSION = `1.0.0`
+
+	// prefix of references to component schemas
+	SCHEMA_REF_PREFIX = `#/components/schemas/`
+)
+
+// Document is an OpenAPI document, limited to the subset of the
+// specification needed to describe the telemetry client REST API.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+type PathItem struct {
+	Post *Operation `json:"post,omitempty"`
+}
+
+type Operation struct {
+	OperationId string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Ref         string  `json:"$ref,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	In          string  `json:"in,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Ref         string                `json:"$ref,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	Parameters      map[string]*Parameter      `json:"parameters,omitempty"`
+	Responses       map[string]*Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Schema is an OpenAPI schema object, which is either a reference to a
+// component schema, or an inline schema definition.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum,omitempty"`
+	Maximum              *int64             `json:"maximum,omitempty"`
+	ExclusiveMaximum     bool               `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int64             `json:"minLength,omitempty"`
+	MaxLength            *int64             `json:"maxLength,omitempty"`
+	MinItems             *int64             `json:"minItems,omitempty"`
+	MaxItems             *int64             `json:"maxItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// SchemaRef returns a schema referencing the named component schema.
+func SchemaRef(name string) *Schema {
+	return &Schema{Ref: SCHEMA_REF_PREFIX + name}
+}
+
+// ResolveSchema returns the component schema that the schema references,
+// or the schema itself if it isn't a reference.
+func (d *Document) ResolveSchema(s *Schema) (*Schema, error) {
+	if s.Ref == "" {
+		return s, nil
+	}
+
+	name, found := strings.CutPrefix(s.Ref, SCHEMA_REF_PREFIX)
+	if !found {
+		return nil, fmt.Errorf("unsupported schema reference %q", s.Ref)
+	}
+
+	resolved, found := d.Components.Schemas[name]
+	if !found {
+		return nil, fmt.Errorf("unknown schema reference %q", s.Ref)
+	}
+
+	return resolved, nil
+}
+
+// AddServer adds a server URL, such as a telemetry_base_url, to the document.
+func (d *Document) AddServer(url, description string) {
+	d.Servers = append(d.Servers, Server{URL: url, Description: description})
+}
+
+// JSON returns the indented JSON encoding of the document.
+func (d *Document) JSON() (data []byte, err error) {
+	data, err = json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to JSON encode OpenAPI document: %w", err)
+	}
+
+	return append(data, '\n'), nil
+}
+
+// YAML returns the YAML encoding of the document, with the same field
+// ordering as the JSON encoding.
+func (d *Document) YAML() (data []byte, err error) {
+	jsonData, err := d.JSON()
+	if err != nil {
+		return
+	}
+
+	// JSON is valid YAML, so decoding it into a node, rather than a map,
+	// preserves the field ordering when re-encoding it as YAML
+	var node yaml.Node
+	if err = yaml.Unmarshal(jsonData, &node); err != nil {
+		return nil, fmt.Errorf("failed to convert OpenAPI document to YAML: %w", err)
+	}
+	clearStyle(&node)
+
+	data, err = yaml.Marshal(&node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to YAML encode OpenAPI document: %w", err)
+	}
+
+	return
+}
+
+// clearStyle resets the flow and quoting styles that yaml.Unmarshal
+// records for JSON input, so that the document is encoded in block style.
+func clearStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearStyle(child)
+	}
+}
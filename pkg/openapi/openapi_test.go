@@ -0,0 +1,230 @@
+package openapi
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/yaml.v3"
+)
+
+// location of the committed specification, relative to this package
+const committedSpec = "../../doc/api/openapi.yaml"
+
+type OpenAPITestSuite struct {
+	suite.Suite
+
+	doc *Document
+}
+
+func (t *OpenAPITestSuite) SetupTest() {
+	var err error
+	t.doc, err = Generate()
+	t.Require().NoError(err, "should be able to generate OpenAPI document")
+}
+
+// collectRefs returns all of the $ref values found in the decoded document
+func collectRefs(value any, refs map[string]bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if ref, ok := child.(string); ok && key == "$ref" {
+				refs[ref] = true
+				continue
+			}
+			collectRefs(child, refs)
+		}
+	case []any:
+		for _, child := range v {
+			collectRefs(child, refs)
+		}
+	}
+}
+
+func (t *OpenAPITestSuite) TestCommittedSpecUpToDate() {
+	expected, err := t.doc.YAML()
+	t.Require().NoError(err)
+
+	committed, err := os.ReadFile(committedSpec)
+	t.Require().NoError(err)
+
+	t.Equal(string(expected), string(committed), "%s is out of date, regenerate it using `make openapi`", committedSpec)
+}
+
+func (t *OpenAPITestSuite) TestRefsResolve() {
+	data, err := t.doc.JSON()
+	t.Require().NoError(err)
+
+	var decoded map[string]any
+	t.Require().NoError(json.Unmarshal(data, &decoded))
+
+	refs := map[string]bool{}
+	collectRefs(decoded, refs)
+	t.NotEmpty(refs)
+
+	for ref := range refs {
+		var found bool
+		switch {
+		case strings.HasPrefix(ref, SCHEMA_REF_PREFIX):
+			_, found = t.doc.Components.Schemas[strings.TrimPrefix(ref, SCHEMA_REF_PREFIX)]
+		case strings.HasPrefix(ref, "#/components/parameters/"):
+			_, found = t.doc.Components.Parameters[strings.TrimPrefix(ref, "#/components/parameters/")]
+		case strings.HasPrefix(ref, "#/components/responses/"):
+			_, found = t.doc.Components.Responses[strings.TrimPrefix(ref, "#/components/responses/")]
+		}
+		t.True(found, "reference %q should resolve", ref)
+	}
+}
+
+func (t *OpenAPITestSuite) TestYAMLMatchesJSON() {
+	jsonData, err := t.doc.JSON()
+	t.Require().NoError(err)
+	yamlData, err := t.doc.YAML()
+	t.Require().NoError(err)
+
+	var fromJSON, fromYAML any
+	t.Require().NoError(json.Unmarshal(jsonData, &fromJSON))
+	t.Require().NoError(yaml.Unmarshal(yamlData, &fromYAML))
+
+	// re-encode the YAML as JSON to normalise the decoded types
+	reencoded, err := json.Marshal(fromYAML)
+	t.Require().NoError(err)
+	t.Require().NoError(json.Unmarshal(reencoded, &fromYAML))
+
+	t.Equal(fromJSON, fromYAML)
+}
+
+func (t *OpenAPITestSuite) TestOperations() {
+	for _, path := range []string{"/register", "/authenticate", "/report"} {
+		item, found := t.doc.Paths[path]
+		t.Require().True(found, "path %q should be described", path)
+		t.Require().NotNil(item.Post, "path %q should have a POST operation", path)
+		t.Contains(item.Post.Responses, "200")
+		t.Contains(item.Post.Responses, "400")
+	}
+
+	report := t.doc.Paths["/report"].Post
+	t.Equal([]map[string][]string{{SECURITY_BEARER_AUTH: {}}}, report.Security)
+	t.Equal(parameterRef(PARAM_REGISTRATION_ID), report.Parameters[0])
+	t.Equal(responseRef(RESPONSE_UNAUTHORIZED), report.Responses["401"])
+
+	t.Empty(t.doc.Paths["/register"].Post.Security, "/register shouldn't require auth")
+	t.Equal(responseRef(RESPONSE_CONFLICT), t.doc.Paths["/register"].Post.Responses["409"])
+}
+
+func (t *OpenAPITestSuite) TestSchemasFromValidateTags() {
+	schema := func(name string) *Schema {
+		s, found := t.doc.Components.Schemas[name]
+		t.Require().True(found, "schema %q should exist", name)
+		return s
+	}
+
+	registration := schema("ClientRegistration")
+	t.Equal([]string{"clientId", "timestamp"}, registration.Required)
+	t.Equal("uuid", registration.Properties["clientId"].Format)
+	t.Equal("date-time", registration.Properties["timestamp"].Format)
+
+	hash := schema("ClientRegistrationHash")
+	t.Equal([]string{"sha256", "sha512"}, hash.Properties["method"].Enum)
+	t.Equal(`^(?:[0-9a-f]{64}|[0-9a-f]{128})$`, hash.Properties["value"].Pattern)
+
+	response := schema("ClientRegistrationResponse")
+	t.Equal(int64(1), *response.Properties["registrationId"].Minimum)
+	t.Equal("int64", response.Properties["registrationId"].Format)
+
+	// the embedded TelemetryReport fields are flattened into the request
+	report := schema("TelemetryReportRequest")
+	t.Equal([]string{"header", "telemetryBundles"}, report.Required)
+	t.Equal(int64(1), *report.Properties["telemetryBundles"].MinItems)
+	t.Equal(SchemaRef("TelemetryBundle"), report.Properties["telemetryBundles"].Items)
+
+	item := schema("TelemetryDataItem")
+	t.Equal("object", item.Properties["telemetryData"].Type)
+	t.Equal(int64(5), *schema("TelemetryDataItemHeader").Properties["telemetryType"].MinLength)
+	t.Equal(`^[0-9a-f]{32}$`, schema("TelemetryBundleFooter").Properties["checksum"].Pattern)
+
+	resolved, err := t.doc.ResolveSchema(report.Properties["header"])
+	t.Require().NoError(err)
+	t.Equal(schema("TelemetryReportHeader"), resolved)
+}
+
+type ruleTest struct {
+	Items    []string          `json:"items" validate:"required,gt=0,lt=4,dive,min=2"`
+	Count    int               `json:"count,omitempty" validate:"omitempty,gt=0,max=10"`
+	Choice   string            `json:"choice" validate:"oneof=a b c"`
+	Exact    string            `json:"exact" validate:"len=8"`
+	Labels   map[string]string `json:"labels"`
+	Skipped  string            `json:"-"`
+	internal string
+}
+
+type unsupportedRuleTest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type mismatchedRuleTest struct {
+	Count int `json:"count" validate:"uuid"`
+}
+
+type marshalerTest struct {
+	value string
+}
+
+func (m marshalerTest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.value)
+}
+
+type customEncodingTest struct {
+	Value marshalerTest `json:"value"`
+}
+
+func (t *OpenAPITestSuite) TestSchemaRules() {
+	g := newSchemaGenerator()
+
+	ref, err := g.Ref(&ruleTest{})
+	t.Require().NoError(err)
+	t.Equal(SchemaRef("ruleTest"), ref)
+
+	s := g.schemas["ruleTest"]
+	t.Equal([]string{"items"}, s.Required)
+	t.Len(s.Properties, 5)
+	t.NotContains(s.Properties, "Skipped")
+	t.NotContains(s.Properties, "internal")
+
+	items := s.Properties["items"]
+	t.Equal(int64(1), *items.MinItems)
+	t.Equal(int64(3), *items.MaxItems)
+	t.Equal(int64(2), *items.Items.MinLength)
+
+	count := s.Properties["count"]
+	t.Equal(int64(0), *count.Minimum)
+	t.True(count.ExclusiveMinimum)
+	t.Equal(int64(10), *count.Maximum)
+	t.False(count.ExclusiveMaximum)
+
+	t.Equal([]string{"a", "b", "c"}, s.Properties["choice"].Enum)
+	t.Equal(int64(8), *s.Properties["exact"].MinLength)
+	t.Equal(int64(8), *s.Properties["exact"].MaxLength)
+	t.Equal(&Schema{Type: "string"}, s.Properties["labels"].AdditionalProperties)
+
+	// rules with no schema equivalent, or that don't apply to the field
+	// type, and types with custom JSON encodings, should be rejected
+	// rather than silently ignored
+	_, err = g.Ref(&unsupportedRuleTest{})
+	t.ErrorContains(err, `unsupported validate rule "email"`)
+
+	_, err = g.Ref(&mismatchedRuleTest{})
+	t.Error(err)
+
+	_, err = g.Ref(&customEncodingTest{})
+	t.ErrorContains(err, "custom JSON encoding")
+
+	_, err = g.Ref("not a struct")
+	t.Error(err)
+}
+
+func TestOpenAPITestSuite(t *testing.T) {
+	suite.Run(t, new(OpenAPITestSuite))
+}
@@ -0,0 +1,390 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SUSE/telemetry/pkg/types"
+)
+
+// schemas for types with custom JSON encodings, which can't be derived
+// from their struct fields
+var knownSchemas = map[reflect.Type]func() *Schema{
+	reflect.TypeOf(time.Time{}): func() *Schema {
+		return &Schema{Type: "string", Format: "date-time"}
+	},
+	reflect.TypeOf(types.TelemetryTimeStamp{}): func() *Schema {
+		return &Schema{Type: "string", Format: "date-time"}
+	},
+	reflect.TypeOf(json.RawMessage{}): func() *Schema {
+		// see types.TelemetryBlob.Valid()
+		return &Schema{
+			Type:                 "object",
+			Description:          "A versioned JSON object containing the telemetry data",
+			Properties:           map[string]*Schema{"version": {}},
+			Required:             []string{"version"},
+			AdditionalProperties: &Schema{},
+		}
+	},
+}
+
+// formats and patterns (without anchors) equivalent to the string
+// validations used in validate tags
+var (
+	tagFormats = map[string]string{
+		"uuid":         "uuid",
+		"uuid_rfc4122": "uuid",
+	}
+
+	tagPatterns = map[string]string{
+		"jwt":    `[A-Za-z0-9-_]+\.[A-Za-z0-9-_]+\.[A-Za-z0-9-_]*`,
+		"md5":    `[0-9a-f]{32}`,
+		"sha256": `[0-9a-f]{64}`,
+		"sha512": `[0-9a-f]{128}`,
+	}
+
+	// datetime layouts that correspond to the date-time format
+	dateTimeLayouts = []string{time.RFC3339, time.RFC3339Nano}
+)
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// schemaGenerator derives schemas from Go types, adding a component schema
+// for each named struct type encountered.
+type schemaGenerator struct {
+	schemas map[string]*Schema
+	types   map[string]reflect.Type
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		schemas: map[string]*Schema{},
+		types:   map[string]reflect.Type{},
+	}
+}
+
+// Ref returns a reference to the component schema for the value's type,
+// which must be a named struct type.
+func (g *schemaGenerator) Ref(value any) (*Schema, error) {
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || t.Name() == "" {
+		return nil, fmt.Errorf("component schemas require a named struct type, not %s", t)
+	}
+
+	return g.schema(t)
+}
+
+// schema returns the schema for the type, which is a reference to a
+// component schema for named struct types.
+func (g *schemaGenerator) schema(t reflect.Type) (s *Schema, err error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if known, found := knownSchemas[t]; found {
+		return known(), nil
+	}
+
+	if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) {
+		return nil, fmt.Errorf("no schema defined for %s, which has a custom JSON encoding", t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}, nil
+
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}, nil
+
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}, nil
+
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}, nil
+
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes byte slices as base64 strings
+			return &Schema{Type: "string", Format: "byte"}, nil
+		}
+		s = &Schema{Type: "array"}
+		s.Items, err = g.schema(t.Elem())
+		return
+
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		s = &Schema{Type: "object"}
+		s.AdditionalProperties, err = g.schema(t.Elem())
+		return
+
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return g.componentRef(t)
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// componentRef adds a component schema for the named struct type, if not
+// already added, and returns a reference to it.
+func (g *schemaGenerator) componentRef(t reflect.Type) (*Schema, error) {
+	name := t.Name()
+
+	if existing, found := g.types[name]; found {
+		if existing != t {
+			return nil, fmt.Errorf("component schema name %q used by both %s and %s", name, existing, t)
+		}
+		return SchemaRef(name), nil
+	}
+
+	// register the type before generating its schema, to support
+	// recursive types
+	g.types[name] = t
+
+	s, err := g.structSchema(t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s schema: %w", name, err)
+	}
+	g.schemas[name] = s
+
+	return SchemaRef(name), nil
+}
+
+// structSchema returns an object schema for the struct's JSON encoded
+// fields, with embedded structs being flattened as per encoding/json.
+func (g *schemaGenerator) structSchema(t reflect.Type) (s *Schema, err error) {
+	s = &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if jsonName == "-" {
+			continue
+		}
+
+		if field.Anonymous && jsonName == "" && field.Type.Kind() == reflect.Struct {
+			if _, known := knownSchemas[field.Type]; !known {
+				embedded, err := g.structSchema(field.Type)
+				if err != nil {
+					return nil, err
+				}
+				for name, property := range embedded.Properties {
+					s.Properties[name] = property
+				}
+				s.Required = append(s.Required, embedded.Required...)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+
+		property, required, err := g.fieldSchema(field)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+
+		s.Properties[jsonName] = property
+		if required {
+			s.Required = append(s.Required, jsonName)
+		}
+	}
+
+	return
+}
+
+// fieldSchema returns the schema for the struct field, constrained by its
+// validate tag, and whether the field is required.
+func (g *schemaGenerator) fieldSchema(field reflect.StructField) (s *Schema, required bool, err error) {
+	s, err = g.schema(field.Type)
+	if err != nil {
+		return
+	}
+
+	var rules []string
+	if tag := field.Tag.Get("validate"); tag != "" {
+		rules = strings.Split(tag, ",")
+	}
+
+	for _, rule := range rules {
+		if rule == "dive" {
+			break
+		}
+		if rule == "required" {
+			required = true
+		}
+	}
+
+	err = applyRules(s, rules)
+
+	return
+}
+
+// applyRules constrains the schema for the type according to the validate
+// tag rules; rules following a dive apply to the elements of a slice.
+func applyRules(s *Schema, rules []string) (err error) {
+	for i, rule := range rules {
+		switch rule {
+		case "", "required", "omitempty":
+			continue
+
+		case "dive":
+			if s.Type != "array" {
+				// diving into types with custom JSON encodings, such
+				// as json.RawMessage, has no schema equivalent
+				return nil
+			}
+			return applyRules(s.Items, rules[i+1:])
+		}
+
+		if s.Ref != "" {
+			return fmt.Errorf("validate rule %q can't be applied to %s", rule, s.Ref)
+		}
+
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "min", "gte", "gt", "max", "lte", "lt", "len":
+			err = applyLimit(s, name, param)
+
+		case "oneof":
+			s.Enum = strings.Fields(param)
+
+		case "datetime":
+			if !isDateTimeLayout(param) {
+				return fmt.Errorf("unsupported datetime layout %q", param)
+			}
+			s.Format = "date-time"
+
+		default:
+			err = applyStringRule(s, rule)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func isDateTimeLayout(layout string) bool {
+	for _, dateTimeLayout := range dateTimeLayouts {
+		if layout == dateTimeLayout {
+			return true
+		}
+	}
+	return false
+}
+
+// applyLimit applies a numeric limit rule, which constrains the value of
+// numbers, the length of strings, or the number of items in arrays.
+func applyLimit(s *Schema, name, param string) error {
+	limit, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s limit %q: %w", name, param, err)
+	}
+
+	if s.Type == "integer" || s.Type == "number" {
+		switch name {
+		case "min", "gte", "gt":
+			s.Minimum, s.ExclusiveMinimum = &limit, name == "gt"
+		case "max", "lte", "lt":
+			s.Maximum, s.ExclusiveMaximum = &limit, name == "lt"
+		case "len":
+			s.Minimum, s.Maximum = &limit, &limit
+		}
+		return nil
+	}
+
+	var minimum, maximum **int64
+	switch s.Type {
+	case "string":
+		minimum, maximum = &s.MinLength, &s.MaxLength
+	case "array":
+		minimum, maximum = &s.MinItems, &s.MaxItems
+	default:
+		return fmt.Errorf("validate rule %q can't be applied to %s schema", name, s.Type)
+	}
+
+	// lengths are integers, so exclusive limits are converted to
+	// inclusive ones
+	switch name {
+	case "min", "gte":
+		*minimum = &limit
+	case "gt":
+		limit++
+		*minimum = &limit
+	case "max", "lte":
+		*maximum = &limit
+	case "lt":
+		limit--
+		*maximum = &limit
+	case "len":
+		*minimum, *maximum = &limit, &limit
+	}
+
+	return nil
+}
+
+// applyStringRule applies a string format rule, which may specify
+// alternatives, e.g. uuid|uuid_rfc4122, as either a format, if all of the
+// alternatives share the same format, or as a pattern.
+func applyStringRule(s *Schema, rule string) error {
+	if s.Type != "string" {
+		return fmt.Errorf("validate rule %q can't be applied to %s schema", rule, s.Type)
+	}
+
+	alternatives := strings.Split(rule, "|")
+
+	format := tagFormats[alternatives[0]]
+	for _, alternative := range alternatives {
+		if tagFormats[alternative] != format {
+			format = ""
+			break
+		}
+	}
+	if format != "" {
+		s.Format = format
+		return nil
+	}
+
+	patterns := make([]string, 0, len(alternatives))
+	for _, alternative := range alternatives {
+		pattern, found := tagPatterns[alternative]
+		if !found {
+			return fmt.Errorf("unsupported validate rule %q", alternative)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if len(patterns) == 1 {
+		s.Pattern = "^" + patterns[0] + "$"
+	} else {
+		s.Pattern = "^(?:" + strings.Join(patterns, "|") + ")$"
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/SUSE/telemetry/pkg/restapi"
+)
+
+const (
+	// name of the security scheme used for auth tokens
+	SECURITY_BEARER_AUTH = `bearerAuth`
+
+	// names of the shared parameter and response components
+	PARAM_REGISTRATION_ID  = `RegistrationId`
+	PARAM_CONTENT_ENCODING = `ContentEncoding`
+	RESPONSE_BAD_REQUEST   = `BadRequest`
+	RESPONSE_UNAUTHORIZED  = `Unauthorized`
+	RESPONSE_CONFLICT      = `Conflict`
+	RESPONSE_TOO_LARGE     = `ContentTooLarge`
+	RESPONSE_UNSUPPORTED   = `UnsupportedContentEncoding`
+	RESPONSE_TOO_MANY      = `TooManyRequests`
+	RESPONSE_UNAVAILABLE   = `ServiceUnavailable`
+)
+
+// operation describes a POST request to one of the REST API paths
+type operation struct {
+	path        string
+	id          string
+	summary     string
+	description string
+	authorized  bool
+	request     any
+	response    any
+	responses   map[int]string // additional response components, by status code
+}
+
+var operations = []operation{
+	{
+		path:    "/register",
+		id:      "register",
+		summary: "Register a system as a telemetry client and obtain client credentials",
+		description: "Registers the client registration with the telemetry server, which " +
+			"responds with the client's registrationId, and an auth token to use when " +
+			"submitting reports. The client is responsible for persisting these credentials.",
+		request:  &restapi.ClientRegistrationRequest{},
+		response: &restapi.ClientRegistrationResponse{},
+		responses: map[int]string{
+			http.StatusConflict: RESPONSE_CONFLICT,
+		},
+	},
+	{
+		path:    "/authenticate",
+		id:      "authenticate",
+		summary: "Obtain refreshed client credentials",
+		description: "Authenticates a registered client, using a hash of its client " +
+			"registration, and responds with a new auth token.",
+		request:  &restapi.ClientAuthenticationRequest{},
+		response: &restapi.ClientAuthenticationResponse{},
+		responses: map[int]string{
+			http.StatusUnauthorized: RESPONSE_UNAUTHORIZED,
+		},
+	},
+	{
+		path:    "/report",
+		id:      "report",
+		summary: "Submit a telemetry report",
+		description: "Submits a telemetry report containing one or more bundles of " +
+			"telemetry data items, authorized using the client credentials.",
+		authorized: true,
+		request:    &restapi.TelemetryReportRequest{},
+		response:   &restapi.TelemetryReportResponse{},
+		responses: map[int]string{
+			http.StatusUnauthorized:       RESPONSE_UNAUTHORIZED,
+			http.StatusTooManyRequests:    RESPONSE_TOO_MANY,
+			http.StatusServiceUnavailable: RESPONSE_UNAVAILABLE,
+		},
+	},
+}
+
+func jsonContent(schema *Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: schema}}
+}
+
+func responseRef(name string) *Response {
+	return &Response{Ref: "#/components/responses/" + name}
+}
+
+func parameterRef(name string) *Parameter {
+	return &Parameter{Ref: "#/components/parameters/" + name}
+}
+
+// components returns the shared security scheme, parameter and response
+// components, with the schemas they reference added to the generator.
+func components(g *schemaGenerator) (c Components, err error) {
+	errorSchema, err := g.Ref(&restapi.ErrorResponse{})
+	if err != nil {
+		return
+	}
+
+	errorResponse := func(description string) *Response {
+		return &Response{Description: description, Content: jsonContent(errorSchema)}
+	}
+
+	retryAfter := map[string]*Header{
+		"Retry-After": {
+			Description: "The number of seconds the client should wait before retrying",
+			Schema:      &Schema{Type: "integer", Format: "int32"},
+		},
+	}
+
+	// see restapi.ClientRegistrationResponse
+	minRegistrationId := int64(1)
+
+	c.SecuritySchemes = map[string]*SecurityScheme{
+		SECURITY_BEARER_AUTH: {
+			Type:         "http",
+			Scheme:       "bearer",
+			BearerFormat: "JWT",
+			Description:  "The auth token issued to the client by /register or /authenticate",
+		},
+	}
+
+	c.Parameters = map[string]*Parameter{
+		PARAM_REGISTRATION_ID: {
+			Name:        restapi.HEADER_REGISTRATION_ID,
+			In:          "header",
+			Description: "The registrationId of the telemetry client submitting the request",
+			Required:    true,
+			Schema:      &Schema{Type: "integer", Format: "int64", Minimum: &minRegistrationId},
+		},
+		PARAM_CONTENT_ENCODING: {
+			Name:        "Content-Encoding",
+			In:          "header",
+			Description: "The encoding of the request body, if compressed",
+			Schema: &Schema{
+				Type: "string",
+				Enum: []string{
+					restapi.CONTENT_ENCODING_IDENTITY,
+					restapi.CONTENT_ENCODING_GZIP,
+					restapi.CONTENT_ENCODING_ZSTD,
+				},
+			},
+		},
+	}
+
+	c.Responses = map[string]*Response{
+		RESPONSE_BAD_REQUEST: errorResponse("Missing, malformed or invalid request body"),
+		RESPONSE_UNAUTHORIZED: {
+			Description: fmt.Sprintf(
+				"The client must re-authenticate or re-register, as indicated by the "+
+					"scope of the WWW-Authenticate challenge, e.g. %s",
+				restapi.FormatChallenge(restapi.AUTH_SCOPE_AUTHENTICATE),
+			),
+			Headers: map[string]*Header{
+				"WWW-Authenticate": {
+					Description: "The authorization challenge",
+					Required:    true,
+					Schema: &Schema{
+						Type: "string",
+						Pattern: fmt.Sprintf(
+							`^%s realm="%s" scope="(?:%s|%s)"$`,
+							restapi.AUTH_CHALLENGE,
+							restapi.AUTH_REALM,
+							restapi.AUTH_SCOPE_AUTHENTICATE,
+							restapi.AUTH_SCOPE_REGISTER,
+						),
+					},
+				},
+			},
+			Content: jsonContent(errorSchema),
+		},
+		RESPONSE_CONFLICT:    errorResponse("The client registration, or its clientId, is already registered"),
+		RESPONSE_TOO_LARGE:   errorResponse("The decoded request body is too large"),
+		RESPONSE_UNSUPPORTED: errorResponse("The request body's Content-Encoding is not supported"),
+		RESPONSE_TOO_MANY: {
+			Description: "The client is submitting requests too frequently",
+			Headers:     retryAfter,
+			Content:     jsonContent(errorSchema),
+		},
+		RESPONSE_UNAVAILABLE: {
+			Description: "The server is temporarily unable to handle the request",
+			Headers:     retryAfter,
+			Content:     jsonContent(errorSchema),
+		},
+	}
+
+	return
+}
+
+// newOperation returns the OpenAPI operation for the REST API operation.
+func newOperation(g *schemaGenerator, op *operation) (o *Operation, err error) {
+	requestSchema, err := g.Ref(op.request)
+	if err != nil {
+		return
+	}
+
+	responseSchema, err := g.Ref(op.response)
+	if err != nil {
+		return
+	}
+
+	o = &Operation{
+		OperationId: op.id,
+		Summary:     op.summary,
+		Description: op.description,
+		Parameters:  []*Parameter{parameterRef(PARAM_CONTENT_ENCODING)},
+		RequestBody: &RequestBody{
+			Required: true,
+			Content:  jsonContent(requestSchema),
+		},
+		Responses: map[string]*Response{
+			strconv.Itoa(http.StatusOK): {
+				Description: "Success",
+				Content:     jsonContent(responseSchema),
+			},
+			strconv.Itoa(http.StatusBadRequest):            responseRef(RESPONSE_BAD_REQUEST),
+			strconv.Itoa(http.StatusRequestEntityTooLarge): responseRef(RESPONSE_TOO_LARGE),
+			strconv.Itoa(http.StatusUnsupportedMediaType):  responseRef(RESPONSE_UNSUPPORTED),
+		},
+	}
+
+	if op.authorized {
+		o.Parameters = append([]*Parameter{parameterRef(PARAM_REGISTRATION_ID)}, o.Parameters...)
+		o.Security = []map[string][]string{{SECURITY_BEARER_AUTH: {}}}
+	}
+
+	for statusCode, name := range op.responses {
+		o.Responses[strconv.Itoa(statusCode)] = responseRef(name)
+	}
+
+	return
+}
+
+// Generate returns the OpenAPI document describing the telemetry client
+// REST API.
+func Generate() (d *Document, err error) {
+	g := newSchemaGenerator()
+
+	d = &Document{
+		OpenAPI: OPENAPI_VERSION,
+		Info: Info{
+			Title: "SUSE Telemetry Client REST API",
+			Description: "The REST API used by telemetry clients to register with, and " +
+				"submit telemetry reports to, a telemetry server or relay. Paths are " +
+				"relative to the telemetry_base_url.",
+			Version: API_VERSION,
+		},
+		Paths: map[string]*PathItem{},
+	}
+
+	d.Components, err = components(g)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range operations {
+		op, err := newOperation(g, &operations[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate %s operation: %w", operations[i].path, err)
+		}
+		d.Paths[operations[i].path] = &PathItem{Post: op}
+	}
+
+	d.Components.Schemas = g.schemas
+
+	return
+}
@@ -0,0 +1,203 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	telemetrylib "github.com/SUSE/telemetry/pkg/lib"
+	"github.com/SUSE/telemetry/pkg/restapi"
+	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// issuer of the auth tokens issued to downstream clients
+const TOKEN_ISSUER = `suse-telemetry-relay`
+
+// issueToken creates a signed auth token for the specified client.
+func (r *Relay) issueToken(registrationId int64) (token string, err error) {
+	now := time.Now()
+	token, err = jwt.NewWithClaims(
+		jwt.SigningMethodHS256,
+		jwt.RegisteredClaims{
+			Issuer:    TOKEN_ISSUER,
+			Subject:   strconv.FormatInt(registrationId, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(r.cfg.Relay.TokenDuration)),
+		},
+	).SignedString(r.registry.SigningKey())
+	if err != nil {
+		return "", fmt.Errorf("failed to sign auth token: %w", err)
+	}
+
+	return
+}
+
+// verifyToken verifies that the auth token was issued to the specified
+// client, either by the relay or, if configured, by a trusted external auth
+// service, and has not expired.
+func (r *Relay) verifyToken(token string, registrationId int64) (err error) {
+	var claims jwt.RegisteredClaims
+	_, err = jwt.ParseWithClaims(
+		token,
+		&claims,
+		func(*jwt.Token) (any, error) {
+			return r.registry.SigningKey(), nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(TOKEN_ISSUER),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil && r.verifier != nil {
+		claims = jwt.RegisteredClaims{}
+		_, err = r.verifier.Verify(token, &claims)
+	}
+	if err != nil {
+		return
+	}
+
+	if claims.Subject != strconv.FormatInt(registrationId, 10) {
+		return fmt.Errorf("auth token subject %q doesn't match registration id %d", claims.Subject, registrationId)
+	}
+
+	return
+}
+
+// verifyClientAuth verifies that the client is registered with the relay,
+// and that it presented a valid auth token issued to it.
+func (r *Relay) verifyClientAuth(ctx context.Context, auth restapi.ClientAuth) (err error) {
+	if _, found := r.registry.Lookup(auth.RegistrationId); !found {
+		return restapi.ErrClientNotRegistered
+	}
+
+	return r.verifyToken(auth.AuthToken, auth.RegistrationId)
+}
+
+func (r *Relay) registerHandler(w http.ResponseWriter, req *http.Request) {
+	var crReq restapi.ClientRegistrationRequest
+	if !restapi.DecodeRequest(w, req, MAX_REQUEST_SIZE, &crReq) {
+		return
+	}
+
+	client, err := r.registry.Register(crReq.ClientRegistration)
+	if err != nil {
+		slog.Error(
+			"failed to register client",
+			slog.String("clientId", crReq.ClientRegistration.ClientId),
+			slog.String("err", err.Error()),
+		)
+		restapi.WriteError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	authToken, err := r.issueToken(client.RegistrationId)
+	if err != nil {
+		slog.Error("failed to issue auth token", slog.String("err", err.Error()))
+		restapi.WriteError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	slog.Info(
+		"Registered relay client",
+		slog.String("clientId", client.Registration.ClientId),
+		slog.Int64("registrationId", client.RegistrationId),
+	)
+
+	restapi.WriteJSON(w, http.StatusOK, &restapi.ClientRegistrationResponse{
+		RegistrationId:   client.RegistrationId,
+		AuthToken:        authToken,
+		RegistrationDate: client.RegistrationDate,
+	})
+}
+
+func (r *Relay) authenticateHandler(w http.ResponseWriter, req *http.Request) {
+	var caReq restapi.ClientAuthenticationRequest
+	if !restapi.DecodeRequest(w, req, MAX_REQUEST_SIZE, &caReq) {
+		return
+	}
+
+	// clients that are unknown, or whose registration doesn't match, need
+	// to register again
+	client, found := r.registry.Lookup(caReq.RegistrationId)
+	if !found || !client.Registration.Hash(caReq.RegHash.Method).Match(&caReq.RegHash) {
+		slog.Debug(
+			"client authentication failed",
+			slog.Int64("registrationId", caReq.RegistrationId),
+			slog.Bool("found", found),
+		)
+		restapi.WriteChallenge(w, restapi.AUTH_SCOPE_REGISTER)
+		return
+	}
+
+	authToken, err := r.issueToken(client.RegistrationId)
+	if err != nil {
+		slog.Error("failed to issue auth token", slog.String("err", err.Error()))
+		restapi.WriteError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	restapi.WriteJSON(w, http.StatusOK, &restapi.ClientAuthenticationResponse{
+		RegistrationId:   client.RegistrationId,
+		AuthToken:        authToken,
+		RegistrationDate: client.RegistrationDate,
+	})
+}
+
+func (r *Relay) reportHandler(w http.ResponseWriter, req *http.Request) {
+	// the client auth has been verified by the middleware
+	auth, _ := restapi.ClientAuthFromContext(req.Context())
+	registrationId := auth.RegistrationId
+
+	// the relay can't annotate bundles until it is registered upstream
+	if r.client.RegistrationId() == 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(r.cfg.Relay.CheckInterval.Seconds())))
+		restapi.WriteError(w, http.StatusServiceUnavailable, "relay not registered upstream")
+		return
+	}
+
+	var trReq restapi.TelemetryReportRequest
+	if !restapi.DecodeRequest(w, req, MAX_REQUEST_SIZE, &trReq) {
+		return
+	}
+
+	err := trReq.VerifyChecksum()
+	if err != nil {
+		restapi.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if r.mode == RELAY_MODE_PROXY {
+		if err = r.ProxyContext(req.Context(), &trReq.TelemetryReport, registrationId); err != nil {
+			slog.Warn(
+				"failed to proxy relayed report",
+				slog.String("reportId", trReq.Header.ReportId),
+				slog.String("err", err.Error()),
+			)
+			r.writeProxyError(w, err)
+			return
+		}
+
+		restapi.WriteJSON(w, http.StatusOK, restapi.NewTelemetryReportResponse(0, types.Now()))
+		return
+	}
+
+	if err = r.StageContext(req.Context(), &trReq.TelemetryReport, registrationId); err != nil {
+		slog.Error(
+			"failed to stage relayed report",
+			slog.String("reportId", trReq.Header.ReportId),
+			slog.String("err", err.Error()),
+		)
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, telemetrylib.ErrChecksumMismatch) {
+			statusCode = http.StatusBadRequest
+		}
+		restapi.WriteError(w, statusCode, err.Error())
+		return
+	}
+
+	restapi.WriteJSON(w, http.StatusOK, restapi.NewTelemetryReportResponse(0, types.Now()))
+}
@@ -0,0 +1,152 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/SUSE/telemetry/pkg/client"
+	"github.com/SUSE/telemetry/pkg/config"
+	telemetrylib "github.com/SUSE/telemetry/pkg/lib"
+	"github.com/SUSE/telemetry/pkg/restapi"
+	"github.com/SUSE/telemetry/pkg/types"
+)
+
+const (
+	// supported relay modes
+	RELAY_MODE_AUTO  = `auto`
+	RELAY_MODE_STAGE = `stage`
+	RELAY_MODE_PROXY = `proxy`
+
+	// proxied reports are submitted upstream with at most one retry
+	PROXY_MAX_TRIES = 2
+
+	// longest delay between proxied report submission attempts, with the
+	// client being asked to retry later if the upstream server wants a
+	// longer delay
+	PROXY_MAX_RETRY_DELAY = 5 * time.Second
+
+	// how long clients are asked to wait before retrying a failed proxied
+	// report, if the upstream server didn't specify a delay
+	PROXY_RETRY_AFTER = 1 * time.Minute
+
+	// longest a proxied report waits for other upstream submissions to
+	// complete, with the client being asked to retry later if it can't be
+	// submitted in time
+	PROXY_MAX_SUBMIT_WAIT = 10 * time.Second
+)
+
+var (
+	// returned when a proxied report couldn't be submitted upstream because
+	// other upstream submissions took too long to complete
+	ErrUpstreamBusy = errors.New("upstream submission busy")
+)
+
+// relayMode determines the relay mode to use, resolving the auto mode
+// based upon whether the datastore used for staging is persistent.
+func relayMode(cfg *config.RelayConfig, tc *client.TelemetryClient) (mode string, err error) {
+	switch cfg.Mode {
+	case "", RELAY_MODE_AUTO:
+		mode = RELAY_MODE_STAGE
+		if !tc.PersistentDatastore() {
+			mode = RELAY_MODE_PROXY
+		}
+	case RELAY_MODE_STAGE, RELAY_MODE_PROXY:
+		mode = cfg.Mode
+	default:
+		return "", fmt.Errorf(
+			"unsupported relay mode %q, must be one of %s, %s or %s",
+			cfg.Mode,
+			RELAY_MODE_AUTO,
+			RELAY_MODE_STAGE,
+			RELAY_MODE_PROXY,
+		)
+	}
+
+	return
+}
+
+// Proxy annotates the bundles in the report received from the specified
+// downstream client and immediately submits them upstream in a new report,
+// without staging them locally.
+func (r *Relay) Proxy(report *telemetrylib.TelemetryReport, clientRegistrationId int64) (err error) {
+	return r.ProxyContext(context.Background(), report, clientRegistrationId)
+}
+
+// ProxyContext is the context aware variant of Proxy.
+func (r *Relay) ProxyContext(ctx context.Context, report *telemetrylib.TelemetryReport, clientRegistrationId int64) (err error) {
+	tag := string(r.RelayedViaTag(clientRegistrationId))
+	for i := range report.TelemetryBundles {
+		header := &report.TelemetryBundles[i].Header
+		if !slices.Contains(header.BundleAnnotations, tag) {
+			header.BundleAnnotations = append(header.BundleAnnotations, tag)
+		}
+	}
+
+	// the relay is the client submitting the upstream report
+	upstreamReport, err := telemetrylib.NewTelemetryReport(r.client.ClientId(), types.Tags{})
+	if err != nil {
+		return fmt.Errorf("failed to create upstream report: %w", err)
+	}
+	upstreamReport.TelemetryBundles = report.TelemetryBundles
+	if err = upstreamReport.UpdateChecksum(); err != nil {
+		return fmt.Errorf("failed to update upstream report checksum: %w", err)
+	}
+
+	// the telemetry client isn't safe for concurrent submissions, so wait,
+	// for a limited time, for any other upstream submission to complete
+	waitCtx, cancel := context.WithTimeout(ctx, r.proxySubmitWait)
+	err = r.lockSubmission(waitCtx)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to proxy report %q: %w: %w", report.Header.ReportId, ErrUpstreamBusy, err)
+	}
+	defer r.unlockSubmission()
+
+	_, err = r.client.SubmitReportContext(ctx, upstreamReport, PROXY_MAX_TRIES, PROXY_MAX_RETRY_DELAY)
+	if err != nil {
+		return fmt.Errorf("failed to proxy report %q: %w", report.Header.ReportId, err)
+	}
+
+	slog.Debug(
+		"Proxied relayed report",
+		slog.String("reportId", report.Header.ReportId),
+		slog.String("upstreamReportId", upstreamReport.Header.ReportId),
+		slog.Int("bundles", len(report.TelemetryBundles)),
+		slog.Int64("registrationId", clientRegistrationId),
+	)
+
+	return
+}
+
+// writeProxyError responds to a failed proxied report, passing through
+// upstream rejections that resubmitting the same report won't resolve, and
+// otherwise asking the client to retry later.
+func (r *Relay) writeProxyError(w http.ResponseWriter, err error) {
+	var statusErr *client.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+			restapi.WriteError(w, statusErr.StatusCode, err.Error())
+			return
+		}
+	}
+
+	retryAfter := PROXY_RETRY_AFTER
+	switch {
+	case errors.Is(err, client.ErrServerBackoff):
+		retryAfter = time.Until(r.client.SubmitNotBefore())
+	case errors.As(err, &statusErr) && statusErr.RetryAfter > 0:
+		retryAfter = statusErr.RetryAfter
+	}
+
+	// round up to whole seconds, as required by the Retry-After header
+	seconds := int64((max(retryAfter, time.Second) + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	restapi.WriteError(w, http.StatusServiceUnavailable, "upstream submission failed, retry later")
+}
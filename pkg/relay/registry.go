@@ -0,0 +1,245 @@
+package relay
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+
+	"github.com/SUSE/telemetry/pkg/config"
+	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/SUSE/telemetry/pkg/utils"
+)
+
+const (
+	REGISTRY_NAME = `relay-clients`
+	REGISTRY_PERM = 0600
+
+	// size in bytes of the generated auth token signing secret
+	REGISTRY_SECRET_SIZE = 32
+)
+
+// RelayClient is a downstream client that has registered with the relay.
+type RelayClient struct {
+	RegistrationId   int64                    `json:"registrationId"`
+	Registration     types.ClientRegistration `json:"registration"`
+	RegistrationDate string                   `json:"registrationDate"`
+}
+
+// RelayRegistry tracks the downstream clients that have registered with
+// the relay, along with the secret used to sign the auth tokens issued to
+// them, persisted in the config dir so that registrations, and issued auth
+// tokens, remain valid across relay restarts.
+type RelayRegistry struct {
+	Secret  string                 `json:"secret"`
+	NextId  int64                  `json:"nextId"`
+	Clients map[int64]*RelayClient `json:"clients"`
+
+	mutex        sync.Mutex
+	config       *config.Config
+	registryFile utils.FileManager
+}
+
+func NewRelayRegistry(cfg *config.Config) (*RelayRegistry, error) {
+	registryPath := filepath.Join(cfg.ConfigDir(), REGISTRY_NAME)
+	r := &RelayRegistry{
+		NextId:  1,
+		Clients: map[int64]*RelayClient{},
+		config:  cfg,
+	}
+
+	// create a managed file to manage the registry file based upon
+	// the location, ownership and permissions of the config file with
+	// backups disabled.
+	fm := utils.NewManagedFile()
+	err := fm.Init(
+		registryPath,
+		r.config.ConfigUser(),
+		r.config.ConfigGroup(),
+		REGISTRY_PERM,
+	)
+	fm.DisableBackups()
+
+	if err != nil {
+		slog.Debug(
+			"failed to setup relay registry file manager",
+			slog.String("path", registryPath),
+			slog.String("err", err.Error()),
+		)
+		return nil, fmt.Errorf("failed to setup relay registry file manager: %w", err)
+	}
+
+	r.registryFile = fm
+
+	return r, nil
+}
+
+func (r *RelayRegistry) String() string {
+	return fmt.Sprintf("<p:%q, n:%d, c:%d>", r.Path(), r.NextId, len(r.Clients))
+}
+
+func (r *RelayRegistry) Exists() bool {
+	exists, _ := r.registryFile.Exists()
+	return exists
+}
+
+func (r *RelayRegistry) Path() string {
+	return r.registryFile.Path()
+}
+
+// Setup loads the registry, if it exists, generating and saving a new
+// auth token signing secret if one isn't available.
+func (r *RelayRegistry) Setup() (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err = r.load(); err != nil {
+		return
+	}
+
+	if r.Secret != "" {
+		return
+	}
+
+	secret := make([]byte, REGISTRY_SECRET_SIZE)
+	if _, err = rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate relay auth secret: %w", err)
+	}
+	r.Secret = hex.EncodeToString(secret)
+
+	return r.save()
+}
+
+// SigningKey returns the key used to sign issued auth tokens.
+func (r *RelayRegistry) SigningKey() []byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return []byte(r.Secret)
+}
+
+// Register records a newly registered client, assigning it a new
+// registration id, and replacing any existing registration for the same
+// client id.
+func (r *RelayRegistry) Register(reg types.ClientRegistration) (client *RelayClient, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for id, existing := range r.Clients {
+		if existing.Registration.ClientId == reg.ClientId {
+			delete(r.Clients, id)
+		}
+	}
+
+	client = &RelayClient{
+		RegistrationId:   r.NextId,
+		Registration:     reg,
+		RegistrationDate: types.Now().String(),
+	}
+	r.Clients[client.RegistrationId] = client
+	r.NextId++
+
+	if err = r.save(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// Lookup returns the client registered with the specified registration
+// id, if any.
+func (r *RelayRegistry) Lookup(registrationId int64) (client *RelayClient, found bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	client, found = r.Clients[registrationId]
+	return
+}
+
+func (r *RelayRegistry) save() (err error) {
+	err = r.registryFile.Create()
+	if err != nil {
+		slog.Debug(
+			"failed to create/open relay registry",
+			slog.String("path", r.Path()),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+	defer r.registryFile.Close()
+
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		slog.Error(
+			"failed to json.Marshal() relay registry",
+			slog.String("registry", r.String()),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	err = r.registryFile.Update(bytes)
+	if err != nil {
+		slog.Error(
+			"failed to save relay registry file",
+			slog.String("registry", r.String()),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	slog.Debug(
+		"relay registry saved",
+		slog.String("registry", r.String()),
+	)
+	return
+}
+
+func (r *RelayRegistry) load() (err error) {
+	// nothing to load if the registry file doesn't exist
+	if !r.Exists() {
+		return
+	}
+
+	err = r.registryFile.Open(
+		false, // no need to create, should already exist
+	)
+	if err != nil {
+		slog.Error(
+			"failed to open relay registry",
+			slog.String("path", r.Path()),
+		)
+		return
+	}
+	defer r.registryFile.Close()
+
+	bytes, err := r.registryFile.Read()
+	if err != nil {
+		slog.Error(
+			"failed to read relay registry file",
+			slog.String("path", r.Path()),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	err = json.Unmarshal(bytes, r)
+	if err != nil {
+		slog.Error(
+			"failed to json.Unmarshal() relay registry file contents",
+			slog.String("path", r.Path()),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	slog.Debug(
+		"relay registry loaded",
+		slog.String("registry", r.String()),
+	)
+
+	return
+}
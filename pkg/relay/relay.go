@@ -0,0 +1,407 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SUSE/telemetry/pkg/auth"
+	"github.com/SUSE/telemetry/pkg/client"
+	"github.com/SUSE/telemetry/pkg/config"
+	telemetrylib "github.com/SUSE/telemetry/pkg/lib"
+	"github.com/SUSE/telemetry/pkg/restapi"
+	"github.com/SUSE/telemetry/pkg/types"
+)
+
+const (
+	// tag used to annotate bundles with the path via which they were relayed
+	RELAYED_VIA_TAG = telemetrylib.RELAYED_VIA_TAG
+
+	// maximum size in bytes of a decoded request body
+	MAX_REQUEST_SIZE = 64 << 20
+
+	// time allowed for in-flight requests to complete during shutdown
+	SHUTDOWN_TIMEOUT = 30 * time.Second
+)
+
+// Relay is a telemetry server for downstream clients that stages the
+// telemetry bundles it receives from them, forwarding them upstream, via
+// a telemetry client, once enough bundles have been staged or the oldest
+// staged bundle has been waiting long enough. Alternatively, in proxy
+// mode, received telemetry is forwarded upstream before responding.
+type Relay struct {
+	cfg      *config.Config
+	client   *client.TelemetryClient
+	registry *RelayRegistry
+	mode     string
+
+	// optional verifier of auth tokens issued to downstream clients by an
+	// external auth service
+	verifier *auth.Verifier
+
+	// serialises the staging of received bundles with creating the reports
+	// that forward them
+	mutex sync.Mutex
+
+	// serialises upstream submissions, whether forwarding staged telemetry
+	// or proxying received reports, which the telemetry client doesn't
+	// support concurrently; it is never held while staging, so that
+	// downstream clients aren't blocked by a slow upstream server
+	submitLock chan struct{}
+
+	// how long a proxied report waits for other upstream submissions
+	proxySubmitWait time.Duration
+
+	// when bundles were first staged since they were last forwarded
+	firstStaged time.Time
+}
+
+func NewRelay(cfg *config.Config) (r *Relay, err error) {
+	tc, err := client.NewTelemetryClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup relay telemetry client: %w", err)
+	}
+
+	mode, err := relayMode(&cfg.Relay, tc)
+	if err != nil {
+		return
+	}
+
+	registry, err := NewRelayRegistry(cfg)
+	if err != nil {
+		return
+	}
+
+	if err = registry.Setup(); err != nil {
+		return nil, fmt.Errorf("failed to setup relay registry: %w", err)
+	}
+
+	r = &Relay{
+		cfg:        cfg,
+		client:     tc,
+		registry:   registry,
+		mode:       mode,
+		submitLock: make(chan struct{}, 1),
+
+		proxySubmitWait: PROXY_MAX_SUBMIT_WAIT,
+	}
+
+	if cfg.Relay.Verify.Enabled() {
+		r.verifier, err = auth.NewVerifier(&cfg.Relay.Verify)
+		if err != nil {
+			return nil, fmt.Errorf("failed to setup relay token verification: %w", err)
+		}
+	}
+
+	return
+}
+
+// Client returns the telemetry client used to forward telemetry upstream
+func (r *Relay) Client() *client.TelemetryClient {
+	return r.client
+}
+
+// Registry returns the registry of downstream clients
+func (r *Relay) Registry() *RelayRegistry {
+	return r.registry
+}
+
+// Mode returns the mode in which the relay is operating, either stage or
+// proxy
+func (r *Relay) Mode() string {
+	return r.mode
+}
+
+// Handler returns the HTTP handler that serves downstream client requests
+func (r *Relay) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /register", r.registerHandler)
+	mux.HandleFunc("POST /authenticate", r.authenticateHandler)
+	mux.Handle("POST /report", restapi.RequireClientAuth(r.verifyClientAuth)(http.HandlerFunc(r.reportHandler)))
+	return mux
+}
+
+// Run registers the relay with the upstream server and serves downstream
+// client requests on the configured listen address until the context is
+// done, periodically forwarding staged telemetry upstream.
+func (r *Relay) Run(ctx context.Context) (err error) {
+	listener, err := net.Listen("tcp", r.cfg.Relay.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %q: %w", r.cfg.Relay.Listen, err)
+	}
+
+	return r.Serve(ctx, listener)
+}
+
+// Serve is like Run but serves downstream client requests via the
+// provided listener.
+func (r *Relay) Serve(ctx context.Context, listener net.Listener) (err error) {
+	if err = r.client.RegisterContext(ctx); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to register relay upstream: %w", err)
+	}
+
+	// ensure that any telemetry staged by a previous run is forwarded
+	if r.mode == RELAY_MODE_STAGE {
+		if err = r.checkStaged(ctx); err != nil {
+			listener.Close()
+			return
+		}
+	}
+
+	server := &http.Server{
+		Handler: r.Handler(),
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	slog.Info(
+		"Telemetry relay started",
+		slog.String("listen", listener.Addr().String()),
+		slog.Int64("registrationId", r.client.RegistrationId()),
+		slog.String("mode", r.mode),
+	)
+
+	// only staged telemetry needs to be periodically forwarded
+	var tick <-chan time.Time
+	if r.mode == RELAY_MODE_STAGE {
+		ticker := time.NewTicker(r.cfg.Relay.CheckInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case err = <-serveErr:
+			return fmt.Errorf("relay server failed: %w", err)
+		case <-tick:
+			if err := r.ForwardIfNeededContext(ctx); err != nil {
+				slog.Warn(
+					"Failed to forward staged telemetry",
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+
+	if err = server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn(
+			"Failed to shutdown relay server cleanly",
+			slog.String("error", err.Error()),
+		)
+	}
+
+	// make a best effort attempt to forward anything that has been staged
+	if r.mode != RELAY_MODE_STAGE {
+		return nil
+	}
+	if err := r.ForwardContext(shutdownCtx); err != nil {
+		slog.Warn(
+			"Failed to forward staged telemetry during shutdown",
+			slog.String("error", err.Error()),
+		)
+	}
+
+	return nil
+}
+
+// checkStaged initialises the staging age tracking based upon whether
+// there is any previously staged telemetry waiting to be forwarded.
+func (r *Relay) checkStaged(ctx context.Context) (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	processor := r.client.Processor()
+
+	bundleCount, err := processor.BundleCountContext(ctx, "NULL")
+	if err != nil {
+		return fmt.Errorf("failed to count staged bundles: %w", err)
+	}
+
+	reportRows, err := processor.GetPendingReportRowsContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve pending reports: %w", err)
+	}
+
+	if bundleCount > 0 || len(reportRows) > 0 {
+		r.firstStaged = time.Now()
+	}
+
+	return
+}
+
+// RelayedViaTag returns the tag used to annotate bundles received from the
+// downstream client with the specified registration id.
+func (r *Relay) RelayedViaTag(clientRegistrationId int64) types.Tag {
+	return types.Tag(fmt.Sprintf(
+		"%s=%d:%d",
+		RELAYED_VIA_TAG,
+		clientRegistrationId,
+		r.client.RegistrationId(),
+	))
+}
+
+// Stage annotates the bundles in the report received from the specified
+// downstream client and stages them for forwarding upstream.
+func (r *Relay) Stage(report *telemetrylib.TelemetryReport, clientRegistrationId int64) (err error) {
+	return r.StageContext(context.Background(), report, clientRegistrationId)
+}
+
+// StageContext is the context aware variant of Stage.
+func (r *Relay) StageContext(ctx context.Context, report *telemetrylib.TelemetryReport, clientRegistrationId int64) (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	tags := types.Tags{r.RelayedViaTag(clientRegistrationId)}
+	for i := range report.TelemetryBundles {
+		bundle := &report.TelemetryBundles[i]
+		if _, err = r.client.Processor().AddBundleContext(ctx, bundle, tags); err != nil {
+			return fmt.Errorf("failed to stage bundle %q: %w", bundle.Header.BundleId, err)
+		}
+	}
+
+	if r.firstStaged.IsZero() {
+		r.firstStaged = time.Now()
+	}
+
+	slog.Debug(
+		"Staged relayed report",
+		slog.String("reportId", report.Header.ReportId),
+		slog.Int("bundles", len(report.TelemetryBundles)),
+		slog.Int64("registrationId", clientRegistrationId),
+	)
+
+	return
+}
+
+// ForwardIfNeeded forwards the staged telemetry upstream if enough bundles
+// have been staged, or the oldest has been staged for long enough.
+func (r *Relay) ForwardIfNeeded() (err error) {
+	return r.ForwardIfNeededContext(context.Background())
+}
+
+// ForwardIfNeededContext is the context aware variant of ForwardIfNeeded.
+func (r *Relay) ForwardIfNeededContext(ctx context.Context) (err error) {
+	needed, err := r.forwardNeeded(ctx)
+	if err != nil || !needed {
+		return
+	}
+
+	return r.forward(ctx)
+}
+
+// forwardNeeded returns whether enough bundles have been staged, or the
+// oldest has been staged for long enough, to forward them upstream.
+func (r *Relay) forwardNeeded(ctx context.Context) (needed bool, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.firstStaged.IsZero() {
+		return
+	}
+
+	bundleCount, err := r.client.Processor().BundleCountContext(ctx, "NULL")
+	if err != nil {
+		return false, fmt.Errorf("failed to count staged bundles: %w", err)
+	}
+
+	age := time.Since(r.firstStaged)
+	if bundleCount < r.cfg.Relay.MaxBundles && age < r.cfg.Relay.MaxAge {
+		return
+	}
+
+	slog.Info(
+		"Forwarding staged telemetry",
+		slog.Int("bundles", bundleCount),
+		slog.Duration("age", age),
+	)
+
+	return true, nil
+}
+
+// Forward forwards all staged telemetry upstream.
+func (r *Relay) Forward() (err error) {
+	return r.ForwardContext(context.Background())
+}
+
+// ForwardContext is the context aware variant of Forward.
+func (r *Relay) ForwardContext(ctx context.Context) (err error) {
+	return r.forward(ctx)
+}
+
+// lockSubmission waits until no other upstream submission is in progress,
+// or the context is done.
+func (r *Relay) lockSubmission(ctx context.Context) (err error) {
+	select {
+	case r.submitLock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Relay) unlockSubmission() {
+	<-r.submitLock
+}
+
+// forward creates reports from the staged bundles and submits them
+// upstream, only holding the staging lock while the reports are created,
+// so that received bundles can continue to be staged while the upstream
+// submission, and any retries, are in progress.
+func (r *Relay) forward(ctx context.Context) (err error) {
+	if err = r.lockSubmission(ctx); err != nil {
+		return fmt.Errorf("failed to wait for upstream submission: %w", err)
+	}
+	defer r.unlockSubmission()
+
+	firstStaged, err := r.createReports(ctx)
+	if err != nil {
+		return
+	}
+
+	if err = r.client.SubmitContext(ctx); err != nil {
+		// the reports remain staged and will be forwarded again later, so
+		// they should still count towards the staging age
+		r.mutex.Lock()
+		if !firstStaged.IsZero() && (r.firstStaged.IsZero() || firstStaged.Before(r.firstStaged)) {
+			r.firstStaged = firstStaged
+		}
+		r.mutex.Unlock()
+
+		return fmt.Errorf("failed to submit reports: %w", err)
+	}
+
+	return
+}
+
+// createReports creates reports from the staged bundles, resetting the
+// staging age so that bundles staged while they are submitted are tracked
+// separately, and returning when the reported bundles were first staged.
+func (r *Relay) createReports(ctx context.Context) (firstStaged time.Time, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err = r.client.CreateReportsContext(ctx, types.Tags{}); err != nil {
+		return firstStaged, fmt.Errorf("failed to create reports: %w", err)
+	}
+
+	firstStaged, r.firstStaged = r.firstStaged, time.Time{}
+
+	return
+}
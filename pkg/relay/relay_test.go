@@ -0,0 +1,620 @@
+package relay
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SUSE/telemetry/pkg/client"
+	"github.com/SUSE/telemetry/pkg/config"
+	telemetrylib "github.com/SUSE/telemetry/pkg/lib"
+	"github.com/SUSE/telemetry/pkg/restapi"
+	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	// registration id assigned to the relay by the upstream test server
+	upstreamRegistrationId = 42
+
+	relayClientId      = "0ec6ed41-35e4-4a8c-a7e1-4ef5e1e7c8a7"
+	downstreamClientId = "d19ecc03-787c-469b-8bf5-71df704f3b16"
+)
+
+type RelayTestSuite struct {
+	suite.Suite
+
+	// datastore driver used by the relay and its clients
+	driver string
+
+	tmpDir string
+
+	// upstream test server and the reports it has received, failing the
+	// first upstreamFailures report requests with upstreamStatus
+	upstream         *httptest.Server
+	mutex            sync.Mutex
+	received         []*telemetrylib.TelemetryReport
+	reportRequests   int
+	upstreamFailures int
+	upstreamStatus   int
+
+	// if set, the next report request signals upstreamEntered, and then
+	// waits for upstreamRelease to be closed before being handled
+	upstreamEntered chan struct{}
+	upstreamRelease chan struct{}
+
+	// relay under test, and the test server serving its handler
+	relay       *Relay
+	relayServer *httptest.Server
+}
+
+func (t *RelayTestSuite) SetupTest() {
+	tmpDir, err := os.MkdirTemp("", ".relayTest.*")
+	t.Require().NoError(err, "os.MkdirTemp()")
+	t.tmpDir = tmpDir
+
+	t.received = nil
+	t.reportRequests = 0
+	t.upstreamFailures = 0
+	t.upstreamEntered = nil
+	t.upstreamRelease = nil
+	t.upstream = httptest.NewServer(t.upstreamMux())
+}
+
+func (t *RelayTestSuite) TearDownTest() {
+	if t.relayServer != nil {
+		t.relayServer.Close()
+		t.relayServer = nil
+	}
+	t.upstream.Close()
+
+	err := os.RemoveAll(t.tmpDir)
+	t.NoError(err, "os.RemoveAll(t.tmpDir)")
+}
+
+func (t *RelayTestSuite) upstreamMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /register", func(w http.ResponseWriter, r *http.Request) {
+		token, err := jwt.NewWithClaims(
+			jwt.SigningMethodHS256,
+			jwt.MapClaims{
+				"exp": jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				"iss": "relay-test-upstream",
+			},
+		).SignedString([]byte("upstream"))
+		t.Require().NoError(err)
+
+		restapi.WriteJSON(w, http.StatusOK, &restapi.ClientRegistrationResponse{
+			RegistrationId:   upstreamRegistrationId,
+			AuthToken:        token,
+			RegistrationDate: types.Now().String(),
+		})
+	})
+
+	mux.HandleFunc("POST /report", func(w http.ResponseWriter, r *http.Request) {
+		t.mutex.Lock()
+		t.reportRequests++
+		fail := t.reportRequests <= t.upstreamFailures
+		entered, release := t.upstreamEntered, t.upstreamRelease
+		t.upstreamEntered, t.upstreamRelease = nil, nil
+		t.mutex.Unlock()
+		if release != nil {
+			close(entered)
+			<-release
+		}
+		if fail {
+			http.Error(w, http.StatusText(t.upstreamStatus), t.upstreamStatus)
+			return
+		}
+
+		var trReq restapi.TelemetryReportRequest
+		reqBytes, err := restapi.ReadRequestBody(r, 0)
+		t.Require().NoError(err)
+		t.Require().NoError(json.Unmarshal(reqBytes, &trReq))
+		t.Require().NoError(trReq.Validate())
+
+		t.mutex.Lock()
+		t.received = append(t.received, &trReq.TelemetryReport)
+		t.mutex.Unlock()
+
+		restapi.WriteJSON(w, http.StatusOK, restapi.NewTelemetryReportResponse(1, types.Now()))
+	})
+
+	return mux
+}
+
+// receivedBundles returns the bundles received by the upstream server
+func (t *RelayTestSuite) receivedBundles() (bundles []telemetrylib.TelemetryBundle) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, report := range t.received {
+		bundles = append(bundles, report.TelemetryBundles...)
+	}
+	return
+}
+
+// createConfig creates a config in its own sub directory of the test
+// directory, so that each config has its own credentials and data store.
+func (t *RelayTestSuite) createConfig(name, serverURL, clientId string, extraCfg ...string) *config.Config {
+	cfgDir := filepath.Join(t.tmpDir, name)
+	t.Require().NoError(os.MkdirAll(cfgDir, 0700))
+
+	datastoreName := "telemetry.db"
+	if t.driver == telemetrylib.DATASTORE_DRIVER_SPOOL {
+		datastoreName = "spool"
+	}
+
+	cfgContent := fmt.Sprintf(`---
+telemetry_base_url: %q
+enabled: true
+client_id: %s
+customer_id: TEST_CUSTOMER
+tags: []
+datastores:
+  driver: %s
+  params: %s
+logging:
+  level: info
+  location: stderr
+  style: text`,
+		serverURL,
+		clientId,
+		t.driver,
+		filepath.Join(cfgDir, datastoreName),
+	)
+	for _, extra := range extraCfg {
+		cfgContent += "\n" + extra
+	}
+
+	cfgPath := filepath.Join(cfgDir, "config.yaml")
+	t.Require().NoError(os.WriteFile(cfgPath, []byte(cfgContent), 0600))
+
+	cfg, err := config.NewConfig(cfgPath)
+	t.Require().NoError(err, "should be able to load test config")
+
+	return cfg
+}
+
+// setupRelay creates a relay, registered with the upstream test server,
+// and a test server that serves its handler.
+func (t *RelayTestSuite) setupRelay(extraCfg ...string) {
+	cfg := t.createConfig("relay", t.upstream.URL, relayClientId, extraCfg...)
+
+	var err error
+	t.relay, err = NewRelay(cfg)
+	t.Require().NoError(err, "should be able to create relay")
+	t.Require().NoError(t.relay.Client().Register(), "relay should be able to register upstream")
+
+	t.relayServer = httptest.NewServer(t.relay.Handler())
+}
+
+// setupClient creates a downstream client, registered with the relay
+func (t *RelayTestSuite) setupClient(name, clientId string, extraCfg ...string) *client.TelemetryClient {
+	cfg := t.createConfig(name, t.relayServer.URL, clientId, extraCfg...)
+
+	tc, err := client.NewTelemetryClient(cfg)
+	t.Require().NoError(err, "should be able to create downstream client")
+	t.Require().NoError(tc.Register(), "downstream client should be able to register with relay")
+
+	return tc
+}
+
+// generateTelemetry generates a single telemetry item, and creates a
+// report containing it, via the downstream client
+func (t *RelayTestSuite) generateTelemetry(tc *client.TelemetryClient) {
+	err := tc.Generate(
+		"TELEMETRY-RELAY-TEST",
+		types.NewTelemetryBlob([]byte(`{"version":1,"data":{}}`)),
+		types.Tags{},
+	)
+	t.Require().NoError(err, "data item generation should have worked")
+	t.Require().NoError(tc.CreateBundles(types.Tags{}))
+	t.Require().NoError(tc.CreateReports(types.Tags{}))
+}
+
+// submitTelemetry generates a single telemetry item, and submits it via
+// the downstream client
+func (t *RelayTestSuite) submitTelemetry(tc *client.TelemetryClient) {
+	t.generateTelemetry(tc)
+	t.Require().NoError(tc.Submit(), "downstream client submission should succeed")
+}
+
+func (t *RelayTestSuite) stagedBundleCount() int {
+	count, err := t.relay.Client().Processor().BundleCount()
+	t.Require().NoError(err)
+	return count
+}
+
+func (t *RelayTestSuite) Test_StageRelayedReport() {
+	t.setupRelay()
+	t.Equal(int64(upstreamRegistrationId), t.relay.Client().RegistrationId())
+
+	tc := t.setupClient("client", downstreamClientId)
+	t.Require().NoError(tc.Authenticate(), "downstream client should be able to authenticate with relay")
+	t.submitTelemetry(tc)
+
+	// the bundle should be staged, annotated with the relay path
+	bundleRows, err := t.relay.Client().Processor().GetBundleRows()
+	t.Require().NoError(err)
+	t.Require().Len(bundleRows, 1)
+	t.Contains(
+		bundleRows[0].BundleAnnotations,
+		fmt.Sprintf("RELAYED_VIA=%d:%d", tc.RegistrationId(), upstreamRegistrationId),
+	)
+	t.Equal(downstreamClientId, bundleRows[0].BundleClientId)
+
+	// nothing should have been forwarded yet
+	t.Require().NoError(t.relay.ForwardIfNeeded())
+	t.Empty(t.receivedBundles())
+
+	// explicitly forwarding sends the staged bundle upstream
+	t.Require().NoError(t.relay.Forward())
+	bundles := t.receivedBundles()
+	t.Require().Len(bundles, 1)
+	t.Contains(bundles[0].Header.BundleAnnotations, string(t.relay.RelayedViaTag(tc.RegistrationId())))
+	t.Equal(0, t.stagedBundleCount())
+}
+
+func (t *RelayTestSuite) Test_ForwardMaxBundles() {
+	t.setupRelay(`relay:
+  max_bundles: 2
+  max_age: 1h`)
+
+	clientA := t.setupClient("clientA", downstreamClientId)
+	clientB := t.setupClient("clientB", "5b6c3d4e-8e3a-4a4f-9d1c-2f6b7a8c9d0e")
+	t.NotEqual(clientA.RegistrationId(), clientB.RegistrationId())
+
+	t.submitTelemetry(clientA)
+	t.Require().NoError(t.relay.ForwardIfNeeded())
+	t.Empty(t.receivedBundles(), "shouldn't forward until max_bundles are staged")
+
+	t.submitTelemetry(clientB)
+	t.Require().NoError(t.relay.ForwardIfNeeded())
+	bundles := t.receivedBundles()
+	t.Require().Len(bundles, 2, "should forward once max_bundles are staged")
+
+	// all staged bundles should be aggregated into a single report
+	t.Len(t.received, 1)
+	relayedVia := []string{}
+	for _, bundle := range bundles {
+		for _, annotation := range bundle.Header.BundleAnnotations {
+			if strings.HasPrefix(annotation, RELAYED_VIA_TAG+"=") {
+				relayedVia = append(relayedVia, annotation)
+			}
+		}
+	}
+	t.ElementsMatch(
+		[]string{
+			string(t.relay.RelayedViaTag(clientA.RegistrationId())),
+			string(t.relay.RelayedViaTag(clientB.RegistrationId())),
+		},
+		relayedVia,
+	)
+}
+
+func (t *RelayTestSuite) Test_StageWhileForwarding() {
+	t.setupRelay()
+
+	clientA := t.setupClient("clientA", downstreamClientId)
+	clientB := t.setupClient("clientB", "5b6c3d4e-8e3a-4a4f-9d1c-2f6b7a8c9d0e")
+	t.submitTelemetry(clientA)
+
+	// hold the upstream submission of the forwarded report
+	entered, release := make(chan struct{}), make(chan struct{})
+	t.mutex.Lock()
+	t.upstreamEntered, t.upstreamRelease = entered, release
+	t.mutex.Unlock()
+
+	forwarded := make(chan error, 1)
+	go func() {
+		forwarded <- t.relay.Forward()
+	}()
+	<-entered
+
+	// downstream clients can still submit while the relay is forwarding
+	submitted := make(chan error, 1)
+	go func() {
+		t.generateTelemetry(clientB)
+		submitted <- clientB.Submit()
+	}()
+	select {
+	case err := <-submitted:
+		t.Require().NoError(err, "downstream client submission should succeed")
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.FailNow("downstream submission blocked by upstream submission")
+	}
+
+	close(release)
+	t.Require().NoError(<-forwarded)
+	t.Len(t.receivedBundles(), 1, "only the bundle staged before forwarding should be forwarded")
+	t.Equal(1, t.stagedBundleCount(), "bundle staged while forwarding should remain staged")
+
+	t.Require().NoError(t.relay.Forward())
+	t.Len(t.receivedBundles(), 2)
+	t.Equal(0, t.stagedBundleCount())
+}
+
+func (t *RelayTestSuite) Test_ForwardMaxAge() {
+	t.setupRelay(`relay:
+  max_bundles: 100
+  max_age: 1ms`)
+
+	tc := t.setupClient("client", downstreamClientId)
+	t.submitTelemetry(tc)
+
+	time.Sleep(5 * time.Millisecond)
+	t.Require().NoError(t.relay.ForwardIfNeeded())
+	t.Len(t.receivedBundles(), 1, "should forward once max_age has passed")
+	t.Equal(0, t.stagedBundleCount())
+}
+
+func (t *RelayTestSuite) Test_Unauthorized() {
+	t.setupRelay()
+	tc := t.setupClient("client", downstreamClientId)
+
+	post := func(path string, headers map[string]string, body string) *http.Response {
+		req, err := http.NewRequest("POST", t.relayServer.URL+path, strings.NewReader(body))
+		t.Require().NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		t.Require().NoError(err)
+		resp.Body.Close()
+		return resp
+	}
+
+	// reports with an invalid token require re-authentication
+	resp := post("/report", map[string]string{
+		"Authorization":               "Bearer invalid",
+		"X-Telemetry-Registration-Id": fmt.Sprintf("%d", tc.RegistrationId()),
+	}, `{}`)
+	t.Equal(http.StatusUnauthorized, resp.StatusCode)
+	t.Equal(`Bearer realm="suse-telemetry-service" scope="authenticate"`, resp.Header.Get("WWW-Authenticate"))
+
+	// a token issued to a different client is also rejected
+	otherToken, err := t.relay.issueToken(tc.RegistrationId() + 1)
+	t.Require().NoError(err)
+	resp = post("/report", map[string]string{
+		"Authorization":               "Bearer " + otherToken,
+		"X-Telemetry-Registration-Id": fmt.Sprintf("%d", tc.RegistrationId()),
+	}, `{}`)
+	t.Equal(http.StatusUnauthorized, resp.StatusCode)
+	t.Contains(resp.Header.Get("WWW-Authenticate"), `scope="authenticate"`)
+
+	// reports from unknown clients require registration
+	resp = post("/report", map[string]string{
+		"Authorization":               "Bearer " + otherToken,
+		"X-Telemetry-Registration-Id": fmt.Sprintf("%d", tc.RegistrationId()+1),
+	}, `{}`)
+	t.Equal(http.StatusUnauthorized, resp.StatusCode)
+	t.Contains(resp.Header.Get("WWW-Authenticate"), `scope="register"`)
+
+	// authentication with a mismatched registration hash requires
+	// registration
+	caReq := restapi.ClientAuthenticationRequest{
+		RegistrationId: tc.RegistrationId(),
+		RegHash: types.ClientRegistrationHash{
+			Method: "sha256",
+			Value:  strings.Repeat("0", 64),
+		},
+	}
+	resp = post("/authenticate", nil, caReq.String())
+	t.Equal(http.StatusUnauthorized, resp.StatusCode)
+	t.Contains(resp.Header.Get("WWW-Authenticate"), `scope="register"`)
+
+	// invalid registration requests are rejected
+	resp = post("/register", nil, `{"clientRegistration":{}}`)
+	t.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (t *RelayTestSuite) Test_ExternalTokenVerification() {
+	// trust tokens signed by an external auth service
+	authKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	t.Require().NoError(err)
+	keyDer, err := x509.MarshalPKIXPublicKey(authKey.Public())
+	t.Require().NoError(err)
+	keyPath := filepath.Join(t.tmpDir, "auth-service.pem")
+	t.Require().NoError(os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: keyDer}), 0600))
+
+	t.setupRelay(fmt.Sprintf(`relay:
+  verify:
+    public_keys:
+      - %s
+    issuer: external-auth-service`, keyPath))
+	tc := t.setupClient("client", downstreamClientId)
+
+	externalToken := func(key *ecdsa.PrivateKey, issuer string, registrationId int64) string {
+		token, err := jwt.NewWithClaims(
+			jwt.SigningMethodES256,
+			jwt.RegisteredClaims{
+				Issuer:    issuer,
+				Subject:   fmt.Sprintf("%d", registrationId),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		).SignedString(key)
+		t.Require().NoError(err)
+		return token
+	}
+
+	// tokens issued by the relay are still accepted
+	relayToken, err := t.relay.issueToken(tc.RegistrationId())
+	t.Require().NoError(err)
+	t.NoError(t.relay.verifyToken(relayToken, tc.RegistrationId()))
+
+	// as are tokens issued to the client by the external auth service
+	t.NoError(t.relay.verifyToken(externalToken(authKey, "external-auth-service", tc.RegistrationId()), tc.RegistrationId()))
+
+	// but not those issued to another client, by another issuer, or
+	// signed by an untrusted key
+	t.Error(t.relay.verifyToken(externalToken(authKey, "external-auth-service", tc.RegistrationId()+1), tc.RegistrationId()))
+	t.Error(t.relay.verifyToken(externalToken(authKey, "someone-else", tc.RegistrationId()), tc.RegistrationId()))
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	t.Require().NoError(err)
+	t.Error(t.relay.verifyToken(externalToken(otherKey, "external-auth-service", tc.RegistrationId()), tc.RegistrationId()))
+}
+
+func (t *RelayTestSuite) Test_RegistryPersisted() {
+	t.setupRelay()
+	tc := t.setupClient("client", downstreamClientId)
+
+	// a new relay instance using the same config should accept existing
+	// registrations and auth tokens
+	relay, err := NewRelay(t.relay.cfg)
+	t.Require().NoError(err)
+	t.Require().NoError(relay.Client().Register())
+	t.relayServer.Config.Handler = relay.Handler()
+	t.relay = relay
+
+	t.submitTelemetry(tc)
+	t.Equal(1, t.stagedBundleCount())
+}
+
+func (t *RelayTestSuite) Test_ProxyMode() {
+	t.setupRelay(`relay:
+  mode: proxy`)
+	t.Equal(RELAY_MODE_PROXY, t.relay.Mode())
+
+	tc := t.setupClient("client", downstreamClientId)
+	t.submitTelemetry(tc)
+
+	// the report should have been forwarded before the client's submission
+	// completed, without being staged
+	bundles := t.receivedBundles()
+	t.Require().Len(bundles, 1)
+	t.Contains(bundles[0].Header.BundleAnnotations, string(t.relay.RelayedViaTag(tc.RegistrationId())))
+	t.Equal(relayClientId, t.received[0].Header.ReportClientId)
+	t.Equal(downstreamClientId, bundles[0].Header.BundleClientId)
+	t.Equal(0, t.stagedBundleCount())
+}
+
+func (t *RelayTestSuite) Test_ProxyModeRetriesOnce() {
+	t.setupRelay(`relay:
+  mode: proxy`)
+	tc := t.setupClient("client", downstreamClientId, `submission:
+  retries: 0`)
+
+	// a single upstream failure is retried
+	t.upstreamFailures = 1
+	t.upstreamStatus = http.StatusInternalServerError
+	t.submitTelemetry(tc)
+	t.Equal(2, t.reportRequests)
+	t.Len(t.receivedBundles(), 1)
+}
+
+func (t *RelayTestSuite) Test_ProxyModeUpstreamFailure() {
+	t.setupRelay(`relay:
+  mode: proxy`)
+	tc := t.setupClient("client", downstreamClientId, `submission:
+  retries: 0`)
+
+	// repeated upstream failures are returned to the client as retryable
+	t.upstreamFailures = 3
+	t.upstreamStatus = http.StatusInternalServerError
+	t.generateTelemetry(tc)
+	err := tc.Submit()
+	t.Require().Error(err)
+	t.Equal(2, t.reportRequests, "upstream submission should be tried at most twice")
+
+	var statusErr *client.StatusError
+	t.Require().ErrorAs(err, &statusErr)
+	t.Equal(http.StatusServiceUnavailable, statusErr.StatusCode)
+	t.Equal(PROXY_RETRY_AFTER, statusErr.RetryAfter)
+	t.True(statusErr.ServerBusy())
+
+	// the client retains the report for a later submission
+	reportRows, err := tc.Processor().GetPendingReportRows()
+	t.Require().NoError(err)
+	t.Len(reportRows, 1)
+
+	// further submissions are deferred until the requested time
+	t.Require().ErrorIs(tc.Submit(), client.ErrServerBackoff)
+	t.Equal(2, t.reportRequests)
+}
+
+func (t *RelayTestSuite) Test_ProxyModeUpstreamRejection() {
+	t.setupRelay(`relay:
+  mode: proxy`)
+	tc := t.setupClient("client", downstreamClientId)
+
+	// upstream rejections of the report are passed through, without
+	// being retried, so the client quarantines the report
+	t.upstreamFailures = 1
+	t.upstreamStatus = http.StatusBadRequest
+	t.submitTelemetry(tc)
+	t.Equal(1, t.reportRequests)
+
+	reportRows, err := tc.Processor().GetQuarantinedReportRows()
+	t.Require().NoError(err)
+	t.Len(reportRows, 1)
+}
+
+func (t *RelayTestSuite) Test_ProxyModeIgnoresStaging() {
+	t.setupRelay(`relay:
+  mode: proxy`)
+	tc := t.setupClient("client", downstreamClientId)
+
+	// proxied reports don't wait for staging
+	t.relay.mutex.Lock()
+	defer t.relay.mutex.Unlock()
+	t.submitTelemetry(tc)
+	t.Len(t.receivedBundles(), 1)
+}
+
+func (t *RelayTestSuite) Test_ProxyModeUpstreamBusy() {
+	t.setupRelay(`relay:
+  mode: proxy`)
+	tc := t.setupClient("client", downstreamClientId, `submission:
+  retries: 0`)
+	t.relay.proxySubmitWait = 10 * time.Millisecond
+
+	// proxied reports that can't be submitted in time are retryable
+	t.Require().NoError(t.relay.lockSubmission(context.Background()))
+	t.generateTelemetry(tc)
+	err := tc.Submit()
+	t.relay.unlockSubmission()
+	t.Require().Error(err)
+	t.Equal(0, t.reportRequests, "report shouldn't have been submitted upstream")
+
+	var statusErr *client.StatusError
+	t.Require().ErrorAs(err, &statusErr)
+	t.Equal(http.StatusServiceUnavailable, statusErr.StatusCode)
+	t.True(statusErr.ServerBusy())
+}
+
+func (t *RelayTestSuite) Test_InvalidMode() {
+	cfg := t.createConfig("relay", t.upstream.URL, relayClientId, `relay:
+  mode: invalid`)
+	_, err := NewRelay(cfg)
+	t.Require().ErrorContains(err, `unsupported relay mode "invalid"`)
+}
+
+func TestRelayTestSuite(t *testing.T) {
+	if !telemetrylib.DataStoreDriverAvailable(telemetrylib.DATASTORE_DRIVER_SQLITE3) {
+		t.Skip("sqlite3 datastore requires cgo")
+	}
+	suite.Run(t, &RelayTestSuite{driver: telemetrylib.DATASTORE_DRIVER_SQLITE3})
+}
+
+func TestRelaySpoolTestSuite(t *testing.T) {
+	suite.Run(t, &RelayTestSuite{driver: telemetrylib.DATASTORE_DRIVER_SPOOL})
+}
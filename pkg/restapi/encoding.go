@@ -0,0 +1,158 @@
+package restapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/SUSE/telemetry/pkg/utils"
+	"github.com/klauspost/compress/zstd"
+)
+
+//
+// Request Body Content-Encoding Handling
+//
+
+const (
+	CONTENT_ENCODING_IDENTITY = `identity`
+	CONTENT_ENCODING_GZIP     = `gzip`
+	CONTENT_ENCODING_ZSTD     = `zstd`
+)
+
+var (
+	// returned when a request body uses an unsupported Content-Encoding;
+	// servers should respond with http.StatusUnsupportedMediaType
+	ErrUnsupportedContentEncoding = errors.New("unsupported content encoding")
+
+	// returned when a decoded request body exceeds the permitted size
+	ErrContentTooLarge = errors.New("decoded content too large")
+)
+
+// normalizeContentEncoding maps an empty encoding to identity
+func normalizeContentEncoding(encoding string) string {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" {
+		return CONTENT_ENCODING_IDENTITY
+	}
+	return encoding
+}
+
+// ContentEncodingSupported returns true if the specified Content-Encoding
+// can be encoded and decoded.
+func ContentEncodingSupported(encoding string) bool {
+	switch normalizeContentEncoding(encoding) {
+	case CONTENT_ENCODING_IDENTITY, CONTENT_ENCODING_GZIP, CONTENT_ENCODING_ZSTD:
+		return true
+	}
+	return false
+}
+
+// EncodeBody encodes the provided body using the specified Content-Encoding.
+func EncodeBody(encoding string, body []byte) (encoded []byte, err error) {
+	switch normalizeContentEncoding(encoding) {
+	case CONTENT_ENCODING_IDENTITY:
+		return body, nil
+	case CONTENT_ENCODING_GZIP:
+		return utils.CompressGZIP(body)
+	case CONTENT_ENCODING_ZSTD:
+		return utils.CompressZSTD(body)
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedContentEncoding, encoding)
+}
+
+// DecodeBody decodes the provided body using the specified Content-Encoding.
+// If maxSize is greater than zero, the decoded body may not exceed maxSize
+// bytes, to guard against highly compressed payloads expanding without
+// bound.
+func DecodeBody(encoding string, body []byte, maxSize int64) (decoded []byte, err error) {
+	reader, err := NewDecodingReader(encoding, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+
+	return readDecoded(reader, maxSize)
+}
+
+// nopWriteCloser adds a no-op Close method to a writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// NewEncodingWriter wraps the provided writer with an encoder for the
+// specified Content-Encoding, using the same compression levels as
+// EncodeBody. The returned writer must be closed to flush the encoded
+// content, which doesn't close the provided writer.
+func NewEncodingWriter(encoding string, w io.Writer) (wc io.WriteCloser, err error) {
+	switch normalizeContentEncoding(encoding) {
+	case CONTENT_ENCODING_IDENTITY:
+		return nopWriteCloser{w}, nil
+	case CONTENT_ENCODING_GZIP:
+		return gzip.NewWriterLevel(w, gzip.BestCompression)
+	case CONTENT_ENCODING_ZSTD:
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedContentEncoding, encoding)
+}
+
+// NewDecodingReader wraps the provided reader with a decoder for the
+// specified Content-Encoding.
+func NewDecodingReader(encoding string, r io.Reader) (rc io.ReadCloser, err error) {
+	switch normalizeContentEncoding(encoding) {
+	case CONTENT_ENCODING_IDENTITY:
+		return io.NopCloser(r), nil
+	case CONTENT_ENCODING_GZIP:
+		return gzip.NewReader(r)
+	case CONTENT_ENCODING_ZSTD:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedContentEncoding, encoding)
+}
+
+// ReadRequestBody reads the request body, decoding it as specified by the
+// request's Content-Encoding header. If maxSize is greater than zero, the
+// decoded body may not exceed maxSize bytes, to guard against highly
+// compressed payloads expanding without bound.
+func ReadRequestBody(r *http.Request, maxSize int64) (body []byte, err error) {
+	reader, err := NewDecodingReader(r.Header.Get("Content-Encoding"), r.Body)
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+
+	return readDecoded(reader, maxSize)
+}
+
+// readDecoded reads the decoded content from the reader, failing if
+// maxSize is greater than zero and the content exceeds maxSize bytes.
+func readDecoded(reader io.Reader, maxSize int64) (decoded []byte, err error) {
+	if maxSize <= 0 {
+		return io.ReadAll(reader)
+	}
+
+	decoded, err = io.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(decoded)) > maxSize {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrContentTooLarge, maxSize)
+	}
+
+	return
+}
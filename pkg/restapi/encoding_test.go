@@ -0,0 +1,98 @@
+package restapi
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEncodeDecodeBody tests EncodeBody and DecodeBody for all supported
+// encodings, including enforcement of the decoded size limit
+func TestEncodeDecodeBody(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"test": "This is a JSON file"}`), 100)
+
+	for _, encoding := range []string{"", CONTENT_ENCODING_IDENTITY, CONTENT_ENCODING_GZIP, CONTENT_ENCODING_ZSTD} {
+		t.Run(encoding, func(t *testing.T) {
+			assert.True(t, ContentEncodingSupported(encoding))
+
+			encoded, err := EncodeBody(encoding, body)
+			assert.NoError(t, err)
+
+			decoded, err := DecodeBody(encoding, encoded, int64(len(body)))
+			assert.NoError(t, err)
+			assert.Equal(t, body, decoded)
+
+			// decoded bodies larger than the limit are rejected
+			_, err = DecodeBody(encoding, encoded, int64(len(body)-1))
+			assert.ErrorIs(t, err, ErrContentTooLarge)
+		})
+	}
+
+	assert.False(t, ContentEncodingSupported("br"))
+	_, err := EncodeBody("br", body)
+	assert.ErrorIs(t, err, ErrUnsupportedContentEncoding)
+	_, err = DecodeBody("br", body, 0)
+	assert.ErrorIs(t, err, ErrUnsupportedContentEncoding)
+}
+
+// TestEncodingWriter tests that content written via NewEncodingWriter can
+// be decoded with DecodeBody for all supported encodings
+func TestEncodingWriter(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"test": "This is a JSON file"}`), 100)
+
+	for _, encoding := range []string{"", CONTENT_ENCODING_IDENTITY, CONTENT_ENCODING_GZIP, CONTENT_ENCODING_ZSTD} {
+		t.Run(encoding, func(t *testing.T) {
+			var encoded bytes.Buffer
+			writer, err := NewEncodingWriter(encoding, &encoded)
+			assert.NoError(t, err)
+
+			// write the body in pieces, as it would be streamed
+			for chunk := range slices.Chunk(body, 64) {
+				_, err = writer.Write(chunk)
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, writer.Close())
+
+			decoded, err := DecodeBody(encoding, encoded.Bytes(), 0)
+			assert.NoError(t, err)
+			assert.Equal(t, body, decoded)
+		})
+	}
+
+	_, err := NewEncodingWriter("br", &bytes.Buffer{})
+	assert.ErrorIs(t, err, ErrUnsupportedContentEncoding)
+}
+
+// TestReadRequestBody tests ReadRequestBody decodes request bodies and
+// enforces the decoded size limit
+func TestReadRequestBody(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"test": "This is a JSON file"}`), 100)
+
+	for _, encoding := range []string{CONTENT_ENCODING_GZIP, CONTENT_ENCODING_ZSTD} {
+		t.Run(encoding, func(t *testing.T) {
+			encoded, err := EncodeBody(encoding, body)
+			assert.NoError(t, err)
+
+			req := httptest.NewRequest("POST", "/report", bytes.NewReader(encoded))
+			req.Header.Set("Content-Encoding", encoding)
+
+			decoded, err := ReadRequestBody(req, int64(len(body)))
+			assert.NoError(t, err)
+			assert.Equal(t, body, decoded)
+
+			req = httptest.NewRequest("POST", "/report", bytes.NewReader(encoded))
+			req.Header.Set("Content-Encoding", encoding)
+
+			_, err = ReadRequestBody(req, int64(len(body)-1))
+			assert.ErrorIs(t, err, ErrContentTooLarge)
+		})
+	}
+
+	req := httptest.NewRequest("POST", "/report", bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", "br")
+	_, err := ReadRequestBody(req, 0)
+	assert.ErrorIs(t, err, ErrUnsupportedContentEncoding)
+}
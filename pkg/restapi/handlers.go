@@ -0,0 +1,268 @@
+package restapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//
+// Server-side Request Handling
+//
+
+const (
+	// challenge type used in WWW-Authenticate headers
+	AUTH_CHALLENGE = `Bearer`
+
+	// realm used in WWW-Authenticate headers
+	AUTH_REALM = `suse-telemetry-service`
+
+	// scopes used in WWW-Authenticate headers, indicating whether the
+	// client needs to (re-)authenticate or (re-)register
+	AUTH_SCOPE_AUTHENTICATE = `authenticate`
+	AUTH_SCOPE_REGISTER     = `register`
+
+	// header identifying the client submitting a request
+	HEADER_REGISTRATION_ID = `X-Telemetry-Registration-Id`
+)
+
+var (
+	// returned when a request lacks valid client auth headers
+	ErrMissingClientAuth = errors.New("missing or invalid client auth headers")
+
+	// returned by a ClientAuthVerifier when the client isn't registered,
+	// such that it will be asked to (re-)register rather than to
+	// (re-)authenticate
+	ErrClientNotRegistered = errors.New("client not registered")
+
+	// returned when a WWW-Authenticate header can't be parsed
+	ErrInvalidChallenge = errors.New("invalid WWW-Authenticate challenge")
+)
+
+// Validator is implemented by request bodies that can validate their
+// content, such as ClientRegistrationRequest.
+type Validator interface {
+	Validate() error
+}
+
+// ErrorResponse is the response payload body for failed requests
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// WriteJSON responds with the JSON encoding of the body.
+func WriteJSON(w http.ResponseWriter, statusCode int, body any) {
+	bytes, err := json.Marshal(body)
+	if err != nil {
+		slog.Error(
+			"failed to JSON marshal response body",
+			slog.String("err", err.Error()),
+		)
+		statusCode = http.StatusInternalServerError
+		bytes, _ = json.Marshal(&ErrorResponse{Error: http.StatusText(statusCode)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(bytes)
+}
+
+// WriteError responds with an ErrorResponse containing the message.
+func WriteError(w http.ResponseWriter, statusCode int, msg string) {
+	WriteJSON(w, statusCode, &ErrorResponse{Error: msg})
+}
+
+// FormatChallenge returns the WWW-Authenticate header value for the scope.
+func FormatChallenge(scope string) string {
+	return fmt.Sprintf(`%s realm=%q scope=%q`, AUTH_CHALLENGE, AUTH_REALM, scope)
+}
+
+// ParseChallenge parses a WWW-Authenticate header value, which should have
+// the following format
+//
+//	Bearer realm="suse-telemetry-service" scope="<scope>"
+//
+// where <scope> is either "authenticate" or "register", returning the
+// scope.
+func ParseChallenge(value string) (scope string, err error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return "", fmt.Errorf("%w: invalid format %q", ErrInvalidChallenge, value)
+	}
+
+	// first field specifies the challenge
+	if fields[0] != AUTH_CHALLENGE {
+		return "", fmt.Errorf("%w: invalid challenge %q", ErrInvalidChallenge, fields[0])
+	}
+
+	// second field should be realm="<realm>"
+	name, realm, found := parseQuotedAssignment(fields[1])
+	if !found || name != "realm" {
+		return "", fmt.Errorf("%w: missing realm", ErrInvalidChallenge)
+	}
+	if realm != AUTH_REALM {
+		return "", fmt.Errorf("%w: invalid realm %q", ErrInvalidChallenge, realm)
+	}
+
+	// third field should be scope="<scope>"
+	name, scope, found = parseQuotedAssignment(fields[2])
+	if !found || name != "scope" {
+		return "", fmt.Errorf("%w: missing scope", ErrInvalidChallenge)
+	}
+
+	switch scope {
+	case AUTH_SCOPE_AUTHENTICATE, AUTH_SCOPE_REGISTER:
+		// valid
+	default:
+		return "", fmt.Errorf("%w: invalid scope %q", ErrInvalidChallenge, scope)
+	}
+
+	return
+}
+
+func parseQuotedAssignment(assignment string) (field, value string, found bool) {
+	// split assignment on '=', stripping any auth-param separator
+	field, value, found = strings.Cut(strings.TrimSuffix(assignment, ","), "=")
+	if found {
+		// if split was successful string quote and inner wrapping spaces
+		value = strings.TrimSpace(strings.Trim(value, `"'`))
+	}
+	return
+}
+
+// WriteChallenge responds with a 401 Unauthorized, with a WWW-Authenticate
+// challenge indicating whether the client needs to (re-)authenticate or
+// (re-)register.
+func WriteChallenge(w http.ResponseWriter, scope string) {
+	msg := "client authentication required"
+	if scope == AUTH_SCOPE_REGISTER {
+		msg = "client registration required"
+	}
+
+	w.Header().Set("WWW-Authenticate", FormatChallenge(scope))
+	WriteError(w, http.StatusUnauthorized, msg)
+}
+
+// DecodeStatus returns the status code with which to respond to a request
+// whose body couldn't be read by ReadRequestBody.
+func DecodeStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUnsupportedContentEncoding):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrContentTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// DecodeRequest reads the request body, decoding it as needed, and
+// unmarshals and validates it as the specified body. If any of these steps
+// fail an appropriate error response is written and false is returned.
+func DecodeRequest(w http.ResponseWriter, req *http.Request, maxSize int64, body Validator) (ok bool) {
+	bytes, err := ReadRequestBody(req, maxSize)
+	if err != nil {
+		slog.Debug(
+			"failed to read request body",
+			slog.String("path", req.URL.Path),
+			slog.String("err", err.Error()),
+		)
+		WriteError(w, DecodeStatus(err), err.Error())
+		return
+	}
+
+	if err = json.Unmarshal(bytes, body); err != nil {
+		slog.Debug(
+			"failed to JSON unmarshal request body",
+			slog.String("path", req.URL.Path),
+			slog.String("err", err.Error()),
+		)
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = body.Validate(); err != nil {
+		slog.Debug(
+			"request body validation failed",
+			slog.String("path", req.URL.Path),
+			slog.String("err", err.Error()),
+		)
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	return true
+}
+
+// ClientAuth is the client identity and auth token presented by a request.
+type ClientAuth struct {
+	RegistrationId int64
+	AuthToken      string
+}
+
+// ExtractClientAuth extracts the client's registration id and Bearer auth
+// token from the request headers.
+func ExtractClientAuth(req *http.Request) (auth ClientAuth, err error) {
+	auth.RegistrationId, err = strconv.ParseInt(req.Header.Get(HEADER_REGISTRATION_ID), 10, 64)
+	if err != nil || auth.RegistrationId <= 0 {
+		return auth, fmt.Errorf("%w: invalid %s header", ErrMissingClientAuth, HEADER_REGISTRATION_ID)
+	}
+
+	authToken, found := strings.CutPrefix(req.Header.Get("Authorization"), AUTH_CHALLENGE+" ")
+	if !found || authToken == "" {
+		return auth, fmt.Errorf("%w: missing %s Authorization header", ErrMissingClientAuth, AUTH_CHALLENGE)
+	}
+	auth.AuthToken = authToken
+
+	return
+}
+
+type clientAuthKey struct{}
+
+// ClientAuthFromContext returns the client auth verified by the
+// RequireClientAuth middleware, if any.
+func ClientAuthFromContext(ctx context.Context) (auth ClientAuth, found bool) {
+	auth, found = ctx.Value(clientAuthKey{}).(ClientAuth)
+	return
+}
+
+// ClientAuthVerifier verifies the auth token presented by a client,
+// returning an error wrapping ErrClientNotRegistered if the client needs
+// to (re-)register, or any other error if it needs to (re-)authenticate.
+type ClientAuthVerifier func(ctx context.Context, auth ClientAuth) error
+
+// RequireClientAuth returns middleware that only passes requests on to the
+// next handler if they present client auth accepted by the verifier, which
+// is then available via ClientAuthFromContext. Other requests are responded
+// to with an appropriate challenge.
+func RequireClientAuth(verify ClientAuthVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			auth, err := ExtractClientAuth(req)
+			if err == nil {
+				err = verify(req.Context(), auth)
+			}
+			if err != nil {
+				slog.Debug(
+					"client auth verification failed",
+					slog.String("path", req.URL.Path),
+					slog.Int64("registrationId", auth.RegistrationId),
+					slog.String("err", err.Error()),
+				)
+
+				scope := AUTH_SCOPE_AUTHENTICATE
+				if errors.Is(err, ErrClientNotRegistered) {
+					scope = AUTH_SCOPE_REGISTER
+				}
+				WriteChallenge(w, scope)
+				return
+			}
+
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), clientAuthKey{}, auth)))
+		})
+	}
+}
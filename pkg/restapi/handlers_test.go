@@ -0,0 +1,159 @@
+package restapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestChallenge tests that challenges written by WriteChallenge can be
+// parsed by ParseChallenge, and that invalid challenges are rejected
+func TestChallenge(t *testing.T) {
+	for _, scope := range []string{AUTH_SCOPE_AUTHENTICATE, AUTH_SCOPE_REGISTER} {
+		t.Run(scope, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			WriteChallenge(w, scope)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			var errResp ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+			assert.NotEmpty(t, errResp.Error)
+
+			parsed, err := ParseChallenge(w.Header().Get("WWW-Authenticate"))
+			assert.NoError(t, err)
+			assert.Equal(t, scope, parsed)
+		})
+	}
+
+	// auth-params may be comma separated
+	scope, err := ParseChallenge(`Bearer realm="suse-telemetry-service", scope="register"`)
+	assert.NoError(t, err)
+	assert.Equal(t, AUTH_SCOPE_REGISTER, scope)
+
+	for _, invalid := range []string{
+		``,
+		`Bearer realm="suse-telemetry-service"`,
+		`Basic realm="suse-telemetry-service" scope="register"`,
+		`Bearer realm="other-service" scope="register"`,
+		`Bearer scope="register" realm="suse-telemetry-service"`,
+		`Bearer realm="suse-telemetry-service" scope="delete"`,
+	} {
+		_, err = ParseChallenge(invalid)
+		assert.ErrorIs(t, err, ErrInvalidChallenge, "%q should be rejected", invalid)
+	}
+}
+
+// TestDecodeRequest tests that DecodeRequest responds appropriately to
+// undecodable, malformed and invalid request bodies
+func TestDecodeRequest(t *testing.T) {
+	valid, err := json.Marshal(&ClientRegistrationRequest{
+		ClientRegistration: types.ClientRegistration{
+			ClientId:   "d19ecc03-787c-469b-8bf5-71df704f3b16",
+			SystemUUID: "74f0f0b0-fb29-4405-a0b8-4e7747bdfd8a",
+			Timestamp:  types.Now().String(),
+		},
+	})
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		body       []byte
+		encoding   string
+		maxSize    int64
+		statusCode int
+	}{
+		{"valid", valid, "", 0, http.StatusOK},
+		{"malformed", []byte(`{"clientRegistration":`), "", 0, http.StatusBadRequest},
+		{"invalid", []byte(`{"clientRegistration":{}}`), "", 0, http.StatusBadRequest},
+		{"unsupported encoding", valid, "br", 0, http.StatusUnsupportedMediaType},
+		{"too large", valid, "", 10, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/register", bytes.NewReader(tc.body))
+			if tc.encoding != "" {
+				req.Header.Set("Content-Encoding", tc.encoding)
+			}
+			w := httptest.NewRecorder()
+
+			var crReq ClientRegistrationRequest
+			ok := DecodeRequest(w, req, tc.maxSize, &crReq)
+			assert.Equal(t, tc.statusCode == http.StatusOK, ok)
+			if ok {
+				return
+			}
+
+			assert.Equal(t, tc.statusCode, w.Code)
+			var errResp ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+			assert.NotEmpty(t, errResp.Error)
+		})
+	}
+}
+
+// TestRequireClientAuth tests that RequireClientAuth only passes on
+// requests with verified client auth, challenging the others
+func TestRequireClientAuth(t *testing.T) {
+	const registeredId = 42
+	const validToken = "valid.auth.token"
+
+	handler := RequireClientAuth(func(ctx context.Context, auth ClientAuth) error {
+		if auth.RegistrationId != registeredId {
+			return ErrClientNotRegistered
+		}
+		if auth.AuthToken != validToken {
+			return assert.AnError
+		}
+		return nil
+	})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth, found := ClientAuthFromContext(req.Context())
+		assert.True(t, found)
+		WriteJSON(w, http.StatusOK, &auth)
+	}))
+
+	testCases := []struct {
+		name           string
+		registrationId string
+		authorization  string
+		scope          string
+	}{
+		{"verified", "42", "Bearer " + validToken, ""},
+		{"missing registration id", "", "Bearer " + validToken, AUTH_SCOPE_AUTHENTICATE},
+		{"missing token", "42", "", AUTH_SCOPE_AUTHENTICATE},
+		{"invalid token", "42", "Bearer invalid", AUTH_SCOPE_AUTHENTICATE},
+		{"unregistered", "7", "Bearer " + validToken, AUTH_SCOPE_REGISTER},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/report", nil)
+			req.Header.Set(HEADER_REGISTRATION_ID, tc.registrationId)
+			req.Header.Set("Authorization", tc.authorization)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if tc.scope == "" {
+				assert.Equal(t, http.StatusOK, w.Code)
+				var auth ClientAuth
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &auth))
+				assert.Equal(t, ClientAuth{RegistrationId: registeredId, AuthToken: validToken}, auth)
+				return
+			}
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			scope, err := ParseChallenge(w.Header().Get("WWW-Authenticate"))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.scope, scope)
+		})
+	}
+}
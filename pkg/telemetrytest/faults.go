@@ -0,0 +1,158 @@
+package telemetrytest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SUSE/telemetry/pkg/restapi"
+)
+
+// Fault is a scripted response to a request, overriding the normal
+// handling of that request.
+//
+// The Delay, if any, is applied first. If neither a StatusCode nor a Body
+// is specified the request is then handled normally, making it a slow
+// response. Otherwise the response has the specified StatusCode, which
+// defaults to 200, and Body, which defaults to a JSON error body.
+type Fault struct {
+	StatusCode int           // response status code
+	Scope      string        // WWW-Authenticate challenge scope, for 401 responses
+	RetryAfter time.Duration // Retry-After header value, if non-zero
+	Delay      time.Duration // delay before responding
+	Body       []byte        // response body, used verbatim
+}
+
+// ChallengeFault returns a 401 Unauthorized fault whose WWW-Authenticate
+// challenge has the specified scope, either restapi.AUTH_SCOPE_AUTHENTICATE
+// or restapi.AUTH_SCOPE_REGISTER.
+func ChallengeFault(scope string) Fault {
+	return Fault{StatusCode: http.StatusUnauthorized, Scope: scope}
+}
+
+// ConflictFault returns a 409 Conflict fault, as returned by the server
+// for duplicate client registrations.
+func ConflictFault() Fault {
+	return Fault{StatusCode: http.StatusConflict}
+}
+
+// BusyFault returns a fault with the specified status code, typically 429
+// Too Many Requests or 503 Service Unavailable, asking the client to retry
+// after the specified delay.
+func BusyFault(statusCode int, retryAfter time.Duration) Fault {
+	return Fault{StatusCode: statusCode, RetryAfter: retryAfter}
+}
+
+// SlowFault returns a fault that delays the normal handling of the
+// request by the specified duration.
+func SlowFault(delay time.Duration) Fault {
+	return Fault{Delay: delay}
+}
+
+// MalformedFault returns a fault that responds with a 200 OK whose body
+// isn't valid JSON.
+func MalformedFault() Fault {
+	return Fault{Body: []byte(`{"malformed":`)}
+}
+
+// Inject queues faults for the specified request path, with each of the
+// subsequent requests for that path being responded to with the next
+// queued fault, until none remain.
+func (s *Server) Inject(path string, faults ...Fault) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.faults[path] = append(s.faults[path], faults...)
+}
+
+// PendingFaults returns the number of queued faults for the specified
+// request path that haven't yet been triggered.
+func (s *Server) PendingFaults(path string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.faults[path])
+}
+
+// nextFault counts the request and returns the next queued fault for the
+// request's path, if any.
+func (s *Server) nextFault(req *http.Request) (fault Fault, found bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path := req.URL.Path
+	s.requests[path]++
+	if len(s.faults[path]) == 0 {
+		return
+	}
+
+	fault, s.faults[path] = s.faults[path][0], s.faults[path][1:]
+	return fault, true
+}
+
+// withFaults wraps the handler such that any queued faults are applied.
+func (s *Server) withFaults(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		fault, found := s.nextFault(req)
+		if !found {
+			handler(w, req)
+			return
+		}
+
+		if fault.Delay > 0 {
+			// consume the request body up front, as the server only
+			// notices that the client has gone away, cancelling the
+			// request context, once the body has been read
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			select {
+			case <-time.After(fault.Delay):
+			case <-req.Context().Done():
+				return
+			}
+		}
+
+		if fault.StatusCode == 0 && fault.Body == nil {
+			handler(w, req)
+			return
+		}
+
+		writeFault(w, fault)
+	}
+}
+
+func writeFault(w http.ResponseWriter, fault Fault) {
+	statusCode := fault.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	if fault.RetryAfter > 0 {
+		// round up to whole seconds, as required by the Retry-After header
+		seconds := int64((fault.RetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+
+	if statusCode == http.StatusUnauthorized {
+		scope := fault.Scope
+		if scope == "" {
+			scope = restapi.AUTH_SCOPE_AUTHENTICATE
+		}
+		w.Header().Set("WWW-Authenticate", restapi.FormatChallenge(scope))
+	}
+
+	if fault.Body == nil {
+		restapi.WriteError(w, statusCode, http.StatusText(statusCode))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(fault.Body)
+}
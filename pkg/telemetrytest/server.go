@@ -0,0 +1,343 @@
+// Package telemetrytest provides an embeddable fake telemetry server,
+// implementing the documented telemetry service API, that can be used to
+// exercise telemetry clients in integration tests.
+package telemetrytest
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	telemetrylib "github.com/SUSE/telemetry/pkg/lib"
+	"github.com/SUSE/telemetry/pkg/restapi"
+	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// request paths served by the fake server
+	PATH_REGISTER     = `/register`
+	PATH_AUTHENTICATE = `/authenticate`
+	PATH_REPORT       = `/report`
+
+	// issuer of the auth tokens issued by the fake server
+	TOKEN_ISSUER = `suse-telemetry-test`
+
+	// lifetime of the auth tokens issued by the fake server
+	TOKEN_DURATION = 1 * time.Hour
+)
+
+// Registration is a client registration held by the fake server.
+type Registration struct {
+	RegistrationId     int64
+	ClientRegistration types.ClientRegistration
+	RegistrationDate   string
+}
+
+// Server is a fake telemetry server, backed by an httptest.Server, that
+// keeps client registrations in memory and stores the reports that it
+// receives so that tests can make assertions about them. Faults can be
+// scripted for each request path to exercise client error handling.
+type Server struct {
+	*httptest.Server
+
+	mutex sync.Mutex
+
+	// auth token signing method and keys, defaulting to HS256 using a
+	// random secret
+	method     jwt.SigningMethod
+	signingKey any
+	verifyKey  any
+	keyId      string
+
+	nextId        int64
+	registrations map[int64]*Registration
+	reports       []*telemetrylib.TelemetryReport
+	requests      map[string]int
+	faults        map[string][]Fault
+}
+
+// NewServer starts and returns a new fake telemetry server. The caller
+// should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewServer(s.Handler())
+	return s
+}
+
+// NewTLSServer starts and returns a new fake telemetry server using TLS.
+// The caller should call Close when finished, to shut it down.
+func NewTLSServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewTLSServer(s.Handler())
+	return s
+}
+
+func newServer() *Server {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("telemetrytest: failed to generate token secret: %s", err.Error()))
+	}
+
+	return &Server{
+		method:        jwt.SigningMethodHS256,
+		signingKey:    secret,
+		verifyKey:     secret,
+		nextId:        1,
+		registrations: make(map[int64]*Registration),
+		requests:      make(map[string]int),
+		faults:        make(map[string][]Fault),
+	}
+}
+
+// Handler returns the HTTP handler implementing the fake server's API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+PATH_REGISTER, s.withFaults(s.registerHandler))
+	mux.HandleFunc("POST "+PATH_AUTHENTICATE, s.withFaults(s.authenticateHandler))
+	mux.HandleFunc(
+		"POST "+PATH_REPORT,
+		s.withFaults(restapi.RequireClientAuth(s.verifyClientAuth)(http.HandlerFunc(s.reportHandler)).ServeHTTP),
+	)
+	return mux
+}
+
+// Registrations returns the client registrations held by the server.
+func (s *Server) Registrations() (registrations []Registration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id := int64(1); id < s.nextId; id++ {
+		if reg, found := s.registrations[id]; found {
+			registrations = append(registrations, *reg)
+		}
+	}
+	return
+}
+
+// Reports returns the reports successfully received by the server, in the
+// order that they were received.
+func (s *Server) Reports() []*telemetrylib.TelemetryReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]*telemetrylib.TelemetryReport(nil), s.reports...)
+}
+
+// Bundles returns the bundles contained in the reports successfully
+// received by the server.
+func (s *Server) Bundles() (bundles []telemetrylib.TelemetryBundle) {
+	for _, report := range s.Reports() {
+		bundles = append(bundles, report.TelemetryBundles...)
+	}
+	return
+}
+
+// Requests returns the number of requests received for the specified path,
+// including those that were responded to with an injected fault.
+func (s *Server) Requests(path string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.requests[path]
+}
+
+// Forget drops the specified client registration, as though the server
+// had lost track of it, such that the client will need to register again.
+func (s *Server) Forget(registrationId int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.registrations, registrationId)
+}
+
+// Reset drops all client registrations, received reports, request counts
+// and pending faults.
+func (s *Server) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.registrations = make(map[int64]*Registration)
+	s.reports = nil
+	s.requests = make(map[string]int)
+	s.faults = make(map[string][]Fault)
+}
+
+// UseSigningKey configures the server to sign the auth tokens it issues
+// using the specified asymmetric method and private key, including the key
+// id in the token header if not empty, such that clients can verify them
+// against the corresponding public key.
+func (s *Server) UseSigningKey(method jwt.SigningMethod, key crypto.Signer, keyId string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.method = method
+	s.signingKey = key
+	s.verifyKey = key.Public()
+	s.keyId = keyId
+}
+
+func (s *Server) issueToken(registrationId int64) (token string, err error) {
+	s.mutex.Lock()
+	method, signingKey, keyId := s.method, s.signingKey, s.keyId
+	s.mutex.Unlock()
+
+	now := time.Now()
+	jwtToken := jwt.NewWithClaims(
+		method,
+		jwt.RegisteredClaims{
+			Issuer:    TOKEN_ISSUER,
+			Subject:   strconv.FormatInt(registrationId, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(TOKEN_DURATION)),
+		},
+	)
+	if keyId != "" {
+		jwtToken.Header["kid"] = keyId
+	}
+
+	token, err = jwtToken.SignedString(signingKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign auth token: %w", err)
+	}
+
+	return
+}
+
+func (s *Server) verifyToken(token string, registrationId int64) (err error) {
+	s.mutex.Lock()
+	method, verifyKey := s.method, s.verifyKey
+	s.mutex.Unlock()
+
+	var claims jwt.RegisteredClaims
+	_, err = jwt.ParseWithClaims(
+		token,
+		&claims,
+		func(*jwt.Token) (any, error) {
+			return verifyKey, nil
+		},
+		jwt.WithValidMethods([]string{method.Alg()}),
+		jwt.WithIssuer(TOKEN_ISSUER),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return
+	}
+
+	if claims.Subject != strconv.FormatInt(registrationId, 10) {
+		return fmt.Errorf("auth token subject %q doesn't match registration id %d", claims.Subject, registrationId)
+	}
+
+	return
+}
+
+func (s *Server) lookup(registrationId int64) (reg Registration, found bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r, found := s.registrations[registrationId]
+	if found {
+		reg = *r
+	}
+	return
+}
+
+func (s *Server) verifyClientAuth(ctx context.Context, auth restapi.ClientAuth) (err error) {
+	if _, found := s.lookup(auth.RegistrationId); !found {
+		return restapi.ErrClientNotRegistered
+	}
+
+	return s.verifyToken(auth.AuthToken, auth.RegistrationId)
+}
+
+func (s *Server) registerHandler(w http.ResponseWriter, req *http.Request) {
+	var crReq restapi.ClientRegistrationRequest
+	if !restapi.DecodeRequest(w, req, 0, &crReq) {
+		return
+	}
+
+	// a client registering again replaces its previous registration
+	s.mutex.Lock()
+	for id, reg := range s.registrations {
+		if reg.ClientRegistration.ClientId == crReq.ClientRegistration.ClientId {
+			delete(s.registrations, id)
+		}
+	}
+	reg := &Registration{
+		RegistrationId:     s.nextId,
+		ClientRegistration: crReq.ClientRegistration,
+		RegistrationDate:   types.Now().String(),
+	}
+	s.registrations[reg.RegistrationId] = reg
+	s.nextId++
+	s.mutex.Unlock()
+
+	authToken, err := s.issueToken(reg.RegistrationId)
+	if err != nil {
+		restapi.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	slog.Debug(
+		"Fake server registered client",
+		slog.String("clientId", reg.ClientRegistration.ClientId),
+		slog.Int64("registrationId", reg.RegistrationId),
+	)
+
+	restapi.WriteJSON(w, http.StatusOK, &restapi.ClientRegistrationResponse{
+		RegistrationId:   reg.RegistrationId,
+		AuthToken:        authToken,
+		RegistrationDate: reg.RegistrationDate,
+	})
+}
+
+func (s *Server) authenticateHandler(w http.ResponseWriter, req *http.Request) {
+	var caReq restapi.ClientAuthenticationRequest
+	if !restapi.DecodeRequest(w, req, 0, &caReq) {
+		return
+	}
+
+	reg, found := s.lookup(caReq.RegistrationId)
+	if !found || !reg.ClientRegistration.Hash(caReq.RegHash.Method).Match(&caReq.RegHash) {
+		restapi.WriteChallenge(w, restapi.AUTH_SCOPE_REGISTER)
+		return
+	}
+
+	authToken, err := s.issueToken(reg.RegistrationId)
+	if err != nil {
+		restapi.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	restapi.WriteJSON(w, http.StatusOK, &restapi.ClientAuthenticationResponse{
+		RegistrationId:   reg.RegistrationId,
+		AuthToken:        authToken,
+		RegistrationDate: reg.RegistrationDate,
+	})
+}
+
+func (s *Server) reportHandler(w http.ResponseWriter, req *http.Request) {
+	var trReq restapi.TelemetryReportRequest
+	if !restapi.DecodeRequest(w, req, 0, &trReq) {
+		return
+	}
+
+	if err := trReq.VerifyChecksum(); err != nil {
+		restapi.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	s.reports = append(s.reports, &trReq.TelemetryReport)
+	processingId := int64(len(s.reports))
+	s.mutex.Unlock()
+
+	restapi.WriteJSON(w, http.StatusOK, restapi.NewTelemetryReportResponse(processingId, types.Now()))
+}
@@ -0,0 +1,213 @@
+package telemetrytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	telemetrylib "github.com/SUSE/telemetry/pkg/lib"
+	"github.com/SUSE/telemetry/pkg/restapi"
+	"github.com/SUSE/telemetry/pkg/types"
+	"github.com/stretchr/testify/suite"
+)
+
+const testClientId = "d19ecc03-787c-469b-8bf5-71df704f3b16"
+
+type ServerTestSuite struct {
+	suite.Suite
+
+	server *Server
+	reg    types.ClientRegistration
+}
+
+func (t *ServerTestSuite) SetupTest() {
+	t.server = NewServer()
+	t.reg = types.ClientRegistration{
+		ClientId:   testClientId,
+		SystemUUID: "74f0f0b0-fb29-4405-a0b8-4e7747bdfd8a",
+		Timestamp:  types.Now().String(),
+	}
+}
+
+func (t *ServerTestSuite) TearDownTest() {
+	t.server.Close()
+}
+
+// post sends the body as a JSON request to the specified path, returning
+// the response and its body.
+func (t *ServerTestSuite) post(path string, body any, headers map[string]string) (*http.Response, []byte) {
+	reqBytes, err := json.Marshal(body)
+	t.Require().NoError(err)
+
+	req, err := http.NewRequest("POST", t.server.URL+path, bytes.NewBuffer(reqBytes))
+	t.Require().NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.server.Client().Do(req)
+	t.Require().NoError(err)
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	t.Require().NoError(err)
+
+	return resp, respBytes
+}
+
+func (t *ServerTestSuite) register() (crResp restapi.ClientRegistrationResponse) {
+	resp, body := t.post(PATH_REGISTER, &restapi.ClientRegistrationRequest{ClientRegistration: t.reg}, nil)
+	t.Require().Equal(http.StatusOK, resp.StatusCode, string(body))
+	t.Require().NoError(json.Unmarshal(body, &crResp))
+	t.Require().NoError(crResp.Validate())
+	return
+}
+
+func (t *ServerTestSuite) report(crResp restapi.ClientRegistrationResponse) (*http.Response, []byte) {
+	report, err := telemetrylib.NewTelemetryReport(testClientId, types.Tags{})
+	t.Require().NoError(err)
+
+	bundle, err := telemetrylib.NewTelemetryBundle(testClientId, "TEST_CUSTOMER", types.Tags{})
+	t.Require().NoError(err)
+	item, err := telemetrylib.NewTelemetryDataItem(
+		types.TelemetryType("TEST-FAKE-SERVER"),
+		types.Tags{},
+		types.NewTelemetryBlob([]byte(`{"version":1}`)),
+	)
+	t.Require().NoError(err)
+	bundle.TelemetryDataItems = append(bundle.TelemetryDataItems, *item)
+	t.Require().NoError(bundle.UpdateChecksum())
+
+	report.TelemetryBundles = append(report.TelemetryBundles, *bundle)
+	t.Require().NoError(report.UpdateChecksum())
+
+	return t.post(
+		PATH_REPORT,
+		&restapi.TelemetryReportRequest{TelemetryReport: *report},
+		map[string]string{
+			"Authorization":               "Bearer " + crResp.AuthToken,
+			"X-Telemetry-Registration-Id": fmt.Sprintf("%d", crResp.RegistrationId),
+		},
+	)
+}
+
+func (t *ServerTestSuite) Test_RegisterAuthenticateReport() {
+	crResp := t.register()
+	t.Require().Equal(int64(1), crResp.RegistrationId)
+
+	regs := t.server.Registrations()
+	t.Require().Len(regs, 1)
+	t.Require().Equal(t.reg, regs[0].ClientRegistration)
+
+	// authentication requires a matching registration hash
+	caReq := restapi.ClientAuthenticationRequest{
+		RegistrationId: crResp.RegistrationId,
+		RegHash:        *t.reg.Hash("sha256"),
+	}
+	resp, body := t.post(PATH_AUTHENTICATE, &caReq, nil)
+	t.Require().Equal(http.StatusOK, resp.StatusCode, string(body))
+
+	caReq.RegHash = *t.reg.Hash("sha512")
+	caReq.RegHash.Value = caReq.RegHash.Value[1:] + "0"
+	resp, _ = t.post(PATH_AUTHENTICATE, &caReq, nil)
+	t.Require().Equal(http.StatusUnauthorized, resp.StatusCode)
+	t.Require().Contains(resp.Header.Get("WWW-Authenticate"), `scope="register"`)
+
+	resp, body = t.report(crResp)
+	t.Require().Equal(http.StatusOK, resp.StatusCode, string(body))
+
+	reports := t.server.Reports()
+	t.Require().Len(reports, 1)
+	t.Require().Len(t.server.Bundles(), 1)
+	t.Require().Equal(testClientId, reports[0].Header.ReportClientId)
+	t.Require().Equal(1, t.server.Requests(PATH_REPORT))
+}
+
+func (t *ServerTestSuite) Test_ReportAuthorization() {
+	crResp := t.register()
+
+	// an invalid token requires re-authentication
+	badResp := crResp
+	badResp.AuthToken = "not.a.token"
+	resp, _ := t.report(badResp)
+	t.Require().Equal(http.StatusUnauthorized, resp.StatusCode)
+	t.Require().Contains(resp.Header.Get("WWW-Authenticate"), `scope="authenticate"`)
+
+	// a forgotten registration requires re-registration
+	t.server.Forget(crResp.RegistrationId)
+	resp, _ = t.report(crResp)
+	t.Require().Equal(http.StatusUnauthorized, resp.StatusCode)
+	t.Require().Contains(resp.Header.Get("WWW-Authenticate"), `scope="register"`)
+
+	t.Require().Empty(t.server.Reports())
+}
+
+func (t *ServerTestSuite) Test_InjectedFaults() {
+	t.server.Inject(
+		PATH_REGISTER,
+		ConflictFault(),
+		MalformedFault(),
+	)
+	t.server.Inject(
+		PATH_REPORT,
+		ChallengeFault(restapi.AUTH_SCOPE_REGISTER),
+		ChallengeFault(restapi.AUTH_SCOPE_AUTHENTICATE),
+		BusyFault(http.StatusTooManyRequests, 1500*time.Millisecond),
+		BusyFault(http.StatusServiceUnavailable, 0),
+	)
+	t.Require().Equal(2, t.server.PendingFaults(PATH_REGISTER))
+
+	crReq := &restapi.ClientRegistrationRequest{ClientRegistration: t.reg}
+	resp, _ := t.post(PATH_REGISTER, crReq, nil)
+	t.Require().Equal(http.StatusConflict, resp.StatusCode)
+
+	resp, body := t.post(PATH_REGISTER, crReq, nil)
+	t.Require().Equal(http.StatusOK, resp.StatusCode)
+	t.Require().False(json.Valid(body), "malformed body should not be valid JSON")
+	t.Require().Empty(t.server.Registrations(), "faults should bypass normal handling")
+
+	// faults are consumed in order, after which requests are handled normally
+	crResp := t.register()
+
+	resp, _ = t.report(crResp)
+	t.Require().Equal(http.StatusUnauthorized, resp.StatusCode)
+	t.Require().Contains(resp.Header.Get("WWW-Authenticate"), `scope="register"`)
+
+	resp, _ = t.report(crResp)
+	t.Require().Equal(http.StatusUnauthorized, resp.StatusCode)
+	t.Require().Contains(resp.Header.Get("WWW-Authenticate"), `scope="authenticate"`)
+
+	resp, _ = t.report(crResp)
+	t.Require().Equal(http.StatusTooManyRequests, resp.StatusCode)
+	t.Require().Equal("2", resp.Header.Get("Retry-After"))
+
+	resp, _ = t.report(crResp)
+	t.Require().Equal(http.StatusServiceUnavailable, resp.StatusCode)
+	t.Require().Empty(resp.Header.Get("Retry-After"))
+
+	resp, _ = t.report(crResp)
+	t.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	t.Require().Zero(t.server.PendingFaults(PATH_REPORT))
+	t.Require().Equal(5, t.server.Requests(PATH_REPORT))
+	t.Require().Len(t.server.Reports(), 1)
+}
+
+func (t *ServerTestSuite) Test_SlowFault() {
+	delay := 200 * time.Millisecond
+	t.server.Inject(PATH_REGISTER, SlowFault(delay))
+
+	start := time.Now()
+	t.register()
+	t.Require().GreaterOrEqual(time.Since(start), delay)
+	t.Require().Len(t.server.Registrations(), 1, "slow requests should be handled normally")
+}
+
+func TestServerTestSuite(t *testing.T) {
+	suite.Run(t, new(ServerTestSuite))
+}
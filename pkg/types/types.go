@@ -132,6 +132,20 @@ func (tc *TelemetryClass) String() string {
 	return "UNKNOWN_TELEMETRY_CLASS"
 }
 
+func TelemetryClassFromString(classString string) (tc TelemetryClass, err error) {
+	switch classString {
+	case "MANDATORY":
+		tc = MANDATORY_TELEMETRY
+	case "OPT-OUT":
+		tc = OPT_OUT_TELEMETRY
+	case "OPT-IN":
+		tc = OPT_IN_TELEMETRY
+	default:
+		err = fmt.Errorf("unknown telemetry class %q", classString)
+	}
+	return
+}
+
 type ClientRegistrationHash struct {
 	Method string `json:"method" validate:"required,oneof=sha256 sha512"`
 	Value  string `json:"value" validate:"required,sha256|sha512"`
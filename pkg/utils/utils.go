@@ -6,6 +6,8 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 func CompressGZIP(data []byte) (compressedData []byte, err error) {
@@ -49,6 +51,31 @@ func DecompressGZIP(compressedData []byte) (decompressedData []byte, err error)
 	return decompressedData, nil
 }
 
+func CompressZSTD(data []byte) (compressedData []byte, err error) {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		return nil, err
+	}
+	defer encoder.Close()
+
+	return encoder.EncodeAll(data, nil), nil
+}
+
+func DecompressZSTD(compressedData []byte) (decompressedData []byte, err error) {
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+
+	decompressedData, err = decoder.DecodeAll(compressedData, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return decompressedData, nil
+}
+
 // TODO: Both CompressWhenNeeded and DecompressWhenNeeded should be methods in TelemetryData
 
 // TODO: check if it's worth trying to compress the data prior to compressing it (e.g: using entropy algorithms)
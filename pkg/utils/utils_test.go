@@ -29,6 +29,27 @@ func TestCompressDecompressGZIP(t *testing.T) {
 	}
 }
 
+// TestCompressDecompressZSTD tests both CompressZSTD and DecompressZSTD functions.
+func TestCompressDecompressZSTD(t *testing.T) {
+	mockData := []byte(`{"test": "This is a JSON file"}`)
+
+	// Compress data
+	compressedData, err := CompressZSTD(mockData)
+	if err != nil {
+		t.Errorf("Error compressing data: %v", err)
+	}
+
+	// Decompress data to verify
+	decompressedData, err := DecompressZSTD(compressedData)
+	if err != nil {
+		t.Errorf("Error decompressing data: %v", err)
+	}
+
+	if !bytes.Equal(mockData, decompressedData) {
+		t.Fatalf("Decompressed data does not match original data:\n Expected: %v\n Got: %v", string(mockData), string(decompressedData))
+	}
+}
+
 // TestCompressWhenNeeded tests CompressWhenNeeded function
 func TestCompressWhenNeeded(t *testing.T) {
 	tests := []struct {
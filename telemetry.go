@@ -1,6 +1,7 @@
 package telemetry
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 
@@ -180,7 +181,7 @@ func getTelemetryClient(cfg *config.Config) (tc *client.TelemetryClient, err err
 	return
 }
 
-func registerClient(cfg *config.Config) (tc *client.TelemetryClient, err error) {
+func registerClient(ctx context.Context, cfg *config.Config) (tc *client.TelemetryClient, err error) {
 	// get a telemetry client
 	tc, err = getTelemetryClient(cfg)
 	if err != nil {
@@ -188,7 +189,7 @@ func registerClient(cfg *config.Config) (tc *client.TelemetryClient, err error)
 	}
 
 	// trigger registration of the client
-	err = tc.Register()
+	err = tc.RegisterContext(ctx)
 	if err != nil {
 		slog.Warn(
 			"Failed to register TelemetryClient with upstream server",
@@ -205,6 +206,11 @@ func registerClient(cfg *config.Config) (tc *client.TelemetryClient, err error)
 //
 
 func Register() (err error) {
+	return RegisterContext(context.Background())
+}
+
+// RegisterContext is the context aware variant of Register.
+func RegisterContext(ctx context.Context) (err error) {
 
 	// attempt to load the active config file
 	cfg, err := getTelemetryConfig()
@@ -218,7 +224,7 @@ func Register() (err error) {
 		return
 	}
 
-	_, err = registerClient(cfg)
+	_, err = registerClient(ctx, cfg)
 	if err != nil {
 		slog.Error(
 			"Failed to register telemetry client",
@@ -239,6 +245,18 @@ func Generate(
 	content []byte,
 	tags types.Tags,
 	flags GenerateFlags,
+) (err error) {
+	return GenerateContext(context.Background(), telemetry, class, content, tags, flags)
+}
+
+// GenerateContext is the context aware variant of Generate.
+func GenerateContext(
+	ctx context.Context,
+	telemetry types.TelemetryType,
+	class TelemetryClass,
+	content []byte,
+	tags types.Tags,
+	flags GenerateFlags,
 ) (err error) {
 	// check that the telemetry type is valid
 	if valid, err := telemetry.Valid(); !valid {
@@ -305,7 +323,7 @@ func Generate(
 	}
 
 	// generate the telemetry, storing it in the local data store
-	err = tc.Generate(telemetry, blob, tags)
+	err = tc.GenerateWithClassContext(ctx, telemetry, class, blob, tags)
 	if err != nil {
 		slog.Warn(
 			"Failed to generate telemetry",
@@ -318,7 +336,7 @@ func Generate(
 	// check if immediate submission requested
 	if flags.SubmitRequested() {
 		slog.Info("Telemetry submission required")
-		if err = submitTelemetry(tc); err != nil {
+		if err = submitTelemetry(ctx, tc); err != nil {
 			slog.Error(
 				"Failed to submit telemetry",
 				slog.String("url", tc.ServerURL()),
@@ -332,11 +350,11 @@ func Generate(
 	return
 }
 
-func submitTelemetry(tc *client.TelemetryClient) (err error) {
+func submitTelemetry(ctx context.Context, tc *client.TelemetryClient) (err error) {
 
 	// generate bundles containing any staged data items,
 	// including any tags specified in the config file
-	if err = tc.CreateBundles(tc.ConfigTags()); err != nil {
+	if err = tc.CreateBundlesContext(ctx, tc.ConfigTags()); err != nil {
 		slog.Debug(
 			"Failed to create bundles",
 			slog.String("err", err.Error()),
@@ -350,7 +368,7 @@ func submitTelemetry(tc *client.TelemetryClient) (err error) {
 
 	// generate reports containing generated bundles, with
 	// an empty set of report tags
-	if err = tc.CreateReports(types.Tags{}); err != nil {
+	if err = tc.CreateReportsContext(ctx, types.Tags{}); err != nil {
 		slog.Debug(
 			"Failed to create reports",
 			slog.String("err", err.Error()),
@@ -363,7 +381,7 @@ func submitTelemetry(tc *client.TelemetryClient) (err error) {
 	}
 
 	// submit generated reports
-	if err = tc.Submit(); err != nil {
+	if err = tc.SubmitContext(ctx); err != nil {
 		slog.Debug(
 			"Failed to submit reports",
 			slog.String("err", err.Error()),
@@ -383,14 +401,33 @@ func submitTelemetry(tc *client.TelemetryClient) (err error) {
 //
 
 func Status() (status ClientStatus) {
+	// the background context is never done, so no error is possible
+	status, _ = StatusContext(context.Background())
+	return
+}
+
+// StatusContext is the context aware variant of Status; if the context is
+// done before the status check completes, the status reached so far is
+// returned along with an error wrapping the context's error.
+func StatusContext(ctx context.Context) (status ClientStatus, err error) {
 	var exists bool
-	var cfg *config.Config
-	var tc *client.TelemetryClient
-	var err error
 
 	// default to being uninitialised
 	status = CLIENT_UNINITIALIZED
 
+	// stop checking if the context is done
+	incomplete := func() bool {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = fmt.Errorf("telemetry client status check incomplete: %w", ctxErr)
+			return true
+		}
+		return false
+	}
+
+	if incomplete() {
+		return
+	}
+
 	// check that active config exists
 	exists = utils.CheckPathExists(activeConfigPath)
 	if !exists {
@@ -398,12 +435,12 @@ func Status() (status ClientStatus) {
 			"Specified telemetry client config doesn't exist",
 			slog.String("path", activeConfigPath),
 		)
-		return CLIENT_CONFIG_MISSING
+		return CLIENT_CONFIG_MISSING, nil
 	}
 
 	// attempt to load the active config
-	cfg, err = getTelemetryConfig()
-	if err != nil {
+	cfg, cfgErr := getTelemetryConfig()
+	if cfgErr != nil {
 		return
 	}
 
@@ -413,23 +450,31 @@ func Status() (status ClientStatus) {
 	// check if the telemetry client is enabled in config
 	if !cfg.Enabled {
 		slog.Info("The telemetry client is disabled in the configuration")
-		return CLIENT_DISABLED
+		return CLIENT_DISABLED, nil
+	}
+
+	if incomplete() {
+		return
 	}
 
 	// get a telemetry client
-	tc, err = getTelemetryClient(cfg)
-	if err != nil {
+	tc, tcErr := getTelemetryClient(cfg)
+	if tcErr != nil {
 		slog.Error(
 			"Failed to setup telemetry client using provided config",
 			slog.String("path", activeConfigPath),
-			slog.String("error", err.Error()),
+			slog.String("error", tcErr.Error()),
 		)
-		return CLIENT_MISCONFIGURED
+		return CLIENT_MISCONFIGURED, nil
 	}
 
 	// update status to indicate that telemetry client datastore is accessible
 	status = CLIENT_DATASTORE_ACCESSIBLE
 
+	if incomplete() {
+		return
+	}
+
 	// check that an registration is available
 	if !tc.RegistrationAccessible() {
 		slog.Warn("Telemetry client registration has not been setup", slog.String("path", tc.RegistrationPath()))
@@ -439,6 +484,10 @@ func Status() (status ClientStatus) {
 	// update status to indicate client has registration
 	status = CLIENT_REGISTRATION_ACCESSIBLE
 
+	if incomplete() {
+		return
+	}
+
 	// check that we have obtained telemetry client credentials
 	if !tc.CredentialsAccessible() {
 		slog.Warn(